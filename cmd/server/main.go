@@ -4,10 +4,13 @@ package main
 import (
 	"context"
 	"llrss/internal/config"
+	"llrss/internal/events"
 	"llrss/internal/handler"
-	sqlite "llrss/internal/models/db"
 	repodb "llrss/internal/repository/db"
+	"llrss/internal/rules"
+	"llrss/internal/scheduler"
 	"llrss/internal/service"
+	"llrss/internal/smtpd"
 	"log"
 	"net/http"
 	"os"
@@ -20,6 +23,10 @@ import (
 )
 
 func main() {
+	serverConfig := config.NewServerConfig()
+	retentionConfig := config.NewRetentionConfig()
+	digestConfig := config.NewDigestConfig()
+	newsletterConfig := config.NewNewsletterConfig()
 	dbConfig := config.NewDatabaseConfig()
 	db, err := config.InitDatabase(dbConfig)
 	if err != nil {
@@ -27,16 +34,92 @@ func main() {
 	}
 
 	// Auto migrate the schema
-	if err := db.AutoMigrate(&sqlite.Feed{}, &sqlite.Item{}); err != nil {
+	if err := repodb.AutoMigrate(db); err != nil {
 		log.Fatal("failed to migrate database:", err)
 	}
 
-	// Initialize repository
-	feedRepo := repodb.NewGormFeedRepository(db)
+	// Initialize repository, changes to feeds and items are published on the bus
+	bus := events.NewBus()
+	webhookRepo := repodb.NewGormWebhookRepository(db)
+	ruleRepo := repodb.NewGormRuleRepository(db)
+	digestRepo := repodb.NewGormDigestRepository(db)
+	// Rules apply to new items before they are published
+	feedRepo := events.NewFeedRepository(rules.NewFeedRepository(repodb.NewGormFeedRepository(db), ruleRepo, webhookRepo), bus)
+	webSubRepo := repodb.NewGormWebSubRepository(db)
+	retentionRepo := repodb.NewGormRetentionRepository(db)
+	folderRepo := repodb.NewGormFolderRepository(db)
+	savedSearchRepo := repodb.NewGormSavedSearchRepository(db)
+	numberRepo := events.NewNumberRepository(repodb.NewGormNumberRepository(db), bus)
 
 	feedService := service.NewFeedService(feedRepo)
+	webSubService := service.NewWebSubService(feedRepo, webSubRepo, serverConfig.BaseURL)
+	retentionService := service.NewRetentionService(feedRepo, retentionRepo, retentionConfig.Defaults)
+	folderService := service.NewFolderService(feedRepo, folderRepo)
+	opmlService := service.NewOPMLService(feedService, folderService)
+	savedSearchService := service.NewSavedSearchService(feedService, savedSearchRepo)
+	feverService := service.NewFeverService(feedService, folderService, numberRepo)
+	readerService := service.NewReaderService(feedService, folderService, numberRepo)
+	nextcloudService := service.NewNextcloudService(feedService, folderService, numberRepo)
+	eventService := service.NewEventService(bus, folderService)
+	webhookService := service.NewWebhookService(webhookRepo, feedService, folderService, savedSearchService, bus)
+	extractService := service.NewExtractService(feedRepo, bus)
+	ruleService := service.NewRuleService(ruleRepo, feedService, retentionRepo, webhookRepo)
+	digestService, err := service.NewDigestService(digestRepo, feedService, folderService, savedSearchService, service.DigestSettings{
+		SMTPAddr:     digestConfig.SMTPAddr,
+		SMTPUsername: digestConfig.SMTPUsername,
+		SMTPPassword: digestConfig.SMTPPassword,
+		From:         digestConfig.From,
+		Location:     digestConfig.Location,
+		BaseURL:      serverConfig.BaseURL,
+		Templates:    digestConfig.Templates,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	newsletterService := service.NewNewsletterService(feedRepo, newsletterConfig.Domain)
+	outputService := service.NewOutputService(feedService, folderService, savedSearchService, serverConfig.BaseURL)
 	feedHandler := handler.NewFeedHandler(feedService)
-	staticHandler := handler.NewStaticHandler(feedService)
+	webSubHandler := handler.NewWebSubHandler(webSubService)
+	maintenanceHandler := handler.NewMaintenanceHandler(retentionService)
+	folderHandler := handler.NewFolderHandler(folderService)
+	opmlHandler := handler.NewOPMLHandler(opmlService)
+	savedSearchHandler := handler.NewSavedSearchHandler(savedSearchService)
+	eventHandler := handler.NewEventHandler(eventService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	ruleHandler := handler.NewRuleHandler(ruleService)
+	extractHandler := handler.NewExtractHandler(extractService)
+	digestHandler := handler.NewDigestHandler(digestService)
+	newsletterHandler := handler.NewNewsletterHandler(newsletterService)
+	outputHandler := handler.NewOutputHandler(outputService, serverConfig.OutputToken)
+	feverHandler := handler.NewFeverHandler(feverService, serverConfig.Username, serverConfig.Password)
+	readerHandler := handler.NewReaderHandler(readerService, serverConfig.Username, serverConfig.Password)
+	nextcloudHandler := handler.NewNextcloudHandler(nextcloudService, serverConfig.Username, serverConfig.Password)
+	staticHandler := handler.NewStaticHandler(feedService, folderService)
+
+	// Background jobs, stopped on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go scheduler.Every(ctx, "websub", 10*time.Minute, webSubService.SyncSubscriptions)
+	go scheduler.Every(ctx, "purge", retentionConfig.Interval, func(ctx context.Context) error {
+		report, err := retentionService.Purge(ctx, false)
+		if err == nil && report.Total > 0 {
+			log.Printf("purged %d items", report.Total)
+		}
+		return err
+	})
+	go webhookService.Run(ctx)
+	go extractService.Run(ctx)
+	go scheduler.Every(ctx, "digests", time.Minute, digestService.SendDueDigests)
+	if newsletterConfig.Addr != "" {
+		smtpServer := &smtpd.Server{Hostname: newsletterConfig.Domain, Handler: newsletterService}
+		go func() {
+			log.Printf("Receiving newsletters on %s", newsletterConfig.Addr)
+			if err := smtpServer.ListenAndServe(ctx, newsletterConfig.Addr); err != nil {
+				log.Printf("newsletter listener failed: %v", err)
+			}
+		}()
+	}
 
 	r := chi.NewRouter()
 
@@ -44,19 +127,48 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60 * time.Second))
+
+	// Requests time out, but for the event stream which stays open
+	timeout := middleware.Timeout(60 * time.Second)
 
 	r.Route("/api/v1", func(r chi.Router) {
-		feedHandler.RegisterRoutes(r)
+		eventHandler.RegisterRoutes(r)
+
+		r.Group(func(r chi.Router) {
+			r.Use(timeout)
+			feedHandler.RegisterRoutes(r)
+			maintenanceHandler.RegisterRoutes(r)
+			folderHandler.RegisterRoutes(r)
+			opmlHandler.RegisterRoutes(r)
+			savedSearchHandler.RegisterRoutes(r)
+			webhookHandler.RegisterRoutes(r)
+			ruleHandler.RegisterRoutes(r)
+			extractHandler.RegisterRoutes(r)
+			digestHandler.RegisterRoutes(r)
+			newsletterHandler.RegisterRoutes(r)
+		})
 	})
 
-	r.Route("/", func(r chi.Router) {
-		staticHandler.RegisterRoutes(r)
+	r.Group(func(r chi.Router) {
+		r.Use(timeout)
+		webSubHandler.RegisterRoutes(r)
+		outputHandler.RegisterRoutes(r)
+
+		// The APIs of mobile readers are only served with a password
+		if serverConfig.Password != "" {
+			feverHandler.RegisterRoutes(r)
+			readerHandler.RegisterRoutes(r)
+			nextcloudHandler.RegisterRoutes(r)
+		}
+
+		r.Route("/", func(r chi.Router) {
+			staticHandler.RegisterRoutes(r)
+		})
 	})
 
 	// Create server
 	srv := &http.Server{
-		Addr:         ":8080",
+		Addr:         serverConfig.Addr,
 		Handler:      r,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
@@ -65,7 +177,7 @@ func main() {
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Starting server on :8080")
+		log.Printf("Starting server on %s", serverConfig.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed: %v", err)
 		}
@@ -77,6 +189,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	cancel()
 
 	// TODO: Add timeout cancellable context
 	// ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
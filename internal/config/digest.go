@@ -0,0 +1,36 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type DigestConfig struct {
+	// SMTPAddr is the host:port of the SMTP server digests are sent through, disabled when empty.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	// Location is the time zone of the times digests are sent at.
+	Location *time.Location
+	// Templates is a directory with digest.html and digest.txt templates replacing the default ones.
+	Templates string
+}
+
+func NewDigestConfig() *DigestConfig {
+	tz := getEnv("LLRSS_DIGEST_TIMEZONE", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Printf("invalid LLRSS_DIGEST_TIMEZONE=%q, using UTC", tz)
+		loc = time.UTC
+	}
+
+	return &DigestConfig{
+		SMTPAddr:     getEnv("LLRSS_SMTP_ADDR", ""),
+		SMTPUsername: getEnv("LLRSS_SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("LLRSS_SMTP_PASSWORD", ""),
+		From:         getEnv("LLRSS_DIGEST_FROM", "llrss <llrss@localhost>"),
+		Location:     loc,
+		Templates:    getEnv("LLRSS_DIGEST_TEMPLATES", ""),
+	}
+}
@@ -0,0 +1,16 @@
+package config
+
+type NewsletterConfig struct {
+	// Addr is where newsletters are received over SMTP or LMTP, a TCP address or unix:/path,
+	// disabled when empty.
+	Addr string
+	// Domain is the domain of the addresses of newsletters.
+	Domain string
+}
+
+func NewNewsletterConfig() *NewsletterConfig {
+	return &NewsletterConfig{
+		Addr:   getEnv("LLRSS_NEWSLETTER_ADDR", ""),
+		Domain: getEnv("LLRSS_NEWSLETTER_DOMAIN", "localhost"),
+	}
+}
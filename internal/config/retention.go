@@ -0,0 +1,26 @@
+package config
+
+import (
+	"llrss/internal/models/db"
+	"time"
+)
+
+type RetentionConfig struct {
+	// Defaults is the policy of feeds without an override.
+	Defaults db.RetentionPolicy
+	// Interval is how often the purge job runs.
+	Interval time.Duration
+}
+
+func NewRetentionConfig() *RetentionConfig {
+	maxItems := getEnvInt("LLRSS_RETENTION_MAX_ITEMS", 0)
+	readDays := getEnvInt("LLRSS_RETENTION_READ_DAYS", 0)
+
+	return &RetentionConfig{
+		Defaults: db.RetentionPolicy{
+			MaxItems: &maxItems,
+			ReadDays: &readDays,
+		},
+		Interval: time.Duration(getEnvInt("LLRSS_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+type ServerConfig struct {
+	Addr string
+	// BaseURL is the public URL of the server, used to build callback URLs given to third parties.
+	BaseURL string
+	// OutputToken, when set, is required as the ?token= of the output feeds.
+	OutputToken string
+	// Username and Password are the credentials of the APIs of mobile readers, disabled without a password.
+	Username string
+	Password string
+}
+
+func NewServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Addr:        getEnv("LLRSS_ADDR", ":8080"),
+		BaseURL:     getEnv("LLRSS_BASE_URL", "http://localhost:8080"),
+		OutputToken: getEnv("LLRSS_OUTPUT_TOKEN", ""),
+		Username:    getEnv("LLRSS_USERNAME", "llrss"),
+		Password:    getEnv("LLRSS_PASSWORD", ""),
+	}
+}
@@ -0,0 +1,137 @@
+// Package events publishes what changes in the database, for clients to follow without polling.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of events.
+const (
+	// ItemsAdded is published with the IDs of the items a refresh inserted.
+	ItemsAdded = "items.added"
+	// ItemsRead and ItemsUnread are published with the IDs of the items marked, or with only
+	// a Count for bulk marks, along with their feed or folder when they were restricted to one.
+	ItemsRead   = "items.read"
+	ItemsUnread = "items.unread"
+	// FeedAdded is published for new feeds, their first items aren't published as added.
+	FeedAdded   = "feed.added"
+	FeedRemoved = "feed.removed"
+	// Resync is sent, without an ID, to subscribers resuming from an event which isn't kept anymore:
+	// they missed some and should sync again.
+	Resync = "resync"
+)
+
+// Types are the types of the events published on the bus.
+var Types = []string{ItemsAdded, ItemsRead, ItemsUnread, FeedAdded, FeedRemoved}
+
+const (
+	// HistorySize is how many of the latest events are kept for subscribers to resume from.
+	HistorySize = 1024
+	// bufferSize is how many events a subscriber can lag behind before it's dropped.
+	bufferSize = 64
+)
+
+type Event struct {
+	ID       int64
+	Type     string
+	Time     time.Time
+	FeedID   string   `json:",omitempty"`
+	FolderID string   `json:",omitempty"`
+	ItemIDs  []string `json:",omitempty"`
+	Count    int64    `json:",omitempty"`
+}
+
+// Bus fans events out to subscribers, and keeps the latest ones for those resuming after a disconnection.
+// Events IDs start from the time the bus is created in milliseconds, so that they keep growing across restarts.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  int64
+	history []Event
+	subs    map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		lastID: time.Now().UnixMilli(),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events matching its filter on C, which is closed
+// when the subscriber lags too far behind or unsubscribes.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	match func(Event) bool
+}
+
+// Publish sets the ID and time of an event and sends it to the subscribers. A nil bus drops events.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	e.Time = time.Now().UTC()
+
+	if len(b.history) == HistorySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, e)
+
+	for sub := range b.subs {
+		if sub.match != nil && !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// A subscriber that can't keep up resumes from its last event on its own
+			delete(b.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events matching match, all of them when it's nil,
+// along with the events published after lastID, none when it's 0. When lastID is older than
+// the events kept, they start with a Resync event.
+func (b *Bus) Subscribe(lastID int64, match func(Event) bool) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, bufferSize)
+	sub := &Subscription{C: c, c: c, match: match}
+	b.subs[sub] = struct{}{}
+
+	if lastID <= 0 || lastID >= b.lastID {
+		return sub, nil
+	}
+
+	var missed []Event
+	if len(b.history) == 0 || b.history[0].ID > lastID+1 {
+		missed = append(missed, Event{Type: Resync, Time: time.Now().UTC()})
+	}
+	for _, e := range b.history {
+		if e.ID > lastID && (match == nil || match(e)) {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed
+}
+
+// Unsubscribe stops sending events to sub, and closes its channel.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
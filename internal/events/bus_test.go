@@ -0,0 +1,77 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusFilters(t *testing.T) {
+	b := NewBus()
+	all, _ := b.Subscribe(0, nil)
+	hn, _ := b.Subscribe(0, func(e Event) bool { return e.FeedID == "hn" })
+
+	b.Publish(Event{Type: ItemsAdded, FeedID: "xkcd"})
+	b.Publish(Event{Type: ItemsAdded, FeedID: "hn"})
+
+	first, second := <-all.C, <-all.C
+	assert.Equal(t, "xkcd", first.FeedID)
+	assert.Equal(t, first.ID+1, second.ID)
+	assert.False(t, first.Time.IsZero())
+
+	e := <-hn.C
+	assert.Equal(t, second.ID, e.ID)
+	assert.Empty(t, hn.C)
+
+	b.Unsubscribe(hn)
+	_, ok := <-hn.C
+	assert.False(t, ok, "channel closed on unsubscribe")
+}
+
+func TestBusLaggingSubscriber(t *testing.T) {
+	b := NewBus()
+	sub, _ := b.Subscribe(0, nil)
+
+	for range bufferSize + 1 {
+		b.Publish(Event{Type: ItemsRead})
+	}
+
+	n := 0
+	for range sub.C {
+		n++
+	}
+	assert.Equal(t, bufferSize, n, "the channel is closed once full")
+
+	// Unsubscribing a dropped subscription is fine
+	b.Unsubscribe(sub)
+}
+
+func TestBusResume(t *testing.T) {
+	b := NewBus()
+	b.Publish(Event{Type: FeedAdded, FeedID: "hn"})
+	first := b.history[0].ID
+	b.Publish(Event{Type: ItemsAdded, FeedID: "hn"})
+	b.Publish(Event{Type: ItemsAdded, FeedID: "xkcd"})
+
+	_, missed := b.Subscribe(first, nil)
+	require.Len(t, missed, 2)
+	assert.Equal(t, first+1, missed[0].ID)
+
+	_, missed = b.Subscribe(first, func(e Event) bool { return e.FeedID == "hn" })
+	require.Len(t, missed, 1)
+	assert.Equal(t, ItemsAdded, missed[0].Type)
+
+	_, missed = b.Subscribe(first+2, nil)
+	assert.Empty(t, missed, "nothing was missed after the last event")
+
+	for range HistorySize {
+		b.Publish(Event{Type: ItemsRead})
+	}
+	assert.Len(t, b.history, HistorySize)
+
+	_, missed = b.Subscribe(first, nil)
+	require.Len(t, missed, HistorySize+1)
+	assert.Equal(t, Resync, missed[0].Type)
+	assert.Zero(t, missed[0].ID)
+}
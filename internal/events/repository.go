@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+)
+
+// feedRepository publishes the changes made through a feed repository. Its methods
+// don't fail because of events, those are only published once a change succeeded.
+type feedRepository struct {
+	repository.FeedRepository
+	bus *Bus
+}
+
+// NewFeedRepository wraps repo so that it publishes added and removed feeds, added items
+// and read status changes on bus.
+func NewFeedRepository(repo repository.FeedRepository, bus *Bus) repository.FeedRepository {
+	return &feedRepository{FeedRepository: repo, bus: bus}
+}
+
+func (r *feedRepository) SaveFeed(ctx context.Context, feed *db.Feed) (string, error) {
+	id, err := r.FeedRepository.SaveFeed(ctx, feed)
+	if err != nil {
+		return "", err
+	}
+
+	e := Event{Type: FeedAdded, FeedID: id}
+	if feed.FolderID != nil {
+		e.FolderID = *feed.FolderID
+	}
+	r.bus.Publish(e)
+	return id, nil
+}
+
+func (r *feedRepository) DeleteFeed(ctx context.Context, id string) error {
+	folderID := r.folderOf(ctx, id)
+	if err := r.FeedRepository.DeleteFeed(ctx, id); err != nil {
+		return err
+	}
+
+	r.bus.Publish(Event{Type: FeedRemoved, FeedID: id, FolderID: folderID})
+	return nil
+}
+
+func (r *feedRepository) SaveFeedItems(ctx context.Context, feedID string, items []db.Item) ([]db.Item, error) {
+	added, err := r.FeedRepository.SaveFeedItems(ctx, feedID, items)
+	if err != nil || len(added) == 0 {
+		return added, err
+	}
+
+	ids := make([]string, len(added))
+	for i, item := range added {
+		ids[i] = item.ID
+	}
+	r.bus.Publish(Event{Type: ItemsAdded, FeedID: feedID, FolderID: r.folderOf(ctx, feedID), ItemIDs: ids})
+	return added, nil
+}
+
+// UpdateFeedItem publishes the change of the read status of the item, when there's one.
+func (r *feedRepository) UpdateFeedItem(ctx context.Context, item *db.Item) error {
+	var wasRead bool
+	if prev, err := r.FeedRepository.GetFeedItem(ctx, item.ID); err == nil {
+		wasRead = prev.IsRead
+	}
+
+	if err := r.FeedRepository.UpdateFeedItem(ctx, item); err != nil {
+		return err
+	}
+
+	if item.IsRead != wasRead {
+		r.bus.Publish(Event{
+			Type:     readType(item.IsRead),
+			FeedID:   item.FeedID,
+			FolderID: r.folderOf(ctx, item.FeedID),
+			ItemIDs:  []string{item.ID},
+		})
+	}
+	return nil
+}
+
+func (r *feedRepository) MarkItemsRead(ctx context.Context, params models.SearchParams, read bool) (int64, error) {
+	n, err := r.FeedRepository.MarkItemsRead(ctx, params, read)
+	if err != nil || n == 0 {
+		return n, err
+	}
+
+	r.bus.Publish(markEvent(params, read, n))
+	return n, nil
+}
+
+// folderOf returns the folder of a feed, or an empty ID.
+func (r *feedRepository) folderOf(ctx context.Context, feedID string) string {
+	feed, err := r.FeedRepository.GetFeed(ctx, feedID)
+	if err != nil || feed.FolderID == nil {
+		return ""
+	}
+	return *feed.FolderID
+}
+
+// numberRepository publishes the items the number repository marks as read.
+type numberRepository struct {
+	repository.NumberRepository
+	bus *Bus
+}
+
+func NewNumberRepository(repo repository.NumberRepository, bus *Bus) repository.NumberRepository {
+	return &numberRepository{NumberRepository: repo, bus: bus}
+}
+
+func (r *numberRepository) MarkItemsRead(ctx context.Context, params models.SearchParams, maxNumber int64) (int64, error) {
+	n, err := r.NumberRepository.MarkItemsRead(ctx, params, maxNumber)
+	if err != nil || n == 0 {
+		return n, err
+	}
+
+	r.bus.Publish(markEvent(params, true, n))
+	return n, nil
+}
+
+// markEvent is the event of a bulk mark, with the feed or folder it was restricted to.
+func markEvent(params models.SearchParams, read bool, n int64) Event {
+	e := Event{Type: readType(read), FolderID: params.FolderID, Count: n}
+	if len(params.FeedIDs) == 1 {
+		e.FeedID = params.FeedIDs[0]
+	}
+	return e
+}
+
+func readType(read bool) string {
+	if read {
+		return ItemsRead
+	}
+	return ItemsUnread
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DigestHandler struct {
+	digestService service.DigestService
+}
+
+func NewDigestHandler(digestService service.DigestService) *DigestHandler {
+	return &DigestHandler{
+		digestService: digestService,
+	}
+}
+
+func (h *DigestHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/digests", h.ListDigests)
+	r.Post("/digests", h.CreateDigest)
+	r.Get("/digests/{id}", h.GetDigest)
+	r.Put("/digests/{id}", h.UpdateDigest)
+	r.Delete("/digests/{id}", h.DeleteDigest)
+	r.Get("/digests/{id}/preview", h.PreviewDigest)
+	r.Post("/digests/{id}/send", h.SendDigest)
+}
+
+type digestRequest struct {
+	Name          string   `json:"name"`
+	Recipients    []string `json:"recipients"`
+	FolderID      string   `json:"folder_id"`
+	Tag           string   `json:"tag"`
+	SavedSearchID string   `json:"saved_search_id"`
+	Time          string   `json:"time"`
+	Days          []string `json:"days"`
+}
+
+func (req *digestRequest) digest(id string) *db.Digest {
+	return &db.Digest{
+		ID:            id,
+		Name:          req.Name,
+		Recipients:    req.Recipients,
+		FolderID:      req.FolderID,
+		Tag:           req.Tag,
+		SavedSearchID: req.SavedSearchID,
+		Time:          req.Time,
+		Days:          req.Days,
+	}
+}
+
+func (h *DigestHandler) ListDigests(w http.ResponseWriter, r *http.Request) {
+	digests, err := h.digestService.ListDigests(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(digests)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *DigestHandler) CreateDigest(w http.ResponseWriter, r *http.Request) {
+	var req digestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	digest := req.digest("")
+	if err := h.digestService.CreateDigest(r.Context(), digest); err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *DigestHandler) GetDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	digest, err := h.digestService.GetDigest(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *DigestHandler) UpdateDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req digestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	digest := req.digest(id)
+	if err := h.digestService.UpdateDigest(r.Context(), digest); err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *DigestHandler) DeleteDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.digestService.DeleteDigest(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewDigest renders the next email of a digest, as HTML or as text with format=text.
+func (h *DigestHandler) PreviewDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	msg, err := h.digestService.PreviewDigest(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(msg.Text))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(msg.HTML))
+}
+
+// SendDigest sends the next email of a digest right away.
+func (h *DigestHandler) SendDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	res, err := h.digestService.SendDigest(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), digestErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func digestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrDigestNotFound), errors.Is(err, repository.ErrFolderNotFound),
+		errors.Is(err, repository.ErrSavedSearchNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidDigestName), errors.Is(err, service.ErrInvalidDigest),
+		errors.Is(err, service.ErrInvalidTag):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrMailDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
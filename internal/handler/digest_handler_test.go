@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// smtpMessage is an email received by smtpServer.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is an in-process SMTP stand-in, speaking just enough of the protocol for net/smtp.
+type smtpServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &smtpServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			msg = smtpMessage{from: strings.Trim(strings.SplitN(cmd, ":", 2)[1], "<> ")}
+			reply("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.SplitN(cmd, ":", 2)[1], "<> "))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// parts returns the text and HTML parts of a digest email.
+func parts(t *testing.T, data string) (*mail.Message, string, string) {
+	t.Helper()
+
+	m, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read the email: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Failed to parse the content type: %v", err)
+	}
+
+	var text, html string
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		// The reader decodes quoted-printable parts
+		b, _ := io.ReadAll(p)
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/html") {
+			html = string(b)
+		} else {
+			text = string(b)
+		}
+	}
+	return m, text, html
+}
+
+func TestDigests(t *testing.T) {
+	d := newTestDB(t)
+	smtpd := newSMTPServer(t)
+
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	savedSearchService := service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))
+	digestService, err := service.NewDigestService(repodb.NewGormDigestRepository(d), feedService, folderService, savedSearchService, service.DigestSettings{
+		SMTPAddr: smtpd.listener.Addr().String(),
+		From:     "llrss <digest@example.com>",
+		BaseURL:  "http://localhost:8080",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create the digest service: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewDigestHandler(digestService).RegisterRoutes(r)
+	})
+
+	tech := "tech"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News", FolderID: &tech})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog", Name: "Go", FolderID: &tech})
+	d.Create(&db.Feed{ID: "xkcd", URL: "http://example.com/xkcd", Title: "xkcd"})
+	// The unread backlog is older than the digest
+	d.Create(&db.Item{ID: "hn-0", FeedID: "hn", Title: "Old news", Link: "http://example.com/hn/0", CreatedAt: time.Now().Add(-time.Hour).Unix()})
+
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &b)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, tc := range map[string]struct {
+		body     map[string]any
+		expected int
+	}{
+		"no name":         {map[string]any{"recipients": []string{"me@example.com"}}, http.StatusBadRequest},
+		"no recipient":    {map[string]any{"name": "Tech"}, http.StatusBadRequest},
+		"invalid address": {map[string]any{"name": "Tech", "recipients": []string{"me"}}, http.StatusBadRequest},
+		"invalid time":    {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "time": "25:00"}, http.StatusBadRequest},
+		"invalid day":     {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "days": []string{"someday"}}, http.StatusBadRequest},
+		"two selections":  {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "folder_id": tech, "tag": "go"}, http.StatusBadRequest},
+		"unknown folder":  {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "folder_id": "missing"}, http.StatusNotFound},
+		"unknown search":  {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "saved_search_id": "missing"}, http.StatusNotFound},
+		"blank tag":       {map[string]any{"name": "Tech", "recipients": []string{"me@example.com"}, "tag": "  "}, http.StatusBadRequest},
+	} {
+		if w := request(http.MethodPost, "/api/v1/digests", tc.body); w.Code != tc.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", name, tc.expected, w.Code, w.Body.String())
+		}
+	}
+
+	w := request(http.MethodPost, "/api/v1/digests", map[string]any{
+		"name":       "Tech news",
+		"recipients": []string{"Me <me@example.com>", "you@example.com"},
+		"folder_id":  tech,
+		"time":       "7:30",
+		"days":       []string{"Friday", "mon", "mon"},
+	})
+	var digest db.Digest
+	json.NewDecoder(w.Body).Decode(&digest)
+	if w.Code != http.StatusCreated || digest.Time != "07:30" || strings.Join(digest.Days, ",") != "mon,fri" ||
+		digest.Recipients[0] != "me@example.com" {
+		t.Fatalf("Expected a normalized digest, got %d %+v", w.Code, digest)
+	}
+	d.Create(&db.Item{ID: "hn-1", FeedID: "hn", Title: "Show HN: <llrss>", Link: "http://example.com/hn/1", Description: "A reader, in Go."})
+	d.Create(&db.Item{ID: "go-1", FeedID: "go-blog", Title: "Go 1.24 is released", Link: "http://example.com/go/1"})
+	d.Create(&db.Item{ID: "go-2", FeedID: "go-blog", Title: "Range functions", Link: "http://example.com/go/2", IsRead: true})
+	d.Create(&db.Item{ID: "xkcd-1", FeedID: "xkcd", Title: "Standards", Link: "http://example.com/xkcd/1"})
+
+	w = request(http.MethodGet, "/api/v1/digests/"+digest.ID+"/preview", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Show HN: &lt;llrss&gt;") {
+		t.Errorf("Expected an escaped HTML preview, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = request(http.MethodPost, "/api/v1/digests/"+digest.ID+"/send", nil)
+	var res models.DigestResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res.Sent != 2 {
+		t.Fatalf("Expected the 2 unread items of the folder sent, got %d %+v", w.Code, res)
+	}
+
+	messages := smtpd.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.from != "digest@example.com" || strings.Join(msg.to, ",") != "me@example.com,you@example.com" {
+		t.Errorf("Expected the email from the sender to both recipients, got %s to %v", msg.from, msg.to)
+	}
+	m, text, html := parts(t, msg.data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if subject != "Tech news: 2 new items" {
+		t.Errorf("Expected the subject to count the items, got %q", subject)
+	}
+	// Feeds are sorted by their name
+	if !strings.Contains(text, "== Go ==") || strings.Index(text, "== Go ==") > strings.Index(text, "== Hacker News ==") {
+		t.Errorf("Expected the items grouped by feed in the text part, got %s", text)
+	}
+	if !strings.Contains(text, "http://example.com/hn/1") || strings.Contains(text, "Range functions") || strings.Contains(text, "Standards") ||
+		strings.Contains(text, "Old news") {
+		t.Errorf("Expected the new unread items of the folder only, got %s", text)
+	}
+	if !strings.Contains(html, `<a href="http://example.com/go/1"`) {
+		t.Errorf("Expected the items linked in the HTML part, got %s", html)
+	}
+
+	// Items are only sent once, nothing is sent without new ones
+	w = request(http.MethodPost, "/api/v1/digests/"+digest.ID+"/send", nil)
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Sent != 0 || len(smtpd.received()) != 1 {
+		t.Errorf("Expected nothing sent again, got %+v and %d emails", res, len(smtpd.received()))
+	}
+
+	d.Create(&db.Item{ID: "hn-2", FeedID: "hn", Title: "Ask HN: digests?", Link: "http://example.com/hn/2"})
+	request(http.MethodPost, "/api/v1/digests/"+digest.ID+"/send", nil)
+	messages = smtpd.received()
+	if len(messages) != 2 {
+		t.Fatalf("Expected a second email, got %d", len(messages))
+	}
+	if _, text, _ := parts(t, messages[1].data); !strings.Contains(text, "Ask HN") || strings.Contains(text, "Show HN") {
+		t.Errorf("Expected only the new item in the second email, got %s", text)
+	}
+
+	if w := request(http.MethodDelete, "/api/v1/digests/"+digest.ID, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	var digested int64
+	d.Model(&db.DigestItem{}).Where("digest_id = ?", digest.ID).Count(&digested)
+	if digested != 0 {
+		t.Errorf("Expected the sent items forgotten with the digest, got %d", digested)
+	}
+}
+
+func TestDueDigests(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	smtpd := newSMTPServer(t)
+
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	savedSearchService := service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))
+	digestService, err := service.NewDigestService(repodb.NewGormDigestRepository(d), feedService, folderService, savedSearchService, service.DigestSettings{
+		SMTPAddr: smtpd.listener.Addr().String(),
+		From:     "digest@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create the digest service: %v", err)
+	}
+
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News"})
+	d.Create(&db.Item{ID: "hn-1", FeedID: "hn", Title: "Show HN", Link: "http://example.com/hn/1"})
+	d.Create(&db.Item{ID: "hn-2", FeedID: "hn", Title: "Ask HN", Link: "http://example.com/hn/2"})
+	d.Model(&db.Item{ID: "hn-2"}).Association("Tags").Append(&db.Tag{Name: "ask"})
+
+	now := time.Now().UTC()
+	lastWeek := now.AddDate(0, 0, -7)
+	yesterday := now.AddDate(0, 0, -1)
+	d.Create(&db.Digest{ID: "due", Name: "Due", Recipients: []string{"me@example.com"}, Tag: "ask", Time: "00:00", CreatedAt: lastWeek})
+	d.Create(&db.Digest{ID: "sent", Name: "Sent", Recipients: []string{"me@example.com"}, Time: now.Add(time.Hour).Format("15:04"),
+		CreatedAt: lastWeek, LastSentAt: &now})
+	d.Create(&db.Digest{ID: "weekly", Name: "Weekly", Recipients: []string{"me@example.com"}, Time: "00:00",
+		Days: []string{[]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}[now.AddDate(0, 0, 3).Weekday()]}, CreatedAt: yesterday})
+
+	if err := digestService.SendDueDigests(ctx); err != nil {
+		t.Fatalf("Failed to send the digests: %v", err)
+	}
+
+	messages := smtpd.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected the due digest sent only, got %d emails", len(messages))
+	}
+	if _, text, _ := parts(t, messages[0].data); !strings.Contains(text, "Ask HN") || strings.Contains(text, "Show HN") {
+		t.Errorf("Expected the tagged item only, got %s", text)
+	}
+
+	var due db.Digest
+	d.First(&due, "id = ?", "due")
+	if due.LastSentAt == nil {
+		t.Errorf("Expected the digest sending time recorded")
+	}
+	if err := digestService.SendDueDigests(ctx); err != nil {
+		t.Fatalf("Failed to send the digests: %v", err)
+	}
+	if n := len(smtpd.received()); n != 1 {
+		t.Errorf("Expected the digest not due anymore, got %d emails", n)
+	}
+}
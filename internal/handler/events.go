@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"llrss/internal/events"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// eventsHeartbeat is how often a comment is sent on idle streams, so that proxies don't close them.
+const eventsHeartbeat = 30 * time.Second
+
+// EventHandler streams events as Server-Sent Events. It must be served without a request timeout.
+type EventHandler struct {
+	eventService service.EventService
+}
+
+func NewEventHandler(eventService service.EventService) *EventHandler {
+	return &EventHandler{
+		eventService: eventService,
+	}
+}
+
+func (h *EventHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/events", h.Events)
+}
+
+// Events streams the events of the feeds given as feed_id and of the folder given as folder, of all
+// of them without any. Clients resuming give the last event they got as Last-Event-ID, or last_event_id.
+func (h *EventHandler) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID int64
+	if lastID != "" {
+		var err error
+		if lastEventID, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	sub, missed, err := h.eventService.Subscribe(ctx, r.URL.Query()["feed_id"], r.URL.Query().Get("folder"), lastEventID)
+	if err != nil {
+		http.Error(w, err.Error(), eventErrorStatus(err))
+		return
+	}
+	defer h.eventService.Unsubscribe(sub)
+
+	// The server write timeout would end the stream
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			// Dropped for lagging behind, the client reconnects from its last event
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if e.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+func eventErrorStatus(err error) int {
+	switch {
+	case repository.IsNotFound(err), errors.Is(err, repository.ErrFolderNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/events"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type eventsTest struct {
+	t           *testing.T
+	srv         *httptest.Server
+	feedRepo    repository.FeedRepository
+	feedService service.FeedService
+}
+
+func newEventsTest(t *testing.T) *eventsTest {
+	d := newTestDB(t)
+	bus := events.NewBus()
+	feedRepo := events.NewFeedRepository(repodb.NewGormFeedRepository(d), bus)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewEventHandler(service.NewEventService(bus, folderService)).RegisterRoutes(r)
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	tech, golang := "tech", "golang"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+	d.Create(&db.Folder{ID: golang, Name: "Go", ParentID: &tech})
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News", FolderID: &tech})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog", FolderID: &golang})
+	d.Create(&db.Feed{ID: "xkcd", URL: "http://example.com/xkcd", Title: "xkcd"})
+	d.Create(&db.Item{ID: "hn-1", FeedID: "hn", Title: "HN 1", Link: "http://example.com/hn/1"})
+	d.Create(&db.Item{ID: "xkcd-1", FeedID: "xkcd", Title: "xkcd 1", Link: "http://example.com/xkcd/1"})
+
+	return &eventsTest{t: t, srv: srv, feedRepo: feedRepo, feedService: feedService}
+}
+
+// eventStream reads the events of a stream.
+type eventStream struct {
+	t      *testing.T
+	events chan events.Event
+	cancel context.CancelFunc
+}
+
+// stream opens /api/v1/events with the given query and Last-Event-ID.
+func (et *eventsTest) stream(query, lastEventID string) *eventStream {
+	et.t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	et.t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, et.srv.URL+"/api/v1/events?"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		et.t.Fatalf("Failed to open the stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		et.t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s := &eventStream{t: et.t, events: make(chan events.Event, 16), cancel: cancel}
+	go func() {
+		defer resp.Body.Close()
+		defer close(s.events)
+
+		var e events.Event
+		var id string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+					return
+				}
+			case line == "" && e.Type != "":
+				if id != "" && id != fmt.Sprint(e.ID) {
+					return
+				}
+				s.events <- e
+				e, id = events.Event{}, ""
+			}
+		}
+	}()
+	return s
+}
+
+// next returns the next event, failing after a second without any.
+func (s *eventStream) next() events.Event {
+	s.t.Helper()
+
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			s.t.Fatalf("Expected an event, the stream ended")
+		}
+		return e
+	case <-time.After(time.Second):
+		s.t.Fatalf("Expected an event, got none")
+		return events.Event{}
+	}
+}
+
+// none checks that no event comes soon.
+func (s *eventStream) none() {
+	s.t.Helper()
+
+	select {
+	case e := <-s.events:
+		s.t.Errorf("Expected no event, got %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEvents(t *testing.T) {
+	et := newEventsTest(t)
+	ctx := context.Background()
+
+	all := et.stream("", "")
+	hn := et.stream("feed_id=hn", "")
+	tech := et.stream("folder=tech", "")
+
+	// Only the items a refresh inserts are published
+	added, err := et.feedRepo.SaveFeedItems(ctx, "go-blog", []db.Item{
+		{Title: "Go 1.24", Link: "http://example.com/go/1.24"},
+		{Title: "Go 1.24", Link: "http://example.com/go/1.24"},
+	})
+	if err != nil || len(added) != 1 {
+		t.Fatalf("Expected 1 item added, got %d: %v", len(added), err)
+	}
+	first := all.next()
+	if first.Type != events.ItemsAdded || first.FeedID != "go-blog" || first.FolderID != "golang" || len(first.ItemIDs) != 1 || first.ID == 0 {
+		t.Errorf("Expected the added item, got %+v", first)
+	}
+	if e := tech.next(); e.ID != first.ID {
+		t.Errorf("Expected the items of a subfolder in the folder stream, got %+v", e)
+	}
+
+	if err := et.feedService.MarkFeedItemRead(ctx, "xkcd-1", true); err != nil {
+		t.Fatalf("Failed to mark the item: %v", err)
+	}
+	if e := all.next(); e.Type != events.ItemsRead || e.FeedID != "xkcd" || e.ItemIDs[0] != "xkcd-1" {
+		t.Errorf("Expected xkcd-1 read, got %+v", e)
+	}
+	// Marking it again changes nothing
+	if err := et.feedService.MarkFeedItemRead(ctx, "xkcd-1", true); err != nil {
+		t.Fatalf("Failed to mark the item: %v", err)
+	}
+
+	if err := et.feedService.MarkFeedItemRead(ctx, "hn-1", true); err != nil {
+		t.Fatalf("Failed to mark the item: %v", err)
+	}
+	if _, err := et.feedService.MarkFeedItems(ctx, models.SearchParams{FolderID: "golang"}, true); err != nil {
+		t.Fatalf("Failed to mark the folder: %v", err)
+	}
+	if e := hn.next(); e.Type != events.ItemsRead || e.ItemIDs[0] != "hn-1" {
+		t.Errorf("Expected hn-1 read, got %+v", e)
+	}
+	hn.none()
+	if e := tech.next(); e.FeedID != "hn" {
+		t.Errorf("Expected hn-1 read in the folder stream, got %+v", e)
+	}
+	if e := tech.next(); e.FolderID != "golang" || e.Count != 1 {
+		t.Errorf("Expected the subfolder marked read, got %+v", e)
+	}
+	tech.none()
+
+	if err := et.feedService.DeleteFeed(ctx, "hn"); err != nil {
+		t.Fatalf("Failed to delete the feed: %v", err)
+	}
+	if e := hn.next(); e.Type != events.FeedRemoved || e.FolderID != "tech" {
+		t.Errorf("Expected hn removed, got %+v", e)
+	}
+
+	// Resuming replays the events published since
+	resumed := et.stream("", fmt.Sprint(first.ID))
+	for _, expected := range []string{events.ItemsRead, events.ItemsRead, events.ItemsRead, events.FeedRemoved} {
+		if e := resumed.next(); e.Type != expected || e.ID <= first.ID {
+			t.Errorf("Expected a replayed %s event, got %+v", expected, e)
+		}
+	}
+	resumed.none()
+
+	if e := et.stream("", "1").next(); e.Type != events.Resync {
+		t.Errorf("Expected a resync for events that aren't kept, got %+v", e)
+	}
+}
+
+func TestEventsErrors(t *testing.T) {
+	et := newEventsTest(t)
+
+	for query, expected := range map[string]int{
+		"folder=missing":  http.StatusNotFound,
+		"feed_id=missing": http.StatusNotFound,
+	} {
+		resp, err := http.Get(et.srv.URL + "/api/v1/events?" + query)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Expected status code %d for %s, got %d", expected, query, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, et.srv.URL+"/api/v1/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request the stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid Last-Event-ID, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/readability"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ExtractHandler struct {
+	extractService service.ExtractService
+}
+
+func NewExtractHandler(extractService service.ExtractService) *ExtractHandler {
+	return &ExtractHandler{
+		extractService: extractService,
+	}
+}
+
+func (h *ExtractHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/items/{id}/extract", h.ExtractItem)
+}
+
+// ExtractItem fetches the full article of an item now, and returns the item with it.
+func (h *ExtractHandler) ExtractItem(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	item, err := h.extractService.ExtractItem(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), extractErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(item)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func extractErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, readability.ErrNoArticle):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrArticleUnavailable):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/events"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const articlePage = `<html><head><title>Weak pointers in Go</title></head><body>
+<nav><a href="/">Home</a> <a href="/blog">Blog</a></nav>
+<article>
+<p>Go 1.24 adds weak pointers to the standard library, in the new weak package, for caches and canonicalization maps.</p>
+<p>A weak pointer references a value without keeping it alive, once the value is collected the pointer returns nil.</p>
+<p>Read the <a href="/doc/weak">documentation</a> for the details, and the examples of caches built with them.</p>
+</article>
+<div class="comments"><p>Great post, thanks, I was waiting for this one, finally, awesome, cool.</p></div>
+</body></html>`
+
+func TestExtractItem(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	feedRepo := events.NewFeedRepository(repodb.NewGormFeedRepository(d), bus)
+	extractService := service.NewExtractService(feedRepo, bus)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/weak", "/auto":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, articlePage)
+		case "/teaser":
+			fmt.Fprint(w, `<html><body><p>Read the full post on the site.</p></body></html>`)
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<rss><channel></channel></rss>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewExtractHandler(extractService).RegisterRoutes(r)
+	})
+
+	d.Create(&db.Feed{ID: "go-blog", URL: site.URL + "/feed.xml", Title: "The Go Blog"})
+	added, err := feedRepo.SaveFeedItems(ctx, "go-blog", []db.Item{
+		{Title: "Weak pointers", Link: site.URL + "/weak", Description: "Go 1.24 adds weak pointers..."},
+		{Title: "Teaser", Link: site.URL + "/teaser"},
+		{Title: "Gone", Link: site.URL + "/gone"},
+		{Title: "Feed", Link: site.URL + "/feed.xml"},
+	})
+	if err != nil || len(added) != 4 {
+		t.Fatalf("Failed to save items: %v", err)
+	}
+	d.Model(&db.Item{}).Where("id = ?", added[0].ID).Update("is_read", true)
+
+	extract := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/items/"+id+"/extract", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := extract(added[0].ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var item db.Item
+	json.NewDecoder(w.Body).Decode(&item)
+	if !strings.Contains(item.Article, "A weak pointer references a value") || strings.Contains(item.Article, "Great post") {
+		t.Errorf("Expected the article without the comments, got %q", item.Article)
+	}
+	if !strings.Contains(item.Article, `href="`+site.URL+`/doc/weak"`) {
+		t.Errorf("Expected absolute links in the article, got %q", item.Article)
+	}
+
+	var saved db.Item
+	d.First(&saved, "id = ?", added[0].ID)
+	if saved.Article != item.Article || saved.ExtractedAt == nil || !saved.IsRead {
+		t.Errorf("Expected the article saved without changing the item, got %+v", saved)
+	}
+
+	for id, expected := range map[string]int{
+		added[1].ID: http.StatusUnprocessableEntity,
+		added[2].ID: http.StatusBadGateway,
+		added[3].ID: http.StatusBadGateway,
+		"missing":   http.StatusNotFound,
+	} {
+		if w := extract(id); w.Code != expected {
+			t.Errorf("Expected status code %d for %s, got %d: %s", expected, id, w.Code, w.Body.String())
+		}
+	}
+
+	// New items of feeds with Extract on have their article extracted
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go extractService.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	d.Create(&db.Feed{ID: "teasers", URL: site.URL + "/teasers.xml", Title: "Teasers", Extract: true})
+	auto, _ := feedRepo.SaveFeedItems(ctx, "teasers", []db.Item{{Title: "Auto", Link: site.URL + "/auto"}})
+	other, _ := feedRepo.SaveFeedItems(ctx, "go-blog", []db.Item{{Title: "Other", Link: site.URL + "/weak?other"}})
+
+	var extracted db.Item
+	for deadline := time.Now().Add(2 * time.Second); extracted.ExtractedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		extracted = db.Item{}
+		d.First(&extracted, "id = ?", auto[0].ID)
+	}
+	if !strings.Contains(extracted.Article, "A weak pointer references a value") {
+		t.Errorf("Expected the article of the new item extracted, got %+v", extracted)
+	}
+	var skipped db.Item
+	d.First(&skipped, "id = ?", other[0].ID)
+	if skipped.ExtractedAt != nil {
+		t.Errorf("Expected no article extracted for feeds without Extract")
+	}
+}
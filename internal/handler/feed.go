@@ -2,13 +2,19 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"llrss/internal/models"
 	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/scraper"
+	"llrss/internal/search"
 	"llrss/internal/service"
 	"llrss/internal/text"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -27,12 +33,22 @@ func NewFeedHandler(feedService service.FeedService) *FeedHandler {
 func (h *FeedHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/feeds", h.ListFeeds)
 	r.Post("/feeds", h.AddFeed)
+	r.Post("/feeds/preview", h.PreviewFeed)
 	r.Get("/feeds/{id}", h.GetFeed)
+	r.Get("/counts", h.Counts)
 	r.Get("/feeds/items/search", h.SearchFeedItems)
+	r.Get("/feeds/{id}/items", h.FeedItems)
 	r.Delete("/feeds/{id}", h.DeleteFeed)
+	r.Patch("/feeds/{id}", h.UpdateFeed)
 	r.Put("/feeds/{id}", h.UpdateFeed)
 	r.Put("/feeds/read/{id}", h.MarkAsRead)
 	r.Put("/feeds/unread/{id}", h.MarkAsUnread)
+	r.Post("/items/mark", h.MarkItems)
+	r.Put("/items/{id}/star", h.Star)
+	r.Put("/items/{id}/unstar", h.Unstar)
+	r.Put("/items/{id}/tags/{tag}", h.AddTag)
+	r.Delete("/items/{id}/tags/{tag}", h.RemoveTag)
+	r.Put("/items/{id}/note", h.SetNote)
 	r.Post("/feeds/refresh", h.RefreshFeeds)
 	r.Delete("/nuke", h.Nuke)
 }
@@ -44,26 +60,66 @@ func (h *FeedHandler) ListFeeds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(feeds)
+	counts, err := h.feedService.CountFeedItems(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]models.FeedCount, len(feeds))
+	for i, f := range feeds {
+		res[i] = models.FeedCount{Feed: f, ItemCount: counts.Feeds[f.ID]}
+	}
+
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (h *FeedHandler) AddFeed(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		URL string `json:"url"`
+// feedRequest adds a feed, scraped from the web page at URL when it has selectors.
+type feedRequest struct {
+	URL     string          `json:"url"`
+	Scraper *scraperRequest `json:"scraper"`
+}
+
+type scraperRequest struct {
+	Item       string `json:"item"`
+	Title      string `json:"title"`
+	Link       string `json:"link"`
+	Date       string `json:"date"`
+	Summary    string `json:"summary"`
+	DateFormat string `json:"date_format"`
+}
+
+func (req *scraperRequest) scraper() db.Scraper {
+	return db.Scraper{
+		Item:       req.Item,
+		Title:      req.Title,
+		Link:       req.Link,
+		Date:       req.Date,
+		Summary:    req.Summary,
+		DateFormat: req.DateFormat,
 	}
+}
 
+func (h *FeedHandler) AddFeed(w http.ResponseWriter, r *http.Request) {
+	var req feedRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	ID, err := h.feedService.AddFeed(r.Context(), req.URL)
+	var ID string
+	var err error
+	if req.Scraper != nil {
+		ID, err = h.feedService.AddScraperFeed(r.Context(), req.URL, req.Scraper.scraper())
+	} else {
+		ID, err = h.feedService.AddFeed(r.Context(), req.URL)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), feedErrorStatus(err))
 		return
 	}
 
@@ -71,6 +127,34 @@ func (h *FeedHandler) AddFeed(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(ID))
 }
 
+// PreviewFeed fetches a feed, or scrapes a web page with selectors, and returns it
+// with its items without saving anything.
+func (h *FeedHandler) PreviewFeed(w http.ResponseWriter, r *http.Request) {
+	var req feedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var feed *db.Feed
+	var err error
+	if req.Scraper != nil {
+		feed, err = h.feedService.ScrapeFeed(r.Context(), req.URL, req.Scraper.scraper())
+	} else {
+		feed, err = h.feedService.FetchFeed(r.Context(), req.URL)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), feedErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(feed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (h *FeedHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	feed, err := h.feedService.GetFeed(r.Context(), id)
@@ -79,7 +163,28 @@ func (h *FeedHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(feed)
+	counts, err := h.feedService.CountFeedItems(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(models.FeedCount{Feed: *feed, ItemCount: counts.Feeds[id]})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Counts returns the unread and total items of every feed, cheap enough to be polled.
+func (h *FeedHandler) Counts(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.feedService.CountFeedItems(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(counts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -96,21 +201,48 @@ func (h *FeedHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// UpdateFeed updates the fields of a feed which are in the body, among service.UpdatableFeedFields,
+// and leaves the others as they are. It's a PATCH, PUT is the same for older clients.
 func (h *FeedHandler) UpdateFeed(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	var feed db.Feed
-	if err := json.NewDecoder(r.Body).Decode(&feed); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(body, &sent); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	feed, err := h.feedService.GetFeed(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), feedErrorStatus(err))
+		return
+	}
+	// The fields sent replace those of the feed, JSON keys match them case-insensitively
+	if err := json.Unmarshal(body, feed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	feed.ID = id
-	if err := h.feedService.UpdateFeed(r.Context(), &feed); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	var fields []string
+	for key := range sent {
+		for _, f := range service.UpdatableFeedFields {
+			if strings.EqualFold(key, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	if err := h.feedService.UpdateFeedFields(r.Context(), feed, fields...); err != nil {
+		http.Error(w, err.Error(), feedErrorStatus(err))
 		return
 	}
+	feed.Items = nil
 
-	err := json.NewEncoder(w).Encode(feed)
+	err = json.NewEncoder(w).Encode(feed)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -131,7 +263,186 @@ func (h *FeedHandler) markReadStatusHandler(status bool) http.HandlerFunc {
 	}
 }
 
+// MarkItems marks many items as read, or unread with "read": false, at once. The items
+// are those of a feed or folder, matching a search, and/or published before a date.
+func (h *FeedHandler) MarkItems(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Read     *bool     `json:"read"`
+		FeedID   string    `json:"feed_id"`
+		FolderID string    `json:"folder_id"`
+		Query    string    `json:"query"`
+		Tags     []string  `json:"tags"`
+		Starred  bool      `json:"starred"`
+		Before   time.Time `json:"before"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	read := true
+	if req.Read != nil {
+		read = *req.Read
+	}
+
+	filter, err := search.Parse(req.Query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := models.SearchParams{
+		OlderThan: req.Before,
+		Query:     req.Query,
+		Filter:    filter,
+		FolderID:  req.FolderID,
+		Tags:      req.Tags,
+		Starred:   req.Starred,
+	}
+	if req.FeedID != "" {
+		params.FeedIDs = []string{req.FeedID}
+	}
+
+	updated, err := h.feedService.MarkFeedItems(r.Context(), params, read)
+	if err != nil {
+		http.Error(w, err.Error(), itemErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(models.MarkResult{Updated: updated})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *FeedHandler) starStatusHandler(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		err := h.feedService.StarFeedItem(r.Context(), id, starred)
+		if err != nil {
+			http.Error(w, err.Error(), itemErrorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *FeedHandler) tagStatusHandler(tagged bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		tag := chi.URLParam(r, "tag")
+
+		err := h.feedService.TagFeedItem(r.Context(), id, tag, tagged)
+		if err != nil {
+			http.Error(w, err.Error(), itemErrorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *FeedHandler) SetNote(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		Note string `json:"note"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.feedService.SetFeedItemNote(r.Context(), id, req.Note); err != nil {
+		http.Error(w, err.Error(), itemErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// feedErrorStatus maps errors of the feed operations to their HTTP status code.
+func feedErrorStatus(err error) int {
+	switch {
+	case repository.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.Is(err, scraper.ErrInvalidSelector):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// itemErrorStatus maps errors of the item operations to their HTTP status code.
+func itemErrorStatus(err error) int {
+	switch {
+	case repository.IsItemNotFound(err), errors.Is(err, repository.ErrTagNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidTag), errors.Is(err, service.ErrNoteTooLong), errors.Is(err, service.ErrNoMarkScope):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *FeedHandler) SearchFeedItems(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.search(w, r, params)
+}
+
+// FeedItems searches the items of a single feed, with the same parameters as SearchFeedItems.
+func (h *FeedHandler) FeedItems(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.feedService.GetFeed(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	params, err := parseSearchParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.FeedIDs = []string{id}
+	params.ExcludeFeedIDs = nil
+
+	h.search(w, r, params)
+}
+
+func (h *FeedHandler) search(w http.ResponseWriter, r *http.Request, params models.SearchParams) {
+	res, err := h.feedService.SearchFeedItems(r.Context(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Tags, err = h.feedService.CountFeedItemTags(r.Context(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseSearchParams reads the search parameters from the query string, defaulting to the
+// 10 most recent unread items. Queries with is:read or is:unread aren't restricted to
+// unread items.
+func parseSearchParams(r *http.Request) (models.SearchParams, error) {
 	var err error
 	var fromDate, toDate time.Time
 
@@ -140,21 +451,38 @@ func (h *FeedHandler) SearchFeedItems(w http.ResponseWriter, r *http.Request) {
 	limit := 10
 	sort := "desc" // Uses PubDate
 
-	query := r.URL.Query().Get("query")
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+	filter, err := search.Parse(query)
+	if err != nil {
+		return models.SearchParams{}, err
+	}
 
 	u := r.URL.Query().Get("unread")
-	if u == "0" {
+	if u == "0" || search.HasTerm(filter, search.FieldIs, search.IsRead, search.IsUnread) {
 		unread = false
 	}
 
+	starred := r.URL.Query().Get("starred") == "1"
+	folderID := r.URL.Query().Get("folder")
+	feedIDs := r.URL.Query()["feed_id"]
+	excludeFeedIDs := r.URL.Query()["exclude_feed_id"]
+
+	var tags []string
+	for _, t := range r.URL.Query()["tag"] {
+		tag, err := service.NormalizeTag(t)
+		if err != nil {
+			return models.SearchParams{}, fmt.Errorf("invalid tag: %s", t)
+		}
+		tags = append(tags, tag)
+	}
+
 	fd := r.URL.Query().Get("from")
 	if fd == "" {
 		fd = "1900-01-01"
 	}
 	fromDate, err = text.ParseAPISearchDate(fd)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("invalid fromDate: %s", fd), http.StatusBadRequest)
-		return
+		return models.SearchParams{}, fmt.Errorf("invalid fromDate: %s", fd)
 	}
 
 	td := r.URL.Query().Get("to")
@@ -163,12 +491,11 @@ func (h *FeedHandler) SearchFeedItems(w http.ResponseWriter, r *http.Request) {
 	}
 	toDate, err = text.ParseAPISearchDate(td)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("invalid toDate: %s", td), http.StatusBadRequest)
-		return
+		return models.SearchParams{}, fmt.Errorf("invalid toDate: %s", td)
 	}
 
 	s := r.URL.Query().Get("sort")
-	if s == "asc" {
+	if s == "asc" || s == "relevance" {
 		sort = s
 	}
 
@@ -176,8 +503,7 @@ func (h *FeedHandler) SearchFeedItems(w http.ResponseWriter, r *http.Request) {
 	if l != "" {
 		limit, err = strconv.Atoi(l)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("invalid limit: %s", l), http.StatusBadRequest)
-			return
+			return models.SearchParams{}, fmt.Errorf("invalid limit: %s", l)
 		}
 	}
 	if limit > 100 {
@@ -187,46 +513,45 @@ func (h *FeedHandler) SearchFeedItems(w http.ResponseWriter, r *http.Request) {
 		limit = 1
 	}
 
-	// TODO: Implement cursor instead of offset
-	// cursor := r.URL.Query().Get("cursor")
+	// Cursors are preferred, offsets are still accepted for older clients
+	var cursor *models.Cursor
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err = service.ParseCursor(c)
+		if err != nil {
+			return models.SearchParams{}, err
+		}
+		if sort == "relevance" {
+			return models.SearchParams{}, service.ErrRelevanceCursor
+		}
+	}
 
 	o := r.URL.Query().Get("offset")
 	if o != "" {
 		offset, err = strconv.Atoi(o)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("invalid offset: %s", o), http.StatusBadRequest)
-			return
+			return models.SearchParams{}, fmt.Errorf("invalid offset: %s", o)
 		}
 	}
 	if offset < 0 {
 		offset = 0
 	}
 
-	items, total, err := h.feedService.SearchFeedItems(r.Context(), models.SearchParams{
-		FromDate: fromDate,
-		ToDate:   toDate,
-		Query:    query,
-		Unread:   unread,
-		Sort:     sort,
-		Limit:    limit,
-		Offset:   offset,
-	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	res := &models.SearchResult{
-		Items: items,
-		Len:   int64(len(items)),
-		Total: total,
-	}
-
-	err = json.NewEncoder(w).Encode(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	return models.SearchParams{
+		FromDate:       fromDate,
+		ToDate:         toDate,
+		Query:          query,
+		Filter:         filter,
+		FolderID:       folderID,
+		FeedIDs:        feedIDs,
+		ExcludeFeedIDs: excludeFeedIDs,
+		Tags:           tags,
+		Unread:         unread,
+		Starred:        starred,
+		Sort:           sort,
+		Limit:          limit,
+		Offset:         offset,
+		Cursor:         cursor,
+	}, nil
 }
 
 func (h *FeedHandler) RefreshFeeds(w http.ResponseWriter, r *http.Request) {
@@ -244,6 +569,22 @@ func (h *FeedHandler) MarkAsUnread(w http.ResponseWriter, r *http.Request) {
 	h.markReadStatusHandler(false)(w, r)
 }
 
+func (h *FeedHandler) Star(w http.ResponseWriter, r *http.Request) {
+	h.starStatusHandler(true)(w, r)
+}
+
+func (h *FeedHandler) Unstar(w http.ResponseWriter, r *http.Request) {
+	h.starStatusHandler(false)(w, r)
+}
+
+func (h *FeedHandler) AddTag(w http.ResponseWriter, r *http.Request) {
+	h.tagStatusHandler(true)(w, r)
+}
+
+func (h *FeedHandler) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	h.tagStatusHandler(false)(w, r)
+}
+
 func (h *FeedHandler) Nuke(w http.ResponseWriter, r *http.Request) {
 	if err := h.feedService.Nuke(r.Context()); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -7,21 +7,27 @@ import (
 	"llrss/internal/models"
 	"llrss/internal/models/db"
 	"llrss/internal/repository"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type mockService struct {
 	feeds map[string]*db.Feed
+	items map[string]*db.Item
 }
 
 func newMockService() *mockService {
 	return &mockService{
 		feeds: make(map[string]*db.Feed),
+		items: make(map[string]*db.Item),
 	}
 }
 
@@ -34,6 +40,16 @@ func (m *mockService) FetchFeed(ctx context.Context, url string) (*db.Feed, erro
 	return feed, nil
 }
 
+func (m *mockService) ScrapeFeed(ctx context.Context, pageURL string, selectors db.Scraper) (*db.Feed, error) {
+	feed := &db.Feed{
+		URL:     pageURL,
+		Title:   "Test Page",
+		Scraper: selectors,
+		Items:   []db.Item{{Title: "Test Item"}},
+	}
+	return feed, nil
+}
+
 func (m *mockService) GetFeed(ctx context.Context, id string) (*db.Feed, error) {
 	feed, ok := m.feeds[id]
 	if !ok {
@@ -58,6 +74,23 @@ func (m *mockService) ListFeeds(ctx context.Context) ([]db.Feed, error) {
 	return feeds, nil
 }
 
+func (m *mockService) CountFeedItems(ctx context.Context, feedIDs ...string) (*models.Counts, error) {
+	counts := &models.Counts{Feeds: make(map[string]models.ItemCount)}
+	for _, item := range m.items {
+		c := counts.Feeds[item.FeedID]
+		c.Total++
+		if !item.IsRead {
+			c.Unread++
+		}
+		counts.Feeds[item.FeedID] = c
+		counts.Total++
+		if !item.IsRead {
+			counts.Unread++
+		}
+	}
+	return counts, nil
+}
+
 func (m *mockService) AddFeed(ctx context.Context, url string) (string, error) {
 	feed := &db.Feed{
 		ID:    "test-id",
@@ -68,6 +101,17 @@ func (m *mockService) AddFeed(ctx context.Context, url string) (string, error) {
 	return feed.ID, nil
 }
 
+func (m *mockService) AddScraperFeed(ctx context.Context, pageURL string, selectors db.Scraper) (string, error) {
+	feed := &db.Feed{
+		ID:      "test-id",
+		URL:     pageURL,
+		Title:   "Test Page",
+		Scraper: selectors,
+	}
+	m.feeds[feed.ID] = feed
+	return feed.ID, nil
+}
+
 func (m *mockService) DeleteFeed(ctx context.Context, id string) error {
 	delete(m.feeds, id)
 	return nil
@@ -78,14 +122,52 @@ func (m *mockService) UpdateFeed(ctx context.Context, feed *db.Feed) error {
 	return nil
 }
 
+func (m *mockService) UpdateFeedFields(ctx context.Context, feed *db.Feed, fields ...string) error {
+	m.feeds[feed.ID] = feed
+	return nil
+}
+
 func (m *mockService) MarkFeedItemRead(ctx context.Context, feedItemID string, read bool) error {
 	// TODO Implement this
 	return nil
 }
 
-func (m *mockService) SearchFeedItems(ctx context.Context, items models.SearchParams) ([]db.Item, int64, error) {
+func (m *mockService) MarkFeedItems(ctx context.Context, params models.SearchParams, read bool) (int64, error) {
 	// TODO Implement this
-	return nil, 0, nil
+	return 0, nil
+}
+
+func (m *mockService) StarFeedItem(ctx context.Context, feedItemID string, starred bool) error {
+	item, ok := m.items[feedItemID]
+	if !ok {
+		return repository.ErrItemNotFound
+	}
+	item.IsStarred = starred
+	return nil
+}
+
+func (m *mockService) TagFeedItem(ctx context.Context, feedItemID, tag string, tagged bool) error {
+	// TODO Implement this
+	return nil
+}
+
+func (m *mockService) SetFeedItemNote(ctx context.Context, feedItemID, note string) error {
+	item, ok := m.items[feedItemID]
+	if !ok {
+		return repository.ErrItemNotFound
+	}
+	item.Note = note
+	return nil
+}
+
+func (m *mockService) CountFeedItemTags(ctx context.Context, params models.SearchParams) ([]models.TagCount, error) {
+	// TODO Implement this
+	return nil, nil
+}
+
+func (m *mockService) SearchFeedItems(ctx context.Context, params models.SearchParams) (*models.SearchResult, error) {
+	// TODO Implement this
+	return &models.SearchResult{}, nil
 }
 
 func (m *mockService) RefreshFeeds(ctx context.Context) error {
@@ -171,3 +253,433 @@ func TestGetFeed(t *testing.T) {
 		t.Errorf("Expected feed ID %s, got %s", ID, responseFeed.ID)
 	}
 }
+
+func TestStarItem(t *testing.T) {
+	r, mockSvc := setupTestHandler()
+	mockSvc.items["item-id"] = &db.Item{ID: "item-id"}
+
+	tests := []struct {
+		name            string
+		path            string
+		expectedStatus  int
+		expectedStarred bool
+	}{
+		{name: "star", path: "/items/item-id/star", expectedStatus: http.StatusOK, expectedStarred: true},
+		{name: "unstar", path: "/items/item-id/unstar", expectedStatus: http.StatusOK, expectedStarred: false},
+		{name: "unknown item", path: "/items/other/star", expectedStatus: http.StatusNotFound, expectedStarred: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if mockSvc.items["item-id"].IsStarred != tt.expectedStarred {
+				t.Errorf("Expected starred %v, got %v", tt.expectedStarred, mockSvc.items["item-id"].IsStarred)
+			}
+		})
+	}
+}
+
+func TestMarkItems(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn"})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "hn", PubDate: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "2", FeedID: "hn", PubDate: time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC)},
+	})
+
+	mark := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/items/mark", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := mark(`{"before": "2024-11-02T00:00:00Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var res models.MarkResult
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.Updated != 1 {
+		t.Errorf("Expected 1 item marked as read, got %d", res.Updated)
+	}
+
+	// Items published at the timestamp aren't older than it, whatever its offset
+	d.Model(&db.Item{}).Where("1 = 1").Update("is_read", false)
+	d.Create(&db.Item{ID: "3", FeedID: "hn", PubDate: time.Date(2024, 11, 2, 10, 0, 0, 0, time.UTC)})
+	w = mark(`{"before": "2024-11-02T11:00:00+02:00"}`)
+	res = models.MarkResult{}
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Updated != 1 {
+		t.Errorf("Expected 1 item older than 09:00Z marked as read, got %d", res.Updated)
+	}
+	w = mark(`{"before": "2024-11-03T00:00:00Z"}`)
+	res = models.MarkResult{}
+	json.NewDecoder(w.Body).Decode(&res)
+	if res.Updated != 1 {
+		t.Errorf("Expected only the item published before the timestamp marked as read, got %d", res.Updated)
+	}
+
+	w = mark(`{"feed_id": "hn", "read": false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var read int64
+	d.Model(&db.Item{}).Where("is_read = ?", true).Count(&read)
+	if read != 0 {
+		t.Errorf("Expected all the items of the feed to be unread, got %d read", read)
+	}
+
+	if w := mark(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without any filter, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	d.Create(&[]db.Feed{{ID: "hn", URL: "http://example.com/hn"}, {ID: "empty", URL: "http://example.com/empty"}})
+	d.Create(&[]db.Item{{ID: "1", FeedID: "hn"}, {ID: "2", FeedID: "hn", IsRead: true}})
+
+	get := func(path string, v any) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d", http.StatusOK, path, w.Code)
+		}
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+
+	var counts models.Counts
+	get("/counts", &counts)
+	if counts.Unread != 1 || counts.Total != 2 || counts.Feeds["hn"] != (models.ItemCount{Unread: 1, Total: 2}) {
+		t.Errorf("Unexpected counts %+v", counts)
+	}
+
+	var feeds []models.FeedCount
+	get("/feeds", &feeds)
+	for _, f := range feeds {
+		if f.ID == "hn" && (f.Unread != 1 || f.Total != 2) {
+			t.Errorf("Unexpected counts for hn: %+v", f.ItemCount)
+		}
+		if f.ID == "empty" && f.Total != 0 {
+			t.Errorf("Expected no items for the empty feed, got %+v", f.ItemCount)
+		}
+	}
+
+	var feed models.FeedCount
+	get("/feeds/hn", &feed)
+	if feed.ID != "hn" || feed.Unread != 1 {
+		t.Errorf("Unexpected feed %+v", feed)
+	}
+}
+
+func TestFeedItems(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	pubDate := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	d.Create(&[]db.Feed{{ID: "hn", URL: "http://example.com/hn"}, {ID: "go", URL: "http://example.com/go"}})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "hn", PubDate: pubDate},
+		{ID: "2", FeedID: "hn", PubDate: pubDate.Add(time.Hour)},
+		{ID: "3", FeedID: "hn", PubDate: pubDate.Add(2 * time.Hour)},
+		{ID: "4", FeedID: "go", PubDate: pubDate},
+	})
+
+	search := func(path string) (models.SearchResult, int) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var res models.SearchResult
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return res, w.Code
+	}
+
+	res, _ := search("/feeds/hn/items?limit=2&offset=1")
+	if res.Total != 3 || res.Len != 2 || res.Items[0].ID != "2" {
+		t.Errorf("Expected the second page of hn, got %+v", res)
+	}
+
+	res, _ = search("/feeds/items/search?exclude_feed_id=hn")
+	if res.Total != 1 || res.Items[0].ID != "4" {
+		t.Errorf("Expected only the item of go, got %+v", res)
+	}
+
+	res, _ = search("/feeds/items/search?feed_id=hn&feed_id=go")
+	if res.Total != 4 {
+		t.Errorf("Expected the items of both feeds, got %d", res.Total)
+	}
+
+	if _, code := search("/feeds/missing/items"); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestSearchCursors(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	// Items 3 and 4 are published at the same time
+	pubDate := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn"})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "hn", PubDate: pubDate},
+		{ID: "2", FeedID: "hn", PubDate: pubDate.Add(time.Hour)},
+		{ID: "3", FeedID: "hn", PubDate: pubDate.Add(2 * time.Hour)},
+		{ID: "4", FeedID: "hn", PubDate: pubDate.Add(2 * time.Hour)},
+		{ID: "5", FeedID: "hn", PubDate: pubDate.Add(3 * time.Hour)},
+	})
+
+	search := func(query string) models.SearchResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/feeds/items/search?limit=2&"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var res models.SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return res
+	}
+
+	ids := func(res models.SearchResult) string {
+		var s []string
+		for _, item := range res.Items {
+			s = append(s, item.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	first := search("")
+	if ids(first) != "5,4" || first.PrevCursor != "" || first.NextCursor == "" || first.Total != 5 {
+		t.Fatalf("Unexpected first page %s %+v", ids(first), first)
+	}
+
+	// A new item doesn't shift the following pages
+	d.Create(&db.Item{ID: "6", FeedID: "hn", PubDate: pubDate.Add(4 * time.Hour)})
+
+	second := search("cursor=" + first.NextCursor)
+	if ids(second) != "3,2" || second.PrevCursor == "" || second.NextCursor == "" {
+		t.Fatalf("Unexpected second page %s", ids(second))
+	}
+
+	last := search("cursor=" + second.NextCursor)
+	if ids(last) != "1" || last.NextCursor != "" {
+		t.Fatalf("Unexpected last page %s, next %q", ids(last), last.NextCursor)
+	}
+
+	back := search("cursor=" + last.PrevCursor)
+	if ids(back) != "3,2" || back.NextCursor == "" {
+		t.Errorf("Expected to go back to the second page, got %s", ids(back))
+	}
+
+	back = search("cursor=" + back.PrevCursor)
+	if ids(back) != "5,4" || back.PrevCursor == "" {
+		t.Errorf("Expected to go back to the first page, got %s", ids(back))
+	}
+	if back = search("cursor=" + back.PrevCursor); ids(back) != "6" || back.PrevCursor != "" {
+		t.Errorf("Expected the new item before the first page, got %s", ids(back))
+	}
+
+	asc := search("sort=asc")
+	asc = search("sort=asc&cursor=" + asc.NextCursor)
+	if ids(asc) != "3,4" {
+		t.Errorf("Expected 3,4 in ascending order, got %s", ids(asc))
+	}
+
+	// Offsets still work
+	if res := search("offset=2"); ids(res) != "4,3" || res.PrevCursor == "" {
+		t.Errorf("Unexpected page with offset %s", ids(res))
+	}
+
+	for _, query := range []string{"cursor=bogus", "sort=relevance&query=x&cursor=" + first.NextCursor} {
+		req := httptest.NewRequest(http.MethodGet, "/feeds/items/search?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestSearchQueryLanguage(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn"})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "hn", Title: "Kubernetes", Author: "foo", PubDate: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "2", FeedID: "hn", Title: "Kubernetes", Author: "bar", PubDate: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), IsRead: true},
+		{ID: "3", FeedID: "hn", Title: "Meetup at 10:30", Author: "foo", PubDate: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/feeds/items/search?unread=0&query="+url.QueryEscape("kubernetes -author:bar"), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var res models.SearchResult
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.Total != 1 || res.Items[0].ID != "1" {
+		t.Errorf("Expected only the item by foo, got %+v", res.Items)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds/items/search?query="+url.QueryEscape("is:new"), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "invalid query at column 1: unknown is:new") {
+		t.Errorf("Expected the syntax error in the response, got %q", w.Body.String())
+	}
+
+	// is:read replaces the default unread filter
+	req = httptest.NewRequest(http.MethodGet, "/feeds/items/search?query="+url.QueryEscape("is:read"), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	res = models.SearchResult{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res.Total != 1 || res.Items[0].ID != "2" {
+		t.Errorf("Expected the read item, got %+v", res.Items)
+	}
+
+	// Words with a colon are searched as they are, unless it follows a field
+	tests := []struct {
+		query          string
+		expectedStatus int
+		expectedTotal  int64
+	}{
+		{query: "10:30", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{query: "http://example.com", expectedStatus: http.StatusOK, expectedTotal: 0},
+		{query: "before:notadate", expectedStatus: http.StatusBadRequest},
+		{query: "\xff", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req = httptest.NewRequest(http.MethodGet, "/feeds/items/search?query="+url.QueryEscape(tt.query), nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("Expected status code %d for %q, got %d", tt.expectedStatus, tt.query, w.Code)
+			continue
+		}
+		res = models.SearchResult{}
+		if tt.expectedStatus == http.StatusOK && (json.NewDecoder(w.Body).Decode(&res) != nil || res.Total != tt.expectedTotal) {
+			t.Errorf("Expected %d items for %q, got %+v", tt.expectedTotal, tt.query, res)
+		}
+	}
+}
+
+func TestRefreshKeepsChanges(t *testing.T) {
+	d := newTestDB(t)
+	feedService := service.NewFeedService(repodb.NewGormFeedRepository(d))
+
+	tech := "tech"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+	// The feed is renamed and moved while it's being fetched
+	var feedID string
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.Model(&db.Feed{}).Where("id = ?", feedID).Updates(map[string]any{"name": "HN", "folder_id": tech, "extract": true})
+		w.Write([]byte(`<rss version="2.0"><channel><title>Hacker News</title><link>https://news.ycombinator.com</link></channel></rss>`))
+	}))
+	defer site.Close()
+
+	feed := db.Feed{URL: site.URL, Title: "Old title"}
+	feedID, _ = repodb.NewGormFeedRepository(d).SaveFeed(context.Background(), &feed)
+
+	if err := feedService.RefreshFeeds(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	var refreshed db.Feed
+	d.First(&refreshed, "id = ?", feedID)
+	if refreshed.Title != "Hacker News" || refreshed.SiteURL != "https://news.ycombinator.com" || refreshed.LastFetch.IsZero() {
+		t.Errorf("Expected the fetched fields updated, got %+v", refreshed)
+	}
+	if refreshed.Name != "HN" || refreshed.FolderID == nil || *refreshed.FolderID != tech || !refreshed.Extract {
+		t.Errorf("Expected the changes made during the fetch kept, got %+v", refreshed)
+	}
+}
+
+func TestUpdateFeed(t *testing.T) {
+	d := newTestDB(t)
+	r := chi.NewRouter()
+	NewFeedHandler(service.NewFeedService(repodb.NewGormFeedRepository(d))).RegisterRoutes(r)
+
+	tech := "tech"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News", FolderID: &tech, HubURL: "http://example.com/hub"})
+
+	update := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(http.MethodPatch, "/feeds/hn", `{"Retention": {"MaxItems": 2}, "Title": "Ignored"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := update(http.MethodPut, "/feeds/hn", `{"extract": true}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var feed db.Feed
+	d.First(&feed, "id = ?", "hn")
+	if feed.Retention.MaxItems == nil || *feed.Retention.MaxItems != 2 || !feed.Extract {
+		t.Errorf("Expected the retention and extraction updated, got %+v", feed)
+	}
+	if feed.URL != "http://example.com/hn" || feed.Title != "Hacker News" || feed.FolderID == nil || *feed.FolderID != tech ||
+		feed.HubURL != "http://example.com/hub" {
+		t.Errorf("Expected the other fields kept, got %+v", feed)
+	}
+
+	if w := update(http.MethodPatch, "/feeds/missing", `{"Name": "Missing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	var count int64
+	d.Model(&db.Feed{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected no feed created, got %d feeds", count)
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"llrss/internal/models/fever"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// FeverHandler serves the Fever API, the requested data is given by the presence of
+// query parameters (e.g. /fever/?api&items&since_id=42) and api_key is posted as a form.
+type FeverHandler struct {
+	feverService service.FeverService
+	// apiKey is the md5 of "username:password", as clients compute it.
+	apiKey string
+}
+
+func NewFeverHandler(feverService service.FeverService, username, password string) *FeverHandler {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return &FeverHandler{
+		feverService: feverService,
+		apiKey:       hex.EncodeToString(sum[:]),
+	}
+}
+
+func (h *FeverHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/fever/", h.API)
+	r.Post("/fever/", h.API)
+}
+
+func (h *FeverHandler) API(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Some clients give api_key uppercase, or in the query string
+	apiKey := strings.ToLower(r.Form.Get("api_key"))
+	res := map[string]any{"api_version": fever.APIVersion, "auth": 0}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(h.apiKey)) != 1 {
+		writeFever(w, res)
+		return
+	}
+	res["auth"] = 1
+
+	ctx := r.Context()
+	has := func(key string) bool {
+		_, ok := r.Form[key]
+		return ok
+	}
+
+	// Marks come first, so that the data requested along reflects them
+	if has("mark") {
+		m, err := parseFeverMark(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.feverService.Mark(ctx, m); err != nil {
+			http.Error(w, err.Error(), feverErrorStatus(err))
+			return
+		}
+	}
+
+	var err error
+	if res["last_refreshed_on_time"], err = h.feverService.LastRefreshed(ctx); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if has("groups") {
+		if res["groups"], err = h.feverService.Groups(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if has("feeds") {
+		if res["feeds"], err = h.feverService.Feeds(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// feeds_groups comes with both groups and feeds
+	if has("groups") || has("feeds") {
+		if res["feeds_groups"], err = h.feverService.FeedsGroups(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if has("favicons") {
+		if res["favicons"], err = h.feverService.Favicons(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if has("items") {
+		q, err := parseFeverItemQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		items, total, err := h.feverService.Items(ctx, q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res["items"] = items
+		res["total_items"] = total
+	}
+
+	// Hot links aren't supported, there are never any
+	if has("links") {
+		res["links"] = []any{}
+	}
+
+	if has("unread_item_ids") {
+		if res["unread_item_ids"], err = h.feverService.UnreadItemIDs(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if has("saved_item_ids") {
+		if res["saved_item_ids"], err = h.feverService.SavedItemIDs(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeFever(w, res)
+}
+
+func parseFeverMark(r *http.Request) (fever.Mark, error) {
+	m := fever.Mark{
+		Type: r.Form.Get("mark"),
+		As:   r.Form.Get("as"),
+	}
+
+	var err error
+	if m.ID, err = strconv.ParseInt(r.Form.Get("id"), 10, 64); err != nil {
+		return m, errors.New("invalid id")
+	}
+
+	if before := r.Form.Get("before"); before != "" {
+		if m.Before, err = strconv.ParseInt(before, 10, 64); err != nil {
+			return m, errors.New("invalid before")
+		}
+	}
+	return m, nil
+}
+
+func parseFeverItemQuery(r *http.Request) (fever.ItemQuery, error) {
+	var q fever.ItemQuery
+	var err error
+
+	if v := r.Form.Get("since_id"); v != "" {
+		if q.SinceID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, errors.New("invalid since_id")
+		}
+	}
+
+	if v := r.Form.Get("max_id"); v != "" {
+		if q.MaxID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, errors.New("invalid max_id")
+		}
+	}
+
+	if v := r.Form.Get("with_ids"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return q, errors.New("invalid with_ids")
+			}
+			q.WithIDs = append(q.WithIDs, id)
+		}
+	}
+	return q, nil
+}
+
+func writeFever(w http.ResponseWriter, res map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func feverErrorStatus(err error) int {
+	switch {
+	case repository.IsItemNotFound(err), repository.IsNotFound(err), errors.Is(err, repository.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidMark):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// feverClient replays the requests of a Fever client, Reeder posts api_key as a form
+// and asks for data through the query string.
+type feverClient struct {
+	t      *testing.T
+	router chi.Router
+	apiKey string
+}
+
+func newFeverTest(t *testing.T) (*feverClient, *gorm.DB) {
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	feverService := service.NewFeverService(feedService, folderService, repodb.NewGormNumberRepository(d))
+
+	r := chi.NewRouter()
+	NewFeverHandler(feverService, "reader", "secret").RegisterRoutes(r)
+
+	tech, golang := "tech", "golang"
+	pubDate := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	// 120 items, so that syncing takes 3 pages of 50
+	seedSyncItems(t, d, 120, []string{"hn", "go-blog", "xkcd"}, func(i int, item *db.Item) {
+		item.PubDate = pubDate.Add(time.Duration(i) * time.Minute)
+		item.IsRead = i <= 100
+		item.IsStarred = i == 7
+	})
+	d.Create(&db.Folder{ID: golang, Name: "Go", ParentID: &tech})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog", SiteURL: "http://example.com", FolderID: &golang})
+	d.Model(&db.Feed{ID: "hn"}).Update("last_fetch", time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC))
+	d.Model(&db.Feed{ID: "xkcd"}).Update("name", "Comics")
+
+	sum := md5.Sum([]byte("reader:secret"))
+	return &feverClient{t: t, router: r, apiKey: hex.EncodeToString(sum[:])}, d
+}
+
+// call posts the API key to /fever/?api&query and decodes the response.
+func (c *feverClient) call(query string, form url.Values) map[string]any {
+	c.t.Helper()
+
+	if form == nil {
+		form = url.Values{}
+	}
+	if form.Get("api_key") == "" {
+		form.Set("api_key", c.apiKey)
+	}
+
+	target := "/fever/?api"
+	if query != "" {
+		target += "&" + query
+	}
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, query, w.Code, w.Body.String())
+	}
+
+	var res map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		c.t.Fatalf("Failed to decode response: %v", err)
+	}
+	if res["api_version"] != float64(3) {
+		c.t.Errorf("Expected api_version 3, got %v", res["api_version"])
+	}
+	return res
+}
+
+// items returns the items of a response, by ID.
+func (c *feverClient) items(res map[string]any) []map[string]any {
+	c.t.Helper()
+
+	raw, ok := res["items"].([]any)
+	if !ok {
+		c.t.Fatalf("Expected items, got %v", res)
+	}
+	items := make([]map[string]any, len(raw))
+	for i, item := range raw {
+		items[i] = item.(map[string]any)
+	}
+	return items
+}
+
+func TestFeverAuth(t *testing.T) {
+	c, _ := newFeverTest(t)
+
+	for _, key := range []string{"wrong", strings.ToUpper(c.apiKey) + "0"} {
+		res := c.call("groups", url.Values{"api_key": {key}})
+		if res["auth"] != float64(0) || res["groups"] != nil {
+			t.Errorf("Expected no auth and no data with api_key %s, got %v", key, res)
+		}
+	}
+
+	// Unread sends the key uppercase
+	res := c.call("", url.Values{"api_key": {strings.ToUpper(c.apiKey)}})
+	if res["auth"] != float64(1) {
+		t.Errorf("Expected auth with an uppercase api_key, got %v", res)
+	}
+	if res["last_refreshed_on_time"] != float64(time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC).Unix()) {
+		t.Errorf("Expected the last fetch as last_refreshed_on_time, got %v", res["last_refreshed_on_time"])
+	}
+}
+
+func TestFeverSync(t *testing.T) {
+	c, _ := newFeverTest(t)
+
+	// Reeder's first sync: groups, feeds and favicons, then the ID lists and every item
+	groups := c.call("groups", nil)
+	groupIDs := map[string]float64{}
+	for _, g := range groups["groups"].([]any) {
+		g := g.(map[string]any)
+		groupIDs[g["title"].(string)] = g["id"].(float64)
+	}
+	if len(groupIDs) != 2 {
+		t.Fatalf("Expected the 2 folders as groups, got %v", groups["groups"])
+	}
+	if groups["feeds_groups"] == nil {
+		t.Errorf("Expected feeds_groups along groups")
+	}
+
+	feeds := c.call("feeds", nil)
+	feedIDs := map[string]float64{}
+	for _, f := range feeds["feeds"].([]any) {
+		f := f.(map[string]any)
+		feedIDs[f["title"].(string)] = f["id"].(float64)
+		if f["favicon_id"] != float64(1) {
+			t.Errorf("Expected every feed to have the default favicon, got %v", f)
+		}
+	}
+	if len(feedIDs) != 3 || feedIDs["Comics"] == 0 {
+		t.Fatalf("Expected the 3 feeds by name, got %v", feeds["feeds"])
+	}
+
+	// The feeds of the Go subfolder are also in the Tech group
+	expected := map[float64]string{
+		groupIDs["Tech"]: fmt.Sprintf("%v,%v", feedIDs["Hacker News"], feedIDs["The Go Blog"]),
+		groupIDs["Go"]:   fmt.Sprintf("%v", feedIDs["The Go Blog"]),
+	}
+	for _, fg := range feeds["feeds_groups"].([]any) {
+		fg := fg.(map[string]any)
+		if want := expected[fg["group_id"].(float64)]; fg["feed_ids"] != want {
+			t.Errorf("Expected group %v to have feeds %q, got %q", fg["group_id"], want, fg["feed_ids"])
+		}
+	}
+
+	favicons := c.call("favicons", nil)
+	if f := favicons["favicons"].([]any); len(f) != 1 || !strings.HasPrefix(f[0].(map[string]any)["data"].(string), "image/gif;base64,") {
+		t.Errorf("Expected the default favicon, got %v", f)
+	}
+
+	unread := strings.Split(c.call("unread_item_ids", nil)["unread_item_ids"].(string), ",")
+	if len(unread) != 20 {
+		t.Errorf("Expected 20 unread items, got %d", len(unread))
+	}
+	if saved := c.call("saved_item_ids", nil)["saved_item_ids"]; saved != "7" {
+		t.Errorf("Expected item 7 to be saved, got %v", saved)
+	}
+
+	var sinceID float64
+	var all []map[string]any
+	for page := 0; ; page++ {
+		res := c.call(fmt.Sprintf("items&since_id=%v", sinceID), nil)
+		items := c.items(res)
+		if len(items) == 0 {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("Expected the sync to end after 3 pages")
+		}
+		if res["total_items"] != float64(120) {
+			t.Errorf("Expected total_items 120, got %v", res["total_items"])
+		}
+		all = append(all, items...)
+		sinceID = items[len(items)-1]["id"].(float64)
+	}
+	if len(all) != 120 {
+		t.Fatalf("Expected to sync 120 items, got %d", len(all))
+	}
+
+	item := all[6]
+	if item["title"] != "Item 7" || item["is_saved"] != float64(1) || item["is_read"] != float64(1) || item["html"] != "Summary" ||
+		item["feed_id"] != feedIDs["The Go Blog"] || item["url"] != "http://example.com/go-blog/7" {
+		t.Errorf("Unexpected item %v", item)
+	}
+	if item["created_on_time"] != float64(time.Date(2024, 11, 1, 0, 7, 0, 0, time.UTC).Unix()) {
+		t.Errorf("Expected the publication date as created_on_time, got %v", item["created_on_time"])
+	}
+
+	// Going back from the newest item, as ReadKit does
+	older := c.items(c.call(fmt.Sprintf("items&max_id=%v", all[119]["id"]), nil))
+	if len(older) != 50 || older[0]["title"] != "Item 119" {
+		t.Errorf("Expected the 50 items before the newest one, newest first, got %d from %v", len(older), older[0]["title"])
+	}
+
+	// Fetching the unread items by ID
+	withIDs := c.items(c.call("items&with_ids="+strings.Join(unread[:3], ","), nil))
+	if len(withIDs) != 3 || withIDs[0]["is_read"] != float64(0) {
+		t.Errorf("Expected the 3 unread items asked for, got %v", withIDs)
+	}
+
+	if links := c.call("links", nil)["links"]; links == nil || len(links.([]any)) != 0 {
+		t.Errorf("Expected no links, got %v", links)
+	}
+}
+
+func TestFeverMarks(t *testing.T) {
+	c, d := newFeverTest(t)
+
+	itemID := func(id string) string {
+		return fmt.Sprint(itemNumber(t, d, id))
+	}
+	status := func(id string) db.Item {
+		var item db.Item
+		d.First(&item, "id = ?", id)
+		return item
+	}
+
+	c.call("", url.Values{"mark": {"item"}, "as": {"read"}, "id": {itemID("item-101")}})
+	c.call("", url.Values{"mark": {"item"}, "as": {"unread"}, "id": {itemID("item-1")}})
+	c.call("", url.Values{"mark": {"item"}, "as": {"saved"}, "id": {itemID("item-102")}})
+	c.call("", url.Values{"mark": {"item"}, "as": {"unsaved"}, "id": {itemID("item-7")}})
+	if !status("item-101").IsRead || status("item-1").IsRead || !status("item-102").IsStarred || status("item-7").IsStarred {
+		t.Errorf("Expected the item marks to be applied")
+	}
+
+	// Marks can be sent along requests for the new state
+	res := c.call("unread_item_ids&saved_item_ids", url.Values{"mark": {"item"}, "as": {"read"}, "id": {itemID("item-1")}})
+	if unread := strings.Split(res["unread_item_ids"].(string), ","); len(unread) != 19 {
+		t.Errorf("Expected 19 unread items after marking, got %d", len(unread))
+	}
+	if res["saved_item_ids"] != itemID("item-102") {
+		t.Errorf("Expected item 102 to be the only saved item, got %v", res["saved_item_ids"])
+	}
+
+	var feeds []map[string]any
+	for _, f := range c.call("feeds", nil)["feeds"].([]any) {
+		feeds = append(feeds, f.(map[string]any))
+	}
+	feverID := func(title string) string {
+		for _, f := range feeds {
+			if f["title"] == title {
+				return fmt.Sprint(f["id"])
+			}
+		}
+		t.Fatalf("No feed %s", title)
+		return ""
+	}
+
+	// Items of xkcd (i%3 == 2) published after item 110 stay unread
+	before := time.Date(2024, 11, 1, 1, 50, 0, 0, time.UTC).Unix()
+	c.call("", url.Values{"mark": {"feed"}, "as": {"read"}, "id": {feverID("Comics")}, "before": {fmt.Sprint(before)}})
+	if !status("item-104").IsRead || status("item-113").IsRead || status("item-103").IsRead {
+		t.Errorf("Expected the xkcd items before 110 to be read and the others untouched")
+	}
+
+	var groupID string
+	for _, g := range c.call("groups", nil)["groups"].([]any) {
+		if g := g.(map[string]any); g["title"] == "Tech" {
+			groupID = fmt.Sprint(g["id"])
+		}
+	}
+	c.call("", url.Values{"mark": {"group"}, "as": {"read"}, "id": {groupID}, "before": {fmt.Sprint(time.Now().Unix())}})
+	if !status("item-103").IsRead || !status("item-106").IsRead || status("item-113").IsRead {
+		t.Errorf("Expected the items of the Tech group and its subfolder to be read")
+	}
+
+	// Group 0 is everything
+	c.call("", url.Values{"mark": {"group"}, "as": {"read"}, "id": {"0"}, "before": {fmt.Sprint(time.Now().Unix())}})
+	if unread := c.call("unread_item_ids", nil)["unread_item_ids"]; unread != "" {
+		t.Errorf("Expected no unread items, got %v", unread)
+	}
+
+	for _, form := range []url.Values{
+		{"mark": {"feed"}, "as": {"saved"}, "id": {feverID("Comics")}},
+		{"mark": {"item"}, "as": {"read"}, "id": {"abc"}},
+	} {
+		form.Set("api_key", c.apiKey)
+		req := httptest.NewRequest(http.MethodPost, "/fever/?api", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		c.router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusBadRequest, form, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/fever/?api", strings.NewReader(url.Values{
+		"api_key": {c.apiKey}, "mark": {"item"}, "as": {"read"}, "id": {"9999"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown item, got %d", http.StatusNotFound, w.Code)
+	}
+}
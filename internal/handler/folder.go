@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type FolderHandler struct {
+	folderService service.FolderService
+}
+
+func NewFolderHandler(folderService service.FolderService) *FolderHandler {
+	return &FolderHandler{
+		folderService: folderService,
+	}
+}
+
+func (h *FolderHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/folders", h.ListFolders)
+	r.Post("/folders", h.CreateFolder)
+	r.Get("/folders/{id}", h.GetFolder)
+	r.Put("/folders/{id}", h.UpdateFolder)
+	r.Delete("/folders/{id}", h.DeleteFolder)
+	r.Put("/feeds/{id}/folder", h.SetFeedFolder)
+}
+
+type folderRequest struct {
+	ParentID *string `json:"parent_id"`
+	Name     string  `json:"name"`
+}
+
+func (h *FolderHandler) ListFolders(w http.ResponseWriter, r *http.Request) {
+	folders, err := h.folderService.ListFolders(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(folders)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req folderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.folderService.CreateFolder(r.Context(), req.Name, req.ParentID)
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *FolderHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	folder, err := h.folderService.GetFolder(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req folderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.folderService.UpdateFolder(r.Context(), id, req.Name, req.ParentID)
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.folderService.DeleteFolder(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetFeedFolder moves a feed into the folder given as {"folder_id": "..."}, or out of any folder with null.
+func (h *FolderHandler) SetFeedFolder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		FolderID *string `json:"folder_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.folderService.SetFeedFolder(r.Context(), id, req.FolderID); err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// folderErrorStatus maps errors of the folder operations to their HTTP status code.
+func folderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrFolderNotFound), repository.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidFolderName), errors.Is(err, service.ErrFolderTooDeep):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
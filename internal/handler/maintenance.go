@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MaintenanceHandler struct {
+	retentionService service.RetentionService
+}
+
+func NewMaintenanceHandler(retentionService service.RetentionService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		retentionService: retentionService,
+	}
+}
+
+func (h *MaintenanceHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/maintenance/purge", h.PurgePreview)
+	r.Post("/maintenance/purge", h.Purge)
+}
+
+// PurgePreview reports what a purge would delete, it never deletes anything.
+func (h *MaintenanceHandler) PurgePreview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("dry_run") != "1" {
+		http.Error(w, "only dry_run=1 is supported, use POST to purge", http.StatusBadRequest)
+		return
+	}
+
+	h.purge(w, r, true)
+}
+
+func (h *MaintenanceHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	h.purge(w, r, r.URL.Query().Get("dry_run") == "1")
+}
+
+func (h *MaintenanceHandler) purge(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	report, err := h.retentionService.Purge(r.Context(), dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
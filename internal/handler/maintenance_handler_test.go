@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"llrss/internal/text"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func setupMaintenanceHandler(t *testing.T) (*chi.Mux, *gorm.DB) {
+	t.Helper()
+
+	d := newTestDB(t)
+	maxItems, readDays := 0, 30
+
+	retentionService := service.NewRetentionService(
+		repodb.NewGormFeedRepository(d),
+		repodb.NewGormRetentionRepository(d),
+		db.RetentionPolicy{MaxItems: &maxItems, ReadDays: &readDays},
+	)
+
+	r := chi.NewRouter()
+	NewMaintenanceHandler(retentionService).RegisterRoutes(r)
+
+	// "capped" keeps its 2 newest items, "default" drops read items older than 30 days
+	keep := 2
+	feeds := []db.Feed{
+		{ID: "capped", URL: "http://example.com/capped", Title: "Capped", Retention: db.RetentionPolicy{MaxItems: &keep}},
+		{ID: "default", URL: "http://example.com/default", Title: "Default"},
+	}
+	if err := d.Create(&feeds).Error; err != nil {
+		t.Fatalf("Failed to create feeds: %v", err)
+	}
+
+	now := time.Now()
+	var items []db.Item
+	for i := 0; i < 4; i++ {
+		items = append(items, db.Item{
+			ID:      fmt.Sprintf("capped-%d", i),
+			FeedID:  "capped",
+			Title:   fmt.Sprintf("Capped %d", i),
+			Link:    fmt.Sprintf("http://example.com/capped/%d", i),
+			PubDate: now.AddDate(0, 0, -i),
+		})
+	}
+	items = append(items,
+		db.Item{ID: "old-read", FeedID: "default", Title: "Old read", Link: "http://example.com/1", PubDate: now.AddDate(0, 0, -60), IsRead: true},
+		db.Item{ID: "old-unread", FeedID: "default", Title: "Old unread", Link: "http://example.com/2", PubDate: now.AddDate(0, 0, -60)},
+		db.Item{ID: "new-read", FeedID: "default", Title: "New read", Link: "http://example.com/3", PubDate: now.AddDate(0, 0, -1), IsRead: true},
+		db.Item{ID: "old-starred", FeedID: "default", Title: "Old starred", Link: "http://example.com/4", PubDate: now.AddDate(0, 0, -60), IsRead: true, IsStarred: true},
+	)
+	if err := d.Create(&items).Error; err != nil {
+		t.Fatalf("Failed to create items: %v", err)
+	}
+
+	return r, d
+}
+
+func TestPurgeDryRun(t *testing.T) {
+	r, d := setupMaintenanceHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/maintenance/purge?dry_run=1", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var report models.PurgeReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if !report.DryRun || report.Total != 3 {
+		t.Errorf("Expected a dry run of 3 items, got %+v", report)
+	}
+
+	purged := map[string]bool{}
+	for _, f := range report.Feeds {
+		for _, item := range f.Items {
+			purged[item.ID] = true
+		}
+	}
+	for _, id := range []string{"capped-2", "capped-3", "old-read"} {
+		if !purged[id] {
+			t.Errorf("Expected %s to be reported", id)
+		}
+	}
+
+	var count int64
+	d.Model(&db.Item{}).Count(&count)
+	if count != 8 {
+		t.Errorf("Expected nothing deleted on a dry run, got %d items left", count)
+	}
+}
+
+func TestPurgePreviewRequiresDryRun(t *testing.T) {
+	r, _ := setupMaintenanceHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/maintenance/purge", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	r, d := setupMaintenanceHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/maintenance/purge", nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var left []string
+	d.Model(&db.Item{}).Order("id").Pluck("id", &left)
+
+	expected := []string{"capped-0", "capped-1", "new-read", "old-starred", "old-unread"}
+	if fmt.Sprint(left) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v left, got %v", expected, left)
+	}
+}
+
+func TestPurgedItemsNotSavedAgain(t *testing.T) {
+	r, d := setupMaintenanceHandler(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	ctx := context.Background()
+
+	keep := 2
+	feed := db.Feed{ID: "refreshed", URL: "http://example.com/refreshed", Title: "Refreshed", Retention: db.RetentionPolicy{MaxItems: &keep}}
+	if err := d.Create(&feed).Error; err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+	now := time.Now()
+	var upstream []db.Item
+	for i := 0; i < 5; i++ {
+		upstream = append(upstream, db.Item{
+			Title:   fmt.Sprintf("Refreshed %d", i),
+			Link:    fmt.Sprintf("http://example.com/refreshed/%d", i),
+			PubDate: now.AddDate(0, 0, -i),
+		})
+	}
+	if _, err := feedRepo.SaveFeedItems(ctx, feed.ID, upstream); err != nil {
+		t.Fatalf("Failed to save items: %v", err)
+	}
+	d.Model(&db.Item{}).Where("feed_id = ?", feed.ID).Update("is_read", true)
+
+	req := httptest.NewRequest(http.MethodPost, "/maintenance/purge", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// The next refresh still has the purged items
+	added, err := feedRepo.SaveFeedItems(ctx, feed.ID, upstream)
+	if err != nil {
+		t.Fatalf("Failed to save items: %v", err)
+	}
+	if len(added) != 0 {
+		t.Errorf("Expected the purged items not saved again, got %+v", added)
+	}
+	var unread int64
+	d.Model(&db.Item{}).Where("feed_id = ? AND is_read = ?", feed.ID, false).Count(&unread)
+	if unread != 0 {
+		t.Errorf("Expected no unread items, got %d", unread)
+	}
+
+	// Once they've left the feed they're forgotten
+	if err := feedRepo.PruneDeletedItems(ctx, feed.ID, upstream[:3]); err != nil {
+		t.Fatalf("Failed to prune deleted items: %v", err)
+	}
+	var deleted []string
+	d.Model(&db.DeletedItem{}).Where("feed_id = ?", feed.ID).Pluck("id", &deleted)
+	if len(deleted) != 1 || deleted[0] != text.URLToID(upstream[2].Link) {
+		t.Errorf("Expected only the purged item still in the feed remembered, got %v", deleted)
+	}
+}
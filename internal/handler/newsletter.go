@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type NewsletterHandler struct {
+	newsletterService service.NewsletterService
+}
+
+func NewNewsletterHandler(newsletterService service.NewsletterService) *NewsletterHandler {
+	return &NewsletterHandler{
+		newsletterService: newsletterService,
+	}
+}
+
+func (h *NewsletterHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/newsletters", h.ListNewsletters)
+	r.Post("/newsletters", h.CreateNewsletter)
+}
+
+func (h *NewsletterHandler) ListNewsletters(w http.ResponseWriter, r *http.Request) {
+	newsletters, err := h.newsletterService.ListNewsletters(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(newsletters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CreateNewsletter creates a newsletter feed, and returns the address to subscribe to newsletters with.
+func (h *NewsletterHandler) CreateNewsletter(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newsletter, err := h.newsletterService.CreateNewsletter(r.Context(), req.Title)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidNewsletterTitle) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(newsletter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"llrss/internal/events"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"llrss/internal/smtpd"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const newsletterMessage = "From: =?utf-8?q?Caf=C3=A9_Weekly?= <news@cafe.example.com>\r\n" +
+	"To: you\r\n" +
+	"Subject: =?utf-8?q?Issue_42=3A_na=C3=AFve_beans?=\r\n" +
+	"Date: Mon, 04 Mar 2024 08:30:00 +0100\r\n" +
+	"Message-ID: <issue-42@cafe.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"This week: na=EFve beans.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PGgxPlRoaXMgd2VlazwvaDE+PHA+bmHDr3ZlIGJlYW5zPC9wPg==\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Disposition: attachment; filename=ad.html\r\n" +
+	"\r\n" +
+	"<p>An attachment</p>\r\n" +
+	"--outer--\r\n"
+
+func TestNewsletters(t *testing.T) {
+	d := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := events.NewBus()
+	feedRepo := events.NewFeedRepository(repodb.NewGormFeedRepository(d), bus)
+	newsletterService := service.NewNewsletterService(feedRepo, "news.example.com")
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewNewsletterHandler(newsletterService).RegisterRoutes(r)
+	})
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		json.NewEncoder(&b).Encode(body)
+		req := httptest.NewRequest(method, path, &b)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Mail is received on a local socket, as a mail server would pass it over LMTP
+	socket := filepath.Join(t.TempDir(), "lmtp.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go (&smtpd.Server{Hostname: "news.example.com", Handler: newsletterService}).Serve(ctx, ln)
+
+	if w := request(http.MethodPost, "/api/v1/newsletters", map[string]string{"title": "  "}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	w := request(http.MethodPost, "/api/v1/newsletters", map[string]string{"title": "Café Weekly!"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var newsletter models.Newsletter
+	json.NewDecoder(w.Body).Decode(&newsletter)
+	if !strings.HasPrefix(newsletter.Address, "cafe-weekly.") || !strings.HasSuffix(newsletter.Address, "@news.example.com") {
+		t.Errorf("Expected an address made from the title, got %q", newsletter.Address)
+	}
+
+	var list []models.Newsletter
+	json.NewDecoder(request(http.MethodGet, "/api/v1/newsletters", nil).Body).Decode(&list)
+	if len(list) != 1 || list[0] != newsletter {
+		t.Errorf("Expected the newsletter listed, got %+v", list)
+	}
+
+	sub, _ := bus.Subscribe(0, nil)
+	conn, err := textproto.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	lmtp := func(code int, line string) {
+		t.Helper()
+		if line != "" {
+			conn.PrintfLine("%s", line)
+		}
+		if _, msg, err := conn.ReadResponse(code); err != nil {
+			t.Fatalf("Expected %d after %q, got %v %s", code, line, err, msg)
+		}
+	}
+	lmtp(220, "")
+	lmtp(250, "LHLO mx.example.com")
+	lmtp(250, "MAIL FROM:<news@cafe.example.com>")
+	lmtp(550, "RCPT TO:<unknown@news.example.com>")
+	lmtp(550, "RCPT TO:<"+strings.Split(newsletter.Address, "@")[0]+"@elsewhere.com>")
+	lmtp(250, "RCPT TO:<"+strings.ToUpper(newsletter.Address)+">")
+	lmtp(354, "DATA")
+	lmtp(250, newsletterMessage+".")
+	lmtp(221, "QUIT")
+
+	var items []db.Item
+	d.Find(&items, "feed_id = ?", newsletter.FeedID)
+	if len(items) != 1 {
+		t.Fatalf("Expected the newsletter saved as an item, got %+v", items)
+	}
+	item := items[0]
+	if item.Title != "Issue 42: naïve beans" || item.Author != "Café Weekly" || item.Link != "mid:issue-42@cafe.example.com" {
+		t.Errorf("Expected the headers decoded, got %+v", item)
+	}
+	if !item.PubDate.Equal(time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected the date of the message, got %v", item.PubDate)
+	}
+	if item.Content != "<h1>This week</h1><p>naïve beans</p>" || item.Description != "This week: naïve beans." {
+		t.Errorf("Expected the HTML and text parts without the attachment, got %q and %q", item.Content, item.Description)
+	}
+	if e := <-sub.C; e.Type != events.ItemsAdded || e.FeedID != newsletter.FeedID {
+		t.Errorf("Expected the item published, got %+v", e)
+	}
+
+	// Plain SMTP works too, and messages without parts are text
+	plain := "Subject: Hello\r\nMessage-ID: <hello@cafe.example.com>\r\n\r\nFirst line\r\nsecond <line>\r\n\r\nBye\r\n"
+	smtpConn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	client, err := smtp.NewClient(smtpConn, "news.example.com")
+	if err != nil {
+		t.Fatalf("Failed to start SMTP: %v", err)
+	}
+	defer client.Close()
+	if err := client.Mail("news@cafe.example.com"); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	if err := client.Rcpt(newsletter.Address); err != nil {
+		t.Fatalf("RCPT failed: %v", err)
+	}
+	wc, _ := client.Data()
+	wc.Write([]byte(plain))
+	if err := wc.Close(); err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+
+	var hello db.Item
+	d.First(&hello, "link = ?", "mid:hello@cafe.example.com")
+	if hello.Content != "<p>First line<br>second &lt;line&gt;</p>\n<p>Bye</p>\n" || hello.Author != "" {
+		t.Errorf("Expected the text as HTML paragraphs, got %+v", hello)
+	}
+}
+
+// editingFeedRepository runs edit before saving items, like a user editing the feed meanwhile.
+type editingFeedRepository struct {
+	repository.FeedRepository
+	edit func()
+}
+
+func (r *editingFeedRepository) SaveFeedItems(ctx context.Context, feedID string, items []db.Item) ([]db.Item, error) {
+	r.edit()
+	return r.FeedRepository.SaveFeedItems(ctx, feedID, items)
+}
+
+func TestNewsletterKeepsChanges(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	tech := "tech"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+
+	var feedID string
+	feedRepo := &editingFeedRepository{FeedRepository: repodb.NewGormFeedRepository(d), edit: func() {
+		d.Model(&db.Feed{}).Where("id = ?", feedID).Updates(map[string]any{"name": "Coffee", "folder_id": tech})
+	}}
+	newsletterService := service.NewNewsletterService(feedRepo, "news.example.com")
+
+	newsletter, err := newsletterService.CreateNewsletter(ctx, "Café Weekly")
+	if err != nil {
+		t.Fatalf("Failed to create the newsletter: %v", err)
+	}
+	feedID = newsletter.FeedID
+
+	// The feed is renamed and moved while the message is delivered
+	if err := newsletterService.Deliver(ctx, newsletter.Address, []byte(newsletterMessage)); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	var feed db.Feed
+	d.First(&feed, "id = ?", feedID)
+	if feed.LastFetch.IsZero() || feed.Name != "Coffee" || feed.FolderID == nil || *feed.FolderID != tech {
+		t.Errorf("Expected the delivery time set and the changes made meanwhile kept, got %+v", feed)
+	}
+}
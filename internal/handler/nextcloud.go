@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"llrss/internal/models/nextcloud"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// NextcloudHandler serves the Nextcloud News API v1-3, authenticated with basic auth.
+// Actions are PUT requests in the specification, some clients POST them.
+type NextcloudHandler struct {
+	nextcloudService service.NextcloudService
+	username         string
+	password         string
+}
+
+func NewNextcloudHandler(nextcloudService service.NextcloudService, username, password string) *NextcloudHandler {
+	return &NextcloudHandler{
+		nextcloudService: nextcloudService,
+		username:         username,
+		password:         password,
+	}
+}
+
+func (h *NextcloudHandler) RegisterRoutes(r chi.Router) {
+	// Clients discover the API version before logging in
+	r.Get("/index.php/apps/news/api", h.Versions)
+
+	r.Route("/index.php/apps/news/api/v1-3", func(r chi.Router) {
+		r.Use(h.authenticate)
+		action := func(pattern string, fn http.HandlerFunc) {
+			r.Put(pattern, fn)
+			r.Post(pattern, fn)
+		}
+
+		r.Get("/version", h.Version)
+		r.Get("/status", h.Status)
+		r.Get("/user", h.User)
+
+		r.Get("/folders", h.Folders)
+		r.Post("/folders", h.CreateFolder)
+		r.Delete("/folders/{id}", h.DeleteFolder)
+		action("/folders/{id}", h.RenameFolder)
+		action("/folders/{id}/read", h.MarkFolderRead)
+
+		r.Get("/feeds", h.Feeds)
+		r.Post("/feeds", h.CreateFeed)
+		r.Delete("/feeds/{id}", h.DeleteFeed)
+		action("/feeds/{id}/move", h.MoveFeed)
+		action("/feeds/{id}/rename", h.RenameFeed)
+		action("/feeds/{id}/read", h.MarkFeedRead)
+
+		r.Get("/items", h.Items)
+		r.Get("/items/updated", h.UpdatedItems)
+		action("/items/read", h.MarkAllRead)
+		action("/items/{id}/read", h.markItem(true))
+		action("/items/{id}/unread", h.markItem(false))
+		action("/items/{id}/star", h.starItem(true))
+		action("/items/{id}/unstar", h.starItem(false))
+		action("/items/read/multiple", h.markItems(true))
+		action("/items/unread/multiple", h.markItems(false))
+		action("/items/star/multiple", h.starItems(true))
+		action("/items/unstar/multiple", h.starItems(false))
+	})
+}
+
+func (h *NextcloudHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		user := subtle.ConstantTimeCompare([]byte(username), []byte(h.username))
+		pass := subtle.ConstantTimeCompare([]byte(password), []byte(h.password))
+		if !ok || user&pass != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="llrss"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *NextcloudHandler) Versions(w http.ResponseWriter, _ *http.Request) {
+	writeNextcloud(w, map[string][]string{"apiLevels": {"v1-3"}})
+}
+
+func (h *NextcloudHandler) Version(w http.ResponseWriter, _ *http.Request) {
+	writeNextcloud(w, nextcloud.Version{Version: service.NextcloudVersion})
+}
+
+func (h *NextcloudHandler) Status(w http.ResponseWriter, _ *http.Request) {
+	writeNextcloud(w, nextcloud.Status{Version: service.NextcloudVersion})
+}
+
+func (h *NextcloudHandler) User(w http.ResponseWriter, _ *http.Request) {
+	writeNextcloud(w, nextcloud.User{UserID: h.username, DisplayName: h.username})
+}
+
+func (h *NextcloudHandler) Folders(w http.ResponseWriter, r *http.Request) {
+	folders, err := h.nextcloudService.Folders(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, folders)
+}
+
+func (h *NextcloudHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	folders, err := h.nextcloudService.CreateFolder(r.Context(), req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, folders)
+}
+
+func (h *NextcloudHandler) RenameFolder(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.nextcloudService.RenameFolder(r.Context(), id, req.Name); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.nextcloudService.DeleteFolder(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) MarkFolderRead(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	newest, ok := newestItemID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.nextcloudService.MarkFolderRead(r.Context(), id, newest); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) Feeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := h.nextcloudService.Feeds(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, feeds)
+}
+
+// CreateFeed subscribes to url in the folder folderId, null or 0 for the root.
+func (h *NextcloudHandler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL      string `json:"url"`
+		FolderID *int64 `json:"folderId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	var folderID int64
+	if req.FolderID != nil {
+		folderID = *req.FolderID
+	}
+
+	feeds, err := h.nextcloudService.CreateFeed(r.Context(), req.URL, folderID)
+	if err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, feeds)
+}
+
+func (h *NextcloudHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.nextcloudService.DeleteFeed(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) MoveFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FolderID *int64 `json:"folderId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var folderID int64
+	if req.FolderID != nil {
+		folderID = *req.FolderID
+	}
+
+	if err := h.nextcloudService.MoveFeed(r.Context(), id, folderID); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) RenameFeed(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FeedTitle string `json:"feedTitle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.nextcloudService.RenameFeed(r.Context(), id, req.FeedTitle); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) MarkFeedRead(w http.ResponseWriter, r *http.Request) {
+	id, ok := nextcloudID(w, r)
+	if !ok {
+		return
+	}
+
+	newest, ok := newestItemID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.nextcloudService.MarkFeedRead(r.Context(), id, newest); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+// Items serves a page of items, given type, id, batchSize, offset, getRead and oldestFirst.
+func (h *NextcloudHandler) Items(w http.ResponseWriter, r *http.Request) {
+	q, err := parseNextcloudItemQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.items(w, r, q)
+}
+
+// UpdatedItems serves the items of type and id changed since lastModified, read or not.
+func (h *NextcloudHandler) UpdatedItems(w http.ResponseWriter, r *http.Request) {
+	q, err := parseNextcloudItemQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastModified, err := strconv.ParseInt(r.URL.Query().Get("lastModified"), 10, 64)
+	if err != nil || lastModified < 0 {
+		http.Error(w, "invalid lastModified", http.StatusBadRequest)
+		return
+	}
+
+	// Clients give it in seconds, milliseconds or microseconds
+	switch {
+	case lastModified > 1e14:
+		lastModified /= 1e6
+	case lastModified > 1e11:
+		lastModified /= 1e3
+	}
+	// An item modified in the same second as the last sync is returned again rather than missed
+	q.LastModified = max(lastModified, 1)
+	q.BatchSize = -1
+	q.Offset = 0
+	h.items(w, r, q)
+}
+
+func (h *NextcloudHandler) items(w http.ResponseWriter, r *http.Request, q nextcloud.ItemQuery) {
+	items, err := h.nextcloudService.Items(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, items)
+}
+
+func (h *NextcloudHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	newest, ok := newestItemID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.nextcloudService.MarkAllRead(r.Context(), newest); err != nil {
+		http.Error(w, err.Error(), nextcloudErrorStatus(err))
+		return
+	}
+	writeNextcloud(w, struct{}{})
+}
+
+func (h *NextcloudHandler) markItem(read bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := nextcloudID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.nextcloudService.MarkItems(r.Context(), []int64{id}, read); err != nil {
+			http.Error(w, err.Error(), nextcloudErrorStatus(err))
+			return
+		}
+		writeNextcloud(w, struct{}{})
+	}
+}
+
+func (h *NextcloudHandler) starItem(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := nextcloudID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.nextcloudService.StarItems(r.Context(), []int64{id}, starred); err != nil {
+			http.Error(w, err.Error(), nextcloudErrorStatus(err))
+			return
+		}
+		writeNextcloud(w, struct{}{})
+	}
+}
+
+func (h *NextcloudHandler) markItems(read bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, ok := nextcloudItemIDs(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.nextcloudService.MarkItems(r.Context(), ids, read); err != nil {
+			http.Error(w, err.Error(), nextcloudErrorStatus(err))
+			return
+		}
+		writeNextcloud(w, struct{}{})
+	}
+}
+
+func (h *NextcloudHandler) starItems(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, ok := nextcloudItemIDs(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.nextcloudService.StarItems(r.Context(), ids, starred); err != nil {
+			http.Error(w, err.Error(), nextcloudErrorStatus(err))
+			return
+		}
+		writeNextcloud(w, struct{}{})
+	}
+}
+
+// parseNextcloudItemQuery parses type and id, and the paging of batchSize (-1 for all), offset,
+// getRead and oldestFirst, with the defaults of Nextcloud.
+func parseNextcloudItemQuery(r *http.Request) (nextcloud.ItemQuery, error) {
+	query := r.URL.Query()
+	q := nextcloud.ItemQuery{Type: nextcloud.TypeAll, BatchSize: -1, GetRead: true}
+
+	ints := []struct {
+		name string
+		dst  *int64
+	}{{"id", &q.ID}, {"offset", &q.Offset}}
+	for _, p := range ints {
+		if v := query.Get(p.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = n
+		}
+	}
+
+	if v := query.Get("type"); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid type")
+		}
+		q.Type = t
+	}
+
+	if v := query.Get("batchSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid batchSize")
+		}
+		q.BatchSize = n
+	}
+
+	bools := []struct {
+		name string
+		dst  *bool
+	}{{"getRead", &q.GetRead}, {"oldestFirst", &q.OldestFirst}}
+	for _, p := range bools {
+		if v := query.Get(p.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = b
+		}
+	}
+	return q, nil
+}
+
+// nextcloudID parses the id path parameter, writing the error when it's invalid.
+func nextcloudID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// newestItemID parses the newestItemId of the body, writing the error when it's missing.
+func newestItemID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	var req struct {
+		NewestItemID int64 `json:"newestItemId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewestItemID <= 0 {
+		http.Error(w, "invalid newestItemId", http.StatusBadRequest)
+		return 0, false
+	}
+	return req.NewestItemID, true
+}
+
+// nextcloudItemIDs parses the itemIds of the body, writing the error when it's invalid.
+func nextcloudItemIDs(w http.ResponseWriter, r *http.Request) ([]int64, bool) {
+	var req struct {
+		ItemIDs []int64 `json:"itemIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid itemIds", http.StatusBadRequest)
+		return nil, false
+	}
+	return req.ItemIDs, true
+}
+
+func writeNextcloud(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// nextcloudErrorStatus follows Nextcloud: conflicts are 409, and invalid names or feeds that can't be fetched 422.
+func nextcloudErrorStatus(err error) int {
+	switch {
+	case repository.IsItemNotFound(err), repository.IsNotFound(err), errors.Is(err, repository.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrFolderExists), errors.Is(err, service.ErrFeedExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidFolderName), errors.Is(err, service.ErrUnreadableFeed):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrInvalidItemType):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
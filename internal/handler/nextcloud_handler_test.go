@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models/db"
+	"llrss/internal/models/nextcloud"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const nextcloudAPI = "/index.php/apps/news/api/v1-3"
+
+// nextcloudClient replays the requests of a Nextcloud News client like the Android app.
+type nextcloudClient struct {
+	t        *testing.T
+	router   chi.Router
+	password string
+}
+
+func newNextcloudTest(t *testing.T) (*nextcloudClient, *gorm.DB) {
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	nextcloudService := service.NewNextcloudService(feedService, folderService, repodb.NewGormNumberRepository(d))
+
+	r := chi.NewRouter()
+	NewNextcloudHandler(nextcloudService, "reader", "secret").RegisterRoutes(r)
+
+	seedSyncItems(t, d, 30, []string{"hn", "xkcd"}, func(i int, item *db.Item) {
+		item.IsStarred = i == 3
+	})
+	// Items were saved long before the client syncs
+	d.Exec("UPDATE items SET updated_at = ?", time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC).Unix())
+
+	return &nextcloudClient{t: t, router: r, password: "secret"}, d
+}
+
+func (c *nextcloudClient) do(method, path string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, nextcloudAPI+path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("reader", c.password)
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	return w
+}
+
+// call sends a request to the API, and decodes its JSON response into v.
+func (c *nextcloudClient) call(method, path string, body, v any) {
+	c.t.Helper()
+
+	w := c.do(method, path, body)
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("Expected status code %d for %s %s, got %d: %s", http.StatusOK, method, path, w.Code, w.Body.String())
+	}
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			c.t.Fatalf("Failed to decode response of %s: %v", path, err)
+		}
+	}
+}
+
+// nextcloudNumbers returns the item numbers by title.
+func nextcloudNumbers(items []nextcloud.Item) map[string]int64 {
+	numbers := make(map[string]int64, len(items))
+	for _, item := range items {
+		numbers[item.Title] = item.ID
+	}
+	return numbers
+}
+
+func TestNextcloudAuth(t *testing.T) {
+	c, _ := newNextcloudTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/index.php/apps/news/api", nil)
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("v1-3")) {
+		t.Errorf("Expected the API levels without authentication, got %d: %s", w.Code, w.Body.String())
+	}
+
+	c.password = "wrong"
+	if w := c.do(http.MethodGet, "/version", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for a wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	c.password = "secret"
+	var version nextcloud.Version
+	c.call(http.MethodGet, "/version", nil, &version)
+	if version.Version != service.NextcloudVersion {
+		t.Errorf("Expected version %s, got %+v", service.NextcloudVersion, version)
+	}
+
+	var user nextcloud.User
+	c.call(http.MethodGet, "/user", nil, &user)
+	if user.UserID != "reader" {
+		t.Errorf("Expected the user name, got %+v", user)
+	}
+}
+
+func TestNextcloudSync(t *testing.T) {
+	c, d := newNextcloudTest(t)
+
+	// The initial sync: folders, feeds, then the unread and starred items in pages
+	var folders nextcloud.Folders
+	c.call(http.MethodGet, "/folders", nil, &folders)
+	if len(folders.Folders) != 1 || folders.Folders[0].Name != "Tech" || folders.Folders[0].ID == 0 {
+		t.Fatalf("Expected the Tech folder, got %+v", folders)
+	}
+	techID := folders.Folders[0].ID
+
+	var feeds nextcloud.Feeds
+	c.call(http.MethodGet, "/feeds", nil, &feeds)
+	if len(feeds.Feeds) != 2 || feeds.StarredCount != 1 || feeds.NewestItemID == 0 {
+		t.Fatalf("Expected 2 feeds, 1 starred item and the newest item, got %+v", feeds)
+	}
+	var hn nextcloud.Feed
+	for _, f := range feeds.Feeds {
+		if f.URL == "http://example.com/hn" {
+			hn = f
+		} else if f.FolderID != 0 || f.UnreadCount != 10 {
+			t.Errorf("Expected xkcd at the root with 10 unread items, got %+v", f)
+		}
+	}
+	if hn.FolderID != techID || hn.UnreadCount != 10 || hn.Title != "Hacker News" || hn.Link != "http://news.example.com" {
+		t.Errorf("Expected hn in the Tech folder with 10 unread items, got %+v", hn)
+	}
+
+	var unread []nextcloud.Item
+	offset := int64(0)
+	for page := 0; ; page++ {
+		var items nextcloud.Items
+		c.call(http.MethodGet, fmt.Sprintf("/items?type=3&getRead=false&batchSize=8&offset=%d", offset), nil, &items)
+		if len(items.Items) == 0 {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("Expected the unread items in 3 pages")
+		}
+		unread = append(unread, items.Items...)
+		offset = items.Items[len(items.Items)-1].ID
+	}
+	if len(unread) != 20 || unread[0].Title != "Item 30" || unread[19].Title != "Item 11" {
+		t.Fatalf("Expected the 20 unread items newest first, got %d", len(unread))
+	}
+	if item := unread[0]; item.FeedID == 0 || item.Body != "Summary" || !item.Unread || item.GUIDHash != "item-30" || item.LastModified == 0 {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	var items nextcloud.Items
+	c.call(http.MethodGet, "/items?type=2&getRead=true&batchSize=-1", nil, &items)
+	if len(items.Items) != 1 || items.Items[0].Title != "Item 3" || !items.Items[0].Starred {
+		t.Errorf("Expected the starred item, got %+v", items.Items)
+	}
+
+	c.call(http.MethodGet, fmt.Sprintf("/items?type=0&id=%d&batchSize=2&oldestFirst=true", hn.ID), nil, &items)
+	if len(items.Items) != 2 || items.Items[0].Title != "Item 2" || items.Items[1].Title != "Item 4" {
+		t.Errorf("Expected the oldest items of hn, got %+v", items.Items)
+	}
+	c.call(http.MethodGet, fmt.Sprintf("/items?type=1&id=%d&getRead=false&batchSize=-1", techID), nil, &items)
+	if len(items.Items) != 10 {
+		t.Errorf("Expected the 10 unread items of the Tech folder, got %d", len(items.Items))
+	}
+
+	// Later syncs only get the items changed since, read or not
+	lastSync := time.Now().Add(-time.Second).Unix()
+	var item db.Item
+	d.First(&item, "id = ?", "item-5")
+	item.IsRead = false
+	d.Save(&item)
+
+	c.call(http.MethodGet, fmt.Sprintf("/items/updated?type=3&lastModified=%d", lastSync*1000), nil, &items)
+	if len(items.Items) != 1 || items.Items[0].Title != "Item 5" || !items.Items[0].Unread {
+		t.Errorf("Expected the item marked unread since the last sync, got %+v", items.Items)
+	}
+
+	if w := c.do(http.MethodGet, "/items?type=7", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown type, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := c.do(http.MethodGet, "/items?type=0&id=999", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown feed, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestNextcloudEdits(t *testing.T) {
+	c, d := newNextcloudTest(t)
+
+	status := func(id string) db.Item {
+		var item db.Item
+		d.First(&item, "id = ?", id)
+		return item
+	}
+
+	var items nextcloud.Items
+	c.call(http.MethodGet, "/items?type=3&batchSize=-1", nil, &items)
+	numbers := nextcloudNumbers(items.Items)
+
+	c.call(http.MethodPut, "/items/read/multiple", map[string]any{"itemIds": []int64{numbers["Item 11"], numbers["Item 12"]}}, nil)
+	c.call(http.MethodPost, "/items/star/multiple", map[string]any{"itemIds": []int64{numbers["Item 11"], 9999}}, nil)
+	c.call(http.MethodPut, fmt.Sprintf("/items/%d/unread", numbers["Item 1"]), nil, nil)
+	c.call(http.MethodPut, fmt.Sprintf("/items/%d/unstar", numbers["Item 3"]), nil, nil)
+
+	if item := status("item-11"); !item.IsRead || !item.IsStarred {
+		t.Errorf("Expected item 11 read and starred, got %+v", item)
+	}
+	if item := status("item-12"); !item.IsRead || item.IsStarred {
+		t.Errorf("Expected item 12 read only, got %+v", item)
+	}
+	if status("item-1").IsRead || status("item-3").IsStarred {
+		t.Errorf("Expected item 1 unread and item 3 unstarred")
+	}
+
+	var feeds nextcloud.Feeds
+	c.call(http.MethodGet, "/feeds", nil, &feeds)
+	var hn, xkcd nextcloud.Feed
+	for _, f := range feeds.Feeds {
+		if f.URL == "http://example.com/hn" {
+			hn = f
+		} else {
+			xkcd = f
+		}
+	}
+
+	// Items fetched after the client's newest one stay unread
+	c.call(http.MethodPut, fmt.Sprintf("/feeds/%d/read", hn.ID), map[string]any{"newestItemId": numbers["Item 20"]}, nil)
+	if !status("item-20").IsRead || status("item-22").IsRead || status("item-19").IsRead {
+		t.Errorf("Expected the items of hn up to item 20 to be read, and no others")
+	}
+
+	var folders nextcloud.Folders
+	c.call(http.MethodPost, "/folders", map[string]any{"name": "Fun"}, &folders)
+	if len(folders.Folders) != 1 || folders.Folders[0].Name != "Fun" {
+		t.Fatalf("Expected the new folder, got %+v", folders)
+	}
+	fun := folders.Folders[0].ID
+	if w := c.do(http.MethodPost, "/folders", map[string]any{"name": "fun"}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for an existing folder, got %d", http.StatusConflict, w.Code)
+	}
+	if w := c.do(http.MethodPost, "/folders", map[string]any{"name": " "}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for an empty name, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	c.call(http.MethodPut, fmt.Sprintf("/feeds/%d/move", xkcd.ID), map[string]any{"folderId": fun}, nil)
+	c.call(http.MethodPut, fmt.Sprintf("/feeds/%d/rename", xkcd.ID), map[string]any{"feedTitle": "Comics"}, nil)
+	c.call(http.MethodPut, fmt.Sprintf("/folders/%d", fun), map[string]any{"name": "Comics"}, nil)
+	c.call(http.MethodPut, fmt.Sprintf("/folders/%d/read", fun), map[string]any{"newestItemId": numbers["Item 30"]}, nil)
+
+	c.call(http.MethodGet, "/feeds", nil, &feeds)
+	for _, f := range feeds.Feeds {
+		if f.ID == xkcd.ID && (f.Title != "Comics" || f.FolderID != fun || f.UnreadCount != 0) {
+			t.Errorf("Expected xkcd renamed, read and moved to the Comics folder, got %+v", f)
+		}
+	}
+
+	c.call(http.MethodPut, fmt.Sprintf("/feeds/%d/move", hn.ID), map[string]any{"folderId": nil}, nil)
+	c.call(http.MethodDelete, fmt.Sprintf("/feeds/%d", xkcd.ID), nil, nil)
+	c.call(http.MethodDelete, fmt.Sprintf("/folders/%d", fun), nil, nil)
+	c.call(http.MethodGet, "/feeds", nil, &feeds)
+	if len(feeds.Feeds) != 1 || feeds.Feeds[0].FolderID != 0 {
+		t.Errorf("Expected hn at the root and xkcd gone, got %+v", feeds.Feeds)
+	}
+
+	c.call(http.MethodPut, "/items/read", map[string]any{"newestItemId": feeds.NewestItemID}, nil)
+	c.call(http.MethodGet, "/feeds", nil, &feeds)
+	if feeds.Feeds[0].UnreadCount != 0 {
+		t.Errorf("Expected every item read, got %+v", feeds.Feeds[0])
+	}
+
+	// The number of a deleted item doesn't cover the next one saved
+	d.Delete(&db.Item{}, "id = ?", "item-30")
+	d.Create(&db.Item{ID: "item-31", FeedID: "hn", Link: "http://example.com/hn/31", PubDate: time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC)})
+	c.call(http.MethodPut, "/items/read", map[string]any{"newestItemId": numbers["Item 30"]}, nil)
+	if status("item-31").IsRead {
+		t.Errorf("Expected item 31 saved after the client's newest item to stay unread")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+	<title>Go Blog</title>
+	<item><title>Go 1.24</title><link>http://example.com/go/1.24</link><pubDate>Tue, 05 Nov 2024 11:00:00 GMT</pubDate></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+
+	c.call(http.MethodPost, "/feeds", map[string]any{"url": srv.URL, "folderId": nil}, &feeds)
+	if len(feeds.Feeds) != 1 || feeds.Feeds[0].Title != "Go Blog" || feeds.Feeds[0].UnreadCount != 1 || feeds.NewestItemID == 0 {
+		t.Errorf("Expected the new feed with its item, got %+v", feeds)
+	}
+	if w := c.do(http.MethodPost, "/feeds", map[string]any{"url": srv.URL}); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for an existing feed, got %d", http.StatusConflict, w.Code)
+	}
+	if w := c.do(http.MethodPost, "/feeds", map[string]any{"url": srv.URL + "/missing"}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for a feed which can't be read, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
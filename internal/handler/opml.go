@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"llrss/internal/models"
+	"llrss/internal/opml"
+	"llrss/internal/service"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxOPMLSize caps the size of an uploaded OPML file.
+const maxOPMLSize = 5 << 20
+
+type OPMLHandler struct {
+	opmlService service.OPMLService
+}
+
+func NewOPMLHandler(opmlService service.OPMLService) *OPMLHandler {
+	return &OPMLHandler{
+		opmlService: opmlService,
+	}
+}
+
+func (h *OPMLHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/opml/import", h.Import)
+	r.Get("/opml/export", h.Export)
+}
+
+// Import accepts an OPML file either as the "file" field of a multipart form or as the raw request body.
+func (h *OPMLHandler) Import(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	report, err := h.opmlService.Import(r.Context(), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Export downloads the subscriptions as OPML, optionally only those of the folder
+// given as ?folder= and/or of the feeds given as repeated ?feed_id=.
+func (h *OPMLHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter := models.ExportFilter{
+		FolderID: r.URL.Query().Get("folder"),
+		FeedIDs:  r.URL.Query()["feed_id"],
+	}
+
+	doc, err := h.opmlService.Export(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), folderErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="llrss.opml"`)
+	if err := opml.Write(w, doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
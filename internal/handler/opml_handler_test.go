@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/opml"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"llrss/internal/text"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// newFeedServer serves a minimal RSS feed on every path but /broken.
+func newFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+	<title>Feed %[1]s</title>
+	<item><title>Item of %[1]s</title><link>http://example.com%[1]s/1</link><pubDate>Tue, 05 Nov 2024 11:00:00 GMT</pubDate></item>
+</channel></rss>`, r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func setupOPMLHandler(t *testing.T) (*chi.Mux, *gorm.DB) {
+	t.Helper()
+
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+
+	r := chi.NewRouter()
+	NewOPMLHandler(service.NewOPMLService(feedService, folderService)).RegisterRoutes(r)
+
+	return r, d
+}
+
+func TestImportOPML(t *testing.T) {
+	r, d := setupOPMLHandler(t)
+	feeds := newFeedServer(t)
+
+	// An existing subscription is reported but left where it is
+	existing := db.Feed{ID: text.URLToID(feeds.URL + "/existing"), URL: feeds.URL + "/existing", Title: "Existing"}
+	if err := d.Create(&existing).Error; err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+
+	doc := strings.ReplaceAll(`<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <body>
+    <outline text="Tech">
+      <outline text="Go">
+        <outline text="Go Blog" title="The Go Blog" xmlUrl="{{URL}}/go"/>
+        <outline text="Deep">
+          <outline text="Too deep" xmlUrl="{{URL}}/deep"/>
+        </outline>
+      </outline>
+      <outline text="Feed /hn" xmlUrl="{{URL}}/hn"/>
+      <outline text="Existing" xmlUrl="{{URL}}/existing"/>
+    </outline>
+    <outline text="Broken" xmlUrl="{{URL}}/broken"/>
+    <outline text="Invalid" xmlUrl="ftp://example.com/feed"/>
+    <outline text="Go Blog again" xmlUrl="{{URL}}/go"/>
+  </body>
+</opml>`, "{{URL}}", feeds.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/opml/import", strings.NewReader(doc))
+	req.Header.Set("Content-Type", "text/x-opml")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report models.ImportReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if report.Added != 3 || report.Existing != 2 || report.Failed != 2 {
+		t.Errorf("Expected 3 added, 2 existing, 2 failed, got %+v", report)
+	}
+
+	expected := []struct {
+		url    string
+		folder string
+		status string
+	}{
+		{"/go", "Tech/Go", models.OutlineAdded},
+		{"/deep", "Tech/Go", models.OutlineAdded},
+		{"/hn", "Tech", models.OutlineAdded},
+		{"/existing", "Tech", models.OutlineExists},
+		{"/broken", "", models.OutlineFailed},
+		{"ftp://example.com/feed", "", models.OutlineFailed},
+		{"/go", "", models.OutlineExists},
+	}
+	if len(report.Outlines) != len(expected) {
+		t.Fatalf("Expected %d outlines, got %d", len(expected), len(report.Outlines))
+	}
+	for i, e := range expected {
+		o := report.Outlines[i]
+		if !strings.HasSuffix(o.URL, e.url) || o.Folder != e.folder || o.Status != e.status {
+			t.Errorf("Outline %d: expected %s in %q %s, got %+v", i, e.url, e.folder, e.status, o)
+		}
+	}
+
+	var folders []db.Folder
+	d.Find(&folders)
+	byID := map[string]db.Folder{}
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+	if len(folders) != 2 {
+		t.Fatalf("Expected 2 folders, got %+v", folders)
+	}
+
+	var goBlog db.Feed
+	d.First(&goBlog, "url = ?", feeds.URL+"/go")
+	if goBlog.Name != "The Go Blog" {
+		t.Errorf("Expected the outline title as custom name, got %q", goBlog.Name)
+	}
+	if goBlog.FolderID == nil || byID[*goBlog.FolderID].Name != "Go" || byID[*goBlog.FolderID].ParentID == nil {
+		t.Errorf("Expected Go Blog in the Tech/Go folder, got %v", goBlog.FolderID)
+	}
+
+	var hn db.Feed
+	d.First(&hn, "url = ?", feeds.URL+"/hn")
+	if hn.Name != "" {
+		t.Errorf("Expected no custom name when it matches the title, got %q", hn.Name)
+	}
+
+	var items int64
+	d.Model(&db.Item{}).Count(&items)
+	if items != 3 {
+		t.Errorf("Expected the items of the 3 added feeds, got %d", items)
+	}
+
+	d.First(&existing, "id = ?", existing.ID)
+	if existing.FolderID != nil {
+		t.Error("Expected the existing feed not to be moved")
+	}
+}
+
+func TestImportOPMLMultipart(t *testing.T) {
+	r, d := setupOPMLHandler(t)
+	feeds := newFeedServer(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "subscriptions.opml")
+	fmt.Fprintf(fw, `<opml version="1.0"><body><outline text="One" xmlUrl="%s/one"/></body></opml>`, feeds.URL)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/opml/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var count int64
+	d.Model(&db.Feed{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 feed, got %d", count)
+	}
+}
+
+func TestImportOPMLPending(t *testing.T) {
+	r, d := setupOPMLHandler(t)
+	feeds := newFeedServer(t)
+
+	timeout := service.OPMLImportTimeout
+	service.OPMLImportTimeout = 50 * time.Millisecond
+	defer func() { service.OPMLImportTimeout = timeout }()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Slow</title></channel></rss>`)
+	}))
+	defer slow.Close()
+
+	// Names are only cut past MaxFolderNameLength bytes, without splitting runes
+	long := strings.Repeat("a", 40)
+	accented := strings.Repeat("é", 70)
+	doc := fmt.Sprintf(`<opml version="2.0"><body>
+		<outline text="%s"><outline text="Fast" xmlUrl="%s/fast"/></outline>
+		<outline text="%s"><outline text="Slow" xmlUrl="%s/slow"/></outline>
+	</body></opml>`, long, feeds.URL, accented, slow.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/opml/import", strings.NewReader(doc))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var report models.ImportReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Added != 1 || report.Pending != 1 || report.Outlines[1].Status != models.OutlinePending {
+		t.Errorf("Expected the slow feed pending, got %+v", report)
+	}
+	if report.Outlines[0].Folder != long || report.Outlines[1].Folder != strings.Repeat("é", service.MaxFolderNameLength/2) {
+		t.Errorf("Expected the folder names cut at %d bytes, got %q and %q", service.MaxFolderNameLength, report.Outlines[0].Folder, report.Outlines[1].Folder)
+	}
+
+	// The slow feed is still added after the import returns
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	var count int64
+	for count != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		d.Model(&db.Feed{}).Count(&count)
+	}
+	if count != 2 {
+		t.Errorf("Expected the pending feed added in the background, got %d feeds", count)
+	}
+}
+
+func TestImportOPMLInvalid(t *testing.T) {
+	r, _ := setupOPMLHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/opml/import", strings.NewReader("<html></html>"))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestExportOPML(t *testing.T) {
+	r, d := setupOPMLHandler(t)
+
+	tech := "tech"
+	golang := "golang"
+	d.Create(&[]db.Folder{{ID: tech, Name: "Tech"}, {ID: golang, Name: "Go", ParentID: &tech}, {ID: "empty", Name: "Empty"}})
+	d.Create(&[]db.Feed{
+		{ID: "hn", URL: "https://news.ycombinator.com/rss", SiteURL: "https://news.ycombinator.com/", Title: "Hacker News", Name: "HN", FolderID: &tech},
+		{ID: "go-blog", URL: "https://go.dev/blog/feed.atom", Title: "The Go Blog", FolderID: &golang},
+		{ID: "unfiled", URL: "https://example.com/feed", Title: "Example"},
+	})
+
+	export := func(query string) (*opml.OPML, int) {
+		req := httptest.NewRequest(http.MethodGet, "/opml/export"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			return nil, w.Code
+		}
+		doc, err := opml.Parse(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to parse export: %v", err)
+		}
+		return doc, w.Code
+	}
+
+	t.Run("all feeds", func(t *testing.T) {
+		doc, code := export("")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+		}
+		if doc.Version != "2.0" {
+			t.Errorf("Expected OPML 2.0, got %q", doc.Version)
+		}
+
+		outlines := doc.Body.Outlines
+		if len(outlines) != 2 || outlines[0].Text != "Tech" || outlines[1].XMLURL != "https://example.com/feed" {
+			t.Fatalf("Expected the Tech folder and the unfiled feed, got %+v", outlines)
+		}
+
+		tech := outlines[0].Outlines
+		if len(tech) != 2 || tech[0].Text != "Go" || tech[0].Outlines[0].Title != "The Go Blog" {
+			t.Fatalf("Expected the Go subfolder first in Tech, got %+v", tech)
+		}
+		hn := tech[1]
+		if hn.Title != "HN" || hn.XMLURL != "https://news.ycombinator.com/rss" || hn.HTMLURL != "https://news.ycombinator.com/" || hn.Type != "rss" {
+			t.Errorf("Unexpected outline for HN: %+v", hn)
+		}
+	})
+
+	t.Run("single folder", func(t *testing.T) {
+		doc, _ := export("?folder=golang")
+		if len(doc.Body.Outlines) != 1 || doc.Body.Outlines[0].Text != "Go" || len(doc.Body.Outlines[0].Outlines) != 1 {
+			t.Errorf("Expected only the Go folder, got %+v", doc.Body.Outlines)
+		}
+	})
+
+	t.Run("feed IDs", func(t *testing.T) {
+		doc, _ := export("?feed_id=go-blog&feed_id=unfiled")
+		outlines := doc.Body.Outlines
+		if len(outlines) != 2 || len(outlines[0].Outlines) != 1 || outlines[0].Outlines[0].Text != "Go" {
+			t.Errorf("Expected Tech/Go/The Go Blog and the unfiled feed, got %+v", outlines)
+		}
+	})
+
+	t.Run("unknown folder", func(t *testing.T) {
+		if _, code := export("?folder=missing"); code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, code)
+		}
+	})
+}
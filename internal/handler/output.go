@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"io"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type OutputHandler struct {
+	outputService service.OutputService
+	// token, when set, must be given as ?token= to read the output feeds.
+	token string
+}
+
+func NewOutputHandler(outputService service.OutputService, token string) *OutputHandler {
+	return &OutputHandler{
+		outputService: outputService,
+		token:         token,
+	}
+}
+
+func (h *OutputHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/out/{kind}/{id}.xml", h.RSS)
+	r.Get("/out/{kind}/{id}.atom", h.Atom)
+}
+
+// RSS serves the newest items of a feed, folder, tag, saved search or of the starred items ("starred/all") as RSS 2.0.
+func (h *OutputHandler) RSS(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	doc, err := h.outputService.RSS(r.Context(), chi.URLParam(r, "kind"), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), outputErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	if err := writeXML(w, doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Atom serves the same items as RSS, as an Atom feed.
+func (h *OutputHandler) Atom(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	doc, err := h.outputService.Atom(r.Context(), chi.URLParam(r, "kind"), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), outputErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if err := writeXML(w, doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *OutputHandler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.token)) == 1
+}
+
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+func outputErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUnknownOutput), repository.IsNotFound(err),
+		errors.Is(err, repository.ErrFolderNotFound), errors.Is(err, repository.ErrSavedSearchNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidTag):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
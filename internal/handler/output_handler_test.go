@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/xml"
+	"llrss/internal/models/db"
+	"llrss/internal/models/rss"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOutputFeeds(t *testing.T) {
+	d := newTestDB(t)
+	feedService := service.NewFeedService(repodb.NewGormFeedRepository(d))
+	folderService := service.NewFolderService(repodb.NewGormFeedRepository(d), repodb.NewGormFolderRepository(d))
+	savedSearchService := service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))
+	outputService := service.NewOutputService(feedService, folderService, savedSearchService, "http://llrss.example.com/")
+
+	folderID := "tech"
+	pubDate := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	d.Create(&db.Folder{ID: folderID, Name: "Tech"})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog", FolderID: &folderID})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "go-blog", Title: "Go 1.23", Link: "http://example.com/go/1.23", PubDate: pubDate, Tags: []db.Tag{{Name: "go"}}},
+		{ID: "2", FeedID: "go-blog", Title: "Go 1.24", Link: "http://example.com/go/1.24", PubDate: pubDate.Add(time.Hour),
+			Description: "Go <b>1.24</b> is released", Content: "<p>Full post</p>", IsStarred: true, Tags: []db.Tag{{Name: "go"}}},
+		{ID: "3", FeedID: "go-blog", Title: "Generics", Link: "http://example.com/go/generics", PubDate: pubDate.Add(-time.Hour)},
+	})
+
+	serve := func(h *OutputHandler, path string) *httptest.ResponseRecorder {
+		r := chi.NewRouter()
+		h.RegisterRoutes(r)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	h := NewOutputHandler(outputService, "")
+
+	w := serve(h, "/out/tag/go.xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Errorf("Expected an RSS content type, got %s", ct)
+	}
+	var doc rss.RSS
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse RSS: %v", err)
+	}
+	if doc.Channel.Title != "Tagged go" || len(doc.Channel.Items) != 2 {
+		t.Fatalf("Expected the 2 items tagged go, got %+v", doc.Channel)
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != "Go 1.24" || item.GUID == nil || item.GUID.ID != "http://example.com/go/1.24" {
+		t.Errorf("Expected the newest item first with its link as GUID, got %+v", item)
+	}
+	if item.PubDate != "Fri, 01 Nov 2024 13:00:00 +0000" || item.Content == nil || item.Content.Content != "<p>Full post</p>" {
+		t.Errorf("Expected the item date and content, got %+v", item)
+	}
+	if len(doc.Channel.AtomLinks) != 1 || doc.Channel.AtomLinks[0].Href != "http://llrss.example.com/out/tag/go.xml" {
+		t.Errorf("Expected a self link, got %+v", doc.Channel.AtomLinks)
+	}
+
+	w = serve(h, "/out/folder/tech.atom")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var feed rss.AtomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("Failed to parse Atom: %v", err)
+	}
+	if feed.Title != "Tech" || len(feed.Entries) != 3 || feed.Updated != "2024-11-01T13:00:00Z" {
+		t.Fatalf("Expected the 3 items of the folder, got %+v", feed)
+	}
+	if e := feed.Entries[0]; e.ID != "http://example.com/go/1.24" || e.Summary == nil || e.Summary.Body != "Go <b>1.24</b> is released" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	if w := serve(h, "/out/starred/all.xml"); !strings.Contains(w.Body.String(), "Go 1.24") || strings.Contains(w.Body.String(), "Go 1.23") {
+		t.Errorf("Expected only the starred item, got %s", w.Body.String())
+	}
+
+	for _, path := range []string{"/out/feed/unknown.xml", "/out/starred/go.xml", "/out/podcast/go.xml", "/out/search/unknown.atom"} {
+		if w := serve(h, path); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusNotFound, path, w.Code)
+		}
+	}
+
+	h = NewOutputHandler(outputService, "secret")
+	if w := serve(h, "/out/feed/go-blog.xml?token=wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := serve(h, "/out/feed/go-blog.xml?token=secret"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "The Go Blog") {
+		t.Errorf("Expected the feed with the token, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"llrss/internal/models/greader"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ReaderHandler serves the Google Reader API. Clients log in with ClientLogin, then
+// give the token it returns as an "Authorization: GoogleLogin auth=..." header.
+type ReaderHandler struct {
+	readerService service.ReaderService
+	username      string
+	password      string
+	// token is derived from the credentials, so that it survives restarts and changes with the password.
+	token string
+}
+
+func NewReaderHandler(readerService service.ReaderService, username, password string) *ReaderHandler {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte("greader:" + username))
+
+	return &ReaderHandler{
+		readerService: readerService,
+		username:      username,
+		password:      password,
+		token:         username + "/" + hex.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+func (h *ReaderHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/accounts/ClientLogin", h.ClientLogin)
+	r.Post("/accounts/ClientLogin", h.ClientLogin)
+
+	r.Route("/reader/api/0", func(r chi.Router) {
+		r.Use(h.authenticate)
+
+		r.Get("/token", h.Token)
+		r.Get("/user-info", h.UserInfo)
+		r.Get("/subscription/list", h.Subscriptions)
+		r.Post("/subscription/edit", h.EditSubscription)
+		r.Post("/subscription/quickadd", h.QuickAdd)
+		r.Get("/tag/list", h.Tags)
+		r.Get("/unread-count", h.UnreadCounts)
+		r.Get("/stream/items/ids", h.StreamItemIDs)
+		r.Get("/stream/contents", h.StreamContents)
+		r.Get("/stream/contents/*", h.StreamContents)
+		r.Get("/stream/items/contents", h.ItemContents)
+		r.Post("/stream/items/contents", h.ItemContents)
+		r.Post("/edit-tag", h.EditTag)
+		r.Post("/mark-all-as-read", h.MarkAllAsRead)
+	})
+}
+
+// ClientLogin checks the Email and Passwd fields, and returns the token as Auth.
+func (h *ReaderHandler) ClientLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := subtle.ConstantTimeCompare([]byte(r.Form.Get("Email")), []byte(h.username))
+	pass := subtle.ConstantTimeCompare([]byte(r.Form.Get("Passwd")), []byte(h.password))
+	if user&pass != 1 {
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "SID=%s\nLSID=%s\nAuth=%s\n", h.token, h.token, h.token)
+}
+
+func (h *ReaderHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "GoogleLogin auth=")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token returns the token edits are expected to give as T, which isn't checked
+// since requests are already authenticated by their header.
+func (h *ReaderHandler) Token(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, h.token)
+}
+
+func (h *ReaderHandler) UserInfo(w http.ResponseWriter, _ *http.Request) {
+	writeReader(w, greader.UserInfo{
+		UserID:        h.username,
+		UserName:      h.username,
+		UserProfileID: h.username,
+		UserEmail:     h.username,
+	})
+}
+
+func (h *ReaderHandler) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	list, err := h.readerService.Subscriptions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, list)
+}
+
+// EditSubscription takes the action as ac, the stream as s, and optionally a title as t
+// and labels to add and remove as a and r.
+func (h *ReaderHandler) EditSubscription(w http.ResponseWriter, r *http.Request) {
+	edit := greader.SubscriptionEdit{
+		Action:      r.Form.Get("ac"),
+		StreamID:    r.Form.Get("s"),
+		Title:       r.Form.Get("t"),
+		AddLabel:    r.Form.Get("a"),
+		RemoveLabel: r.Form.Get("r"),
+	}
+
+	if err := h.readerService.EditSubscription(r.Context(), edit); err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeOK(w)
+}
+
+func (h *ReaderHandler) QuickAdd(w http.ResponseWriter, r *http.Request) {
+	feedURL := strings.TrimPrefix(r.Form.Get("quickadd"), greader.FeedPrefix)
+	if feedURL == "" {
+		http.Error(w, "quickadd is required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.readerService.QuickAdd(r.Context(), feedURL)
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, res)
+}
+
+func (h *ReaderHandler) Tags(w http.ResponseWriter, r *http.Request) {
+	list, err := h.readerService.Tags(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, list)
+}
+
+func (h *ReaderHandler) UnreadCounts(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.readerService.UnreadCounts(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, counts)
+}
+
+func (h *ReaderHandler) StreamItemIDs(w http.ResponseWriter, r *http.Request) {
+	q, err := parseStreamQuery(r, r.Form.Get("s"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	refs, err := h.readerService.StreamItemIDs(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, refs)
+}
+
+// StreamContents serves the items of the stream given in the path, e.g. /stream/contents/feed%2F{id}, or as s.
+func (h *ReaderHandler) StreamContents(w http.ResponseWriter, r *http.Request) {
+	streamID, err := url.PathUnescape(chi.URLParam(r, "*"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if streamID == "" {
+		streamID = r.Form.Get("s")
+	}
+
+	q, err := parseStreamQuery(r, streamID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, err := h.readerService.StreamContents(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, stream)
+}
+
+// ItemContents serves the items given as repeated i.
+func (h *ReaderHandler) ItemContents(w http.ResponseWriter, r *http.Request) {
+	stream, err := h.readerService.ItemContents(r.Context(), r.Form["i"])
+	if err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeReader(w, stream)
+}
+
+// EditTag adds the states or labels given as repeated a, and removes those given as r, to the items given as repeated i.
+func (h *ReaderHandler) EditTag(w http.ResponseWriter, r *http.Request) {
+	if err := h.readerService.EditTag(r.Context(), r.Form["i"], r.Form["a"], r.Form["r"]); err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeOK(w)
+}
+
+// MarkAllAsRead marks the items of the stream s as read, up to ts in microseconds.
+func (h *ReaderHandler) MarkAllAsRead(w http.ResponseWriter, r *http.Request) {
+	var before time.Time
+	if ts := r.Form.Get("ts"); ts != "" {
+		usec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid ts", http.StatusBadRequest)
+			return
+		}
+		before = time.UnixMicro(usec)
+	}
+
+	if err := h.readerService.MarkAllAsRead(r.Context(), r.Form.Get("s"), before); err != nil {
+		http.Error(w, err.Error(), readerErrorStatus(err))
+		return
+	}
+	writeOK(w)
+}
+
+// parseStreamQuery parses n, r (o for oldest first), xt, it, ot, nt and c.
+func parseStreamQuery(r *http.Request, streamID string) (greader.StreamQuery, error) {
+	q := greader.StreamQuery{
+		StreamID:     streamID,
+		Exclude:      r.Form.Get("xt"),
+		Include:      r.Form.Get("it"),
+		OldestFirst:  r.Form.Get("r") == "o",
+		Continuation: r.Form.Get("c"),
+	}
+
+	ints := []struct {
+		name string
+		dst  *int64
+	}{{"ot", &q.NewerThan}, {"nt", &q.OlderThan}}
+	for _, p := range ints {
+		if v := r.Form.Get(p.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = n
+		}
+	}
+
+	if v := r.Form.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return q, errors.New("invalid n")
+		}
+		q.Count = n
+	}
+	return q, nil
+}
+
+func writeReader(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+func readerErrorStatus(err error) int {
+	switch {
+	case repository.IsItemNotFound(err), repository.IsNotFound(err), errors.Is(err, repository.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrUnknownStream), errors.Is(err, service.ErrInvalidSubscriptionEdit),
+		errors.Is(err, service.ErrInvalidCursor), errors.Is(err, service.ErrInvalidTag),
+		errors.Is(err, service.ErrInvalidFolderName), errors.Is(err, greader.ErrInvalidItemID):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models/db"
+	"llrss/internal/models/greader"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// readerClient replays the requests of a Google Reader client like NetNewsWire.
+type readerClient struct {
+	t      *testing.T
+	router chi.Router
+	auth   string
+}
+
+func newReaderTest(t *testing.T) (*readerClient, *gorm.DB) {
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	readerService := service.NewReaderService(feedService, folderService, repodb.NewGormNumberRepository(d))
+
+	r := chi.NewRouter()
+	NewReaderHandler(readerService, "reader", "secret").RegisterRoutes(r)
+
+	seedSyncItems(t, d, 30, []string{"hn", "xkcd"}, func(i int, item *db.Item) {
+		item.Description = ""
+		item.Content = fmt.Sprintf("<p>Content %d</p>", i)
+	})
+
+	return &readerClient{t: t, router: r}, d
+}
+
+func (c *readerClient) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	var req *http.Request
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		if form != nil {
+			path += "?" + form.Encode()
+		}
+		req = httptest.NewRequest(method, path, nil)
+	}
+	if c.auth != "" {
+		req.Header.Set("Authorization", "GoogleLogin auth="+c.auth)
+	}
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	return w
+}
+
+// call sends an authenticated request to the API, and decodes its JSON response into v.
+func (c *readerClient) call(method, path string, form url.Values, v any) {
+	c.t.Helper()
+
+	w := c.do(method, "/reader/api/0"+path, form)
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, path, w.Code, w.Body.String())
+	}
+	if v == nil {
+		if w.Body.String() != "OK" {
+			c.t.Errorf("Expected OK for %s, got %s", path, w.Body.String())
+		}
+		return
+	}
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		c.t.Fatalf("Failed to decode response of %s: %v", path, err)
+	}
+}
+
+func (c *readerClient) login() {
+	c.t.Helper()
+
+	w := c.do(http.MethodPost, "/accounts/ClientLogin", url.Values{"Email": {"reader"}, "Passwd": {"secret"}})
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if auth, ok := strings.CutPrefix(line, "Auth="); ok {
+			c.auth = auth
+		}
+	}
+	if c.auth == "" {
+		c.t.Fatalf("Expected an Auth token, got %s", w.Body.String())
+	}
+}
+
+func TestReaderAuth(t *testing.T) {
+	c, _ := newReaderTest(t)
+
+	if w := c.do(http.MethodPost, "/accounts/ClientLogin", url.Values{"Email": {"reader"}, "Passwd": {"wrong"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for a wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	c.auth = "reader/forged"
+	if w := c.do(http.MethodGet, "/reader/api/0/user-info", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for a wrong token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	c.login()
+	var info greader.UserInfo
+	c.call(http.MethodGet, "/user-info", nil, &info)
+	if info.UserName != "reader" {
+		t.Errorf("Expected the user name, got %+v", info)
+	}
+
+	if w := c.do(http.MethodGet, "/reader/api/0/token", nil); w.Body.String() != c.auth {
+		t.Errorf("Expected the token, got %s", w.Body.String())
+	}
+}
+
+func TestReaderSync(t *testing.T) {
+	c, _ := newReaderTest(t)
+	c.login()
+
+	// NetNewsWire's sync: tags, subscriptions, then the unread and starred item IDs, then their contents
+	var tags greader.TagList
+	c.call(http.MethodGet, "/tag/list", url.Values{"output": {"json"}}, &tags)
+	if len(tags.Tags) != 2 || tags.Tags[0].ID != greader.StateStarred || tags.Tags[1] != (greader.Tag{ID: "user/-/label/Tech", Type: "folder"}) {
+		t.Errorf("Expected the starred state and the Tech folder, got %+v", tags.Tags)
+	}
+
+	var subs greader.SubscriptionList
+	c.call(http.MethodGet, "/subscription/list", url.Values{"output": {"json"}}, &subs)
+	if len(subs.Subscriptions) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %+v", subs)
+	}
+	for _, s := range subs.Subscriptions {
+		if s.ID == "feed/hn" && (len(s.Categories) != 1 || s.Categories[0].Label != "Tech" || s.HTMLURL != "http://news.example.com") {
+			t.Errorf("Expected hn in the Tech folder, got %+v", s)
+		}
+	}
+
+	var counts greader.UnreadCounts
+	c.call(http.MethodGet, "/unread-count", url.Values{"output": {"json"}}, &counts)
+	for _, uc := range counts.UnreadCounts {
+		if expected := map[string]int64{greader.StateReadingList: 20, "feed/hn": 10, "feed/xkcd": 10, "user/-/label/Tech": 10}[uc.ID]; uc.Count != expected {
+			t.Errorf("Expected %d unread items for %s, got %d", expected, uc.ID, uc.Count)
+		}
+	}
+
+	var unread []string
+	continuation := ""
+	for page := 0; ; page++ {
+		form := url.Values{"s": {greader.StateReadingList}, "xt": {"user/-/state/com.google/read"}, "n": {"8"}, "output": {"json"}}
+		if continuation != "" {
+			form.Set("c", continuation)
+		}
+
+		var refs greader.ItemRefs
+		c.call(http.MethodGet, "/stream/items/ids", form, &refs)
+		for _, ref := range refs.ItemRefs {
+			unread = append(unread, ref.ID)
+		}
+		if refs.Continuation == "" {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("Expected the unread item IDs in 3 pages")
+		}
+		continuation = refs.Continuation
+	}
+	if len(unread) != 20 {
+		t.Fatalf("Expected 20 unread item IDs, got %d", len(unread))
+	}
+
+	// Contents are asked for by short ID, and come back with the long ones
+	var stream greader.Stream
+	c.call(http.MethodPost, "/stream/items/contents", url.Values{"i": unread[:3], "output": {"json"}}, &stream)
+	if len(stream.Items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(stream.Items))
+	}
+	// The newest items come first in the IDs, and last in the contents ordered by ID
+	item := stream.Items[0]
+	if n, _ := greader.ParseItemID(item.ID); fmt.Sprint(n) != unread[2] {
+		t.Errorf("Expected the long ID of item %s, got %s", unread[2], item.ID)
+	}
+	if !strings.HasPrefix(item.Summary.Content, "<p>Content") || item.Origin.StreamID == "" || len(item.Alternate) != 1 {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	// Newest first by default, oldest first with r=o
+	c.call(http.MethodGet, "/stream/contents/"+url.PathEscape("feed/xkcd"), url.Values{"n": {"2"}}, &stream)
+	if len(stream.Items) != 2 || stream.Items[0].Title != "Item 29" || stream.Items[0].Origin.Title != "xkcd" {
+		t.Errorf("Expected the newest items of xkcd, got %+v", stream.Items)
+	}
+	c.call(http.MethodGet, "/stream/contents/user/-/label/Tech", url.Values{"n": {"2"}, "r": {"o"}}, &stream)
+	if len(stream.Items) != 2 || stream.Items[0].Title != "Item 2" || stream.Continuation == "" {
+		t.Errorf("Expected the oldest items of the Tech folder with a continuation, got %+v", stream)
+	}
+	c.call(http.MethodGet, "/stream/contents", url.Values{"s": {greader.StateRead}, "nt": {fmt.Sprint(time.Date(2024, 11, 1, 3, 0, 0, 0, time.UTC).Unix())}}, &stream)
+	if len(stream.Items) != 3 {
+		t.Errorf("Expected the 3 read items published by 3am, got %d", len(stream.Items))
+	}
+
+	if w := c.do(http.MethodGet, "/reader/api/0/stream/contents/user/-/state/com.google/broadcast", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown stream, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestReaderEdits(t *testing.T) {
+	c, d := newReaderTest(t)
+	c.login()
+
+	status := func(id string) db.Item {
+		var item db.Item
+		d.Preload("Tags").First(&item, "id = ?", id)
+		return item
+	}
+	longID := func(id string) string {
+		return greader.LongItemID(itemNumber(t, d, id))
+	}
+
+	c.call(http.MethodPost, "/edit-tag", url.Values{
+		"i": {longID("item-11"), longID("item-12")},
+		"a": {"user/-/state/com.google/read", "user/-/state/com.google/starred", "user/-/label/Later"},
+	}, nil)
+	c.call(http.MethodPost, "/edit-tag", url.Values{"i": {longID("item-1")}, "r": {"user/-/state/com.google/read"}}, nil)
+	c.call(http.MethodPost, "/edit-tag", url.Values{"i": {longID("item-12")}, "r": {"user/-/label/Later", "user/-/state/com.google/starred"}}, nil)
+
+	if item := status("item-11"); !item.IsRead || !item.IsStarred || len(item.Tags) != 1 || item.Tags[0].Name != "later" {
+		t.Errorf("Expected item 11 read, starred and tagged, got %+v", item)
+	}
+	if item := status("item-12"); !item.IsRead || item.IsStarred || len(item.Tags) != 0 {
+		t.Errorf("Expected item 12 read only, got %+v", item)
+	}
+	if status("item-1").IsRead {
+		t.Errorf("Expected item 1 to be unread")
+	}
+
+	// The ID of a deleted item doesn't point to the next one saved
+	deleted := longID("item-30")
+	d.Delete(&db.Item{}, "id = ?", "item-30")
+	d.Create(&db.Item{ID: "item-31", FeedID: "xkcd", Link: "http://example.com/xkcd/31", PubDate: time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC)})
+	c.do(http.MethodPost, "/reader/api/0/edit-tag", url.Values{"i": {deleted}, "a": {"user/-/state/com.google/read"}})
+	if status("item-31").IsRead || longID("item-31") == deleted {
+		t.Errorf("Expected item 31 to get its own ID and stay unread")
+	}
+
+	// Starred items are a stream, and tags are labels
+	var refs greader.ItemRefs
+	c.call(http.MethodGet, "/stream/items/ids", url.Values{"s": {"user/1/state/com.google/starred"}}, &refs)
+	if len(refs.ItemRefs) != 1 {
+		t.Errorf("Expected 1 starred item, got %+v", refs)
+	}
+	c.call(http.MethodGet, "/stream/items/ids", url.Values{"s": {"user/-/label/later"}}, &refs)
+	if len(refs.ItemRefs) != 1 {
+		t.Errorf("Expected 1 item tagged later, got %+v", refs)
+	}
+
+	ts := time.Date(2024, 11, 1, 20, 0, 0, 0, time.UTC).UnixMicro()
+	c.call(http.MethodPost, "/mark-all-as-read", url.Values{"s": {"feed/hn"}, "ts": {fmt.Sprint(ts)}}, nil)
+	if !status("item-20").IsRead || status("item-22").IsRead || status("item-19").IsRead {
+		t.Errorf("Expected the items of hn published by 8pm to be read, and no others")
+	}
+
+	c.call(http.MethodPost, "/subscription/edit", url.Values{"ac": {"edit"}, "s": {"feed/xkcd"}, "t": {"Comics"}, "a": {"user/-/label/Fun"}}, nil)
+	var subs greader.SubscriptionList
+	c.call(http.MethodGet, "/subscription/list", nil, &subs)
+	for _, s := range subs.Subscriptions {
+		if s.ID == "feed/xkcd" && (s.Title != "Comics" || len(s.Categories) != 1 || s.Categories[0].Label != "Fun") {
+			t.Errorf("Expected xkcd renamed and moved to a new Fun folder, got %+v", s)
+		}
+	}
+
+	c.call(http.MethodPost, "/subscription/edit", url.Values{"ac": {"edit"}, "s": {"feed/hn"}, "r": {"user/-/label/Tech"}}, nil)
+	c.call(http.MethodPost, "/subscription/edit", url.Values{"ac": {"unsubscribe"}, "s": {"feed/xkcd"}}, nil)
+	c.call(http.MethodGet, "/subscription/list", nil, &subs)
+	if len(subs.Subscriptions) != 1 || len(subs.Subscriptions[0].Categories) != 0 {
+		t.Errorf("Expected hn out of any folder and xkcd gone, got %+v", subs)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+	<title>Go Blog</title>
+	<item><title>Go 1.24</title><link>http://example.com/go/1.24</link><pubDate>Tue, 05 Nov 2024 11:00:00 GMT</pubDate></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+
+	var added greader.QuickAddResult
+	c.call(http.MethodPost, "/subscription/quickadd", url.Values{"quickadd": {srv.URL}}, &added)
+	if added.NumResults != 1 || added.StreamName != "Go Blog" || !strings.HasPrefix(added.StreamID, "feed/") {
+		t.Errorf("Unexpected quickadd result %+v", added)
+	}
+
+	if w := c.do(http.MethodPost, "/reader/api/0/edit-tag", url.Values{"i": {"9999"}, "a": {greader.StateRead}}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown item, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := c.do(http.MethodPost, "/reader/api/0/edit-tag", url.Values{"i": {"abc"}, "a": {greader.StateRead}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid item ID, got %d", http.StatusBadRequest, w.Code)
+	}
+}
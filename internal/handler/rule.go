@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/rules"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RuleHandler struct {
+	ruleService service.RuleService
+}
+
+func NewRuleHandler(ruleService service.RuleService) *RuleHandler {
+	return &RuleHandler{
+		ruleService: ruleService,
+	}
+}
+
+func (h *RuleHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/rules", h.ListRules)
+	r.Post("/rules", h.CreateRule)
+	r.Get("/rules/{id}", h.GetRule)
+	r.Put("/rules/{id}", h.UpdateRule)
+	r.Delete("/rules/{id}", h.DeleteRule)
+	r.Post("/rules/{id}/apply", h.ApplyRule)
+}
+
+type ruleRequest struct {
+	Name       string `json:"name"`
+	Conditions []struct {
+		Field string `json:"field"`
+		Op    string `json:"op"`
+		Value string `json:"value"`
+	} `json:"conditions"`
+	Actions []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"actions"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+func (req *ruleRequest) rule(id string) *db.Rule {
+	rule := &db.Rule{
+		ID:      id,
+		Name:    req.Name,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	for _, c := range req.Conditions {
+		rule.Conditions = append(rule.Conditions, db.RuleCondition{Field: c.Field, Op: c.Op, Value: c.Value})
+	}
+	for _, a := range req.Actions {
+		rule.Actions = append(rule.Actions, db.RuleAction{Type: a.Type, Value: a.Value})
+	}
+	return rule
+}
+
+func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.ruleService.ListRules(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule := req.rule("")
+	if err := h.ruleService.CreateRule(r.Context(), rule); err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *RuleHandler) GetRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	rule, err := h.ruleService.GetRule(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *RuleHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule := req.rule(id)
+	if err := h.ruleService.UpdateRule(r.Context(), rule); err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *RuleHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.ruleService.DeleteRule(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ApplyRule runs a rule on the items already saved, and returns how many it matched.
+func (h *RuleHandler) ApplyRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	res, err := h.ruleService.ApplyRule(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), ruleErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func ruleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrRuleNotFound), errors.Is(err, repository.ErrWebhookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidRuleName), errors.Is(err, service.ErrInvalidTag),
+		errors.Is(err, rules.ErrInvalidCondition), errors.Is(err, rules.ErrInvalidAction):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
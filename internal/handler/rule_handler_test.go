@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"llrss/internal/events"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/rules"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRules(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	ruleRepo := repodb.NewGormRuleRepository(d)
+	webhookRepo := repodb.NewGormWebhookRepository(d)
+	feedRepo := events.NewFeedRepository(rules.NewFeedRepository(repodb.NewGormFeedRepository(d), ruleRepo, webhookRepo), bus)
+	feedService := service.NewFeedService(feedRepo)
+	ruleService := service.NewRuleService(ruleRepo, feedService, repodb.NewGormRetentionRepository(d), webhookRepo)
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewRuleHandler(ruleService).RegisterRoutes(r)
+	})
+
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News"})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog"})
+	d.Create(&db.Webhook{ID: "hook", URL: "http://example.com/hook", Secret: "s3cr3t", EventTypes: []string{events.ItemsAdded}})
+
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &b)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(body map[string]any) db.Rule {
+		t.Helper()
+		w := request(http.MethodPost, "/api/v1/rules", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var rule db.Rule
+		json.NewDecoder(w.Body).Decode(&rule)
+		return rule
+	}
+	condition := func(field, op, value string) map[string]string {
+		return map[string]string{"field": field, "op": op, "value": value}
+	}
+	action := func(typ, value string) map[string]string {
+		return map[string]string{"type": typ, "value": value}
+	}
+
+	sponsored := []map[string]string{condition("title", "matches", "/sponsored/i")}
+	for name, tc := range map[string]struct {
+		body     map[string]any
+		expected int
+	}{
+		"no name":         {map[string]any{"conditions": sponsored, "actions": []any{action("delete", "")}}, http.StatusBadRequest},
+		"no condition":    {map[string]any{"name": "Ads", "actions": []any{action("delete", "")}}, http.StatusBadRequest},
+		"unknown op":      {map[string]any{"name": "Ads", "conditions": []any{condition("title", "like", "ad")}, "actions": []any{action("delete", "")}}, http.StatusBadRequest},
+		"invalid regexp":  {map[string]any{"name": "Ads", "conditions": []any{condition("title", "matches", "/(ad/")}, "actions": []any{action("delete", "")}}, http.StatusBadRequest},
+		"unknown action":  {map[string]any{"name": "Ads", "conditions": sponsored, "actions": []any{action("archive", "")}}, http.StatusBadRequest},
+		"invalid tag":     {map[string]any{"name": "Ads", "conditions": sponsored, "actions": []any{action("tag", "   ")}}, http.StatusBadRequest},
+		"unknown webhook": {map[string]any{"name": "Ads", "conditions": sponsored, "actions": []any{action("webhook", "missing")}}, http.StatusNotFound},
+	} {
+		if w := request(http.MethodPost, "/api/v1/rules", tc.body); w.Code != tc.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", name, tc.expected, w.Code, w.Body.String())
+		}
+	}
+
+	create(map[string]any{
+		"name":       "Ads",
+		"conditions": []any{condition("feed", "equals", "hn"), sponsored[0]},
+		"actions":    []any{action("delete", "")},
+	})
+	security := create(map[string]any{
+		"name":       "Security",
+		"conditions": []any{condition("category", "contains", "security")},
+		"actions":    []any{action("tag", " Security "), action("star", ""), action("webhook", "hook")},
+	})
+	if security.Actions[0].Value != "security" || !security.Enabled {
+		t.Errorf("Expected an enabled rule with a normalized tag, got %+v", security)
+	}
+	create(map[string]any{
+		"name":       "Jane",
+		"conditions": []any{condition("author", "equals", "Jane")},
+		"actions":    []any{action("mark_read", "")},
+	})
+	releases := create(map[string]any{
+		"name":       "Releases",
+		"conditions": []any{condition("title", "contains", "release")},
+		"actions":    []any{action("mark_read", "")},
+		"enabled":    false,
+	})
+
+	sub, _ := bus.Subscribe(0, nil)
+	added, err := feedRepo.SaveFeedItems(ctx, "hn", []db.Item{
+		{Title: "SPONSORED: a VPN", Link: "http://example.com/hn/ad"},
+		{Title: "A new TLS attack", Link: "http://example.com/hn/tls", Category: "Security", Author: "jane"},
+		{Title: "Go 1.24 release", Link: "http://example.com/hn/go"},
+	})
+	if err != nil || len(added) != 2 {
+		t.Fatalf("Expected the sponsored item deleted and 2 items added, got %d: %v", len(added), err)
+	}
+	if e := <-sub.C; e.Type != events.ItemsAdded || len(e.ItemIDs) != 2 {
+		t.Errorf("Expected the 2 added items published, got %+v", e)
+	}
+
+	var ad int64
+	d.Model(&db.Item{}).Where("link = ?", "http://example.com/hn/ad").Count(&ad)
+	if ad != 0 {
+		t.Errorf("Expected the sponsored item not saved")
+	}
+
+	var tls db.Item
+	d.Preload("Tags").First(&tls, "link = ?", "http://example.com/hn/tls")
+	if !tls.IsStarred || !tls.IsRead || len(tls.Tags) != 1 || tls.Tags[0].Name != "security" {
+		t.Errorf("Expected the security item starred, read and tagged, got %+v", tls)
+	}
+
+	var release db.Item
+	d.First(&release, "link = ?", "http://example.com/hn/go")
+	if release.IsRead || release.IsStarred {
+		t.Errorf("Expected the disabled rule not to run, got %+v", release)
+	}
+
+	var deliveries []db.WebhookDelivery
+	d.Find(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].WebhookID != "hook" || deliveries[0].EventType != rules.WebhookEvent {
+		t.Fatalf("Expected a rule.matched delivery, got %+v", deliveries)
+	}
+	var payload models.WebhookPayload
+	json.Unmarshal([]byte(deliveries[0].Payload), &payload)
+	if payload.RuleID != security.ID || len(payload.Items) != 1 || payload.Items[0].ID != tls.ID {
+		t.Errorf("Expected the security item in the payload, got %+v", payload)
+	}
+
+	// Applying a rule runs it on the saved items, even disabled
+	w := request(http.MethodPost, "/api/v1/rules/"+releases.ID+"/apply", nil)
+	var res models.RuleResult
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res.Matched != 1 {
+		t.Errorf("Expected 1 item matched, got %d %+v", w.Code, res)
+	}
+	d.First(&release, "link = ?", "http://example.com/hn/go")
+	if !release.IsRead {
+		t.Errorf("Expected the release marked read")
+	}
+	if e := <-sub.C; e.Type != events.ItemsRead || e.ItemIDs[0] != release.ID {
+		t.Errorf("Expected the release read published, got %+v", e)
+	}
+
+	// Items deleted by a disabled rule aren't saved again by the next refresh
+	cleanup := create(map[string]any{
+		"name":       "Cleanup",
+		"conditions": []any{condition("title", "contains", "release")},
+		"actions":    []any{action("delete", "")},
+		"enabled":    false,
+	})
+	if w := request(http.MethodPost, "/api/v1/rules/"+cleanup.ID+"/apply", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	added, err = feedRepo.SaveFeedItems(ctx, "hn", []db.Item{{Title: "Go 1.24 release", Link: "http://example.com/hn/go"}})
+	if err != nil || len(added) != 0 {
+		t.Errorf("Expected the deleted release not saved again, got %+v: %v", added, err)
+	}
+	if w := request(http.MethodDelete, "/api/v1/rules/"+cleanup.ID, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if w := request(http.MethodPost, "/api/v1/rules/missing/apply", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var list []db.Rule
+	json.NewDecoder(request(http.MethodGet, "/api/v1/rules", nil).Body).Decode(&list)
+	if len(list) != 4 || list[0].Name != "Ads" {
+		t.Errorf("Expected the 4 rules in creation order, got %+v", list)
+	}
+	if w := request(http.MethodDelete, "/api/v1/rules/"+releases.ID, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := request(http.MethodGet, "/api/v1/rules/"+releases.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
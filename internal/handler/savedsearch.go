@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/search"
+	"llrss/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SavedSearchHandler struct {
+	savedSearchService service.SavedSearchService
+}
+
+func NewSavedSearchHandler(savedSearchService service.SavedSearchService) *SavedSearchHandler {
+	return &SavedSearchHandler{
+		savedSearchService: savedSearchService,
+	}
+}
+
+func (h *SavedSearchHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/searches", h.ListSavedSearches)
+	r.Post("/searches", h.CreateSavedSearch)
+	r.Get("/searches/{id}", h.GetSavedSearch)
+	r.Put("/searches/{id}", h.UpdateSavedSearch)
+	r.Delete("/searches/{id}", h.DeleteSavedSearch)
+	r.Get("/searches/{id}/items", h.SearchSavedSearch)
+}
+
+type savedSearchRequest struct {
+	Name           string     `json:"name"`
+	Query          string     `json:"query"`
+	FolderID       string     `json:"folder_id"`
+	FeedIDs        []string   `json:"feed_ids"`
+	ExcludeFeedIDs []string   `json:"exclude_feed_ids"`
+	Tags           []string   `json:"tags"`
+	Unread         bool       `json:"unread"`
+	Starred        bool       `json:"starred"`
+	Sort           string     `json:"sort"`
+	FromDate       *time.Time `json:"from_date"`
+	ToDate         *time.Time `json:"to_date"`
+}
+
+func (req *savedSearchRequest) savedSearch(id string) *db.SavedSearch {
+	return &db.SavedSearch{
+		ID:             id,
+		Name:           req.Name,
+		Query:          req.Query,
+		FolderID:       req.FolderID,
+		FeedIDs:        req.FeedIDs,
+		ExcludeFeedIDs: req.ExcludeFeedIDs,
+		Tags:           req.Tags,
+		Unread:         req.Unread,
+		Starred:        req.Starred,
+		Sort:           req.Sort,
+		FromDate:       req.FromDate,
+		ToDate:         req.ToDate,
+	}
+}
+
+func (h *SavedSearchHandler) ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	searches, err := h.savedSearchService.ListSavedSearches(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(searches)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SavedSearchHandler) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	var req savedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved := req.savedSearch("")
+	if err := h.savedSearchService.CreateSavedSearch(r.Context(), saved); err != nil {
+		http.Error(w, err.Error(), savedSearchErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SavedSearchHandler) GetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	saved, err := h.savedSearchService.GetSavedSearch(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), savedSearchErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SavedSearchHandler) UpdateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req savedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved := req.savedSearch(id)
+	if err := h.savedSearchService.UpdateSavedSearch(r.Context(), saved); err != nil {
+		http.Error(w, err.Error(), savedSearchErrorStatus(err))
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *SavedSearchHandler) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.savedSearchService.DeleteSavedSearch(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), savedSearchErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SearchSavedSearch returns the results of a saved search, paginated with the limit,
+// offset and cursor parameters of /feeds/items/search.
+func (h *SavedSearchHandler) SearchSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	page, err := parseSearchParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.savedSearchService.SearchSavedSearch(r.Context(), id, page)
+	if err != nil {
+		http.Error(w, err.Error(), savedSearchErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// savedSearchErrorStatus maps errors of the saved search operations to their HTTP status code.
+func savedSearchErrorStatus(err error) int {
+	var syntaxErr *search.SyntaxError
+	switch {
+	case errors.Is(err, repository.ErrSavedSearchNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidSavedSearchName), errors.Is(err, service.ErrInvalidSort),
+		errors.Is(err, service.ErrInvalidTag), errors.Is(err, service.ErrInvalidDateRange),
+		errors.Is(err, service.ErrRelevanceCursor), errors.As(err, &syntaxErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSavedSearches(t *testing.T) {
+	d := newTestDB(t)
+	feedService := service.NewFeedService(repodb.NewGormFeedRepository(d))
+	r := chi.NewRouter()
+	NewSavedSearchHandler(service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))).RegisterRoutes(r)
+
+	pubDate := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go"})
+	d.Create(&[]db.Item{
+		{ID: "1", FeedID: "go-blog", Title: "Go 1.22 is released", PubDate: pubDate, IsRead: true},
+		{ID: "2", FeedID: "go-blog", Title: "Go 1.23 is released", PubDate: pubDate.Add(time.Hour)},
+		{ID: "3", FeedID: "go-blog", Title: "Go 1.24 is released", PubDate: pubDate.Add(2 * time.Hour)},
+		{ID: "4", FeedID: "go-blog", Title: "Generics", PubDate: pubDate.Add(3 * time.Hour)},
+	})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/searches", `{"name": "Go releases", "query": "released feed:go-blog"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var saved db.SavedSearch
+	if err := json.NewDecoder(w.Body).Decode(&saved); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	w = do(http.MethodGet, "/searches", "")
+	var searches []models.SavedSearchCount
+	if err := json.NewDecoder(w.Body).Decode(&searches); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(searches) != 1 || searches[0].Unread != 2 {
+		t.Errorf("Expected the saved search with 2 unread items, got %+v", searches)
+	}
+
+	page := func(query string) models.SearchResult {
+		t.Helper()
+		w := do(http.MethodGet, "/searches/"+saved.ID+"/items?"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var res models.SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return res
+	}
+
+	// The read item is included, the saved search doesn't filter on unread
+	first := page("limit=2")
+	if first.Total != 3 || first.Len != 2 || first.Items[0].ID != "3" || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page %+v", first)
+	}
+	if next := page("limit=2&cursor=" + first.NextCursor); next.Len != 1 || next.Items[0].ID != "1" {
+		t.Errorf("Unexpected second page %+v", next)
+	}
+
+	w = do(http.MethodPut, "/searches/"+saved.ID, `{"name": "Unread Go releases", "query": "released", "unread": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if res := page(""); res.Total != 2 {
+		t.Errorf("Expected the updated search to only return unread items, got %d", res.Total)
+	}
+
+	// Dates are saved with the search
+	w = do(http.MethodPut, "/searches/"+saved.ID, `{"name": "Recent Go releases", "query": "released", "from_date": "2024-11-01T01:30:00Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if res := page(""); res.Total != 1 || res.Items[0].ID != "3" {
+		t.Errorf("Expected only the release published after the from date, got %+v", res)
+	}
+
+	// Pages by relevance have no cursor
+	w = do(http.MethodPut, "/searches/"+saved.ID, `{"name": "Go releases", "query": "released", "sort": "relevance"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/searches/"+saved.ID+"/items?cursor="+first.NextCursor, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a cursor, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	for _, body := range []string{
+		`{"name": " "}`,
+		`{"name": "Bad", "query": "is:new"}`,
+		`{"name": "Bad", "sort": "random"}`,
+		`{"name": "Bad", "from_date": "2024-11-02T00:00:00Z", "to_date": "2024-11-01T00:00:00Z"}`,
+	} {
+		if w := do(http.MethodPost, "/searches", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+
+	if w := do(http.MethodDelete, "/searches/"+saved.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := do(http.MethodGet, "/searches/"+saved.ID+"/items", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestScraperFeeds(t *testing.T) {
+	d := newTestDB(t)
+	feedService := service.NewFeedService(repodb.NewGormFeedRepository(d))
+
+	jobs := []string{`<li class="job"><a href="/jobs/1">Go developer</a> <span class="posted">2024-03-01</span></li>`}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/careers" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		// Latin-1 page, "Carrières" is decoded from it
+		fmt.Fprintf(w, "<html><head><title>Carri\xe8res</title></head><body><ul>%s</ul></body></html>", strings.Join(jobs, ""))
+	}))
+	defer site.Close()
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewFeedHandler(feedService).RegisterRoutes(r)
+	})
+
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		json.NewEncoder(&b).Encode(body)
+		req := httptest.NewRequest(method, path, &b)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	selectors := map[string]string{"item": "li.job", "title": "a", "date": ".posted"}
+	body := map[string]any{"url": site.URL + "/careers", "scraper": selectors}
+
+	for name, s := range map[string]map[string]string{
+		"no item":          {"title": "a"},
+		"invalid selector": {"item": "li.job >", "title": "a"},
+	} {
+		if w := request(http.MethodPost, "/api/v1/feeds/preview", map[string]any{"url": site.URL + "/careers", "scraper": s}); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", name, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	}
+
+	// Previews aren't saved
+	w := request(http.MethodPost, "/api/v1/feeds/preview", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var preview db.Feed
+	json.NewDecoder(w.Body).Decode(&preview)
+	if preview.Title != "Carrières" || len(preview.Items) != 1 || preview.Items[0].Title != "Go developer" ||
+		preview.Items[0].Link != site.URL+"/jobs/1" || preview.Items[0].PubDate.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("Expected the job scraped, got %+v", preview)
+	}
+	var count int64
+	d.Model(&db.Feed{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no feed saved by the preview")
+	}
+
+	w = request(http.MethodPost, "/api/v1/feeds", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	id := w.Body.String()
+
+	var feed db.Feed
+	d.Preload("Items").First(&feed, "id = ?", id)
+	if feed.URL != site.URL+"/careers" || feed.Scraper.Item != "li.job" || len(feed.Items) != 1 {
+		t.Errorf("Expected the scraper feed saved with its job, got %+v", feed)
+	}
+
+	// Refreshes scrape the page again
+	jobs = append([]string{`<li class="job"><a href="/jobs/2">SRE</a></li>`}, jobs...)
+	if err := feedService.RefreshFeeds(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	var items []db.Item
+	d.Order("pub_date DESC").Find(&items, "feed_id = ?", id)
+	if len(items) != 2 || items[0].Title != "SRE" {
+		t.Errorf("Expected the new job added, got %+v", items)
+	}
+
+	// Updates without the scraper keep its selectors
+	for _, method := range []string{http.MethodPatch, http.MethodPut} {
+		if w := request(method, "/api/v1/feeds/"+id, map[string]any{"name": "Jobs"}); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var updated db.Feed
+		d.First(&updated, "id = ?", id)
+		if updated.Name != "Jobs" || updated.Scraper != feed.Scraper {
+			t.Errorf("%s: expected the feed renamed with its selectors, got %+v", method, updated)
+		}
+	}
+
+	feed.Items = nil
+	feed.Scraper.Title = "a:hover"
+	if w := request(http.MethodPut, "/api/v1/feeds/"+id, feed); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
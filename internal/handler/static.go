@@ -2,18 +2,21 @@ package handler
 
 import (
 	"html/template"
+	"llrss/internal/models"
 	"llrss/internal/service"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type StaticHandler struct {
-	templates   *template.Template
-	feedService service.FeedService
+	templates     *template.Template
+	feedService   service.FeedService
+	folderService service.FolderService
 }
 
-func NewStaticHandler(feedService service.FeedService) *StaticHandler {
+func NewStaticHandler(feedService service.FeedService, folderService service.FolderService) *StaticHandler {
 	// Parse all templates
 	tmpl, err := template.ParseGlob("templates/*.html")
 	if err != nil {
@@ -21,8 +24,9 @@ func NewStaticHandler(feedService service.FeedService) *StaticHandler {
 	}
 
 	return &StaticHandler{
-		templates:   tmpl,
-		feedService: feedService,
+		templates:     tmpl,
+		feedService:   feedService,
+		folderService: folderService,
 	}
 }
 
@@ -31,17 +35,19 @@ func (h *StaticHandler) RegisterRoutes(r chi.Router) {
 	r.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
 	r.Get("/", h.handleHome)
+	r.Get("/starred", h.handleStarred)
 }
 
 func (h *StaticHandler) handleHome(w http.ResponseWriter, r *http.Request) {
-	feeds, err := h.feedService.ListFeeds(r.Context())
+	tree, err := h.folderService.Tree(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to load feeds", http.StatusInternalServerError)
 		return
 	}
 
 	data := map[string]interface{}{
-		"Feeds": feeds,
+		"Folders": tree.Folders,
+		"Feeds":   tree.Feeds,
 	}
 
 	err = h.templates.ExecuteTemplate(w, "home.html", data)
@@ -50,3 +56,28 @@ func (h *StaticHandler) handleHome(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (h *StaticHandler) handleStarred(w http.ResponseWriter, r *http.Request) {
+	res, err := h.feedService.SearchFeedItems(r.Context(), models.SearchParams{
+		FromDate: time.Time{},
+		ToDate:   time.Now().AddDate(100, 0, 0),
+		Starred:  true,
+		Sort:     "desc",
+		Limit:    100,
+	})
+	if err != nil {
+		http.Error(w, "Failed to load starred items", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Items": res.Items,
+		"Total": res.Total,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "starred.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookHandler(webhookService service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *WebhookHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/webhooks", h.ListWebhooks)
+	r.Post("/webhooks", h.CreateWebhook)
+	r.Get("/webhooks/{id}", h.GetWebhook)
+	r.Put("/webhooks/{id}", h.UpdateWebhook)
+	r.Delete("/webhooks/{id}", h.DeleteWebhook)
+	r.Get("/webhooks/{id}/deliveries", h.ListDeliveries)
+}
+
+type webhookRequest struct {
+	URL           string   `json:"url"`
+	Secret        string   `json:"secret"`
+	EventTypes    []string `json:"event_types"`
+	FeedID        string   `json:"feed_id"`
+	FolderID      string   `json:"folder_id"`
+	SavedSearchID string   `json:"saved_search_id"`
+}
+
+func (req *webhookRequest) webhook(id string) *db.Webhook {
+	return &db.Webhook{
+		ID:            id,
+		URL:           req.URL,
+		Secret:        req.Secret,
+		EventTypes:    req.EventTypes,
+		FeedID:        req.FeedID,
+		FolderID:      req.FolderID,
+		SavedSearchID: req.SavedSearchID,
+	}
+}
+
+// createdWebhook is a webhook with its secret, which is only returned when it's created.
+type createdWebhook struct {
+	*db.Webhook
+	Secret string
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.ListWebhooks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(webhooks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	webhook := req.webhook("")
+	if err := h.webhookService.CreateWebhook(r.Context(), webhook); err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(createdWebhook{Webhook: webhook, Secret: webhook.Secret})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	webhook, err := h.webhookService.GetWebhook(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateWebhook replaces a webhook, its secret is kept when none is given.
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	webhook := req.webhook(id)
+	if err := h.webhookService.UpdateWebhook(r.Context(), webhook); err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.webhookService.DeleteWebhook(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, newest first, with their attempts.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	deliveries, err := h.webhookService.ListDeliveries(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(deliveries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound), repository.IsNotFound(err),
+		errors.Is(err, repository.ErrFolderNotFound), errors.Is(err, repository.ErrSavedSearchNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrInvalidEventType):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
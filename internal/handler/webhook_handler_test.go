@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"llrss/internal/events"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookReceiver records the posts it gets, answering with its status code.
+type webhookReceiver struct {
+	mu     sync.Mutex
+	status int
+	posts  []*http.Request
+	bodies [][]byte
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.posts = append(rec.posts, r)
+	rec.bodies = append(rec.bodies, body)
+	w.WriteHeader(rec.status)
+}
+
+func (rec *webhookReceiver) received() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.posts)
+}
+
+func TestWebhooks(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	feedRepo := events.NewFeedRepository(repodb.NewGormFeedRepository(d), bus)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	savedSearchService := service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))
+	webhookService := service.NewWebhookService(repodb.NewGormWebhookRepository(d), feedService, folderService, savedSearchService, bus)
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		NewWebhookHandler(webhookService).RegisterRoutes(r)
+	})
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(receiver)
+	t.Cleanup(srv.Close)
+
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News"})
+	d.Create(&db.Feed{ID: "go-blog", URL: "http://example.com/go", Title: "The Go Blog"})
+	d.Create(&db.SavedSearch{ID: "releases", Name: "Releases", Query: "release"})
+
+	request := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&b).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &b)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, tc := range map[string]struct {
+		body     map[string]any
+		expected int
+	}{
+		"no URL":           {map[string]any{"event_types": []string{"items.added"}}, http.StatusBadRequest},
+		"ftp URL":          {map[string]any{"url": "ftp://example.com", "event_types": []string{"items.added"}}, http.StatusBadRequest},
+		"no event type":    {map[string]any{"url": srv.URL}, http.StatusBadRequest},
+		"unknown event":    {map[string]any{"url": srv.URL, "event_types": []string{"items.deleted"}}, http.StatusBadRequest},
+		"unknown feed":     {map[string]any{"url": srv.URL, "event_types": []string{"items.added"}, "feed_id": "missing"}, http.StatusNotFound},
+		"unknown search":   {map[string]any{"url": srv.URL, "event_types": []string{"items.added"}, "saved_search_id": "missing"}, http.StatusNotFound},
+		"malformed body":   {nil, http.StatusBadRequest},
+		"unknown folder":   {map[string]any{"url": srv.URL, "event_types": []string{"items.added"}, "folder_id": "missing"}, http.StatusNotFound},
+		"valid, no filter": {map[string]any{"url": srv.URL, "event_types": []string{"items.added", "items.added"}}, http.StatusCreated},
+	} {
+		if tc.body == nil {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", bytes.NewBufferString("{"))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.expected {
+				t.Errorf("%s: expected status code %d, got %d", name, tc.expected, w.Code)
+			}
+			continue
+		}
+		if w := request(http.MethodPost, "/api/v1/webhooks", tc.body); w.Code != tc.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", name, tc.expected, w.Code, w.Body.String())
+		}
+	}
+
+	var hooks []db.Webhook
+	list := request(http.MethodGet, "/api/v1/webhooks", nil).Body.Bytes()
+	json.Unmarshal(list, &hooks)
+	if len(hooks) != 1 || len(hooks[0].EventTypes) != 1 || bytes.Contains(list, []byte("Secret")) {
+		t.Fatalf("Expected a webhook with its event type once and no secret, got %+v", hooks)
+	}
+	var all db.Webhook
+	d.First(&all, "id = ?", hooks[0].ID)
+	if all.Secret == "" {
+		t.Errorf("Expected a generated secret")
+	}
+
+	// The secret is only returned when the webhook is created
+	var hn, releases createdWebhook
+	w := request(http.MethodPost, "/api/v1/webhooks", map[string]any{
+		"url": srv.URL, "secret": "s3cr3t", "event_types": []string{"items.added"}, "feed_id": "hn",
+	})
+	json.NewDecoder(w.Body).Decode(&hn)
+	w = request(http.MethodPost, "/api/v1/webhooks", map[string]any{
+		"url": srv.URL, "event_types": []string{"items.added", "items.read"}, "saved_search_id": "releases",
+	})
+	json.NewDecoder(w.Body).Decode(&releases)
+	if hn.Secret != "s3cr3t" || releases.Secret == "" {
+		t.Errorf("Expected the created webhooks with their secrets, got %+v and %+v", hn, releases)
+	}
+	if w := request(http.MethodGet, "/api/v1/webhooks/"+hn.ID, nil); bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+		t.Errorf("Expected the secret left out of the webhook, got %s", w.Body.String())
+	}
+
+	// Updating keeps the secret
+	w = request(http.MethodPut, "/api/v1/webhooks/"+hn.ID, map[string]any{
+		"url": srv.URL + "/hn", "event_types": []string{"items.added"}, "feed_id": "hn",
+	})
+	var updated db.Webhook
+	d.First(&updated, "id = ?", hn.ID)
+	if w.Code != http.StatusOK || updated.Secret != "s3cr3t" || updated.URL != srv.URL+"/hn" {
+		t.Errorf("Expected the webhook updated with its secret, got %d %+v", w.Code, updated)
+	}
+
+	sub, _ := bus.Subscribe(0, nil)
+	publish := func() {
+		t.Helper()
+		select {
+		case e := <-sub.C:
+			if err := webhookService.Enqueue(ctx, e); err != nil {
+				t.Fatalf("Failed to enqueue %s: %v", e.Type, err)
+			}
+		default:
+			t.Fatalf("Expected an event")
+		}
+	}
+
+	added, err := feedRepo.SaveFeedItems(ctx, "go-blog", []db.Item{
+		{Title: "Go 1.24 release", Link: "http://example.com/go/1"},
+		{Title: "Range functions", Link: "http://example.com/go/2"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save items: %v", err)
+	}
+	publish()
+
+	// Both fail the first time
+	if err := webhookService.DeliverPending(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if n := receiver.received(); n != 2 {
+		t.Fatalf("Expected the items of go-blog posted to 2 webhooks, got %d", n)
+	}
+	// Nothing is due until the retry
+	if err := webhookService.DeliverPending(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if n := receiver.received(); n != 2 {
+		t.Errorf("Expected no retry before the backoff, got %d posts", n)
+	}
+
+	receiver.mu.Lock()
+	receiver.status = http.StatusNoContent
+	receiver.mu.Unlock()
+	d.Exec("UPDATE webhook_deliveries SET next_attempt_at = ?", "2000-01-01 00:00:00")
+	if err := webhookService.DeliverPending(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if n := receiver.received(); n != 4 {
+		t.Fatalf("Expected both deliveries retried, got %d posts", n)
+	}
+
+	secrets := map[string]string{all.ID: all.Secret, releases.ID: releases.Secret}
+	for i, post := range receiver.posts[2:] {
+		body := receiver.bodies[2+i]
+		if post.Header.Get("X-LLRSS-Event") != events.ItemsAdded {
+			t.Errorf("Expected an %s post, got %s", events.ItemsAdded, post.Header.Get("X-LLRSS-Event"))
+		}
+
+		var payload models.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("Failed to decode the payload: %v", err)
+		}
+		if payload.Feed == nil || payload.Feed.Title != "The Go Blog" {
+			t.Errorf("Expected the feed in the payload, got %+v", payload.Feed)
+		}
+
+		signature := post.Header.Get("X-LLRSS-Signature")
+		switch signature {
+		case service.WebhookSignature(secrets[all.ID], body):
+			if len(payload.Items) != 2 {
+				t.Errorf("Expected both items posted to the unfiltered webhook, got %+v", payload.Items)
+			}
+		case service.WebhookSignature(secrets[releases.ID], body):
+			if len(payload.Items) != 1 || payload.Items[0].Title != "Go 1.24 release" {
+				t.Errorf("Expected the release posted to the saved search webhook, got %+v", payload.Items)
+			}
+		default:
+			t.Errorf("Expected a valid signature, got %q", signature)
+		}
+	}
+
+	// Read state changes of items outside the search don't concern it
+	if err := feedService.MarkFeedItemRead(ctx, added[1].ID, true); err != nil {
+		t.Fatalf("Failed to mark the item: %v", err)
+	}
+	publish()
+	if err := webhookService.DeliverPending(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if n := receiver.received(); n != 4 {
+		t.Errorf("Expected no post for an item outside the search, got %d posts", n)
+	}
+
+	var deliveries []db.WebhookDelivery
+	w = request(http.MethodGet, "/api/v1/webhooks/"+all.ID+"/deliveries", nil)
+	json.NewDecoder(w.Body).Decode(&deliveries)
+	if w.Code != http.StatusOK || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d %d", w.Code, len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != db.WebhookDeliveryDelivered || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("Expected a delivery on the second attempt, got %+v", delivery)
+	}
+	if len(delivery.AttemptLog) != 2 || delivery.AttemptLog[0].StatusCode != http.StatusInternalServerError ||
+		delivery.AttemptLog[0].Error == "" || delivery.AttemptLog[1].StatusCode != http.StatusNoContent {
+		t.Errorf("Expected a failed then a successful attempt, got %+v", delivery.AttemptLog)
+	}
+
+	if w := request(http.MethodDelete, "/api/v1/webhooks/"+all.ID, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	for _, path := range []string{"/api/v1/webhooks/" + all.ID, "/api/v1/webhooks/" + all.ID + "/deliveries"} {
+		if w := request(http.MethodGet, path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusNotFound, path, w.Code)
+		}
+	}
+	var attempts int64
+	d.Model(&db.WebhookAttempt{}).Where("delivery_id = ?", delivery.ID).Count(&attempts)
+	if attempts != 0 {
+		t.Errorf("Expected the attempts deleted with the webhook, got %d", attempts)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	d := newTestDB(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	feedRepo := events.NewFeedRepository(repodb.NewGormFeedRepository(d), bus)
+	feedService := service.NewFeedService(feedRepo)
+	folderService := service.NewFolderService(feedRepo, repodb.NewGormFolderRepository(d))
+	savedSearchService := service.NewSavedSearchService(feedService, repodb.NewGormSavedSearchRepository(d))
+	webhookService := service.NewWebhookService(repodb.NewGormWebhookRepository(d), feedService, folderService, savedSearchService, bus)
+
+	receiver := &webhookReceiver{status: http.StatusBadGateway}
+	srv := httptest.NewServer(receiver)
+	t.Cleanup(srv.Close)
+
+	hook := &db.Webhook{URL: srv.URL, EventTypes: []string{events.FeedAdded}}
+	if err := webhookService.CreateWebhook(ctx, hook); err != nil {
+		t.Fatalf("Failed to create the webhook: %v", err)
+	}
+	if err := webhookService.Enqueue(ctx, events.Event{ID: 1, Type: events.FeedAdded, FeedID: "hn"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	for i := range service.WebhookMaxAttempts + 1 {
+		d.Exec("UPDATE webhook_deliveries SET next_attempt_at = ?", "2000-01-01 00:00:00")
+		if err := webhookService.DeliverPending(ctx); err != nil {
+			t.Fatalf("Failed to deliver attempt %d: %v", i+1, err)
+		}
+	}
+
+	if n := receiver.received(); n != service.WebhookMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", service.WebhookMaxAttempts, n)
+	}
+	deliveries, err := webhookService.ListDeliveries(ctx, hook.ID)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != db.WebhookDeliveryFailed {
+		t.Errorf("Expected a failed delivery, got %+v", deliveries)
+	}
+	if len(deliveries[0].AttemptLog) != service.WebhookMaxAttempts {
+		t.Errorf("Expected every attempt recorded, got %d", len(deliveries[0].AttemptLog))
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"llrss/internal/models"
+	"llrss/internal/repository"
+	"llrss/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWebSubPayload caps the size of the content a hub can push to us.
+const maxWebSubPayload = 10 << 20
+
+type WebSubHandler struct {
+	webSubService service.WebSubService
+}
+
+func NewWebSubHandler(webSubService service.WebSubService) *WebSubHandler {
+	return &WebSubHandler{
+		webSubService: webSubService,
+	}
+}
+
+func (h *WebSubHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/websub/{feedID}", h.VerifyIntent)
+	r.Post("/websub/{feedID}", h.Distribute)
+}
+
+func (h *WebSubHandler) VerifyIntent(w http.ResponseWriter, r *http.Request) {
+	feedID := chi.URLParam(r, "feedID")
+	q := r.URL.Query()
+
+	v := models.WebSubVerification{
+		Mode:      q.Get("hub.mode"),
+		Topic:     q.Get("hub.topic"),
+		Challenge: q.Get("hub.challenge"),
+		Reason:    q.Get("hub.reason"),
+	}
+	if l := q.Get("hub.lease_seconds"); l != "" {
+		lease, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid hub.lease_seconds: %s", l), http.StatusBadRequest)
+			return
+		}
+		v.LeaseSeconds = lease
+	}
+
+	challenge, err := h.webSubService.VerifyIntent(r.Context(), feedID, v)
+	if err != nil {
+		// Anything but a 2xx tells the hub we don't agree with the intent.
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(challenge))
+}
+
+func (h *WebSubHandler) Distribute(w http.ResponseWriter, r *http.Request) {
+	feedID := chi.URLParam(r, "feedID")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebSubPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = h.webSubService.Distribute(r.Context(), feedID, body, r.Header.Get("X-Hub-Signature"))
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrInvalidSignature):
+		// The spec requires a 2xx even for content we drop, not to leak the verification result.
+		fmt.Printf("dropping websub content for feed %s: %v\n", feedID, err)
+	case errors.Is(err, repository.ErrSubscriptionNotFound), repository.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
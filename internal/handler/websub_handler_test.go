@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"llrss/internal/config"
+	"llrss/internal/models/db"
+	repodb "llrss/internal/repository/db"
+	"llrss/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const webSubFeedXML = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+	<channel>
+		<title>Pushed Feed</title>
+		<description>A feed with a hub</description>
+		<atom:link rel="hub" href="%HUB%"/>
+		<atom:link rel="self" href="http://example.com/feed.xml"/>
+		<link>http://example.com</link>
+		<item>
+			<title>Pushed Item</title>
+			<link>http://example.com/pushed</link>
+			<pubDate>Tue, 05 Nov 2024 11:00:00 GMT</pubDate>
+		</item>
+	</channel>
+</rss>`
+
+// newTestDB opens a private in-memory database with the full schema.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	d, err := config.InitDatabase(&config.DatabaseConfig{
+		DBPath: "file:" + url.PathEscape(t.Name()) + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := repodb.AutoMigrate(d); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		sqlDB, _ := d.DB()
+		sqlDB.Close()
+	})
+
+	return d
+}
+
+// seedSyncItems creates what the tests of the sync APIs start with: the folder "tech" holding
+// the feed "hn", the feed "xkcd" and n items spread over feedIDs, an hour apart from 2024-11-01,
+// the first 10 read. Items are created in order, so their numbers follow their index.
+// edit, when not nil, adjusts each item before it's saved.
+func seedSyncItems(t *testing.T, d *gorm.DB, n int, feedIDs []string, edit func(i int, item *db.Item)) {
+	t.Helper()
+
+	tech := "tech"
+	d.Create(&db.Folder{ID: tech, Name: "Tech"})
+	d.Create(&db.Feed{ID: "hn", URL: "http://example.com/hn", Title: "Hacker News", SiteURL: "http://news.example.com", FolderID: &tech})
+	d.Create(&db.Feed{ID: "xkcd", URL: "http://example.com/xkcd", Title: "xkcd"})
+
+	pubDate := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	var items []db.Item
+	for i := 1; i <= n; i++ {
+		feedID := feedIDs[i%len(feedIDs)]
+		item := db.Item{
+			ID:          fmt.Sprintf("item-%d", i),
+			FeedID:      feedID,
+			Title:       fmt.Sprintf("Item %d", i),
+			Link:        fmt.Sprintf("http://example.com/%s/%d", feedID, i),
+			Description: "Summary",
+			PubDate:     pubDate.Add(time.Duration(i) * time.Hour),
+			IsRead:      i <= 10,
+		}
+		if edit != nil {
+			edit(i, &item)
+		}
+		items = append(items, item)
+	}
+	if err := d.CreateInBatches(items, 50).Error; err != nil {
+		t.Fatalf("Failed to create items: %v", err)
+	}
+}
+
+// itemNumber returns the number the sync APIs know the item by.
+func itemNumber(t *testing.T, d *gorm.DB, id string) int64 {
+	t.Helper()
+
+	var numbers []int64
+	d.Table("item_numbers").Where("id = ?", id).Pluck("number", &numbers)
+	if len(numbers) != 1 {
+		t.Fatalf("Expected a number for %s, got %v", id, numbers)
+	}
+	return numbers[0]
+}
+
+// testHub is a stand-in WebSub hub, it verifies every subscription request
+// against the subscriber's callback before accepting it.
+type testHub struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	h.requests = append(h.requests, r.PostForm)
+	h.mu.Unlock()
+
+	callback, err := url.Parse(r.PostForm.Get("hub.callback"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := callback.Query()
+	q.Set("hub.mode", r.PostForm.Get("hub.mode"))
+	q.Set("hub.topic", r.PostForm.Get("hub.topic"))
+	q.Set("hub.challenge", "challenge-accepted")
+	q.Set("hub.lease_seconds", "3600")
+	callback.RawQuery = q.Encode()
+
+	resp, err := http.Get(callback.String())
+	if err != nil {
+		h.t.Errorf("Hub failed to verify intent: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "challenge-accepted" {
+		h.t.Errorf("Expected challenge echoed back, got %d %q", resp.StatusCode, body)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *testHub) last() url.Values {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.requests) == 0 {
+		return nil
+	}
+	return h.requests[len(h.requests)-1]
+}
+
+func (h *testHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.requests)
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebSubSubscribeAndDistribute(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	webSubRepo := repodb.NewGormWebSubRepository(d)
+
+	hub := &testHub{t: t}
+	hubSrv := httptest.NewServer(hub)
+	defer hubSrv.Close()
+
+	r := chi.NewRouter()
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	webSubService := service.NewWebSubService(feedRepo, webSubRepo, srv.URL)
+	NewWebSubHandler(webSubService).RegisterRoutes(r)
+
+	feed := &db.Feed{
+		URL:     "http://example.com/feed.xml",
+		Title:   "Pushed Feed",
+		HubURL:  hubSrv.URL,
+		SelfURL: "http://example.com/feed.xml",
+	}
+	feedID, err := feedRepo.SaveFeed(ctx, feed)
+	if err != nil {
+		t.Fatalf("Failed to save feed: %v", err)
+	}
+
+	if err := webSubService.SyncSubscriptions(ctx); err != nil {
+		t.Fatalf("Failed to sync subscriptions: %v", err)
+	}
+
+	req := hub.last()
+	if req == nil {
+		t.Fatal("Expected a subscription request to the hub")
+	}
+	if req.Get("hub.mode") != "subscribe" || req.Get("hub.topic") != feed.SelfURL {
+		t.Errorf("Unexpected subscription request: %v", req)
+	}
+	if req.Get("hub.callback") != srv.URL+"/websub/"+feedID {
+		t.Errorf("Unexpected callback %q", req.Get("hub.callback"))
+	}
+
+	sub, err := webSubRepo.GetSubscription(ctx, feedID)
+	if err != nil {
+		t.Fatalf("Failed to get subscription: %v", err)
+	}
+	if sub.State != db.WebSubStateActive {
+		t.Errorf("Expected active subscription, got %s", sub.State)
+	}
+
+	f, _ := feedRepo.GetFeed(ctx, feedID)
+	if !f.WebSubExpiresAt.After(time.Now()) {
+		t.Errorf("Expected feed lease to be mirrored, got %v", f.WebSubExpiresAt)
+	}
+
+	// A second sync doesn't subscribe again, the lease is still fresh
+	if err := webSubService.SyncSubscriptions(ctx); err != nil {
+		t.Fatalf("Failed to sync subscriptions: %v", err)
+	}
+	if hub.count() != 1 {
+		t.Errorf("Expected 1 subscription request, got %d", hub.count())
+	}
+
+	payload := strings.ReplaceAll(webSubFeedXML, "%HUB%", hubSrv.URL)
+
+	tests := []struct {
+		name      string
+		signature string
+		items     int64
+	}{
+		{name: "bad signature is dropped", signature: sign("wrong secret", payload), items: 0},
+		{name: "missing signature is dropped", signature: "", items: 0},
+		{name: "signed content is saved", signature: sign(sub.Secret, payload), items: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, req.Get("hub.callback"), strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/rss+xml")
+			if tt.signature != "" {
+				req.Header.Set("X-Hub-Signature", tt.signature)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to push content: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("Expected status code %d, got %d", http.StatusAccepted, resp.StatusCode)
+			}
+
+			var items int64
+			d.Model(&db.Item{}).Where("feed_id = ?", feedID).Count(&items)
+			if items != tt.items {
+				t.Errorf("Expected %d items, got %d", tt.items, items)
+			}
+		})
+	}
+
+	// Leases about to expire get renewed with the same secret
+	sub.ExpiresAt = time.Now().Add(10 * time.Minute)
+	if err := webSubRepo.SaveSubscription(ctx, sub); err != nil {
+		t.Fatalf("Failed to save subscription: %v", err)
+	}
+	if err := webSubService.SyncSubscriptions(ctx); err != nil {
+		t.Fatalf("Failed to sync subscriptions: %v", err)
+	}
+	if hub.count() != 2 {
+		t.Fatalf("Expected the lease to be renewed, got %d requests", hub.count())
+	}
+	if hub.last().Get("hub.secret") != sub.Secret {
+		t.Error("Expected the secret to be kept on renewal")
+	}
+}
+
+func TestWebSubVerifyIntentUnknownTopic(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	feedRepo := repodb.NewGormFeedRepository(d)
+	webSubRepo := repodb.NewGormWebSubRepository(d)
+
+	r := chi.NewRouter()
+	NewWebSubHandler(service.NewWebSubService(feedRepo, webSubRepo, "http://localhost")).RegisterRoutes(r)
+
+	err := webSubRepo.SaveSubscription(ctx, &db.WebSubSubscription{
+		FeedID:   "feed",
+		HubURL:   "http://hub.example.com",
+		TopicURL: "http://example.com/feed.xml",
+		Secret:   "secret",
+		State:    db.WebSubStatePending,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save subscription: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{name: "unknown feed", query: "/websub/other?hub.mode=subscribe&hub.topic=http://example.com/feed.xml&hub.challenge=x", code: http.StatusNotFound},
+		{name: "other topic", query: "/websub/feed?hub.mode=subscribe&hub.topic=http://example.com/other.xml&hub.challenge=x", code: http.StatusNotFound},
+		{name: "unsubscribe", query: "/websub/feed?hub.mode=unsubscribe&hub.topic=http://example.com/feed.xml&hub.challenge=x", code: http.StatusNotFound},
+		{name: "subscribe", query: "/websub/feed?hub.mode=subscribe&hub.topic=http://example.com/feed.xml&hub.challenge=x", code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.query, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Expected status code %d, got %d", tt.code, w.Code)
+			}
+		})
+	}
+}
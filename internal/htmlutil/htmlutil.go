@@ -0,0 +1,57 @@
+// Package htmlutil has the helpers to read parsed HTML shared by the readability and
+// scraper packages.
+package htmlutil
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Walk calls fn on n and its descendants in document order, skipping the descendants of
+// the nodes fn returns false for.
+func Walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		Walk(c, fn)
+	}
+}
+
+// Text returns the text of a node, with its whitespace collapsed. It's empty for nil.
+func Text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	Walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+			b.WriteByte(' ')
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Attr returns the value of an attribute of n, empty when it doesn't have it.
+func Attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// HasAttr tells if n has an attribute, even an empty one.
+func HasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return true
+		}
+	}
+	return false
+}
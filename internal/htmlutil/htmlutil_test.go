@@ -0,0 +1,43 @@
+package htmlutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestHelpers(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>Some
+	<a href="/a" hidden>linked</a>  <b>text</b></p><script>skipped()</script>`))
+	require.NoError(t, err)
+
+	var p, a *html.Node
+	script := false
+	Walk(doc, func(n *html.Node) bool {
+		if n.Type == html.TextNode && n.Data == "skipped()" {
+			script = true
+		}
+		switch n.DataAtom {
+		case atom.P:
+			p = n
+		case atom.A:
+			a = n
+		}
+		// Descendants of skipped nodes aren't visited
+		return n.DataAtom != atom.Script
+	})
+	require.NotNil(t, p)
+	require.NotNil(t, a)
+	assert.False(t, script, "Expected the script content skipped")
+
+	assert.Equal(t, "Some linked text", Text(p))
+	assert.Equal(t, "", Text(nil))
+	assert.Equal(t, "/a", Attr(a, "href"))
+	assert.Equal(t, "", Attr(a, "title"))
+	assert.True(t, HasAttr(a, "hidden"))
+	assert.False(t, HasAttr(p, "hidden"))
+}
@@ -0,0 +1,27 @@
+package db
+
+import "time"
+
+// Digest emails the unread items of a folder, tag or saved search, or of every feed without
+// any, to its recipients at Time on Days.
+type Digest struct {
+	ID            string   `gorm:"primaryKey"`
+	Name          string   `gorm:"not null"`
+	Recipients    []string `gorm:"serializer:json"`
+	FolderID      string
+	Tag           string
+	SavedSearchID string
+	// Time is when digests are sent, as HH:MM in the time zone of the server configuration.
+	Time string
+	// Days are the days digests are sent, as mon to sun, every day when empty.
+	Days       []string `gorm:"serializer:json"`
+	LastSentAt *time.Time
+	CreatedAt  time.Time
+}
+
+// DigestItem records that an item was sent in a digest, so that it isn't sent again.
+type DigestItem struct {
+	DigestID string `gorm:"primaryKey"`
+	ItemID   string `gorm:"primaryKey;index"`
+	SentAt   time.Time
+}
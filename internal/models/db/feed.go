@@ -9,13 +9,28 @@ type Item struct {
 	Title       string `gorm:"not null"`
 	Link        string `gorm:"not null"`
 	Description string
+	Content     string `gorm:"type:text"`
 	Author      string
 	Category    string
 	Comments    string
 	PubDate     time.Time `gorm:"index;type:datetime"`
 	Source      string
-	FeedID      string `gorm:"index"`
-	IsRead      bool   `gorm:"default:false"`
+	FeedID      string `gorm:"index;index:idx_items_feed_read,priority:1"`
+	IsRead      bool   `gorm:"default:false;index:idx_items_feed_read,priority:2"`
+	IsStarred   bool   `gorm:"default:false;index"`
+	StarredAt   *time.Time
+	Note        string `gorm:"type:text"`
+	// Article is the full article extracted from the page at Link, for feeds which only have a teaser.
+	Article     string `gorm:"type:text"`
+	ExtractedAt *time.Time
+	Tags        []Tag `gorm:"many2many:item_tags"`
+	// UpdatedAt is when the item was saved or its status last changed, in unix seconds.
+	UpdatedAt int64 `gorm:"autoUpdateTime;index"`
+	// CreatedAt is when the item was saved, in unix seconds. It's 0 for items saved before it was tracked.
+	CreatedAt int64 `gorm:"autoCreateTime;index"`
+
+	// Snippet highlights the words matching a full-text search, it's not stored.
+	Snippet string `gorm:"->;-:migration"`
 }
 
 type Feed struct {
@@ -25,4 +40,24 @@ type Feed struct {
 	Description string    `gorm:"type:text"`
 	LastFetch   time.Time `gorm:"index;type:datetime"`
 	Items       []Item    `gorm:"foreignKey:FeedID"`
+	FolderID    *string   `gorm:"index"`
+
+	// Name is the custom name given by the user, shown instead of Title when set.
+	Name string
+	// SiteURL is the website the feed belongs to.
+	SiteURL string
+
+	// WebSub discovery, see service.WebSubService.
+	HubURL          string
+	SelfURL         string
+	WebSubExpiresAt time.Time `gorm:"type:datetime"`
+
+	// Retention overrides the global retention policy for this feed's items.
+	Retention RetentionPolicy `gorm:"embedded;embeddedPrefix:retention_"`
+
+	// Scraper holds the selectors of feeds scraped from web pages, URL is then the page's.
+	Scraper Scraper `gorm:"embedded;embeddedPrefix:scraper_"`
+
+	// Extract fetches the full article of new items, see service.ExtractService.
+	Extract bool
 }
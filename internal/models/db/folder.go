@@ -0,0 +1,11 @@
+package db
+
+import "time"
+
+// Folder groups feeds, folders can be nested one level deep.
+type Folder struct {
+	ID        string  `gorm:"primaryKey"`
+	Name      string  `gorm:"not null"`
+	ParentID  *string `gorm:"index"`
+	CreatedAt time.Time
+}
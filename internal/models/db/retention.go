@@ -0,0 +1,31 @@
+package db
+
+import "time"
+
+// RetentionPolicy decides which items get purged. Nil fields inherit the
+// global policy, zero values disable the rule.
+type RetentionPolicy struct {
+	// MaxItems is how many of the newest items of a feed are kept.
+	MaxItems *int
+	// ReadDays is after how many days read items are deleted.
+	ReadDays *int
+}
+
+// Or returns the policy with its unset fields taken from def.
+func (p RetentionPolicy) Or(def RetentionPolicy) RetentionPolicy {
+	if p.MaxItems == nil {
+		p.MaxItems = def.MaxItems
+	}
+	if p.ReadDays == nil {
+		p.ReadDays = def.ReadDays
+	}
+	return p
+}
+
+// DeletedItem remembers an item deleted by a purge or a rule, so that refreshes don't save
+// it again while it's still in its feed.
+type DeletedItem struct {
+	ID        string    `gorm:"primaryKey;type:string"`
+	FeedID    string    `gorm:"index"`
+	DeletedAt time.Time `gorm:"type:datetime"`
+}
@@ -0,0 +1,27 @@
+package db
+
+import "time"
+
+// Rule runs its actions on the new items matching all of its conditions.
+type Rule struct {
+	ID         string          `gorm:"primaryKey"`
+	Name       string          `gorm:"not null"`
+	Conditions []RuleCondition `gorm:"serializer:json"`
+	Actions    []RuleAction    `gorm:"serializer:json"`
+	Enabled    bool
+	CreatedAt  time.Time
+}
+
+// RuleCondition compares a field of items, e.g. title, with Value, see rules.Fields and rules.Ops.
+type RuleCondition struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// RuleAction is done to the matching items, Value is the tag of tag actions and the webhook
+// ID of webhook ones.
+type RuleAction struct {
+	Type  string
+	Value string `json:",omitempty"`
+}
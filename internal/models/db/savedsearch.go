@@ -0,0 +1,20 @@
+package db
+
+import "time"
+
+// SavedSearch is a named item search, shown like a folder whose content is the search results.
+type SavedSearch struct {
+	ID             string `gorm:"primaryKey"`
+	Name           string `gorm:"not null"`
+	Query          string
+	FolderID       string
+	FeedIDs        []string `gorm:"serializer:json"`
+	ExcludeFeedIDs []string `gorm:"serializer:json"`
+	Tags           []string `gorm:"serializer:json"`
+	Unread         bool
+	Starred        bool
+	Sort           string
+	FromDate       *time.Time
+	ToDate         *time.Time
+	CreatedAt      time.Time
+}
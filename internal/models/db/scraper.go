@@ -0,0 +1,15 @@
+package db
+
+// Scraper makes a feed out of a web page which has none, a feed is scraped when Item is set.
+// The items are the elements matching Item, their fields are taken from the first element
+// matching the other CSS selectors in each of them.
+type Scraper struct {
+	Item  string
+	Title string
+	// Link defaults to the first link of the item.
+	Link    string
+	Date    string
+	Summary string
+	// DateFormat is the Go layout of the dates, common formats are tried when it's empty.
+	DateFormat string
+}
@@ -0,0 +1,6 @@
+package db
+
+// Tag is a user defined label on items, items and tags are linked through the item_tags table.
+type Tag struct {
+	Name string `gorm:"primaryKey"`
+}
@@ -0,0 +1,49 @@
+package db
+
+import "time"
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook posts the events of the given types to URL, signed with Secret. Its feed, folder
+// and saved search, when set, restrict which events it gets. The secret is only shown once,
+// when the webhook is created.
+type Webhook struct {
+	ID            string   `gorm:"primaryKey"`
+	URL           string   `gorm:"not null"`
+	Secret        string   `gorm:"not null" json:"-"`
+	EventTypes    []string `gorm:"serializer:json"`
+	FeedID        string
+	FolderID      string
+	SavedSearchID string
+	CreatedAt     time.Time
+}
+
+// WebhookDelivery is the payload of an event queued for a webhook, retried until it's delivered or failed for good.
+type WebhookDelivery struct {
+	ID            string `gorm:"primaryKey"`
+	WebhookID     string `gorm:"not null;index"`
+	EventID       int64
+	EventType     string
+	Payload       string `gorm:"type:text"`
+	Status        string `gorm:"not null;index"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index;type:datetime"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time `gorm:"index"`
+
+	AttemptLog []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookAttempt records a try at sending a delivery, StatusCode is 0 when there was no response.
+type WebhookAttempt struct {
+	ID         uint   `gorm:"primaryKey"`
+	DeliveryID string `gorm:"not null;index"`
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
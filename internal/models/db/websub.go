@@ -0,0 +1,21 @@
+package db
+
+import "time"
+
+const (
+	WebSubStatePending = "pending"
+	WebSubStateActive  = "active"
+	WebSubStateDenied  = "denied"
+)
+
+// WebSubSubscription tracks a push subscription of a feed to its WebSub hub.
+type WebSubSubscription struct {
+	FeedID       string `gorm:"primaryKey"`
+	HubURL       string `gorm:"not null"`
+	TopicURL     string `gorm:"not null"`
+	Secret       string `gorm:"not null"`
+	State        string `gorm:"not null;index"`
+	LeaseSeconds int
+	ExpiresAt    time.Time `gorm:"index;type:datetime"`
+	UpdatedAt    time.Time
+}
@@ -2,21 +2,253 @@ package models
 
 import (
 	"llrss/internal/models/db"
+	"llrss/internal/search"
 	"time"
 )
 
 type SearchParams struct {
 	FromDate time.Time
 	ToDate   time.Time
-	Query    string
-	Sort     string
-	Limit    int
-	Offset   int
-	Unread   bool
+	// OlderThan restricts the search to the items published strictly before it.
+	OlderThan time.Time
+	Query     string
+	// Filter is the parsed Query, when set it's used instead of it.
+	Filter         search.Expr
+	Sort           string
+	Limit          int
+	Offset         int
+	FolderID       string
+	FeedIDs        []string
+	ExcludeFeedIDs []string
+	// ItemIDs restricts the search to the given items.
+	ItemIDs []string
+	// Undigested restricts the search to the items the digest with this ID hasn't sent yet.
+	Undigested string
+	// SavedSince restricts the search to the items saved since then.
+	SavedSince time.Time
+	Tags       []string
+	Unread     bool
+	Starred    bool
+	// Cursor, when set, replaces Offset to page from a given item.
+	Cursor *Cursor
+}
+
+// Cursor is a position in the search results, the pages either start after
+// the item or end before it.
+type Cursor struct {
+	PubDate time.Time
+	ID      string
+	Before  bool
+}
+
+// ItemCount is how many items a feed has, and how many of them are unread.
+type ItemCount struct {
+	Unread int64
+	Total  int64
+}
+
+// FeedCount is a feed with its item counts.
+type FeedCount struct {
+	db.Feed
+	ItemCount
+}
+
+// Counts are the item counts of every feed, and their sum.
+type Counts struct {
+	ItemCount
+	Feeds map[string]ItemCount
+}
+
+// SavedSearchCount is a saved search with how many unread items match it.
+type SavedSearchCount struct {
+	db.SavedSearch
+	Unread int64
+}
+
+// MarkResult is the number of items whose read status was changed by a bulk mark.
+type MarkResult struct {
+	Updated int64
 }
 
 type SearchResult struct {
 	Items []db.Item
+	// Tags counts the tags of all the items matching the search, not only the ones in this page.
+	Tags  []TagCount
 	Len   int64
 	Total int64
+	// NextCursor and PrevCursor page from the last and first item, they're empty when there's no such page.
+	NextCursor string
+	PrevCursor string
+}
+
+type TagCount struct {
+	Tag   string
+	Count int64
+}
+
+// WebSubVerification is the intent verification request sent by a WebSub hub.
+type WebSubVerification struct {
+	Mode         string
+	Topic        string
+	Challenge    string
+	Reason       string
+	LeaseSeconds int
+}
+
+// PurgeReport lists the items deleted, or to be deleted on a dry run, by the retention policies.
+type PurgeReport struct {
+	Feeds  []FeedPurge
+	Total  int64
+	DryRun bool
+}
+
+type FeedPurge struct {
+	Policy db.RetentionPolicy
+	FeedID string
+	Title  string
+	Items  []db.Item
+	Count  int64
+}
+
+// FolderCount is a folder with the unread items of its feeds, including the ones in its subfolders.
+type FolderCount struct {
+	db.Folder
+	Unread int64
+}
+
+// FolderTree is the whole subscription list, grouped by folder.
+type FolderTree struct {
+	Folders []FolderNode
+	// Feeds are the ones not in any folder.
+	Feeds []db.Feed
+}
+
+type FolderNode struct {
+	Folder   db.Folder
+	Feeds    []db.Feed
+	Children []FolderNode
+	Unread   int64
+}
+
+const (
+	OutlineAdded  = "added"
+	OutlineExists = "exists"
+	OutlineFailed = "failed"
+	// OutlinePending is for the feeds still being added when the import returns.
+	OutlinePending = "pending"
+)
+
+// ImportReport is the result of an OPML import, with an entry per feed outline.
+type ImportReport struct {
+	Outlines []OutlineResult
+	Added    int
+	Existing int
+	Failed   int
+	Pending  int
+}
+
+// ExportFilter restricts an OPML export to a folder and/or a set of feeds, empty fields don't filter.
+type ExportFilter struct {
+	FolderID string
+	FeedIDs  []string
+}
+
+type OutlineResult struct {
+	Name   string
+	URL    string
+	Folder string
+	Status string
+	FeedID string
+	Error  string
+}
+
+// NumberedItem is an item with the integer ID mobile reader APIs know it by.
+type NumberedItem struct {
+	db.Item
+	Number int64
+}
+
+// NumberQuery selects the items matching Params by number: those between After and Before,
+// or those listed in Numbers, modified since ModifiedSince (unix seconds) when set. The sorting
+// and pagination of Params are ignored, items are ordered by number.
+type NumberQuery struct {
+	Params        SearchParams
+	After         int64
+	Before        int64
+	Numbers       []int64
+	ModifiedSince int64
+	Desc          bool
+	// Limit is the most items returned, all of them when it's not positive.
+	Limit int
+}
+
+// WebhookPayload is the body posted to webhooks for an event. Items are the new items of
+// items.added events and those matched by the rule of rule.matched ones, ItemIDs those
+// marked by read state changes, Count how many items a bulk mark changed.
+type WebhookPayload struct {
+	ID       int64
+	Type     string
+	Time     time.Time
+	RuleID   string        `json:",omitempty"`
+	FeedID   string        `json:",omitempty"`
+	FolderID string        `json:",omitempty"`
+	Feed     *WebhookFeed  `json:",omitempty"`
+	Items    []WebhookItem `json:",omitempty"`
+	ItemIDs  []string      `json:",omitempty"`
+	Count    int64         `json:",omitempty"`
+}
+
+type WebhookFeed struct {
+	ID      string
+	Title   string
+	URL     string
+	SiteURL string
+}
+
+type WebhookItem struct {
+	ID          string
+	Title       string
+	Link        string
+	Author      string
+	Description string
+	PubDate     time.Time
+}
+
+func NewWebhookItems(items []db.Item) []WebhookItem {
+	res := make([]WebhookItem, len(items))
+	for i, item := range items {
+		res[i] = WebhookItem{
+			ID:          item.ID,
+			Title:       item.Title,
+			Link:        item.Link,
+			Author:      item.Author,
+			Description: item.Description,
+			PubDate:     item.PubDate,
+		}
+	}
+	return res
+}
+
+// RuleResult is how many saved items a rule applied to.
+type RuleResult struct {
+	Matched int64
+}
+
+// DigestMessage is a rendered digest email.
+type DigestMessage struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// DigestResult is how many items a digest sent.
+type DigestResult struct {
+	Sent int
+}
+
+// Newsletter is a feed receiving the newsletters mailed to its address.
+type Newsletter struct {
+	FeedID  string
+	Title   string
+	Address string
 }
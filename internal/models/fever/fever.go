@@ -0,0 +1,63 @@
+// Package fever holds the types of the Fever API, spoken by mobile readers like Reeder.
+// See https://feedafever.com/api, IDs are integers and lists of IDs comma separated strings.
+package fever
+
+// APIVersion is the version of the Fever API implemented.
+const APIVersion = 3
+
+type Group struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// FeedsGroup lists the comma separated IDs of the feeds of a group.
+type FeedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type Feed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+// Favicon is an image as a data URI without its "data:" prefix, e.g. "image/gif;base64,...".
+type Favicon struct {
+	ID   int64  `json:"id"`
+	Data string `json:"data"`
+}
+
+type Item struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// ItemQuery selects the items of a page: those after SinceID in ascending order,
+// those before MaxID in descending order, or those listed in WithIDs.
+type ItemQuery struct {
+	SinceID int64
+	MaxID   int64
+	WithIDs []int64
+	Limit   int
+}
+
+// Mark is a change of status: Type is item, feed or group, As read, unread, saved or unsaved.
+// Feeds and groups can only be marked as read, up to Before (a unix timestamp).
+type Mark struct {
+	Type   string
+	As     string
+	ID     int64
+	Before int64
+}
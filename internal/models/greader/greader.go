@@ -0,0 +1,184 @@
+// Package greader holds the types of the Google Reader API, as spoken by NetNewsWire, FeedMe or Read You.
+//
+// Streams are named by IDs like "feed/{id}", "user/-/label/{folder or tag}" or the states below,
+// items by the integer they're numbered with, as a long hex tag or in decimal.
+package greader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// States are streams of items, and the categories items are added to and removed from to change their status.
+const (
+	StateReadingList = "user/-/state/com.google/reading-list"
+	StateRead        = "user/-/state/com.google/read"
+	StateStarred     = "user/-/state/com.google/starred"
+	StateKeptUnread  = "user/-/state/com.google/kept-unread"
+
+	FeedPrefix  = "feed/"
+	LabelPrefix = "user/-/label/"
+
+	itemIDPrefix = "tag:google.com,2005:reader/item/"
+)
+
+// ErrInvalidItemID is returned for item IDs that are neither in the long nor in the short form.
+var ErrInvalidItemID = errors.New("invalid item id")
+
+// LongItemID returns the long form of an item ID, e.g. tag:google.com,2005:reader/item/000000000000001f.
+func LongItemID(n int64) string {
+	return fmt.Sprintf("%s%016x", itemIDPrefix, uint64(n))
+}
+
+// ParseItemID parses an item ID given in the long form, or in the short (decimal) one.
+func ParseItemID(s string) (int64, error) {
+	if hex, ok := strings.CutPrefix(s, itemIDPrefix); ok {
+		n, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return 0, ErrInvalidItemID
+		}
+		return int64(n), nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidItemID
+	}
+	return n, nil
+}
+
+// NormalizeStreamID replaces the user ID of a stream by "-", clients may use either.
+func NormalizeStreamID(id string) string {
+	if rest, ok := strings.CutPrefix(id, "user/"); ok {
+		if _, path, ok := strings.Cut(rest, "/"); ok {
+			return "user/-/" + path
+		}
+	}
+	return id
+}
+
+type UserInfo struct {
+	UserID        string `json:"userId"`
+	UserName      string `json:"userName"`
+	UserProfileID string `json:"userProfileId"`
+	UserEmail     string `json:"userEmail"`
+}
+
+type Category struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type Subscription struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Categories []Category `json:"categories"`
+	URL        string     `json:"url"`
+	HTMLURL    string     `json:"htmlUrl"`
+	IconURL    string     `json:"iconUrl"`
+}
+
+type SubscriptionList struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// SubscriptionEdit is a change to a subscription, Action is subscribe, unsubscribe or edit.
+// Title renames the feed, AddLabel and RemoveLabel move it in and out of folders.
+type SubscriptionEdit struct {
+	Action      string
+	StreamID    string
+	Title       string
+	AddLabel    string
+	RemoveLabel string
+}
+
+type QuickAddResult struct {
+	NumResults int    `json:"numResults"`
+	Query      string `json:"query"`
+	StreamID   string `json:"streamId"`
+	StreamName string `json:"streamName"`
+}
+
+// Tag is a state, or a label with the type folder or tag.
+type Tag struct {
+	ID   string `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type TagList struct {
+	Tags []Tag `json:"tags"`
+}
+
+type UnreadCount struct {
+	ID    string `json:"id"`
+	Count int64  `json:"count"`
+}
+
+type UnreadCounts struct {
+	Max          int64         `json:"max"`
+	UnreadCounts []UnreadCount `json:"unreadcounts"`
+}
+
+// StreamQuery selects the items of a stream: Exclude and Include are states (e.g. exclude the
+// read items), OlderThan and NewerThan unix timestamps, Continuation the token of the previous page.
+type StreamQuery struct {
+	StreamID     string
+	Exclude      string
+	Include      string
+	Count        int
+	OldestFirst  bool
+	NewerThan    int64
+	OlderThan    int64
+	Continuation string
+}
+
+type ItemRef struct {
+	ID string `json:"id"`
+}
+
+type ItemRefs struct {
+	ItemRefs     []ItemRef `json:"itemRefs"`
+	Continuation string    `json:"continuation,omitempty"`
+}
+
+type Link struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type Content struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type Origin struct {
+	StreamID string `json:"streamId"`
+	Title    string `json:"title"`
+	HTMLURL  string `json:"htmlUrl"`
+}
+
+type Item struct {
+	ID            string   `json:"id"`
+	CrawlTimeMsec string   `json:"crawlTimeMsec"`
+	TimestampUsec string   `json:"timestampUsec"`
+	Published     int64    `json:"published"`
+	Updated       int64    `json:"updated"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author,omitempty"`
+	Canonical     []Link   `json:"canonical"`
+	Alternate     []Link   `json:"alternate"`
+	Summary       Content  `json:"summary"`
+	Categories    []string `json:"categories"`
+	Origin        Origin   `json:"origin"`
+}
+
+type Stream struct {
+	Direction    string `json:"direction"`
+	ID           string `json:"id"`
+	Title        string `json:"title,omitempty"`
+	Updated      int64  `json:"updated"`
+	Items        []Item `json:"items"`
+	Continuation string `json:"continuation,omitempty"`
+}
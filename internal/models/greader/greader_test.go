@@ -0,0 +1,29 @@
+package greader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemID(t *testing.T) {
+	assert.Equal(t, "tag:google.com,2005:reader/item/000000000000001f", LongItemID(31))
+
+	for _, id := range []string{"tag:google.com,2005:reader/item/000000000000001f", "31"} {
+		n, err := ParseItemID(id)
+		require.NoError(t, err, id)
+		assert.Equal(t, int64(31), n, id)
+	}
+
+	for _, id := range []string{"", "1f", "tag:google.com,2005:reader/item/xyz"} {
+		_, err := ParseItemID(id)
+		assert.ErrorIs(t, err, ErrInvalidItemID, id)
+	}
+}
+
+func TestNormalizeStreamID(t *testing.T) {
+	assert.Equal(t, StateRead, NormalizeStreamID("user/1234/state/com.google/read"))
+	assert.Equal(t, LabelPrefix+"Tech", NormalizeStreamID("user/-/label/Tech"))
+	assert.Equal(t, "feed/abc", NormalizeStreamID("feed/abc"))
+}
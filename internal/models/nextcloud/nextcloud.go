@@ -0,0 +1,99 @@
+// Package nextcloud holds the types of the Nextcloud News API v1-3, see
+// https://nextcloud.github.io/news/api/api-v1-3/. IDs are integers, dates unix timestamps.
+package nextcloud
+
+// Item types, what the ID of an item query refers to.
+const (
+	TypeFeed    = 0
+	TypeFolder  = 1
+	TypeStarred = 2
+	TypeAll     = 3
+)
+
+type Version struct {
+	Version string `json:"version"`
+}
+
+type Status struct {
+	Version  string   `json:"version"`
+	Warnings Warnings `json:"warnings"`
+}
+
+type Warnings struct {
+	ImproperlyConfiguredCron bool `json:"improperlyConfiguredCron"`
+	IncorrectDBCharset       bool `json:"incorrectDbCharset"`
+}
+
+type User struct {
+	UserID             string  `json:"userId"`
+	DisplayName        string  `json:"displayName"`
+	LastLoginTimestamp int64   `json:"lastLoginTimestamp"`
+	Avatar             *string `json:"avatar"`
+}
+
+type Folder struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Folders struct {
+	Folders []Folder `json:"folders"`
+}
+
+// Feed is a subscription, FolderID is 0 for feeds at the root.
+type Feed struct {
+	ID               int64   `json:"id"`
+	URL              string  `json:"url"`
+	Title            string  `json:"title"`
+	FaviconLink      *string `json:"faviconLink"`
+	Added            int64   `json:"added"`
+	FolderID         int64   `json:"folderId"`
+	UnreadCount      int64   `json:"unreadCount"`
+	Ordering         int     `json:"ordering"`
+	Link             string  `json:"link"`
+	Pinned           bool    `json:"pinned"`
+	UpdateErrorCount int     `json:"updateErrorCount"`
+	LastUpdateError  *string `json:"lastUpdateError"`
+}
+
+type Feeds struct {
+	Feeds        []Feed `json:"feeds"`
+	StarredCount int64  `json:"starredCount"`
+	NewestItemID int64  `json:"newestItemId,omitempty"`
+}
+
+type Item struct {
+	ID            int64   `json:"id"`
+	GUID          string  `json:"guid"`
+	GUIDHash      string  `json:"guidHash"`
+	URL           string  `json:"url"`
+	Title         string  `json:"title"`
+	Author        string  `json:"author"`
+	PubDate       int64   `json:"pubDate"`
+	Body          string  `json:"body"`
+	EnclosureMime *string `json:"enclosureMime"`
+	EnclosureLink *string `json:"enclosureLink"`
+	FeedID        int64   `json:"feedId"`
+	Unread        bool    `json:"unread"`
+	Starred       bool    `json:"starred"`
+	LastModified  int64   `json:"lastModified"`
+	RTL           bool    `json:"rtl"`
+	Fingerprint   string  `json:"fingerprint"`
+}
+
+type Items struct {
+	Items []Item `json:"items"`
+}
+
+// ItemQuery selects items: Type and ID say of what, Offset is the number of the last item
+// of the previous page (0 for the first one), BatchSize how many items a page has (-1 for all).
+// LastModified, when set, only returns the items changed since, read or not.
+type ItemQuery struct {
+	Type         int
+	ID           int64
+	BatchSize    int
+	Offset       int64
+	GetRead      bool
+	OldestFirst  bool
+	LastModified int64
+}
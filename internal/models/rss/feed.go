@@ -31,9 +31,19 @@ type Channel struct {
 	Rating         string   `xml:"rating,omitempty"`
 	SkipHours      string   `xml:"skipHours,omitempty"`
 	SkipDays       string   `xml:"skipDays,omitempty"`
-	Link           string   `xml:"link"`
-	Items          []Item   `xml:"item"`
-	TTL            int      `xml:"ttl,omitempty"`
+	// AtomLinks must come before Link, otherwise <atom:link> elements would end up in Link.
+	AtomLinks []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Link      string     `xml:"link"`
+	Items     []Item     `xml:"item"`
+	TTL       int        `xml:"ttl,omitempty"`
+}
+
+// AtomLink is an <atom:link> element, used by RSS feeds to advertise their
+// canonical (self) URL and WebSub hubs.
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
 }
 
 type Image struct {
@@ -53,8 +63,9 @@ type TextInput struct {
 	Link        string   `xml:"link"`
 }
 
+// Content is the <content:encoded> element of the RSS content module.
 type Content struct {
-	XMLName xml.Name `xml:"content:encoded"`
+	XMLName xml.Name `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
 	Content string   `xml:",cdata"`
 }
 
@@ -71,8 +82,8 @@ type Item struct {
 	GUID        *GUID
 	PubDate     string `xml:"pubDate,omitempty"`
 	Source      string `xml:"source,omitempty"`
-	FeedID      string
-	IsRead      bool
+	FeedID      string `xml:"-"`
+	IsRead      bool   `xml:"-"`
 }
 
 type Feed struct {
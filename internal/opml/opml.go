@@ -0,0 +1,92 @@
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// OPML is an OPML 1.0 or 2.0 document, see http://opml.org/spec2.opml.
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+type Head struct {
+	Title        string `xml:"title,omitempty"`
+	DateCreated  string `xml:"dateCreated,omitempty"`
+	DateModified string `xml:"dateModified,omitempty"`
+	OwnerName    string `xml:"ownerName,omitempty"`
+	Docs         string `xml:"docs,omitempty"`
+}
+
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is either a feed, when it has an XMLURL, or a folder of other outlines.
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+
+	// Some OPML 1.0 exporters don't respect the attributes' case.
+	LowerXMLURL string `xml:"xmlurl,attr,omitempty"`
+}
+
+// FeedURL returns the URL of the feed the outline subscribes to, if any.
+func (o *Outline) FeedURL() string {
+	if o.XMLURL != "" {
+		return strings.TrimSpace(o.XMLURL)
+	}
+	return strings.TrimSpace(o.LowerXMLURL)
+}
+
+// Name returns the name given to the outline, preferring its title to its text.
+func (o *Outline) Name() string {
+	if o.Title != "" {
+		return strings.TrimSpace(o.Title)
+	}
+	return strings.TrimSpace(o.Text)
+}
+
+// Parse reads an OPML document, honoring the encoding declared by its XML header.
+func Parse(r io.Reader) (*OPML, error) {
+	var doc OPML
+
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	// Hand edited subscription lists often have stray entities and unclosed tags
+	d.Strict = false
+
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse OPML: %w", err)
+	}
+	if doc.XMLName.Local != "opml" {
+		return nil, fmt.Errorf("parse OPML: unexpected root element %q", doc.XMLName.Local)
+	}
+
+	return &doc, nil
+}
+
+// Write encodes the document with an XML header.
+func Write(w io.Writer, doc *OPML) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("write OPML: %w", err)
+	}
+	return e.Flush()
+}
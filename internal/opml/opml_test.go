@@ -0,0 +1,110 @@
+package opml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Outline
+	}{
+		{
+			name: "opml 2.0 with folders",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Tech" title="Tech">
+      <outline type="rss" text="Hacker News" title="HN" xmlUrl="https://news.ycombinator.com/rss" htmlUrl="https://news.ycombinator.com/"/>
+    </outline>
+    <outline type="rss" text="Go Blog" xmlUrl="https://go.dev/blog/feed.atom"/>
+  </body>
+</opml>`,
+			expected: []Outline{
+				{
+					Text:  "Tech",
+					Title: "Tech",
+					Outlines: []Outline{
+						{Text: "Hacker News", Title: "HN", Type: "rss", XMLURL: "https://news.ycombinator.com/rss", HTMLURL: "https://news.ycombinator.com/"},
+					},
+				},
+				{Text: "Go Blog", Type: "rss", XMLURL: "https://go.dev/blog/feed.atom"},
+			},
+		},
+		{
+			name: "opml 1.0 with lowercase attributes",
+			input: `<?xml version="1.0"?>
+<opml version="1.0">
+  <body>
+    <outline text="Old Reader Export" xmlurl="http://example.com/rss.xml"/>
+  </body>
+</opml>`,
+			expected: []Outline{
+				{Text: "Old Reader Export", LowerXMLURL: "http://example.com/rss.xml"},
+			},
+		},
+		{
+			name: "latin-1 encoding",
+			input: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+				"<opml version=\"2.0\"><body><outline text=\"Caf\xe9\" xmlUrl=\"http://example.com/cafe\"/></body></opml>",
+			expected: []Outline{
+				{Text: "Café", XMLURL: "http://example.com/cafe"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, doc.Body.Outlines)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<rss version="2.0"><channel></channel></rss>`))
+	require.Error(t, err)
+
+	_, err = Parse(strings.NewReader(`not xml at all`))
+	require.Error(t, err)
+}
+
+func TestOutline(t *testing.T) {
+	o := Outline{Text: " Text ", LowerXMLURL: " http://example.com/feed "}
+	assert.Equal(t, "Text", o.Name())
+	assert.Equal(t, "http://example.com/feed", o.FeedURL())
+
+	o = Outline{Text: "Text", Title: "Title", XMLURL: "http://example.com/a", LowerXMLURL: "http://example.com/b"}
+	assert.Equal(t, "Title", o.Name())
+	assert.Equal(t, "http://example.com/a", o.FeedURL())
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	doc := &OPML{
+		Version: "2.0",
+		Head:    Head{Title: "Subscriptions"},
+		Body: Body{Outlines: []Outline{
+			{Text: "Tech & Science", Title: "Tech & Science", Outlines: []Outline{
+				{Text: "HN", Title: "HN", Type: "rss", XMLURL: "https://news.ycombinator.com/rss?a=1&b=2", HTMLURL: "https://news.ycombinator.com/"},
+			}},
+			{Text: "Go Blog", Title: "Go Blog", Type: "rss", XMLURL: "https://go.dev/blog/feed.atom"},
+		}},
+	}
+
+	var out strings.Builder
+	require.NoError(t, Write(&out, doc))
+	assert.True(t, strings.HasPrefix(out.String(), "<?xml"))
+
+	parsed, err := Parse(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	assert.Equal(t, "2.0", parsed.Version)
+	assert.Equal(t, doc.Head, parsed.Head)
+	assert.Equal(t, doc.Body.Outlines, parsed.Body.Outlines)
+}
@@ -0,0 +1,422 @@
+// Package readability extracts the article of a web page the way reader modes do: the
+// paragraphs are scored, the element holding the best ones is kept and cleaned up.
+package readability
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"llrss/internal/htmlutil"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MinArticleLength is how many characters of text an article needs, less is likely a teaser or a comment.
+const MinArticleLength = 250
+
+// ErrNoArticle is returned for pages without enough text to make an article.
+var ErrNoArticle = errors.New("no article found")
+
+type Article struct {
+	Title string
+	// Content is the article as sanitized HTML, with absolute links.
+	Content string
+	// Length is how many characters of text the article has.
+	Length int
+}
+
+var (
+	// unlikely classes and IDs are those of the parts of pages around articles, unless they
+	// also look like content.
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|legends|menu|modal|` +
+		`newsletter|pager|pagination|popup|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe`)
+	maybe = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|post|story|entry|text`)
+
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)hidden|^hid$|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|` +
+		`outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+
+	sentenceEnd = regexp.MustCompile(`\.( |$)`)
+)
+
+// junk elements are never part of articles.
+var junk = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Link: true, atom.Meta: true,
+	atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Svg: true, atom.Canvas: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true,
+}
+
+// blocks are the elements which a div holding none of is scored as a paragraph.
+var blocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true, atom.Div: true, atom.Dl: true,
+	atom.Figure: true, atom.Footer: true, atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Main: true, atom.Nav: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Ul: true,
+}
+
+// attributes are those kept on the elements of articles, all others are dropped.
+var attributes = map[atom.Atom][]string{
+	atom.A:   {"href", "title"},
+	atom.Img: {"src", "alt", "title", "width", "height"},
+	atom.Td:  {"colspan", "rowspan"},
+	atom.Th:  {"colspan", "rowspan"},
+}
+
+// Extract finds the article of the HTML page at pageURL, which its relative links are resolved against.
+func Extract(r io.Reader, pageURL *url.URL) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse HTML: %w", err)
+	}
+
+	body := find(doc, atom.Body)
+	if body == nil {
+		return nil, ErrNoArticle
+	}
+	prune(body)
+
+	scores := score(body)
+	var top *html.Node
+	for n, s := range scores {
+		if top == nil || s > scores[top] {
+			top = n
+		}
+	}
+	if top == nil {
+		return nil, ErrNoArticle
+	}
+
+	article := gather(top, scores)
+	clean(article, pageURL)
+
+	length := utf8.RuneCountInString(htmlutil.Text(article))
+	if length < MinArticleLength {
+		return nil, ErrNoArticle
+	}
+
+	var b strings.Builder
+	for c := article.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return nil, fmt.Errorf("render article: %w", err)
+		}
+	}
+
+	return &Article{
+		Title:   title(doc),
+		Content: b.String(),
+		Length:  length,
+	}, nil
+}
+
+// prune removes the junk elements, the hidden ones and those unlikely to be part of the article.
+func prune(root *html.Node) {
+	var removed []*html.Node
+	htmlutil.Walk(root, func(n *html.Node) bool {
+		if n.Type == html.CommentNode {
+			removed = append(removed, n)
+			return false
+		}
+		if n.Type != html.ElementNode {
+			return true
+		}
+
+		match := htmlutil.Attr(n, "class") + " " + htmlutil.Attr(n, "id")
+		style := strings.ReplaceAll(htmlutil.Attr(n, "style"), " ", "")
+		switch {
+		case junk[n.DataAtom],
+			htmlutil.HasAttr(n, "hidden"), htmlutil.Attr(n, "aria-hidden") == "true", strings.Contains(style, "display:none"),
+			n.DataAtom != atom.Body && n.DataAtom != atom.Article && n.DataAtom != atom.Main &&
+				unlikely.MatchString(match) && !maybe.MatchString(match):
+			removed = append(removed, n)
+			return false
+		}
+		return true
+	})
+
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// score scores the elements holding paragraphs by how much text they have, and returns
+// the scores of the candidates for the article.
+func score(root *html.Node) map[*html.Node]float64 {
+	scores := make(map[*html.Node]float64)
+	htmlutil.Walk(root, func(n *html.Node) bool {
+		if !paragraph(n) {
+			return true
+		}
+
+		text := htmlutil.Text(n)
+		if len(text) < 25 {
+			return false
+		}
+
+		// A point for the paragraph, per comma, and per 100 characters up to 3
+		s := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+		for level, a := 0, n.Parent; level < 3 && a != nil && a.Type == html.ElementNode; level, a = level+1, a.Parent {
+			if _, ok := scores[a]; !ok {
+				scores[a] = initialScore(a)
+			}
+			switch level {
+			case 0:
+				scores[a] += s
+			case 1:
+				scores[a] += s / 2
+			default:
+				scores[a] += s / float64(level*3)
+			}
+		}
+		return false
+	})
+
+	// Navigation is mostly links
+	for n, s := range scores {
+		scores[n] = s * (1 - linkDensity(n))
+	}
+	return scores
+}
+
+// paragraph tells if the element is scored as a paragraph.
+func paragraph(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	switch n.DataAtom {
+	case atom.P, atom.Pre, atom.Td:
+		return true
+	case atom.Div, atom.Section:
+		inline := true
+		htmlutil.Walk(n, func(c *html.Node) bool {
+			if c != n && c.Type == html.ElementNode && blocks[c.DataAtom] {
+				inline = false
+			}
+			return inline
+		})
+		return inline
+	default:
+		return false
+	}
+}
+
+func initialScore(n *html.Node) float64 {
+	s := classWeight(n)
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		s += 10
+	case atom.Div:
+		s += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s -= 5
+	}
+	return s
+}
+
+// classWeight scores the class and ID of an element by whether they look like content.
+func classWeight(n *html.Node) float64 {
+	var w float64
+	for _, v := range []string{htmlutil.Attr(n, "class"), htmlutil.Attr(n, "id")} {
+		if v == "" {
+			continue
+		}
+		if negative.MatchString(v) {
+			w -= 25
+		}
+		if positive.MatchString(v) {
+			w += 25
+		}
+	}
+	return w
+}
+
+// gather moves the top candidate into a new element, along with its siblings which look
+// like they belong to the article too, e.g. paragraphs split off from the rest.
+func gather(top *html.Node, scores map[*html.Node]float64) *html.Node {
+	article := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	if top.Parent == nil || top.DataAtom == atom.Body {
+		for c := top.FirstChild; c != nil; {
+			next := c.NextSibling
+			top.RemoveChild(c)
+			article.AppendChild(c)
+			c = next
+		}
+		return article
+	}
+
+	threshold := max(10, scores[top]*0.2)
+	class := htmlutil.Attr(top, "class")
+
+	var siblings []*html.Node
+	for c := top.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c == top {
+			siblings = append(siblings, c)
+			continue
+		}
+		if c.Type != html.ElementNode {
+			continue
+		}
+
+		bonus := 0.0
+		if class != "" && htmlutil.Attr(c, "class") == class {
+			bonus = scores[top] * 0.2
+		}
+		if s, ok := scores[c]; ok && s+bonus >= threshold {
+			siblings = append(siblings, c)
+			continue
+		}
+
+		if c.DataAtom == atom.P {
+			text := htmlutil.Text(c)
+			density := linkDensity(c)
+			if len(text) > 80 && density < 0.25 || len(text) <= 80 && density == 0 && sentenceEnd.MatchString(text) {
+				siblings = append(siblings, c)
+			}
+		}
+	}
+
+	for _, c := range siblings {
+		c.Parent.RemoveChild(c)
+		article.AppendChild(c)
+	}
+	return article
+}
+
+// clean removes what's left of the page around the text of the article, and the
+// attributes of its elements but for links and images, made absolute.
+func clean(article *html.Node, pageURL *url.URL) {
+	var removed, unwrapped []*html.Node
+	htmlutil.Walk(article, func(n *html.Node) bool {
+		if n == article || n.Type != html.ElementNode {
+			return true
+		}
+
+		switch n.DataAtom {
+		case atom.Div, atom.Section, atom.Ul, atom.Ol, atom.Table:
+			w := classWeight(n)
+			if w < 0 || w < 25 && linkDensity(n) > 0.5 {
+				removed = append(removed, n)
+				return false
+			}
+		case atom.P:
+			if strings.TrimSpace(htmlutil.Text(n)) == "" && find(n, atom.Img) == nil {
+				removed = append(removed, n)
+				return false
+			}
+		case atom.Img:
+			// Lazy loaded images have their source elsewhere
+			if src := htmlutil.Attr(n, "data-src"); src != "" && (htmlutil.Attr(n, "src") == "" || strings.HasPrefix(htmlutil.Attr(n, "src"), "data:")) {
+				setAttr(n, "src", src)
+			}
+		}
+
+		var attrs []html.Attribute
+		for _, a := range n.Attr {
+			for _, k := range attributes[n.DataAtom] {
+				if a.Namespace == "" && a.Key == k {
+					attrs = append(attrs, a)
+				}
+			}
+		}
+		n.Attr = attrs
+
+		for i, a := range n.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			u, err := pageURL.Parse(strings.TrimSpace(a.Val))
+			if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+				n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+				if n.DataAtom == atom.A {
+					unwrapped = append(unwrapped, n)
+				} else {
+					removed = append(removed, n)
+				}
+				break
+			}
+			n.Attr[i].Val = u.String()
+		}
+		return true
+	})
+
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+	for _, n := range unwrapped {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			n.RemoveChild(c)
+			n.Parent.InsertBefore(c, n)
+			c = next
+		}
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// title returns the title of the page, from its Open Graph metadata or its title element.
+func title(doc *html.Node) string {
+	var og, t string
+	htmlutil.Walk(doc, func(n *html.Node) bool {
+		switch {
+		case n.DataAtom == atom.Meta && htmlutil.Attr(n, "property") == "og:title" && og == "":
+			og = htmlutil.Attr(n, "content")
+		case n.DataAtom == atom.Title && t == "":
+			t = htmlutil.Text(n)
+		}
+		return true
+	})
+
+	if og != "" {
+		return strings.TrimSpace(og)
+	}
+	return strings.TrimSpace(t)
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	htmlutil.Walk(n, func(c *html.Node) bool {
+		if found == nil && c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// linkDensity is the share of the text of a node which is inside links.
+func linkDensity(n *html.Node) float64 {
+	text := len(htmlutil.Text(n))
+	if text == 0 {
+		return 0
+	}
+
+	var links int
+	htmlutil.Walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			links += len(htmlutil.Text(c))
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(text)
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,78 @@
+package readability
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Go 1.24 is released - The Go Blog</title>
+  <meta property="og:title" content="Go 1.24 is released">
+  <script>var tracking = "Lorem ipsum, dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor.";</script>
+</head>
+<body>
+  <header class="site-header"><a href="/">The Go Blog</a></header>
+  <nav><ul><li><a href="/blog">Blog</a></li><li><a href="/doc">Documentation</a></li><li><a href="/play">Playground</a></li></ul></nav>
+  <div id="main">
+    <div class="article-body">
+      <h1>Go 1.24 is released</h1>
+      <p>Today the Go team is very happy to announce the release of Go 1.24, which you can get by visiting the
+         <a href="/dl/" onclick="track()">download page</a>.</p>
+      <p>Go 1.24 comes with many improvements over Go 1.23, including generic type aliases, a faster map
+         implementation, weak pointers, and new tools for benchmarks, all while keeping the promise of compatibility.</p>
+      <p><img src="data:image/gif;base64,R0lGODlh" data-src="img/gopher.png" alt="Gopher" class="lazy"></p>
+      <p>As always, we thank everyone who contributed to this release by writing code, filing bugs, sharing
+         feedback, and testing the release candidates. Your efforts helped to ensure that Go 1.24 is stable.</p>
+      <p><a href="javascript:share()">Share this post</a></p>
+      <div class="share-widget"><a href="https://twitter.com/share">Tweet</a> <a href="https://facebook.com/share">Share</a></div>
+    </div>
+    <p>Enjoy Go 1.24, and happy hacking, from all of us on the Go team at Google and in the community.</p>
+  </div>
+  <div class="sidebar">
+    <p>Subscribe to the newsletter, get the latest posts, news, talks and updates about Go every week.</p>
+  </div>
+  <div class="comments">
+    <p>First, I love this release, thanks a lot, it's amazing, wow, really, so good, thanks, again.</p>
+  </div>
+  <footer><p>Copyright Google, all rights reserved, terms of service, privacy policy, contact us today.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	u, _ := url.Parse("https://go.dev/blog/go1.24")
+	article, err := Extract(strings.NewReader(page), u)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Go 1.24 is released", article.Title)
+	assert.Greater(t, article.Length, MinArticleLength)
+
+	assert.Contains(t, article.Content, "Today the Go team is very happy")
+	assert.Contains(t, article.Content, "keeping the promise of compatibility")
+	assert.Contains(t, article.Content, "happy hacking", "the paragraph next to the article is kept")
+	assert.Contains(t, article.Content, `<a href="https://go.dev/dl/">download page</a>`, "links are absolute without events")
+	assert.Contains(t, article.Content, `<img src="https://go.dev/blog/img/gopher.png" alt="Gopher"/>`, "lazy images are loaded")
+	assert.Contains(t, article.Content, "Share this post", "javascript links are unwrapped")
+
+	for _, s := range []string{"javascript:", "Tweet", "tracking", "Playground", "Subscribe", "I love this release", "Copyright", "class="} {
+		assert.NotContains(t, article.Content, s)
+	}
+}
+
+func TestExtractNoArticle(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	for name, doc := range map[string]string{
+		"empty":  "",
+		"teaser": `<html><body><div class="post"><p>A short teaser of the post, read more on the site.</p></div></body></html>`,
+		"links": `<html><body><ul>` + strings.Repeat(`<li><a href="/a">A link to another page of the site, with a long title</a></li>`, 20) +
+			`</ul></body></html>`,
+	} {
+		_, err := Extract(strings.NewReader(doc), u)
+		assert.ErrorIs(t, err, ErrNoArticle, name)
+	}
+}
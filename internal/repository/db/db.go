@@ -8,20 +8,23 @@ import (
 	"llrss/internal/models/db"
 	"llrss/internal/repository"
 	"llrss/internal/text"
+	"slices"
 	"strings"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-var ErrFeedNotFound = errors.New("feed not found")
+var ErrFeedNotFound = repository.ErrFeedNotFound
 
 type gormFeedRepository struct {
 	d *gorm.DB
+	// fts is set when items can be searched with the items_fts index, see migrateItemSearch.
+	fts bool
 }
 
 func NewGormFeedRepository(d *gorm.DB) repository.FeedRepository {
-	return &gormFeedRepository{d: d}
+	return &gormFeedRepository{d: d, fts: hasItemSearch(d)}
 }
 
 func (r *gormFeedRepository) GetFeed(_ context.Context, id string) (*db.Feed, error) {
@@ -71,19 +74,36 @@ func (r *gormFeedRepository) SaveFeed(ctx context.Context, feed *db.Feed) (strin
 		return "", res.Error
 	}
 
-	err := r.SaveFeedItems(ctx, feed.ID, items)
+	_, err := r.SaveFeedItems(ctx, feed.ID, items)
 	if err != nil {
 		fmt.Printf("failed to save feed items: %v\n", err)
 	}
 	return feed.ID, nil
 }
 
-func (r *gormFeedRepository) SaveFeedItems(_ context.Context, feedID string, items []db.Item) error {
+// SaveFeedItems inserts the items which aren't saved yet, and returns them.
+// Items which were deleted aren't saved again, see db.DeletedItem.
+func (r *gormFeedRepository) SaveFeedItems(_ context.Context, feedID string, items []db.Item) ([]db.Item, error) {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = text.URLToID(item.Link)
+	}
+	deleted, err := r.deletedItems(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []db.Item
 	for _, item := range items {
 		item.ID = text.URLToID(item.Link)
+		if deleted[item.ID] {
+			continue
+		}
 		item.FeedID = feedID
 		item.Title = strings.TrimSpace(item.Title)
 		item.Description = text.CleanDescription(item.Description)
+		// SQLite compares dates as text, which only sorts them right with the same offset
+		item.PubDate = item.PubDate.UTC()
 
 		// NOTE: If multiple feeds try to create the same item (URL as ID), we don't add it but neither fail
 		res := r.d.Clauses(clause.OnConflict{DoNothing: true}).Create(&item)
@@ -91,16 +111,92 @@ func (r *gormFeedRepository) SaveFeedItems(_ context.Context, feedID string, ite
 			fmt.Printf("failed to save item: %v\n", res.Error)
 			continue
 		}
+		if res.RowsAffected > 0 {
+			added = append(added, item)
+		}
+	}
+	return added, nil
+}
+
+// deletedItems returns which of the items were deleted.
+func (r *gormFeedRepository) deletedItems(ids []string) (map[string]bool, error) {
+	deleted := make(map[string]bool)
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(ids))
+		var found []string
+		if err := r.d.Model(&db.DeletedItem{}).Where("id IN ?", ids[start:end]).Pluck("id", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			deleted[id] = true
+		}
+	}
+	return deleted, nil
+}
+
+// PruneDeletedItems forgets the deleted items of a feed which aren't among its items anymore,
+// they can't come back with a refresh.
+func (r *gormFeedRepository) PruneDeletedItems(_ context.Context, feedID string, items []db.Item) error {
+	ids := make(map[string]bool, len(items))
+	for _, item := range items {
+		ids[text.URLToID(item.Link)] = true
+	}
+
+	var deleted []string
+	if err := r.d.Model(&db.DeletedItem{}).Where("feed_id = ?", feedID).Pluck("id", &deleted).Error; err != nil {
+		return err
+	}
+	var gone []string
+	for _, id := range deleted {
+		if !ids[id] {
+			gone = append(gone, id)
+		}
+	}
+
+	for start := 0; start < len(gone); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(gone))
+		if err := r.d.Where("id IN ?", gone[start:end]).Delete(&db.DeletedItem{}).Error; err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (r *gormFeedRepository) DeleteFeed(_ context.Context, id string) error {
 	return r.d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM item_tags WHERE item_id IN (SELECT id FROM items WHERE feed_id = ?)", id).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM digest_items WHERE item_id IN (SELECT id FROM items WHERE feed_id = ?)", id).Error; err != nil {
+			return err
+		}
+
 		if err := tx.Where("feed_id = ?", id).Delete(&db.Item{}).Error; err != nil {
 			return err
 		}
 
+		if err := tx.Where("feed_id = ?", id).Delete(&db.WebSubSubscription{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("feed_id = ?", id).Delete(&db.DeletedItem{}).Error; err != nil {
+			return err
+		}
+
+		// Webhooks restricted to the feed won't get any event
+		err := tx.Exec(`DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries
+			WHERE webhook_id IN (SELECT id FROM webhooks WHERE feed_id = ?))`, id).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE feed_id = ?)", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ?", id).Delete(&db.Webhook{}).Error; err != nil {
+			return err
+		}
+
 		if err := tx.Delete(&db.Feed{}, "id = ?", id).Error; err != nil {
 			return err
 		}
@@ -117,11 +213,24 @@ func (r *gormFeedRepository) UpdateFeed(_ context.Context, feed *db.Feed) error
 	return nil
 }
 
+func (r *gormFeedRepository) UpdateFeedFields(_ context.Context, feed *db.Feed, columns ...string) error {
+	res := r.d.Model(&db.Feed{}).Where("id = ?", feed.ID).Select(columns).Updates(feed)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
 func (r *gormFeedRepository) GetFeedItem(ctx context.Context, id string) (*db.Item, error) {
 	i := &db.Item{}
 	res := r.d.First(i, "id = ?", id)
-	fmt.Println(id, i)
 	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrItemNotFound
+		}
 		fmt.Printf("failed to get feed item: %v\n", res.Error)
 		return nil, res.Error
 	}
@@ -132,64 +241,251 @@ func (r *gormFeedRepository) UpdateFeedItem(_ context.Context, s *db.Item) error
 	return r.d.Save(s).Error
 }
 
+// CountItems returns the unread and total items of the given feeds, or of all of them
+// when none is given. Feeds without items are left out.
+func (r *gormFeedRepository) CountItems(_ context.Context, feedIDs ...string) (map[string]models.ItemCount, error) {
+	var rows []struct {
+		FeedID string
+		models.ItemCount
+	}
+
+	query := r.d.Model(&db.Item{}).
+		Select("feed_id, SUM(CASE WHEN is_read THEN 0 ELSE 1 END) AS unread, COUNT(*) AS total").
+		Group("feed_id")
+	if len(feedIDs) > 0 {
+		query = query.Where("feed_id IN ?", feedIDs)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]models.ItemCount, len(rows))
+	for _, row := range rows {
+		counts[row.FeedID] = row.ItemCount
+	}
+	return counts, nil
+}
+
+// MarkItemsRead sets the read status of all the items matching the search in a single
+// UPDATE, returning how many items changed. Sorting and pagination are ignored.
+func (r *gormFeedRepository) MarkItemsRead(_ context.Context, params models.SearchParams, read bool) (int64, error) {
+	res := r.filterItems(r.d.Model(&db.Item{}), params).
+		Where("is_read = ?", !read).
+		Update("is_read", read)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
 func (r *gormFeedRepository) SearchFeedItems(_ context.Context, params models.SearchParams) ([]db.Item, int64, error) {
 	var items []db.Item
 	var total int64
 	var err error
 
 	// Start building the query
-	query := r.d.Model(&db.Item{})
+	query := r.filterItems(r.d.Model(&db.Item{}), params)
+
+	// Count total before applying pagination, the total doesn't depend on the cursor
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Rank and highlight the items matching the full-text search
+	relevance := false
+	if match := r.rankingMatch(params); match != "" {
+		query = query.
+			Select("items.*, snippet(items_fts, -1, '<mark>', '</mark>', '…', 16) AS snippet").
+			Joins("JOIN item_numbers ON item_numbers.id = items.id").
+			Joins("JOIN items_fts ON items_fts.rowid = item_numbers.number AND items_fts MATCH ?", match)
+		if params.Sort == "relevance" {
+			// Matches in the title weigh the most, then the author
+			query = query.Order("bm25(items_fts, 10.0, 2.0, 1.0, 5.0)")
+			relevance = true
+		}
+	}
 
-	// Apply text search if query is provided
-	if params.Query != "" {
-		searchPattern := "%" + params.Query + "%"
+	// Apply sorting, the ID breaks ties between items published at the same time
+	asc := params.Sort == "asc"
+	if params.Cursor != nil && params.Cursor.Before {
+		// Read backwards from the cursor, the items are put back in order below
+		asc = !asc
+	}
+	if asc {
+		query = query.Order("items.pub_date asc, items.id asc")
+	} else {
+		query = query.Order("items.pub_date desc, items.id desc")
+	}
+
+	// Apply pagination, with either the cursor or the offset. Cursors follow the
+	// publication date, so they can't page by relevance.
+	if c := params.Cursor; c != nil && !relevance {
+		op := "<"
+		if asc {
+			op = ">"
+		}
 		query = query.Where(
-			"title LIKE ? OR description LIKE ? OR author LIKE ? OR category LIKE ?",
+			"items.pub_date "+op+" ? OR (items.pub_date = ? AND items.id "+op+" ?)",
+			c.PubDate, c.PubDate, c.ID,
+		)
+	} else {
+		query = query.Offset(params.Offset)
+	}
+	query = query.Limit(params.Limit)
+
+	// Execute the final query
+	err = query.Preload("Tags").Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if params.Cursor != nil && params.Cursor.Before {
+		slices.Reverse(items)
+	}
+
+	return items, total, nil
+}
+
+// CountItemTags returns how many of the items matching the search have each tag, most used first.
+func (r *gormFeedRepository) CountItemTags(_ context.Context, params models.SearchParams) ([]models.TagCount, error) {
+	matching := r.filterItems(r.d.Model(&db.Item{}), params).Select("id")
+
+	var counts []models.TagCount
+	res := r.d.Table("item_tags").
+		Select("tag_name AS tag, COUNT(*) AS count").
+		Where("item_id IN (?)", matching).
+		Group("tag_name").
+		Order("count desc, tag_name asc").
+		Scan(&counts)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return counts, nil
+}
+
+// filterItems applies the search filters, but not sorting and pagination, to an items query.
+// Columns are qualified, as SearchFeedItems joins items_fts which has some of the same columns.
+func (r *gormFeedRepository) filterItems(query *gorm.DB, params models.SearchParams) *gorm.DB {
+	// Apply text search if query is provided, with the full-text index when there's one.
+	// A parsed query replaces the raw one.
+	if params.Filter != nil {
+		where, args := r.compileFilter(params.Filter)
+		query = query.Where(where, args...)
+	} else if q := strings.TrimSpace(params.Query); r.fts && q != "" {
+		query = query.Where(itemsMatching, matchQuery(q))
+	} else if q != "" {
+		searchPattern := "%" + q + "%"
+		query = query.Where(
+			"items.title LIKE ? OR items.description LIKE ? OR items.author LIKE ? OR items.category LIKE ?",
 			searchPattern, searchPattern, searchPattern, searchPattern,
 		)
 	}
 
 	// Apply unread filter
 	if params.Unread {
-		query = query.Where("is_read = ?", false)
+		query = query.Where("items.is_read = ?", false)
 	}
 
-	// Apply date range
-	query = query.Where("pub_date BETWEEN ? AND ?", params.FromDate, params.ToDate)
+	// Apply starred filter
+	if params.Starred {
+		query = query.Where("items.is_starred = ?", true)
+	}
 
-	// Count total before applying pagination
-	err = query.Count(&total).Error
-	if err != nil {
-		return nil, 0, err
+	// Apply folder filter, including its subfolders
+	if params.FolderID != "" {
+		query = query.Where(
+			"items.feed_id IN (SELECT feeds.id FROM feeds JOIN folders ON folders.id = feeds.folder_id WHERE folders.id = ? OR folders.parent_id = ?)",
+			params.FolderID, params.FolderID,
+		)
 	}
 
-	// Apply sorting
-	if params.Sort == "asc" {
-		query = query.Order("pub_date asc")
-	} else {
-		query = query.Order("pub_date desc")
+	// Apply feeds filter
+	if len(params.FeedIDs) > 0 {
+		query = query.Where("items.feed_id IN ?", params.FeedIDs)
+	}
+	if len(params.ExcludeFeedIDs) > 0 {
+		query = query.Where("items.feed_id NOT IN ?", params.ExcludeFeedIDs)
 	}
 
-	// Apply pagination
-	query = query.Offset(params.Offset).Limit(params.Limit)
+	// Apply items filter
+	if len(params.ItemIDs) > 0 {
+		query = query.Where("items.id IN ?", params.ItemIDs)
+	}
 
-	// Execute the final query
-	err = query.Find(&items).Debug().Error
-	if err != nil {
-		return nil, 0, err
+	// Apply digest filter
+	if params.Undigested != "" {
+		query = query.Where("items.id NOT IN (SELECT item_id FROM digest_items WHERE digest_id = ?)", params.Undigested)
 	}
 
-	return items, total, nil
+	// Apply saved time filter
+	if !params.SavedSince.IsZero() {
+		query = query.Where("items.created_at >= ?", params.SavedSince.Unix())
+	}
+
+	// Apply tags filter, items must have all of them
+	if len(params.Tags) > 0 {
+		query = query.Where(
+			"items.id IN (SELECT item_id FROM item_tags WHERE tag_name IN ? GROUP BY item_id HAVING COUNT(DISTINCT tag_name) = ?)",
+			params.Tags, len(params.Tags),
+		)
+	}
+
+	// Apply date range, a zero bound leaves that side open. Dates are stored in UTC and
+	// compared as text, so the bounds must be in UTC too.
+	if !params.FromDate.IsZero() {
+		query = query.Where("items.pub_date >= ?", params.FromDate.UTC())
+	}
+	if !params.ToDate.IsZero() {
+		query = query.Where("items.pub_date <= ?", params.ToDate.UTC())
+	}
+	if !params.OlderThan.IsZero() {
+		query = query.Where("items.pub_date < ?", params.OlderThan.UTC())
+	}
+
+	return query
 }
 
-func (r *gormFeedRepository) Nuke(_ context.Context) error {
-	res := r.d.Unscoped().Where("1 = 1").Delete(&db.Item{})
+func (r *gormFeedRepository) AddItemTag(_ context.Context, itemID, tag string) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		item := &db.Item{ID: itemID}
+		if err := tx.Select("id").First(item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return repository.ErrItemNotFound
+			}
+			return err
+		}
+
+		// Append creates the tag if it doesn't exist yet and ignores existing links
+		return tx.Model(item).Association("Tags").Append(&db.Tag{Name: tag})
+	})
+}
+
+func (r *gormFeedRepository) RemoveItemTag(_ context.Context, itemID, tag string) error {
+	res := r.d.Exec("DELETE FROM item_tags WHERE item_id = ? AND tag_name = ?", itemID, tag)
 	if res.Error != nil {
 		return res.Error
 	}
-	res = r.d.Unscoped().Where("1 = 1").Delete(&db.Feed{})
-	if res.Error != nil {
-		return res.Error
+	if res.RowsAffected == 0 {
+		return repository.ErrTagNotFound
 	}
 	return nil
 }
+
+func (r *gormFeedRepository) Nuke(_ context.Context) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM item_tags").Error; err != nil {
+			return err
+		}
+
+		for _, model := range []any{
+			&db.Tag{}, &db.Item{}, &db.WebSubSubscription{}, &db.DeletedItem{}, &db.Feed{}, &db.Folder{}, &db.SavedSearch{},
+			&db.WebhookAttempt{}, &db.WebhookDelivery{}, &db.Webhook{}, &db.Rule{}, &db.DigestItem{}, &db.Digest{},
+		} {
+			if err := tx.Unscoped().Where("1 = 1").Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
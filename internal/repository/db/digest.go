@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormDigestRepository struct {
+	d *gorm.DB
+}
+
+func NewGormDigestRepository(d *gorm.DB) repository.DigestRepository {
+	return &gormDigestRepository{d: d}
+}
+
+func (r *gormDigestRepository) GetDigest(_ context.Context, id string) (*db.Digest, error) {
+	var digest db.Digest
+	res := r.d.First(&digest, "id = ?", id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrDigestNotFound
+		}
+		return nil, res.Error
+	}
+	return &digest, nil
+}
+
+func (r *gormDigestRepository) ListDigests(_ context.Context) ([]db.Digest, error) {
+	var digests []db.Digest
+	res := r.d.Order("name asc").Find(&digests)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return digests, nil
+}
+
+func (r *gormDigestRepository) SaveDigest(_ context.Context, digest *db.Digest) error {
+	return r.d.Save(digest).Error
+}
+
+func (r *gormDigestRepository) DeleteDigest(_ context.Context, id string) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&db.Digest{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrDigestNotFound
+		}
+		return tx.Where("digest_id = ?", id).Delete(&db.DigestItem{}).Error
+	})
+}
+
+func (r *gormDigestRepository) MarkDigested(_ context.Context, digestID string, itemIDs []string, sentAt time.Time) error {
+	sentAt = sentAt.UTC()
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		if len(itemIDs) > 0 {
+			items := make([]db.DigestItem, len(itemIDs))
+			for i, id := range itemIDs {
+				items[i] = db.DigestItem{DigestID: digestID, ItemID: id, SentAt: sentAt}
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(items, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&db.Digest{}).Where("id = ?", digestID).Update("last_sent_at", sentAt).Error
+	})
+}
+
+func (r *gormDigestRepository) PruneDigested(_ context.Context) (int64, error) {
+	res := r.d.Where("item_id NOT IN (SELECT id FROM items)").Delete(&db.DigestItem{})
+	return res.RowsAffected, res.Error
+}
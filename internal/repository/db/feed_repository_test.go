@@ -0,0 +1,582 @@
+package sqlite
+
+import (
+	"context"
+	"llrss/internal/config"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/search"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a private in-memory database with the full schema.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	d, err := config.InitDatabase(&config.DatabaseConfig{
+		DBPath: "file:" + url.PathEscape(t.Name()) + "?mode=memory&cache=shared",
+	})
+	require.NoError(t, err)
+	require.NoError(t, AutoMigrate(d))
+
+	t.Cleanup(func() {
+		sqlDB, _ := d.DB()
+		sqlDB.Close()
+	})
+
+	return d
+}
+
+// seedItems creates a feed with the given items, filling in the fields they don't set.
+func seedItems(t *testing.T, d *gorm.DB, feedID string, items []db.Item) {
+	t.Helper()
+
+	require.NoError(t, d.Create(&db.Feed{ID: feedID, URL: "http://example.com/" + feedID, Title: feedID}).Error)
+
+	base := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	for i := range items {
+		items[i].FeedID = feedID
+		if items[i].Link == "" {
+			items[i].Link = "http://example.com/" + items[i].ID
+		}
+		if items[i].PubDate.IsZero() {
+			items[i].PubDate = base.Add(time.Duration(i) * time.Hour)
+		}
+	}
+	require.NoError(t, d.Create(&items).Error)
+}
+
+func allItems() models.SearchParams {
+	return models.SearchParams{
+		FromDate: time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
+		ToDate:   time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		Limit:    100,
+	}
+}
+
+func TestItemTags(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+
+	seedItems(t, d, "feed", []db.Item{
+		{ID: "a", Title: "Go 1.23 released"},
+		{ID: "b", Title: "Kubernetes 1.31"},
+		{ID: "c", Title: "Go and Kubernetes"},
+	})
+
+	require.NoError(t, r.AddItemTag(ctx, "a", "go"))
+	require.NoError(t, r.AddItemTag(ctx, "c", "go"))
+	require.NoError(t, r.AddItemTag(ctx, "c", "k8s"))
+	require.NoError(t, r.AddItemTag(ctx, "b", "k8s"))
+	// Adding a tag twice is a no-op
+	require.NoError(t, r.AddItemTag(ctx, "a", "go"))
+
+	err := r.AddItemTag(ctx, "missing", "go")
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	t.Run("filter by one tag", func(t *testing.T) {
+		params := allItems()
+		params.Tags = []string{"go"}
+
+		items, total, err := r.SearchFeedItems(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		for _, item := range items {
+			assert.Contains(t, item.Tags, db.Tag{Name: "go"})
+		}
+	})
+
+	t.Run("filter by all tags", func(t *testing.T) {
+		params := allItems()
+		params.Tags = []string{"go", "k8s"}
+
+		items, total, err := r.SearchFeedItems(ctx, params)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), total)
+		assert.Equal(t, "c", items[0].ID)
+		assert.ElementsMatch(t, []db.Tag{{Name: "go"}, {Name: "k8s"}}, items[0].Tags)
+	})
+
+	t.Run("tag counts", func(t *testing.T) {
+		counts, err := r.CountItemTags(ctx, allItems())
+		require.NoError(t, err)
+		assert.Equal(t, []models.TagCount{{Tag: "go", Count: 2}, {Tag: "k8s", Count: 2}}, counts)
+
+		params := allItems()
+		params.Query = "Kubernetes"
+		counts, err = r.CountItemTags(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, []models.TagCount{{Tag: "k8s", Count: 2}, {Tag: "go", Count: 1}}, counts)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		require.NoError(t, r.RemoveItemTag(ctx, "a", "go"))
+
+		err := r.RemoveItemTag(ctx, "a", "go")
+		assert.ErrorIs(t, err, repository.ErrTagNotFound)
+	})
+
+	t.Run("deleting the feed removes the links", func(t *testing.T) {
+		require.NoError(t, r.DeleteFeed(ctx, "feed"))
+
+		var links int64
+		require.NoError(t, d.Table("item_tags").Count(&links).Error)
+		assert.Zero(t, links)
+	})
+}
+
+func TestFolders(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+	folders := NewGormFolderRepository(d)
+
+	tech := "tech"
+	golang := "golang"
+	require.NoError(t, folders.SaveFolder(ctx, &db.Folder{ID: tech, Name: "Tech"}))
+	require.NoError(t, folders.SaveFolder(ctx, &db.Folder{ID: golang, Name: "Go", ParentID: &tech}))
+
+	seedItems(t, d, "hn", []db.Item{{ID: "hn-1"}, {ID: "hn-2", IsRead: true}})
+	seedItems(t, d, "go-blog", []db.Item{{ID: "go-1"}, {ID: "go-2"}})
+	seedItems(t, d, "unfiled", []db.Item{{ID: "other"}})
+
+	require.NoError(t, folders.SetFeedFolder(ctx, "hn", &tech))
+	require.NoError(t, folders.SetFeedFolder(ctx, "go-blog", &golang))
+	assert.ErrorIs(t, folders.SetFeedFolder(ctx, "missing", &tech), repository.ErrFeedNotFound)
+
+	t.Run("unread counts", func(t *testing.T) {
+		counts, err := folders.CountUnreadByFolder(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{tech: 1, golang: 2}, counts)
+	})
+
+	t.Run("search includes subfolders", func(t *testing.T) {
+		params := allItems()
+		params.FolderID = tech
+
+		_, total, err := r.SearchFeedItems(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), total)
+
+		params.FolderID = golang
+		_, total, err = r.SearchFeedItems(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+	})
+
+	t.Run("delete moves feeds and subfolders up", func(t *testing.T) {
+		require.NoError(t, folders.DeleteFolder(ctx, tech))
+
+		f, err := folders.GetFolder(ctx, golang)
+		require.NoError(t, err)
+		assert.Nil(t, f.ParentID)
+
+		feed, err := r.GetFeed(ctx, "hn")
+		require.NoError(t, err)
+		assert.Nil(t, feed.FolderID)
+
+		assert.ErrorIs(t, folders.DeleteFolder(ctx, tech), repository.ErrFolderNotFound)
+	})
+}
+
+func TestMarkItemsRead(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+	folders := NewGormFolderRepository(d)
+
+	seedItems(t, d, "hn", []db.Item{{ID: "hn-1", Title: "Go"}, {ID: "hn-2", IsRead: true}, {ID: "hn-3"}})
+	seedItems(t, d, "go-blog", []db.Item{{ID: "go-1", Title: "Go"}, {ID: "go-2"}})
+
+	tech := "tech"
+	require.NoError(t, folders.SaveFolder(ctx, &db.Folder{ID: tech, Name: "Tech"}))
+	require.NoError(t, folders.SetFeedFolder(ctx, "go-blog", &tech))
+
+	unread := func() int64 {
+		var n int64
+		require.NoError(t, d.Model(&db.Item{}).Where("is_read = ?", false).Count(&n).Error)
+		return n
+	}
+
+	// Only the items whose status changes are counted
+	n, err := r.MarkItemsRead(ctx, models.SearchParams{FeedIDs: []string{"hn"}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, int64(2), unread())
+
+	n, err = r.MarkItemsRead(ctx, models.SearchParams{Query: "Go"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = r.MarkItemsRead(ctx, models.SearchParams{FolderID: tech}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// Items are published an hour apart from 2024-11-01
+	n, err = r.MarkItemsRead(ctx, models.SearchParams{ToDate: time.Date(2024, 11, 1, 1, 0, 0, 0, time.UTC)}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, int64(4), unread())
+}
+
+func TestCountItems(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+
+	seedItems(t, d, "hn", []db.Item{{ID: "hn-1"}, {ID: "hn-2", IsRead: true}, {ID: "hn-3"}})
+	seedItems(t, d, "go-blog", []db.Item{{ID: "go-1", IsRead: true}})
+	require.NoError(t, d.Create(&db.Feed{ID: "empty", URL: "http://example.com/empty"}).Error)
+
+	counts, err := r.CountItems(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.ItemCount{
+		"hn":      {Unread: 2, Total: 3},
+		"go-blog": {Unread: 0, Total: 1},
+	}, counts)
+
+	counts, err = r.CountItems(ctx, "go-blog", "empty")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.ItemCount{"go-blog": {Unread: 0, Total: 1}}, counts)
+}
+
+func TestSearchByFeed(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+
+	seedItems(t, d, "hn", []db.Item{{ID: "hn-1"}, {ID: "hn-2"}})
+	seedItems(t, d, "go-blog", []db.Item{{ID: "go-1"}})
+	seedItems(t, d, "lobsters", []db.Item{{ID: "lo-1"}})
+
+	params := allItems()
+	params.FeedIDs = []string{"hn", "go-blog"}
+	_, total, err := r.SearchFeedItems(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+
+	params = allItems()
+	params.ExcludeFeedIDs = []string{"hn"}
+	items, total, err := r.SearchFeedItems(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	for _, item := range items {
+		assert.NotEqual(t, "hn", item.FeedID)
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	if !hasItemSearch(d) {
+		t.Skip("SQLite is built without FTS5, see the sqlite_fts5 build tag")
+	}
+	r := NewGormFeedRepository(d)
+
+	seedItems(t, d, "feed", []db.Item{
+		{ID: "title", Title: "Café culture in Paris"},
+		{ID: "description", Title: "Weekend", Description: "We went to a small cafe downtown"},
+		{ID: "content", Title: "Recipes", Content: "<p>How to brew coffee like a café</p>"},
+		{ID: "other", Title: "Go 1.23 released", Author: "The Go team"},
+	})
+
+	search := func(q, sort string) []db.Item {
+		t.Helper()
+		params := allItems()
+		params.Query = q
+		params.Sort = sort
+		items, _, err := r.SearchFeedItems(ctx, params)
+		require.NoError(t, err)
+		return items
+	}
+
+	ids := func(items []db.Item) []string {
+		var res []string
+		for _, item := range items {
+			res = append(res, item.ID)
+		}
+		return res
+	}
+
+	t.Run("case and diacritics insensitive", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"title", "description", "content"}, ids(search("CAFE", "desc")))
+	})
+
+	t.Run("prefixes and all words", func(t *testing.T) {
+		assert.Equal(t, []string{"other"}, ids(search("go rel", "desc")))
+		assert.Empty(t, search("go paris", "desc"))
+	})
+
+	t.Run("syntax is escaped", func(t *testing.T) {
+		assert.Empty(t, search(`"unbalanced AND (`, "desc"))
+		assert.Empty(t, search("-", "desc"))
+		assert.Equal(t, []string{"other"}, ids(search("1.23", "desc")))
+	})
+
+	t.Run("relevance puts title matches first", func(t *testing.T) {
+		items := search("café", "relevance")
+		require.Len(t, items, 3)
+		assert.Equal(t, "title", items[0].ID)
+	})
+
+	t.Run("snippets", func(t *testing.T) {
+		items := search("paris", "desc")
+		require.Len(t, items, 1)
+		assert.Equal(t, "Café culture in <mark>Paris</mark>", items[0].Snippet)
+	})
+
+	t.Run("index follows updates and deletes", func(t *testing.T) {
+		require.NoError(t, d.Model(&db.Item{}).Where("id = ?", "other").Update("title", "Rust 1.80 released").Error)
+		assert.Empty(t, search("go 1.23", "desc"))
+		assert.Equal(t, []string{"other"}, ids(search("rust", "desc")))
+
+		require.NoError(t, r.DeleteFeed(ctx, "feed"))
+		assert.Empty(t, search("rust", "desc"))
+	})
+
+	t.Run("rebuilt when the triggers are missing", func(t *testing.T) {
+		require.NoError(t, d.Exec("DROP TRIGGER items_fts_ai").Error)
+		seedItems(t, d, "later", []db.Item{{ID: "later", Title: "Written without the index"}})
+
+		require.NoError(t, AutoMigrate(d))
+		assert.Equal(t, []string{"later"}, ids(search("index", "desc")))
+	})
+}
+
+func TestSearchFilter(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+
+	tech := "tech"
+	golang := "golang"
+	folders := NewGormFolderRepository(d)
+	require.NoError(t, folders.SaveFolder(ctx, &db.Folder{ID: tech, Name: "Tech"}))
+	require.NoError(t, folders.SaveFolder(ctx, &db.Folder{ID: golang, Name: "Go", ParentID: &tech}))
+
+	seedItems(t, d, "hn", []db.Item{
+		{ID: "k8s", Title: "Kubernetes 1.31 released", Author: "foo", PubDate: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "ad", Title: "Sponsored: the best cloud", Description: "sponsored content", IsRead: true},
+		{ID: "percent", Title: "Save 100% of the time"},
+	})
+	seedItems(t, d, "go-blog", []db.Item{
+		{ID: "generics", Title: "An exact phrase about generics", Author: "The Go team", IsStarred: true},
+		{ID: "release", Title: "Go 1.23 is released", Author: "foo"},
+	})
+	require.NoError(t, d.Model(&db.Feed{}).Where("id = ?", "hn").Update("name", "Hacker News").Error)
+	require.NoError(t, folders.SetFeedFolder(ctx, "hn", &tech))
+	require.NoError(t, folders.SetFeedFolder(ctx, "go-blog", &golang))
+	require.NoError(t, NewGormFeedRepository(d).AddItemTag(ctx, "release", "go"))
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "released", expected: []string{"k8s", "release"}},
+		{query: "author:foo", expected: []string{"k8s", "release"}},
+		{query: `feed:"Hacker News"`, expected: []string{"k8s", "ad", "percent"}},
+		{query: "feed:go-blog", expected: []string{"generics", "release"}},
+		{query: "folder:tech", expected: []string{"k8s", "ad", "percent", "generics", "release"}},
+		{query: "folder:go", expected: []string{"generics", "release"}},
+		{query: "tag:go", expected: []string{"release"}},
+		{query: "is:read", expected: []string{"ad"}},
+		{query: "is:starred", expected: []string{"generics"}},
+		{query: "before:2024-01-01", expected: []string{"k8s"}},
+		{query: "after:2024-01-01 -sponsored", expected: []string{"percent", "generics", "release"}},
+		{query: `"exact phrase"`, expected: []string{"generics"}},
+		{query: "title:kubernetes", expected: []string{"k8s"}},
+		{query: "title:sponsored", expected: []string{"ad"}},
+		{query: "kubernetes OR tag:go", expected: []string{"k8s", "release"}},
+		{query: "-(is:read OR author:foo) feed:hn", expected: []string{"percent"}},
+		{query: "100%", expected: []string{"percent"}},
+		{query: "author:%", expected: nil},
+	}
+
+	modes := []struct {
+		name string
+		fts  bool
+	}{{"like", false}, {"fts", true}}
+
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			if mode.fts && !hasItemSearch(d) {
+				t.Skip("SQLite is built without FTS5, see the sqlite_fts5 build tag")
+			}
+			r := &gormFeedRepository{d: d, fts: mode.fts}
+
+			for _, tt := range tests {
+				t.Run(tt.query, func(t *testing.T) {
+					filter, err := search.Parse(tt.query)
+					require.NoError(t, err)
+
+					params := allItems()
+					params.Query = tt.query
+					params.Filter = filter
+
+					items, total, err := r.SearchFeedItems(ctx, params)
+					require.NoError(t, err)
+
+					var ids []string
+					for _, item := range items {
+						ids = append(ids, item.ID)
+					}
+					assert.ElementsMatch(t, tt.expected, ids)
+					assert.Equal(t, int64(len(tt.expected)), total)
+				})
+			}
+		})
+	}
+}
+
+func TestMigratePubDates(t *testing.T) {
+	d := newTestDB(t)
+
+	// Dates saved before they were stored in UTC keep their offset
+	paris := time.FixedZone("CET", 3600)
+	seedItems(t, d, "feed", []db.Item{
+		{ID: "early", PubDate: time.Date(2024, 11, 2, 10, 30, 0, 0, paris)},
+		{ID: "late", PubDate: time.Date(2024, 11, 2, 10, 0, 0, 0, time.UTC)},
+	})
+	require.NoError(t, AutoMigrate(d))
+
+	var dates []string
+	require.NoError(t, d.Raw("SELECT pub_date FROM items ORDER BY pub_date").Scan(&dates).Error)
+	assert.Equal(t, []string{"2024-11-02T09:30:00Z", "2024-11-02T10:00:00Z"}, dates)
+
+	var item db.Item
+	require.NoError(t, d.First(&item, "id = ?", "early").Error)
+	assert.True(t, item.PubDate.Equal(time.Date(2024, 11, 2, 9, 30, 0, 0, time.UTC)))
+}
+
+func TestItemNumbers(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	repo := NewGormNumberRepository(d)
+
+	seedItems(t, d, "feed", []db.Item{{ID: "a"}, {ID: "b"}, {ID: "c"}})
+	before, err := repo.ItemNumbers(ctx, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Len(t, before, 3)
+
+	// VACUUM may renumber rowids, not the item numbers
+	require.NoError(t, d.Delete(&db.Item{}, "id = ?", "a").Error)
+	require.NoError(t, d.Exec("VACUUM").Error)
+	numbers, err := repo.ItemNumbers(ctx, []string{"b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"b": before["b"], "c": before["c"]}, numbers)
+
+	// Numbers of deleted items aren't handed out again, even the greatest one
+	require.NoError(t, d.Delete(&db.Item{}, "id = ?", "c").Error)
+	require.NoError(t, d.Create(&db.Item{ID: "d", FeedID: "feed", Link: "http://example.com/d"}).Error)
+	numbers, err = repo.ItemNumbers(ctx, []string{"d"})
+	require.NoError(t, err)
+	assert.Greater(t, numbers["d"], before["c"])
+
+	id, err := repo.GetItemID(ctx, numbers["d"])
+	require.NoError(t, err)
+	assert.Equal(t, "d", id)
+	_, err = repo.GetItemID(ctx, before["c"])
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	// Databases numbered by rowid keep their numbers
+	var rowIDs []int64
+	require.NoError(t, d.Table("items").Order("id").Pluck("rowid", &rowIDs).Error)
+	for table, numbers := range numberTables {
+		require.NoError(t, d.Exec("DROP TABLE "+numbers).Error)
+		require.NoError(t, d.Exec("DROP TRIGGER "+table+"_number_ai").Error)
+		require.NoError(t, d.Exec("DROP TRIGGER "+table+"_number_ad").Error)
+	}
+	require.NoError(t, AutoMigrate(d))
+	numbers, err = repo.ItemNumbers(ctx, []string{"b", "d"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"b": rowIDs[0], "d": rowIDs[1]}, numbers)
+}
+
+func TestItemSearchMigration(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	if !hasItemSearch(d) {
+		t.Skip("SQLite is built without FTS5, see the sqlite_fts5 build tag")
+	}
+
+	// An index keyed on rowids, as older versions created it
+	for name := range itemSearchTriggers {
+		require.NoError(t, d.Exec("DROP TRIGGER "+name).Error)
+	}
+	require.NoError(t, d.Exec("DROP TABLE items_fts").Error)
+	require.NoError(t, d.Exec(`CREATE VIRTUAL TABLE items_fts USING fts5(
+		title, description, content, author, content='items', content_rowid='rowid'
+	)`).Error)
+	seedItems(t, d, "feed", []db.Item{{ID: "deleted", Title: "Gone"}, {ID: "cafe", Title: "Café culture in Paris"}})
+	require.NoError(t, d.Delete(&db.Item{}, "id = ?", "deleted").Error)
+
+	require.NoError(t, AutoMigrate(d))
+	var stmt string
+	require.NoError(t, d.Raw("SELECT sql FROM sqlite_master WHERE name = 'items_fts'").Scan(&stmt).Error)
+	assert.Equal(t, itemSearchTable, stmt)
+
+	r := NewGormFeedRepository(d)
+	params := allItems()
+	params.Query = "cafe"
+	items, _, err := r.SearchFeedItems(ctx, params)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "cafe", items[0].ID)
+	assert.Contains(t, items[0].Snippet, "<mark>Café</mark>")
+
+	// Items written and deleted after the migration are kept in sync
+	require.NoError(t, d.Delete(&db.Item{}, "id = ?", "cafe").Error)
+	seedItems(t, d, "other", []db.Item{{ID: "paris", Title: "Paris cafés"}})
+	items, _, err = r.SearchFeedItems(ctx, params)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "paris", items[0].ID)
+}
+
+func TestDeleteFeedCleanup(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDB(t)
+	r := NewGormFeedRepository(d)
+
+	seedItems(t, d, "hn", []db.Item{{ID: "hn-1"}})
+	seedItems(t, d, "xkcd", []db.Item{{ID: "xkcd-1"}})
+	require.NoError(t, d.Create(&[]db.Webhook{
+		{ID: "hn", URL: "http://example.com/hook", Secret: "s", FeedID: "hn"},
+		{ID: "all", URL: "http://example.com/hook", Secret: "s"},
+	}).Error)
+	require.NoError(t, d.Create(&[]db.WebhookDelivery{
+		{ID: "hn", WebhookID: "hn", Status: db.WebhookDeliveryPending},
+		{ID: "all", WebhookID: "all", Status: db.WebhookDeliveryPending},
+	}).Error)
+	require.NoError(t, d.Create(&[]db.WebhookAttempt{{DeliveryID: "hn"}, {DeliveryID: "all"}}).Error)
+	require.NoError(t, d.Create(&db.Rule{ID: "rule", Name: "Rule"}).Error)
+	require.NoError(t, d.Create(&db.Digest{ID: "digest", Name: "Digest"}).Error)
+	require.NoError(t, d.Create(&[]db.DigestItem{{DigestID: "digest", ItemID: "hn-1"}, {DigestID: "digest", ItemID: "xkcd-1"}}).Error)
+
+	count := func(model any) int64 {
+		t.Helper()
+		var n int64
+		require.NoError(t, d.Model(model).Count(&n).Error)
+		return n
+	}
+
+	// The webhooks of the feed go with it, as do the records of its items sent in digests
+	require.NoError(t, r.DeleteFeed(ctx, "hn"))
+	assert.Equal(t, int64(1), count(&db.Webhook{}))
+	assert.Equal(t, int64(1), count(&db.WebhookDelivery{}))
+	assert.Equal(t, int64(1), count(&db.WebhookAttempt{}))
+	assert.Equal(t, int64(1), count(&db.DigestItem{}))
+	assert.Equal(t, int64(1), count(&db.Rule{}))
+
+	require.NoError(t, r.Nuke(ctx))
+	for _, model := range []any{&db.Feed{}, &db.Item{}, &db.Webhook{}, &db.WebhookDelivery{}, &db.WebhookAttempt{}, &db.Rule{}, &db.Digest{}, &db.DigestItem{}} {
+		assert.Zero(t, count(model), "%T", model)
+	}
+}
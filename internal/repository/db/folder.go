@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+type gormFolderRepository struct {
+	d *gorm.DB
+}
+
+func NewGormFolderRepository(d *gorm.DB) repository.FolderRepository {
+	return &gormFolderRepository{d: d}
+}
+
+func (r *gormFolderRepository) GetFolder(_ context.Context, id string) (*db.Folder, error) {
+	var folder db.Folder
+	res := r.d.First(&folder, "id = ?", id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrFolderNotFound
+		}
+		return nil, res.Error
+	}
+	return &folder, nil
+}
+
+func (r *gormFolderRepository) ListFolders(_ context.Context) ([]db.Folder, error) {
+	var folders []db.Folder
+	res := r.d.Order("name asc").Find(&folders)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return folders, nil
+}
+
+func (r *gormFolderRepository) SaveFolder(_ context.Context, folder *db.Folder) error {
+	return r.d.Save(folder).Error
+}
+
+// DeleteFolder deletes the folder, its feeds are left without a folder and its subfolders are moved to the top level.
+func (r *gormFolderRepository) DeleteFolder(_ context.Context, id string) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&db.Feed{}).Where("folder_id = ?", id).Update("folder_id", nil).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&db.Folder{}).Where("parent_id = ?", id).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+
+		res := tx.Delete(&db.Folder{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrFolderNotFound
+		}
+		return nil
+	})
+}
+
+func (r *gormFolderRepository) SetFeedFolder(_ context.Context, feedID string, folderID *string) error {
+	res := r.d.Model(&db.Feed{}).Where("id = ?", feedID).Update("folder_id", folderID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrFeedNotFound
+	}
+	return nil
+}
+
+// CountUnreadByFolder returns the unread items of the feeds directly in each folder.
+func (r *gormFolderRepository) CountUnreadByFolder(_ context.Context) (map[string]int64, error) {
+	var rows []struct {
+		FolderID string
+		Unread   int64
+	}
+
+	res := r.d.Model(&db.Item{}).
+		Select("feeds.folder_id AS folder_id, COUNT(*) AS unread").
+		Joins("JOIN feeds ON feeds.id = items.feed_id").
+		Where("items.is_read = ? AND feeds.folder_id IS NOT NULL", false).
+		Group("feeds.folder_id").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.FolderID] = row.Unread
+	}
+	return counts, nil
+}
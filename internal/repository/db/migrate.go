@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"fmt"
+	"llrss/internal/models/db"
+
+	"gorm.io/gorm"
+)
+
+// AutoMigrate creates or updates the schema of every table used by the repositories.
+func AutoMigrate(d *gorm.DB) error {
+	err := d.AutoMigrate(
+		&db.Feed{},
+		&db.Item{},
+		&db.Tag{},
+		&db.Folder{},
+		&db.WebSubSubscription{},
+		&db.SavedSearch{},
+		&db.Webhook{},
+		&db.WebhookDelivery{},
+		&db.WebhookAttempt{},
+		&db.Rule{},
+		&db.Digest{},
+		&db.DigestItem{},
+		&db.DeletedItem{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := migratePubDates(d); err != nil {
+		return fmt.Errorf("migrate pub dates: %w", err)
+	}
+	if err := migrateNumbers(d); err != nil {
+		return err
+	}
+
+	return migrateItemSearch(d)
+}
+
+// migratePubDates rewrites the publication dates stored with a time zone offset in UTC.
+// SQLite compares dates as text, so they only sort right once they're all in the same zone.
+// UTC dates are stored with a Z suffix, which makes later runs find nothing to do.
+func migratePubDates(d *gorm.DB) error {
+	var items []db.Item
+	err := d.Model(&db.Item{}).Select("id", "pub_date").Where("pub_date NOT LIKE '%Z'").Find(&items).Error
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	return d.Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			err := tx.Model(&db.Item{}).Where("id = ?", item.ID).UpdateColumn("pub_date", item.PubDate.UTC()).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// numberTables maps the tables whose rows have numbers to the tables holding them.
+var numberTables = map[string]string{
+	"feeds":   "feed_numbers",
+	"folders": "folder_numbers",
+	"items":   "item_numbers",
+}
+
+// migrateNumbers creates the tables numbering feeds, folders and items for the APIs of
+// mobile readers, and the triggers numbering new rows. Numbers are never handed out twice,
+// thanks to AUTOINCREMENT, and unlike rowids VACUUM doesn't renumber them.
+//
+// The numbers used to be the rowids, they're kept for the rows numbered when the table is
+// created so that clients don't have to sync again.
+func migrateNumbers(d *gorm.DB) error {
+	for table, numbers := range numberTables {
+		err := d.Transaction(func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(numbers) {
+				err := tx.Exec("CREATE TABLE " + numbers + " (number INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL UNIQUE)").Error
+				if err != nil {
+					return err
+				}
+				if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (number, id) SELECT rowid, id FROM %s", numbers, table)).Error; err != nil {
+					return err
+				}
+			}
+
+			stmts := []string{
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_number_ai AFTER INSERT ON %[1]s BEGIN
+					INSERT OR IGNORE INTO %[2]s (id) VALUES (new.id);
+				END`, table, numbers),
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_number_ad AFTER DELETE ON %[1]s BEGIN
+					DELETE FROM %[2]s WHERE id = old.id;
+				END`, table, numbers),
+				// Rows written without the triggers, there shouldn't be any
+				fmt.Sprintf("INSERT INTO %[2]s (id) SELECT id FROM %[1]s WHERE id NOT IN (SELECT id FROM %[2]s) ORDER BY rowid", table, numbers),
+			}
+			for _, stmt := range stmts {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", numbers, err)
+		}
+	}
+	return nil
+}
+
+// itemSearchTriggers keep items_fts in sync with the items table. The index refers to items
+// by number, which only exists once the item is: new items are indexed when they're numbered.
+var itemSearchTriggers = map[string]string{
+	"items_fts_ai": `CREATE TRIGGER items_fts_ai AFTER INSERT ON item_numbers BEGIN
+		INSERT INTO items_fts(rowid, title, description, content, author)
+		SELECT new.number, title, description, content, author FROM items WHERE id = new.id;
+	END`,
+	"items_fts_ad": `CREATE TRIGGER items_fts_ad BEFORE DELETE ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, title, description, content, author)
+		SELECT 'delete', number, old.title, old.description, old.content, old.author FROM item_numbers WHERE id = old.id;
+	END`,
+	"items_fts_au": `CREATE TRIGGER items_fts_au AFTER UPDATE OF title, description, content, author ON items BEGIN
+		INSERT INTO items_fts(items_fts, rowid, title, description, content, author)
+		SELECT 'delete', number, old.title, old.description, old.content, old.author FROM item_numbers WHERE id = old.id;
+		INSERT INTO items_fts(rowid, title, description, content, author)
+		SELECT number, new.title, new.description, new.content, new.author FROM item_numbers WHERE id = new.id;
+	END`,
+}
+
+// itemSearchTable is the statement creating items_fts. The index is keyed on the item numbers,
+// which unlike rowids VACUUM doesn't renumber, and reads the items through the item_search view.
+const itemSearchTable = `CREATE VIRTUAL TABLE items_fts USING fts5(
+		title, description, content, author,
+		content='item_search', content_rowid='number', tokenize='unicode61 remove_diacritics 2'
+	)`
+
+// migrateItemSearch creates the items_fts full-text index when SQLite is built with FTS5,
+// see the sqlite_fts5 build tag. Without it the triggers are dropped so items can still be
+// written, and the index is rebuilt the next time it's available. So is an index created
+// by an older version, which was keyed on rowids.
+func migrateItemSearch(d *gorm.DB) error {
+	if !hasFTS5(d) {
+		for name := range itemSearchTriggers {
+			if err := d.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		fmt.Printf("FTS5 is not available, item search falls back to LIKE\n")
+		return nil
+	}
+
+	var stmts []string
+	err := d.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'items_fts'").Scan(&stmts).Error
+	if err != nil {
+		return err
+	}
+	var triggers int64
+	err = d.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'items_fts_%'").Scan(&triggers).Error
+	if err != nil {
+		return err
+	}
+	if len(stmts) == 1 && stmts[0] == itemSearchTable && int(triggers) == len(itemSearchTriggers) {
+		return nil
+	}
+
+	return d.Transaction(func(tx *gorm.DB) error {
+		for name := range itemSearchTriggers {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		if len(stmts) == 1 && stmts[0] != itemSearchTable {
+			if err := tx.Exec("DROP TABLE items_fts").Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Exec(`CREATE VIEW IF NOT EXISTS item_search AS
+			SELECT item_numbers.number, items.title, items.description, items.content, items.author
+			FROM items JOIN item_numbers ON item_numbers.id = items.id`).Error
+		if err != nil {
+			return fmt.Errorf("create item_search: %w", err)
+		}
+		if len(stmts) == 0 || stmts[0] != itemSearchTable {
+			if err := tx.Exec(itemSearchTable).Error; err != nil {
+				return fmt.Errorf("create items_fts: %w", err)
+			}
+		}
+		for name, stmt := range itemSearchTriggers {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("create trigger %s: %w", name, err)
+			}
+		}
+
+		// Index the items written while the triggers were missing
+		return tx.Exec("INSERT INTO items_fts(items_fts) VALUES ('rebuild')").Error
+	})
+}
+
+// hasFTS5 tells if the SQLite library was compiled with FTS5.
+func hasFTS5(d *gorm.DB) bool {
+	var used int
+	if err := d.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error; err != nil {
+		return false
+	}
+	return used == 1
+}
+
+// hasItemSearch tells if items_fts can be used to search items.
+func hasItemSearch(d *gorm.DB) bool {
+	return hasFTS5(d) && d.Migrator().HasTable("items_fts")
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// gormNumberRepository reads the numbers from the feed_numbers, folder_numbers and
+// item_numbers tables, see migrateNumbers. New items get greater numbers than the
+// existing ones, as clients paging from the last item they have expect.
+type gormNumberRepository struct {
+	d *gorm.DB
+	// items filters items the way searches do.
+	items *gormFeedRepository
+}
+
+func NewGormNumberRepository(d *gorm.DB) repository.NumberRepository {
+	return &gormNumberRepository{d: d, items: &gormFeedRepository{d: d, fts: hasItemSearch(d)}}
+}
+
+// numberedID is an entity ID with its number.
+type numberedID struct {
+	ID     string
+	Number int64
+}
+
+func (r *gormNumberRepository) FeedNumbers(_ context.Context) (map[string]int64, error) {
+	return r.numbers(r.d.Table("feed_numbers"))
+}
+
+func (r *gormNumberRepository) FolderNumbers(_ context.Context) (map[string]int64, error) {
+	return r.numbers(r.d.Table("folder_numbers"))
+}
+
+func (r *gormNumberRepository) ItemNumbers(_ context.Context, ids []string) (map[string]int64, error) {
+	if len(ids) == 0 {
+		return map[string]int64{}, nil
+	}
+	return r.numbers(r.d.Table("item_numbers").Where("id IN ?", ids))
+}
+
+func (r *gormNumberRepository) numbers(query *gorm.DB) (map[string]int64, error) {
+	var rows []numberedID
+	if err := query.Select("id, number").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		ids[row.ID] = row.Number
+	}
+	return ids, nil
+}
+
+func (r *gormNumberRepository) GetItemID(_ context.Context, number int64) (string, error) {
+	var ids []string
+	if err := r.d.Table("item_numbers").Where("number = ?", number).Pluck("id", &ids).Error; err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", repository.ErrItemNotFound
+	}
+	return ids[0], nil
+}
+
+func (r *gormNumberRepository) ListNumberedItems(_ context.Context, q models.NumberQuery) ([]models.NumberedItem, error) {
+	query := r.items.filterItems(r.d.Model(&db.Item{}), q.Params).
+		Joins("JOIN item_numbers ON item_numbers.id = items.id").
+		Select("items.id, item_numbers.number")
+
+	if len(q.Numbers) > 0 {
+		query = query.Where("item_numbers.number IN ?", q.Numbers)
+	}
+	if q.After > 0 {
+		query = query.Where("item_numbers.number > ?", q.After)
+	}
+	if q.Before > 0 {
+		query = query.Where("item_numbers.number < ?", q.Before)
+	}
+	if q.ModifiedSince > 0 {
+		query = query.Where("items.updated_at >= ?", q.ModifiedSince)
+	}
+
+	if q.Desc {
+		query = query.Order("item_numbers.number DESC")
+	} else {
+		query = query.Order("item_numbers.number ASC")
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	var rows []numberedID
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// Tags can't be preloaded along the number, items are loaded on their own
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+
+	var items []db.Item
+	if err := r.d.Preload("Tags").Where("id IN ?", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]db.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	res := make([]models.NumberedItem, 0, len(rows))
+	for _, row := range rows {
+		if item, ok := byID[row.ID]; ok {
+			res = append(res, models.NumberedItem{Item: item, Number: row.Number})
+		}
+	}
+	return res, nil
+}
+
+func (r *gormNumberRepository) MarkItemsRead(_ context.Context, params models.SearchParams, maxNumber int64) (int64, error) {
+	res := r.items.filterItems(r.d.Model(&db.Item{}), params).
+		Where("items.id IN (SELECT id FROM item_numbers WHERE number <= ?)", maxNumber).
+		Where("is_read = ?", false).
+		Update("is_read", true)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+func (r *gormNumberRepository) UnreadItemNumbers(_ context.Context) ([]int64, error) {
+	return r.itemNumbers("is_read = ?", false)
+}
+
+func (r *gormNumberRepository) StarredItemNumbers(_ context.Context) ([]int64, error) {
+	return r.itemNumbers("is_starred = ?", true)
+}
+
+func (r *gormNumberRepository) itemNumbers(cond string, args ...any) ([]int64, error) {
+	var numbers []int64
+	err := r.d.Table("item_numbers").
+		Where("id IN (?)", r.d.Table("items").Select("id").Where(cond, args...)).
+		Order("number ASC").
+		Pluck("number", &numbers).Error
+	if err != nil {
+		return nil, err
+	}
+	return numbers, nil
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deleteBatchSize keeps the number of bound parameters below SQLite's limit.
+const deleteBatchSize = 500
+
+type gormRetentionRepository struct {
+	d *gorm.DB
+}
+
+func NewGormRetentionRepository(d *gorm.DB) repository.RetentionRepository {
+	return &gormRetentionRepository{d: d}
+}
+
+// ListPurgeCandidates returns the unstarred items of the feed not satisfying the policy, oldest first.
+// Only the columns needed to report them are loaded.
+func (r *gormRetentionRepository) ListPurgeCandidates(_ context.Context, feedID string, policy db.RetentionPolicy, now time.Time) ([]db.Item, error) {
+	var conds []*gorm.DB
+
+	if policy.MaxItems != nil && *policy.MaxItems > 0 {
+		newest := r.d.Model(&db.Item{}).
+			Select("id").
+			Where("feed_id = ?", feedID).
+			Order("pub_date desc").
+			Offset(*policy.MaxItems)
+		conds = append(conds, r.d.Where("id IN (?)", newest))
+	}
+
+	if policy.ReadDays != nil && *policy.ReadDays > 0 {
+		cutoff := now.AddDate(0, 0, -*policy.ReadDays)
+		conds = append(conds, r.d.Where("is_read = ? AND pub_date < ?", true, cutoff))
+	}
+
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	match := conds[0]
+	for _, c := range conds[1:] {
+		match = match.Or(c)
+	}
+
+	// Starred items are never purged
+	var items []db.Item
+	res := r.d.Model(&db.Item{}).
+		Select("id", "feed_id", "title", "link", "pub_date", "is_read").
+		Where("feed_id = ?", feedID).
+		Where("is_starred = ?", false).
+		Where(match).
+		Order("pub_date asc").
+		Find(&items)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return items, nil
+}
+
+// DeleteItems deletes items and remembers them as deleted, see db.DeletedItem.
+func (r *gormRetentionRepository) DeleteItems(_ context.Context, ids []string) (int64, error) {
+	var deleted int64
+	now := time.Now().UTC()
+	err := r.d.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += deleteBatchSize {
+			end := min(start+deleteBatchSize, len(ids))
+			err := tx.Exec("INSERT OR REPLACE INTO deleted_items (id, feed_id, deleted_at) SELECT id, feed_id, ? FROM items WHERE id IN ?", now, ids[start:end]).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM item_tags WHERE item_id IN ?", ids[start:end]).Error; err != nil {
+				return err
+			}
+
+			res := tx.Where("id IN ?", ids[start:end]).Delete(&db.Item{})
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+		return nil
+	})
+	return deleted, err
+}
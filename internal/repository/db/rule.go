@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+type gormRuleRepository struct {
+	d *gorm.DB
+}
+
+func NewGormRuleRepository(d *gorm.DB) repository.RuleRepository {
+	return &gormRuleRepository{d: d}
+}
+
+func (r *gormRuleRepository) GetRule(_ context.Context, id string) (*db.Rule, error) {
+	var rule db.Rule
+	res := r.d.First(&rule, "id = ?", id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrRuleNotFound
+		}
+		return nil, res.Error
+	}
+	return &rule, nil
+}
+
+func (r *gormRuleRepository) ListRules(_ context.Context) ([]db.Rule, error) {
+	var rules []db.Rule
+	res := r.d.Order("created_at asc, id asc").Find(&rules)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return rules, nil
+}
+
+func (r *gormRuleRepository) SaveRule(_ context.Context, rule *db.Rule) error {
+	return r.d.Save(rule).Error
+}
+
+func (r *gormRuleRepository) DeleteRule(_ context.Context, id string) error {
+	res := r.d.Delete(&db.Rule{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrRuleNotFound
+	}
+	return nil
+}
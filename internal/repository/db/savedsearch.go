@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+type gormSavedSearchRepository struct {
+	d *gorm.DB
+}
+
+func NewGormSavedSearchRepository(d *gorm.DB) repository.SavedSearchRepository {
+	return &gormSavedSearchRepository{d: d}
+}
+
+func (r *gormSavedSearchRepository) GetSavedSearch(_ context.Context, id string) (*db.SavedSearch, error) {
+	var s db.SavedSearch
+	res := r.d.First(&s, "id = ?", id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrSavedSearchNotFound
+		}
+		return nil, res.Error
+	}
+	return &s, nil
+}
+
+func (r *gormSavedSearchRepository) ListSavedSearches(_ context.Context) ([]db.SavedSearch, error) {
+	var searches []db.SavedSearch
+	res := r.d.Order("name asc").Find(&searches)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return searches, nil
+}
+
+func (r *gormSavedSearchRepository) SaveSavedSearch(_ context.Context, s *db.SavedSearch) error {
+	return r.d.Save(s).Error
+}
+
+func (r *gormSavedSearchRepository) DeleteSavedSearch(_ context.Context, id string) error {
+	res := r.d.Delete(&db.SavedSearch{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return repository.ErrSavedSearchNotFound
+	}
+	return nil
+}
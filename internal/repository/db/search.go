@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"llrss/internal/models"
+	"llrss/internal/search"
+	"strings"
+)
+
+// compileFilter turns a parsed query into a WHERE condition on items, with its arguments.
+func (r *gormFeedRepository) compileFilter(e search.Expr) (string, []any) {
+	switch e := e.(type) {
+	case *search.And:
+		return r.compileGroup(e.Exprs, " AND ")
+	case *search.Or:
+		return r.compileGroup(e.Exprs, " OR ")
+	case *search.Not:
+		where, args := r.compileFilter(e.Expr)
+		return "NOT " + where, args
+	case *search.Term:
+		where, args := r.compileTerm(e)
+		return "(" + where + ")", args
+	default:
+		panic("unknown search expression")
+	}
+}
+
+func (r *gormFeedRepository) compileGroup(exprs []search.Expr, op string) (string, []any) {
+	parts := make([]string, len(exprs))
+	var args []any
+	for i, e := range exprs {
+		where, a := r.compileFilter(e)
+		parts[i] = where
+		args = append(args, a...)
+	}
+	return "(" + strings.Join(parts, op) + ")", args
+}
+
+func (r *gormFeedRepository) compileTerm(t *search.Term) (string, []any) {
+	contains := "%" + escapeLike(t.Value) + "%"
+
+	switch t.Field {
+	case search.FieldText, search.FieldTitle:
+		if r.fts {
+			return itemsMatching, []any{matchTerm(t)}
+		}
+		if t.Field == search.FieldTitle {
+			return `items.title LIKE ? ESCAPE '\'`, []any{contains}
+		}
+		return `items.title LIKE ? ESCAPE '\' OR items.description LIKE ? ESCAPE '\' OR items.author LIKE ? ESCAPE '\' OR items.category LIKE ? ESCAPE '\'`,
+			[]any{contains, contains, contains, contains}
+
+	case search.FieldAuthor:
+		return `items.author LIKE ? ESCAPE '\'`, []any{contains}
+
+	case search.FieldFeed:
+		return `items.feed_id IN (SELECT id FROM feeds WHERE id = ? OR title LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\')`,
+			[]any{t.Value, contains, contains}
+
+	case search.FieldFolder:
+		// Folder names are matched whole, and include their subfolders
+		name := escapeLike(t.Value)
+		return `items.feed_id IN (SELECT feeds.id FROM feeds JOIN folders ON folders.id = feeds.folder_id
+			WHERE folders.name LIKE ? ESCAPE '\' OR folders.parent_id IN (SELECT id FROM folders WHERE name LIKE ? ESCAPE '\'))`,
+			[]any{name, name}
+
+	case search.FieldTag:
+		return "items.id IN (SELECT item_id FROM item_tags WHERE tag_name = ?)", []any{t.Value}
+
+	case search.FieldIs:
+		switch t.Value {
+		case search.IsRead:
+			return "items.is_read = ?", []any{true}
+		case search.IsStarred:
+			return "items.is_starred = ?", []any{true}
+		case search.IsUnstarred:
+			return "items.is_starred = ?", []any{false}
+		default:
+			return "items.is_read = ?", []any{false}
+		}
+
+	case search.FieldBefore:
+		return "items.pub_date < ?", []any{t.Date.UTC()}
+
+	case search.FieldAfter:
+		return "items.pub_date >= ?", []any{t.Date.UTC()}
+
+	default:
+		panic("unknown search field " + string(t.Field))
+	}
+}
+
+// rankingMatch returns the FTS5 query the items of a search are ranked and highlighted
+// with, or an empty string when there's no full-text search.
+func (r *gormFeedRepository) rankingMatch(params models.SearchParams) string {
+	if !r.fts {
+		return ""
+	}
+
+	if params.Filter == nil {
+		return matchQuery(params.Query)
+	}
+
+	// Only the terms all items match can be used, the join would drop the others
+	var terms []string
+	for _, t := range search.Required(params.Filter) {
+		if t.Field == search.FieldText || t.Field == search.FieldTitle {
+			terms = append(terms, matchTerm(t))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// itemsMatching selects the items matching an FTS5 query, items_fts is keyed on their numbers.
+const itemsMatching = "items.id IN (SELECT id FROM item_numbers WHERE number IN (SELECT rowid FROM items_fts WHERE items_fts MATCH ?))"
+
+// matchQuery turns the words of a search into an FTS5 query matching items with all of them,
+// as prefixes so partial words match too. Quoting keeps FTS5 syntax out of user input.
+func matchQuery(q string) string {
+	words := strings.Fields(q)
+	for i, w := range words {
+		words[i] = quoteMatch(w) + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// matchTerm returns the FTS5 query of a text or title term, words are matched as
+// prefixes and phrases exactly.
+func matchTerm(t *search.Term) string {
+	match := matchQuery(t.Value)
+	if t.Phrase {
+		match = quoteMatch(t.Value)
+	}
+
+	if t.Field == search.FieldTitle {
+		return "title : (" + match + ")"
+	}
+	return "(" + match + ")"
+}
+
+func quoteMatch(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with \ as escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
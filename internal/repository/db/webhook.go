@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormWebhookRepository struct {
+	d *gorm.DB
+}
+
+func NewGormWebhookRepository(d *gorm.DB) repository.WebhookRepository {
+	return &gormWebhookRepository{d: d}
+}
+
+func (r *gormWebhookRepository) GetWebhook(_ context.Context, id string) (*db.Webhook, error) {
+	var w db.Webhook
+	res := r.d.First(&w, "id = ?", id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrWebhookNotFound
+		}
+		return nil, res.Error
+	}
+	return &w, nil
+}
+
+func (r *gormWebhookRepository) ListWebhooks(_ context.Context) ([]db.Webhook, error) {
+	var webhooks []db.Webhook
+	res := r.d.Order("created_at asc").Find(&webhooks)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return webhooks, nil
+}
+
+func (r *gormWebhookRepository) SaveWebhook(_ context.Context, w *db.Webhook) error {
+	return r.d.Save(w).Error
+}
+
+func (r *gormWebhookRepository) DeleteWebhook(_ context.Context, id string) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&db.Webhook{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return repository.ErrWebhookNotFound
+		}
+
+		if err := tx.Exec("DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)", id).Error; err != nil {
+			return err
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&db.WebhookDelivery{}).Error
+	})
+}
+
+func (r *gormWebhookRepository) SaveDeliveries(_ context.Context, deliveries []db.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.d.Create(&deliveries).Error
+}
+
+func (r *gormWebhookRepository) ListDueDeliveries(_ context.Context, now time.Time, limit int) ([]db.WebhookDelivery, error) {
+	var deliveries []db.WebhookDelivery
+	res := r.d.Where("status = ? AND next_attempt_at <= ?", db.WebhookDeliveryPending, now.UTC()).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&deliveries)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return deliveries, nil
+}
+
+func (r *gormWebhookRepository) ListDeliveries(_ context.Context, webhookID string, limit int) ([]db.WebhookDelivery, error) {
+	var deliveries []db.WebhookDelivery
+	res := r.d.Preload("AttemptLog", func(tx *gorm.DB) *gorm.DB { return tx.Order("id asc") }).
+		Where("webhook_id = ?", webhookID).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&deliveries)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return deliveries, nil
+}
+
+func (r *gormWebhookRepository) RecordAttempt(_ context.Context, delivery *db.WebhookDelivery, attempt *db.WebhookAttempt) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Omit("AttemptLog").Save(delivery).Error
+	})
+}
+
+func (r *gormWebhookRepository) PruneDeliveries(_ context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := r.d.Transaction(func(tx *gorm.DB) error {
+		done := tx.Model(&db.WebhookDelivery{}).Select("id").
+			Where("status <> ? AND created_at < ?", db.WebhookDeliveryPending, before.UTC())
+		if err := tx.Where("delivery_id IN (?)", done).Delete(&db.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Where("status <> ? AND created_at < ?", db.WebhookDeliveryPending, before.UTC()).Delete(&db.WebhookDelivery{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
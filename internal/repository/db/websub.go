@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormWebSubRepository struct {
+	d *gorm.DB
+}
+
+func NewGormWebSubRepository(d *gorm.DB) repository.WebSubRepository {
+	return &gormWebSubRepository{d: d}
+}
+
+func (r *gormWebSubRepository) GetSubscription(_ context.Context, feedID string) (*db.WebSubSubscription, error) {
+	var sub db.WebSubSubscription
+	res := r.d.First(&sub, "feed_id = ?", feedID)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrSubscriptionNotFound
+		}
+		return nil, res.Error
+	}
+	return &sub, nil
+}
+
+func (r *gormWebSubRepository) ListSubscriptions(_ context.Context) ([]db.WebSubSubscription, error) {
+	var subs []db.WebSubSubscription
+	res := r.d.Find(&subs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return subs, nil
+}
+
+// SaveSubscription upserts the subscription and mirrors its lease on the feed,
+// so that polling can skip feeds which are being pushed to us.
+func (r *gormWebSubRepository) SaveSubscription(_ context.Context, sub *db.WebSubSubscription) error {
+	return r.d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+
+		var expiresAt time.Time
+		if sub.State == db.WebSubStateActive {
+			expiresAt = sub.ExpiresAt
+		}
+
+		return tx.Model(&db.Feed{}).Where("id = ?", sub.FeedID).Update("web_sub_expires_at", expiresAt).Error
+	})
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+	"time"
+)
+
+type DigestRepository interface {
+	GetDigest(ctx context.Context, id string) (*db.Digest, error)
+	ListDigests(ctx context.Context) ([]db.Digest, error)
+	SaveDigest(ctx context.Context, d *db.Digest) error
+	// DeleteDigest deletes a digest along with the record of the items it sent.
+	DeleteDigest(ctx context.Context, id string) error
+	// MarkDigested records that the items were sent in the digest at sentAt, along with its LastSentAt.
+	MarkDigested(ctx context.Context, digestID string, itemIDs []string, sentAt time.Time) error
+	// PruneDigested forgets the sent items which were deleted since.
+	PruneDigested(ctx context.Context) (int64, error)
+}
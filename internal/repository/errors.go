@@ -14,6 +14,30 @@ var (
 
 	// ErrDuplicateFeed is returned when trying to save a feed with a duplicate URL.
 	ErrDuplicateFeed = errors.New("duplicate feed URL")
+
+	// ErrItemNotFound is returned when a feed item is not found in the repository.
+	ErrItemNotFound = errors.New("item not found")
+
+	// ErrTagNotFound is returned when removing a tag an item doesn't have.
+	ErrTagNotFound = errors.New("tag not found")
+
+	// ErrFolderNotFound is returned when a folder is not found in the repository.
+	ErrFolderNotFound = errors.New("folder not found")
+
+	// ErrSubscriptionNotFound is returned when a feed has no WebSub subscription.
+	ErrSubscriptionNotFound = errors.New("websub subscription not found")
+
+	// ErrSavedSearchNotFound is returned when a saved search is not found in the repository.
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+
+	// ErrWebhookNotFound is returned when a webhook is not found in the repository.
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrRuleNotFound is returned when a rule is not found in the repository.
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrDigestNotFound is returned when a digest is not found in the repository.
+	ErrDigestNotFound = errors.New("digest not found")
 )
 
 // IsNotFound returns true if the error is an ErrFeedNotFound.
@@ -21,6 +45,11 @@ func IsNotFound(err error) bool {
 	return errors.Is(err, ErrFeedNotFound)
 }
 
+// IsItemNotFound returns true if the error is an ErrItemNotFound.
+func IsItemNotFound(err error) bool {
+	return errors.Is(err, ErrItemNotFound)
+}
+
 // IsEmptyID returns true if the error is an ErrEmptyID.
 func IsEmptyID(err error) bool {
 	return errors.Is(err, ErrEmptyID)
@@ -13,12 +13,23 @@ type FeedRepository interface {
 	SaveFeed(ctx context.Context, feed *db.Feed) (string, error)
 	DeleteFeed(ctx context.Context, id string) error
 	UpdateFeed(ctx context.Context, feed *db.Feed) error
+	// UpdateFeedFields only updates the given columns of the feed, leaving the others as they are.
+	UpdateFeedFields(ctx context.Context, feed *db.Feed, columns ...string) error
 
 	GetFeedItem(ctx context.Context, id string) (*db.Item, error)
 	UpdateFeedItem(ctx context.Context, s *db.Item) error
-	SaveFeedItems(ctx context.Context, feedID string, items []db.Item) error
+	SaveFeedItems(ctx context.Context, feedID string, items []db.Item) ([]db.Item, error)
+	// PruneDeletedItems forgets the deleted items of a feed which aren't among items, its latest ones.
+	PruneDeletedItems(ctx context.Context, feedID string, items []db.Item) error
+
+	CountItems(ctx context.Context, feedIDs ...string) (map[string]models.ItemCount, error)
+	MarkItemsRead(ctx context.Context, params models.SearchParams, read bool) (int64, error)
 
 	SearchFeedItems(ctx context.Context, items models.SearchParams) ([]db.Item, int64, error)
+	CountItemTags(ctx context.Context, params models.SearchParams) ([]models.TagCount, error)
+
+	AddItemTag(ctx context.Context, itemID, tag string) error
+	RemoveItemTag(ctx context.Context, itemID, tag string) error
 
 	Nuke(ctx context.Context) error
 }
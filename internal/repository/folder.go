@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+)
+
+type FolderRepository interface {
+	GetFolder(ctx context.Context, id string) (*db.Folder, error)
+	ListFolders(ctx context.Context) ([]db.Folder, error)
+	SaveFolder(ctx context.Context, folder *db.Folder) error
+	DeleteFolder(ctx context.Context, id string) error
+	SetFeedFolder(ctx context.Context, feedID string, folderID *string) error
+	CountUnreadByFolder(ctx context.Context) (map[string]int64, error)
+}
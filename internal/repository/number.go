@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models"
+)
+
+// NumberRepository gives feeds, folders and items the integer IDs the APIs of mobile readers
+// (Fever, Google Reader, Nextcloud News) know them by.
+type NumberRepository interface {
+	// FeedNumbers returns the number of every feed by feed ID.
+	FeedNumbers(ctx context.Context) (map[string]int64, error)
+	// FolderNumbers returns the number of every folder by folder ID.
+	FolderNumbers(ctx context.Context) (map[string]int64, error)
+	// ItemNumbers returns the number of the given items by item ID, unknown items are left out.
+	ItemNumbers(ctx context.Context, ids []string) (map[string]int64, error)
+	// GetItemID returns the ID of the item with the given number.
+	GetItemID(ctx context.Context, number int64) (string, error)
+	ListNumberedItems(ctx context.Context, q models.NumberQuery) ([]models.NumberedItem, error)
+	// MarkItemsRead marks the unread items matching the search, up to the given number, as read.
+	MarkItemsRead(ctx context.Context, params models.SearchParams, maxNumber int64) (int64, error)
+	UnreadItemNumbers(ctx context.Context) ([]int64, error)
+	StarredItemNumbers(ctx context.Context) ([]int64, error)
+}
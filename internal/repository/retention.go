@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+	"time"
+)
+
+type RetentionRepository interface {
+	ListPurgeCandidates(ctx context.Context, feedID string, policy db.RetentionPolicy, now time.Time) ([]db.Item, error)
+	DeleteItems(ctx context.Context, ids []string) (int64, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+)
+
+type RuleRepository interface {
+	GetRule(ctx context.Context, id string) (*db.Rule, error)
+	// ListRules returns the rules in the order they run, oldest first.
+	ListRules(ctx context.Context) ([]db.Rule, error)
+	SaveRule(ctx context.Context, rule *db.Rule) error
+	DeleteRule(ctx context.Context, id string) error
+}
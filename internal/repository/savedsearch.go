@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+)
+
+type SavedSearchRepository interface {
+	GetSavedSearch(ctx context.Context, id string) (*db.SavedSearch, error)
+	ListSavedSearches(ctx context.Context) ([]db.SavedSearch, error)
+	SaveSavedSearch(ctx context.Context, s *db.SavedSearch) error
+	DeleteSavedSearch(ctx context.Context, id string) error
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+	"time"
+)
+
+type WebhookRepository interface {
+	GetWebhook(ctx context.Context, id string) (*db.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]db.Webhook, error)
+	SaveWebhook(ctx context.Context, w *db.Webhook) error
+	// DeleteWebhook deletes a webhook along with its deliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+
+	SaveDeliveries(ctx context.Context, deliveries []db.WebhookDelivery) error
+	// ListDueDeliveries returns the pending deliveries to attempt by now, oldest first.
+	ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]db.WebhookDelivery, error)
+	// ListDeliveries returns the latest deliveries of a webhook with their attempts, newest first.
+	ListDeliveries(ctx context.Context, webhookID string, limit int) ([]db.WebhookDelivery, error)
+	// RecordAttempt saves an attempt along with the resulting state of its delivery.
+	RecordAttempt(ctx context.Context, delivery *db.WebhookDelivery, attempt *db.WebhookAttempt) error
+	// PruneDeliveries deletes the deliveries which are done and were created before the given time.
+	PruneDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"llrss/internal/models/db"
+)
+
+type WebSubRepository interface {
+	GetSubscription(ctx context.Context, feedID string) (*db.WebSubSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]db.WebSubSubscription, error)
+	SaveSubscription(ctx context.Context, sub *db.WebSubSubscription) error
+}
@@ -0,0 +1,184 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/text"
+	"strings"
+	"time"
+)
+
+// WebhookEvent is the type of the deliveries queued by webhook actions.
+const WebhookEvent = "rule.matched"
+
+// feedRepository runs the enabled rules on the items saved through a feed repository. Items
+// matching a delete rule aren't saved, the other actions are done once the new items are.
+type feedRepository struct {
+	repository.FeedRepository
+	rules    repository.RuleRepository
+	webhooks repository.WebhookRepository
+}
+
+// NewFeedRepository wraps repo so that the rules apply to the items it saves. It should be
+// wrapped by events.NewFeedRepository, for items.added events to have the saved items only.
+func NewFeedRepository(repo repository.FeedRepository, rules repository.RuleRepository, webhooks repository.WebhookRepository) repository.FeedRepository {
+	return &feedRepository{FeedRepository: repo, rules: rules, webhooks: webhooks}
+}
+
+// SaveFeed saves the items of new feeds through the rules as well.
+func (r *feedRepository) SaveFeed(ctx context.Context, feed *db.Feed) (string, error) {
+	items := feed.Items
+	feed.Items = nil
+
+	id, err := r.FeedRepository.SaveFeed(ctx, feed)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := r.SaveFeedItems(ctx, id, items); err != nil {
+		fmt.Printf("failed to save feed items: %v\n", err)
+	}
+	return id, nil
+}
+
+func (r *feedRepository) SaveFeedItems(ctx context.Context, feedID string, items []db.Item) ([]db.Item, error) {
+	matchers, err := r.matchers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(matchers) == 0 {
+		return r.FeedRepository.SaveFeedItems(ctx, feedID, items)
+	}
+
+	kept := make([]db.Item, 0, len(items))
+	for _, item := range items {
+		if !deleted(matchers, saved(feedID, item)) {
+			kept = append(kept, item)
+		}
+	}
+
+	added, err := r.FeedRepository.SaveFeedItems(ctx, feedID, kept)
+	if err != nil || len(added) == 0 {
+		return added, err
+	}
+
+	// The actions failing doesn't undo the save, they are logged instead
+	for _, m := range matchers {
+		var matched []*db.Item
+		for i := range added {
+			if m.Match(&added[i]) {
+				matched = append(matched, &added[i])
+			}
+		}
+		if len(matched) > 0 {
+			if err := r.run(ctx, m, feedID, matched); err != nil {
+				fmt.Printf("rule %s failed: %v\n", m.Rule.Name, err)
+			}
+		}
+	}
+	return added, nil
+}
+
+// matchers returns the compiled enabled rules, the invalid ones are skipped.
+func (r *feedRepository) matchers(ctx context.Context) ([]*Matcher, error) {
+	rules, err := r.rules.ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matchers []*Matcher
+	for i := range rules {
+		if !rules[i].Enabled {
+			continue
+		}
+		if m, err := Compile(&rules[i]); err == nil {
+			matchers = append(matchers, m)
+		}
+	}
+	return matchers, nil
+}
+
+// saved returns an item as SaveFeedItems saves it, for delete rules to match it before.
+func saved(feedID string, item db.Item) *db.Item {
+	item.FeedID = feedID
+	item.Title = strings.TrimSpace(item.Title)
+	item.Description = text.CleanDescription(item.Description)
+	return &item
+}
+
+func deleted(matchers []*Matcher, item *db.Item) bool {
+	for _, m := range matchers {
+		if m.Has(ActionDelete) && m.Match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// run does the actions of a rule but delete to new items.
+func (r *feedRepository) run(ctx context.Context, m *Matcher, feedID string, items []*db.Item) error {
+	var errs []error
+	for _, a := range m.Rule.Actions {
+		switch a.Type {
+		case ActionMarkRead, ActionStar:
+			for _, item := range items {
+				if a.Type == ActionMarkRead {
+					item.IsRead = true
+				} else if !item.IsStarred {
+					now := time.Now().UTC()
+					item.IsStarred, item.StarredAt = true, &now
+				}
+				errs = append(errs, r.FeedRepository.UpdateFeedItem(ctx, item))
+			}
+		case ActionTag:
+			for _, item := range items {
+				errs = append(errs, r.FeedRepository.AddItemTag(ctx, item.ID, a.Value))
+			}
+		case ActionWebhook:
+			list := make([]db.Item, len(items))
+			for i, item := range items {
+				list[i] = *item
+			}
+			errs = append(errs, Notify(ctx, r.webhooks, a.Value, m.Rule, feedID, list))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Notify queues a rule.matched delivery of the items to a webhook, it's attempted with the
+// other pending deliveries. Webhooks deleted since the rule was saved are skipped.
+func Notify(ctx context.Context, webhooks repository.WebhookRepository, webhookID string, rule *db.Rule, feedID string, items []db.Item) error {
+	if _, err := webhooks.GetWebhook(ctx, webhookID); err != nil {
+		if errors.Is(err, repository.ErrWebhookNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(models.WebhookPayload{
+		Type:   WebhookEvent,
+		Time:   now,
+		RuleID: rule.ID,
+		FeedID: feedID,
+		Items:  models.NewWebhookItems(items),
+	})
+	if err != nil {
+		return err
+	}
+
+	return webhooks.SaveDeliveries(ctx, []db.WebhookDelivery{{
+		ID:            text.RandomID(),
+		WebhookID:     webhookID,
+		EventType:     WebhookEvent,
+		Payload:       string(body),
+		Status:        db.WebhookDeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}})
+}
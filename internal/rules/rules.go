@@ -0,0 +1,172 @@
+// Package rules matches items against user rules, like "title matches /sponsored/i", and runs
+// their actions on the items saved by feed refreshes.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"llrss/internal/models/db"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The item fields conditions compare, feed is the ID of the feed of the item.
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldAuthor      = "author"
+	FieldCategory    = "category"
+	FieldLink        = "link"
+	FieldFeed        = "feed"
+)
+
+// The comparisons of conditions. Text comparisons ignore case, matches takes a regular
+// expression, either as is or as /expr/flags.
+const (
+	OpContains    = "contains"
+	OpNotContains = "not_contains"
+	OpEquals      = "equals"
+	OpMatches     = "matches"
+)
+
+// The actions of rules, tag takes the tag and webhook the ID of the webhook as value.
+const (
+	ActionMarkRead = "mark_read"
+	ActionStar     = "star"
+	ActionTag      = "tag"
+	ActionDelete   = "delete"
+	ActionWebhook  = "webhook"
+)
+
+var (
+	Fields  = []string{FieldTitle, FieldDescription, FieldAuthor, FieldCategory, FieldLink, FieldFeed}
+	Ops     = []string{OpContains, OpNotContains, OpEquals, OpMatches}
+	Actions = []string{ActionMarkRead, ActionStar, ActionTag, ActionDelete, ActionWebhook}
+)
+
+var (
+	// ErrInvalidCondition is returned for rules without conditions, or with unknown fields,
+	// comparisons or invalid regular expressions.
+	ErrInvalidCondition = errors.New("invalid rule condition")
+	// ErrInvalidAction is returned for rules without actions, or with unknown ones or missing values.
+	ErrInvalidAction = errors.New("invalid rule action")
+)
+
+// Matcher is a compiled rule.
+type Matcher struct {
+	Rule       *db.Rule
+	conditions []condition
+}
+
+type condition struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Compile checks the conditions and actions of a rule, and returns its matcher.
+func Compile(rule *db.Rule) (*Matcher, error) {
+	if len(rule.Conditions) == 0 {
+		return nil, fmt.Errorf("%w, expected at least one", ErrInvalidCondition)
+	}
+	if len(rule.Actions) == 0 {
+		return nil, fmt.Errorf("%w, expected at least one", ErrInvalidAction)
+	}
+
+	m := &Matcher{Rule: rule, conditions: make([]condition, len(rule.Conditions))}
+	for i, c := range rule.Conditions {
+		if !slices.Contains(Fields, c.Field) {
+			return nil, fmt.Errorf("%w: unknown field %q, expected one of %s", ErrInvalidCondition, c.Field, strings.Join(Fields, ", "))
+		}
+		if !slices.Contains(Ops, c.Op) {
+			return nil, fmt.Errorf("%w: unknown comparison %q, expected one of %s", ErrInvalidCondition, c.Op, strings.Join(Ops, ", "))
+		}
+		value := strings.ToLower(c.Value)
+		if c.Op == OpEquals {
+			// Fields are compared trimmed, so are the values
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s %s needs a value", ErrInvalidCondition, c.Field, c.Op)
+		}
+
+		m.conditions[i] = condition{field: c.Field, op: c.Op, value: value}
+		if c.Op == OpMatches {
+			re, err := compileRegexp(c.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidCondition, err)
+			}
+			m.conditions[i].re = re
+		}
+	}
+
+	for _, a := range rule.Actions {
+		if !slices.Contains(Actions, a.Type) {
+			return nil, fmt.Errorf("%w: unknown action %q, expected one of %s", ErrInvalidAction, a.Type, strings.Join(Actions, ", "))
+		}
+		if (a.Type == ActionTag || a.Type == ActionWebhook) && a.Value == "" {
+			return nil, fmt.Errorf("%w: %s needs a value", ErrInvalidAction, a.Type)
+		}
+	}
+	return m, nil
+}
+
+// compileRegexp compiles expr, given as /expr/flags with flags among i, m, s and U, or as is.
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if end := strings.LastIndex(expr, "/"); strings.HasPrefix(expr, "/") && end > 0 {
+		flags := expr[end+1:]
+		if strings.Trim(flags, "imsU") == "" {
+			expr = expr[1:end]
+			if flags != "" {
+				expr = "(?" + flags + ")" + expr
+			}
+		}
+	}
+	return regexp.Compile(expr)
+}
+
+// Match returns whether the item matches all the conditions of the rule.
+func (m *Matcher) Match(item *db.Item) bool {
+	for _, c := range m.conditions {
+		if !c.match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *condition) match(item *db.Item) bool {
+	var v string
+	switch c.field {
+	case FieldTitle:
+		v = item.Title
+	case FieldDescription:
+		v = item.Description
+	case FieldAuthor:
+		v = item.Author
+	case FieldCategory:
+		v = item.Category
+	case FieldLink:
+		v = item.Link
+	case FieldFeed:
+		v = item.FeedID
+	}
+
+	switch c.op {
+	case OpContains:
+		return strings.Contains(strings.ToLower(v), c.value)
+	case OpNotContains:
+		return !strings.Contains(strings.ToLower(v), c.value)
+	case OpEquals:
+		return strings.ToLower(strings.TrimSpace(v)) == c.value
+	default:
+		return c.re.MatchString(v)
+	}
+}
+
+// Has returns whether the rule has an action of the given type.
+func (m *Matcher) Has(action string) bool {
+	return slices.ContainsFunc(m.Rule.Actions, func(a db.RuleAction) bool { return a.Type == action })
+}
@@ -0,0 +1,68 @@
+package rules
+
+import (
+	"llrss/internal/models/db"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rule(actions []db.RuleAction, conditions ...db.RuleCondition) *db.Rule {
+	return &db.Rule{Name: "test", Conditions: conditions, Actions: actions}
+}
+
+var markRead = []db.RuleAction{{Type: ActionMarkRead}}
+
+func TestCompileErrors(t *testing.T) {
+	title := db.RuleCondition{Field: FieldTitle, Op: OpContains, Value: "go"}
+
+	for name, tc := range map[string]struct {
+		rule     *db.Rule
+		expected error
+	}{
+		"no condition":  {rule(markRead), ErrInvalidCondition},
+		"no action":     {rule(nil, title), ErrInvalidAction},
+		"unknown field": {rule(markRead, db.RuleCondition{Field: "content", Op: OpContains, Value: "go"}), ErrInvalidCondition},
+		"unknown op":    {rule(markRead, db.RuleCondition{Field: FieldTitle, Op: "starts_with", Value: "go"}), ErrInvalidCondition},
+		"no value":      {rule(markRead, db.RuleCondition{Field: FieldTitle, Op: OpContains}), ErrInvalidCondition},
+		"blank equals":  {rule(markRead, db.RuleCondition{Field: FieldTitle, Op: OpEquals, Value: " "}), ErrInvalidCondition},
+		"bad regexp":    {rule(markRead, db.RuleCondition{Field: FieldTitle, Op: OpMatches, Value: "/(go/i"}), ErrInvalidCondition},
+		"unknown type":  {rule([]db.RuleAction{{Type: "archive"}}, title), ErrInvalidAction},
+		"tag no value":  {rule([]db.RuleAction{{Type: ActionTag}}, title), ErrInvalidAction},
+		"webhook no ID": {rule([]db.RuleAction{{Type: ActionWebhook}}, title), ErrInvalidAction},
+	} {
+		_, err := Compile(tc.rule)
+		assert.ErrorIs(t, err, tc.expected, name)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	item := &db.Item{
+		Title:    "Sponsored: Try our VPN",
+		Author:   "Jane Doe",
+		Category: "Security, Privacy",
+		Link:     "https://example.com/vpn",
+		FeedID:   "hn",
+	}
+
+	for name, tc := range map[string]struct {
+		conditions []db.RuleCondition
+		expected   bool
+	}{
+		"regexp with flags":      {[]db.RuleCondition{{Field: FieldTitle, Op: OpMatches, Value: "/^sponsored/i"}}, true},
+		"regexp case":            {[]db.RuleCondition{{Field: FieldTitle, Op: OpMatches, Value: "^sponsored"}}, false},
+		"plain regexp":           {[]db.RuleCondition{{Field: FieldLink, Op: OpMatches, Value: `example\.com/v`}}, true},
+		"contains ignoring case": {[]db.RuleCondition{{Field: FieldCategory, Op: OpContains, Value: "SECURITY"}}, true},
+		"not contains":           {[]db.RuleCondition{{Field: FieldCategory, Op: OpNotContains, Value: "security"}}, false},
+		"equals":                 {[]db.RuleCondition{{Field: FieldAuthor, Op: OpEquals, Value: "jane doe"}}, true},
+		"equals whole value":     {[]db.RuleCondition{{Field: FieldAuthor, Op: OpEquals, Value: "jane"}}, false},
+		"equals trimmed value":   {[]db.RuleCondition{{Field: FieldAuthor, Op: OpEquals, Value: " Jane Doe "}}, true},
+		"all conditions":         {[]db.RuleCondition{{Field: FieldFeed, Op: OpEquals, Value: "hn"}, {Field: FieldTitle, Op: OpContains, Value: "vpn"}}, true},
+		"one condition fails":    {[]db.RuleCondition{{Field: FieldFeed, Op: OpEquals, Value: "xkcd"}, {Field: FieldTitle, Op: OpContains, Value: "vpn"}}, false},
+	} {
+		m, err := Compile(rule(markRead, tc.conditions...))
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, m.Match(item), name)
+	}
+}
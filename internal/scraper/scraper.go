@@ -0,0 +1,230 @@
+// Package scraper makes feeds out of web pages which have none, their items are picked
+// out of the HTML with CSS selectors.
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"llrss/internal/htmlutil"
+	"llrss/internal/models/db"
+	"llrss/internal/text"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// dateFormats are tried, after the RSS ones, on dates without a DateFormat.
+var dateFormats = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"02.01.2006",
+}
+
+var linkSelector = MustCompile("a[href]")
+
+type selectors struct {
+	item, title, link, date, summary Selector
+}
+
+// compile compiles the selectors of a scraper, the item and title ones are required.
+func compile(s db.Scraper) (*selectors, error) {
+	if strings.TrimSpace(s.Item) == "" || strings.TrimSpace(s.Title) == "" {
+		return nil, fmt.Errorf("%w: the item and title selectors are required", ErrInvalidSelector)
+	}
+
+	sel := &selectors{}
+	for _, c := range []struct {
+		s   string
+		sel *Selector
+	}{
+		{s.Item, &sel.item},
+		{s.Title, &sel.title},
+		{s.Link, &sel.link},
+		{s.Date, &sel.date},
+		{s.Summary, &sel.summary},
+	} {
+		if strings.TrimSpace(c.s) == "" {
+			continue
+		}
+		compiled, err := Compile(c.s)
+		if err != nil {
+			return nil, err
+		}
+		*c.sel = compiled
+	}
+	return sel, nil
+}
+
+// Validate checks that the selectors of a scraper compile.
+func Validate(s db.Scraper) error {
+	_, err := compile(s)
+	return err
+}
+
+// Scrape turns the HTML page at pageURL into a feed, with an item per element matching the item
+// selector. Items without a date are dated now, a second apart to keep the order of the page.
+func Scrape(r io.Reader, pageURL *url.URL, s db.Scraper) (*db.Feed, error) {
+	sel, err := compile(s)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse HTML: %w", err)
+	}
+
+	now := time.Now().UTC()
+	feed := &db.Feed{
+		URL:       pageURL.String(),
+		Title:     pageURL.Host,
+		SiteURL:   pageURL.String(),
+		LastFetch: now,
+		Scraper:   s,
+	}
+	htmlutil.Walk(doc, func(n *html.Node) bool {
+		switch {
+		case n.DataAtom == atom.Title && htmlutil.Text(n) != "":
+			feed.Title = htmlutil.Text(n)
+		case n.DataAtom == atom.Meta && htmlutil.Attr(n, "name") == "description":
+			feed.Description = strings.TrimSpace(htmlutil.Attr(n, "content"))
+		}
+		return n.DataAtom != atom.Body
+	})
+
+	seen := make(map[string]bool)
+	for i, n := range sel.item.Select(doc) {
+		title := htmlutil.Text(first(sel.title, n))
+		if title == "" {
+			continue
+		}
+
+		link := resolve(pageURL, itemLink(sel.link, n))
+		if link == "" {
+			// Items without a link are told apart by their ID, or by their title
+			anchor := htmlutil.Attr(n, "id")
+			if anchor == "" {
+				anchor = text.URLToID(title)[:16]
+			}
+			u := *pageURL
+			u.Fragment = anchor
+			link = u.String()
+		}
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		item := db.Item{
+			Title:   title,
+			Link:    link,
+			PubDate: now.Add(-time.Duration(i) * time.Second),
+		}
+		if sel.date != nil {
+			if d, ok := parseDate(first(sel.date, n), s.DateFormat); ok {
+				item.PubDate = d
+			}
+		}
+		if sel.summary != nil {
+			item.Description = innerHTML(first(sel.summary, n))
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+// first returns the item itself when it matches sel, else its first descendant matching it.
+func first(sel Selector, item *html.Node) *html.Node {
+	if sel == nil {
+		return nil
+	}
+	if sel.Match(item) {
+		return item
+	}
+	return sel.SelectFirst(item)
+}
+
+// itemLink returns the href of the element matching sel in the item, or of the first link
+// when there's no such selector: the item itself, its first link, or the link around it.
+func itemLink(sel Selector, item *html.Node) string {
+	n := item
+	if sel != nil {
+		if n = first(sel, item); n == nil {
+			return ""
+		}
+	}
+
+	if href := htmlutil.Attr(n, "href"); href != "" {
+		return href
+	}
+	if a := linkSelector.SelectFirst(n); a != nil {
+		return htmlutil.Attr(a, "href")
+	}
+	for p := n.Parent; sel == nil && p != nil; p = p.Parent {
+		if p.DataAtom == atom.A {
+			return htmlutil.Attr(p, "href")
+		}
+	}
+	return ""
+}
+
+// resolve makes a link absolute, empty for links which aren't to web pages.
+func resolve(pageURL *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+	u, err := pageURL.Parse(link)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// parseDate parses the datetime attribute of the element, which time elements have, or else its text.
+func parseDate(n *html.Node, format string) (time.Time, bool) {
+	if n == nil {
+		return time.Time{}, false
+	}
+
+	value := htmlutil.Attr(n, "datetime")
+	if value == "" {
+		value = htmlutil.Text(n)
+	}
+	if format != "" {
+		d, err := time.Parse(format, value)
+		return d.UTC(), err == nil
+	}
+
+	if d, err := text.ParseRSSDate(value); err == nil {
+		return d.UTC(), true
+	}
+	for _, f := range dateFormats {
+		if d, err := time.Parse(f, value); err == nil {
+			return d.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func innerHTML(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,145 @@
+package scraper
+
+import (
+	"llrss/internal/htmlutil"
+	"llrss/internal/models/db"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const changelog = `<html><head><title>Acme Changelog</title><meta name="description" content="What's new at Acme"></head><body>
+<ul id="nav"><li><a href="/">Home</a></li><li class="active"><a href="/changelog">Changelog</a></li></ul>
+<main>
+  <article class="entry" id="v2">
+    <h2><a href="/changelog/v2">Version 2.0</a></h2>
+    <time datetime="2024-03-01T10:00:00Z">March 1st</time>
+    <div class="summary"><p>A <b>new</b> dashboard.</p></div>
+  </article>
+  <article class="entry" id="v1-1">
+    <h2>Version 1.1</h2>
+    <span class="date">February 2, 2024</span>
+    <div class="summary">Bug fixes.</div>
+  </article>
+  <article class="entry">
+    <h2>Version 1.0</h2>
+    <span class="date">not a date</span>
+  </article>
+  <article class="entry"><h2>  </h2></article>
+  <article class="entry draft"><h2><a href="/changelog/v2">Version 2.0 again</a></h2></article>
+</main>
+</body></html>`
+
+func TestScrape(t *testing.T) {
+	u, _ := url.Parse("https://acme.example.com/changelog")
+	feed, err := Scrape(strings.NewReader(changelog), u, db.Scraper{
+		Item:    "main > article.entry",
+		Title:   "h2",
+		Date:    "time, .date",
+		Summary: ".summary",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Acme Changelog", feed.Title)
+	assert.Equal(t, "What's new at Acme", feed.Description)
+	assert.Equal(t, "https://acme.example.com/changelog", feed.SiteURL)
+
+	require.Len(t, feed.Items, 3, "items without title or with a link already seen are skipped")
+	v2, v11, v1 := feed.Items[0], feed.Items[1], feed.Items[2]
+
+	assert.Equal(t, "Version 2.0", v2.Title)
+	assert.Equal(t, "https://acme.example.com/changelog/v2", v2.Link)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), v2.PubDate)
+	assert.Equal(t, "<p>A <b>new</b> dashboard.</p>", v2.Description)
+
+	assert.Equal(t, "https://acme.example.com/changelog#v1-1", v11.Link, "items without link get the ID of the item")
+	assert.Equal(t, time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC), v11.PubDate)
+	assert.Equal(t, "Bug fixes.", v11.Description)
+
+	assert.True(t, strings.HasPrefix(v1.Link, "https://acme.example.com/changelog#"))
+	assert.WithinDuration(t, time.Now(), v1.PubDate, time.Minute, "items without date are dated now")
+}
+
+func TestScrapeDateFormat(t *testing.T) {
+	u, _ := url.Parse("https://jobs.example.com/")
+	doc := `<table><tr><td><a href="/1">Gopher</a></td><td>01/03/2024</td></tr><tr><td><a href="/2">Rustacean</a></td><td>15/02/2024</td></tr></table>`
+	feed, err := Scrape(strings.NewReader(doc), u, db.Scraper{
+		Item:       "tr",
+		Title:      "td:first-child",
+		Date:       "td:nth-child(2)",
+		DateFormat: "02/01/2006",
+	})
+	require.NoError(t, err)
+	require.Len(t, feed.Items, 2)
+
+	assert.Equal(t, "https://jobs.example.com/1", feed.Items[0].Link, "the first link of the item")
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), feed.Items[0].PubDate)
+	assert.Equal(t, time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC), feed.Items[1].PubDate)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(db.Scraper{Item: ".entry", Title: "h2"}))
+	for name, s := range map[string]db.Scraper{
+		"no item":     {Title: "h2"},
+		"no title":    {Item: ".entry"},
+		"bad item":    {Item: ".entry >", Title: "h2"},
+		"bad summary": {Item: ".entry", Title: "h2", Summary: "p:hover"},
+	} {
+		assert.ErrorIs(t, Validate(s), ErrInvalidSelector, name)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="root" class="a b">
+<p class="x" lang="en-US">1</p><p data-k="v1">2</p><span>3</span><p class="x y">4</p>
+<section><p title="hello world">5</p></section></div>`))
+	require.NoError(t, err)
+
+	text := func(nodes []*html.Node) string {
+		var s []string
+		for _, n := range nodes {
+			s = append(s, htmlutil.Text(n))
+		}
+		return strings.Join(s, ",")
+	}
+
+	for selector, expected := range map[string]string{
+		"p":                               "1,2,4,5",
+		"div > p":                         "1,2,4",
+		"#root.b p.x":                     "1,4",
+		".x.y":                            "4",
+		"p[data-k]":                       "2",
+		`p[data-k="v1"]`:                  "2",
+		"[lang|=en]":                      "1",
+		"[title~=world]":                  "5",
+		"[title^=hell]":                   "5",
+		"[title$='orld']":                 "5",
+		"[title*=lo]":                     "5",
+		"span + p":                        "4",
+		"span ~ p, section > p":           "4,5",
+		"p:first-child":                   "1,5",
+		"p:last-child":                    "5",
+		"p:only-child":                    "5",
+		"div > :nth-child(2n)":            "2,4",
+		"div > :nth-child(odd)":           "1,3,5",
+		"p:nth-child(4)":                  "4",
+		"div > p:not(.x)":                 "2",
+		"P.X":                             "",
+		"*:not(p, div, html, head, body)": "3,5",
+	} {
+		sel, err := Compile(selector)
+		if assert.NoError(t, err, selector) {
+			assert.Equal(t, expected, text(sel.Select(doc)), selector)
+		}
+	}
+
+	for _, selector := range []string{"", "p >", ",p", "p[", "p[a=", "p[a=b", "p:hover", "p:not(.x", "p:nth-child(x)", "p..x", "p#"} {
+		_, err := Compile(selector)
+		assert.ErrorIs(t, err, ErrInvalidSelector, selector)
+	}
+}
@@ -0,0 +1,478 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"llrss/internal/htmlutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// ErrInvalidSelector is returned for selectors which don't parse, or use what isn't supported.
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// Selector is a compiled CSS selector. Supported are type, universal, #id, .class and
+// attribute selectors ([a], [a=v], [a~=v], [a|=v], [a^=v], [a$=v], [a*=v]), the :first-child,
+// :last-child, :only-child, :nth-child() and :not() pseudo-classes, the descendant, >, +
+// and ~ combinators, and groups separated by commas.
+type Selector []complexSelector
+
+// complexSelector is compound selectors joined by combinators, parts[0] has none.
+type complexSelector []part
+
+type part struct {
+	combinator byte
+	compound   compound
+}
+
+// compound is the conditions an element must all meet.
+type compound []func(*html.Node) bool
+
+// Compile parses a CSS selector.
+func Compile(s string) (Selector, error) {
+	p := &parser{s: s}
+	sel, err := p.group(false)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidSelector, s, err)
+	}
+	return sel, nil
+}
+
+// MustCompile is like Compile but panics when the selector is invalid.
+func MustCompile(s string) Selector {
+	sel, err := Compile(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// Match tells if the element matches the selector.
+func (sel Selector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range sel {
+		if c.match(n, len(c)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the descendants of n matching the selector, in document order.
+func (sel Selector) Select(n *html.Node) []*html.Node {
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		htmlutil.Walk(c, func(d *html.Node) bool {
+			if sel.Match(d) {
+				found = append(found, d)
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// SelectFirst returns the first descendant of n matching the selector, or nil.
+func (sel Selector) SelectFirst(n *html.Node) *html.Node {
+	var found *html.Node
+	for c := n.FirstChild; c != nil && found == nil; c = c.NextSibling {
+		htmlutil.Walk(c, func(d *html.Node) bool {
+			if found == nil && sel.Match(d) {
+				found = d
+			}
+			return found == nil
+		})
+	}
+	return found
+}
+
+// match tells if n matches the selector up to its ith part, matching from right to left.
+func (c complexSelector) match(n *html.Node, i int) bool {
+	if !c[i].compound.match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch c[i].combinator {
+	case '>':
+		return n.Parent != nil && n.Parent.Type == html.ElementNode && c.match(n.Parent, i-1)
+	case '+':
+		prev := previousElement(n)
+		return prev != nil && c.match(prev, i-1)
+	case '~':
+		for prev := previousElement(n); prev != nil; prev = previousElement(prev) {
+			if c.match(prev, i-1) {
+				return true
+			}
+		}
+		return false
+	default:
+		for a := n.Parent; a != nil && a.Type == html.ElementNode; a = a.Parent {
+			if c.match(a, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c compound) match(n *html.Node) bool {
+	for _, cond := range c {
+		if !cond(n) {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+// group parses selectors separated by commas, up to the end or to the closing
+// parenthesis of :not().
+func (p *parser) group(nested bool) (Selector, error) {
+	var sel Selector
+	for {
+		p.skipSpace()
+		c, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, c)
+
+		p.skipSpace()
+		if nested && p.pos < len(p.s) && p.s[p.pos] == ')' {
+			return sel, nil
+		}
+		if p.pos == len(p.s) {
+			if nested {
+				return nil, errors.New("expected )")
+			}
+			return sel, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, fmt.Errorf("unexpected %q at %d", p.s[p.pos], p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) complex() (complexSelector, error) {
+	first, err := p.compound()
+	if err != nil {
+		return nil, err
+	}
+	c := complexSelector{{compound: first}}
+
+	for {
+		spaced := p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ',' || p.s[p.pos] == ')' {
+			return c, nil
+		}
+
+		combinator := byte(' ')
+		switch p.s[p.pos] {
+		case '>', '+', '~':
+			combinator = p.s[p.pos]
+			p.pos++
+			p.skipSpace()
+		default:
+			if !spaced {
+				return nil, fmt.Errorf("unexpected %q at %d", p.s[p.pos], p.pos)
+			}
+		}
+
+		next, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, part{combinator: combinator, compound: next})
+	}
+}
+
+func (p *parser) compound() (compound, error) {
+	var c compound
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+		c = append(c, func(*html.Node) bool { return true })
+	} else if name := p.ident(); name != "" {
+		name = strings.ToLower(name)
+		c = append(c, func(n *html.Node) bool { return n.Data == name })
+	}
+
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			id := p.ident()
+			if id == "" {
+				return nil, fmt.Errorf("expected an ID at %d", p.pos)
+			}
+			c = append(c, func(n *html.Node) bool { return htmlutil.Attr(n, "id") == id })
+		case '.':
+			p.pos++
+			class := p.ident()
+			if class == "" {
+				return nil, fmt.Errorf("expected a class at %d", p.pos)
+			}
+			c = append(c, func(n *html.Node) bool { return includes(htmlutil.Attr(n, "class"), class) })
+		case '[':
+			cond, err := p.attribute()
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, cond)
+		case ':':
+			cond, err := p.pseudo()
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, cond)
+		default:
+			if len(c) == 0 {
+				return nil, fmt.Errorf("expected a selector at %d", p.pos)
+			}
+			return c, nil
+		}
+	}
+
+	if len(c) == 0 {
+		return nil, errors.New("unexpected end")
+	}
+	return c, nil
+}
+
+func (p *parser) attribute() (func(*html.Node) bool, error) {
+	p.pos++ // [
+	p.skipSpace()
+	key := strings.ToLower(p.ident())
+	if key == "" {
+		return nil, fmt.Errorf("expected an attribute at %d", p.pos)
+	}
+	p.skipSpace()
+
+	if p.pos < len(p.s) && p.s[p.pos] == ']' {
+		p.pos++
+		return func(n *html.Node) bool { return htmlutil.HasAttr(n, key) }, nil
+	}
+
+	var op string
+	for _, o := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.pos:], o) {
+			op = o
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("expected an attribute operator at %d", p.pos)
+	}
+	p.pos += len(op)
+	p.skipSpace()
+
+	val, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return nil, fmt.Errorf("expected ] at %d", p.pos)
+	}
+	p.pos++
+
+	return func(n *html.Node) bool {
+		if !htmlutil.HasAttr(n, key) {
+			return false
+		}
+		v := htmlutil.Attr(n, key)
+		switch op {
+		case "~=":
+			return includes(v, val)
+		case "|=":
+			return v == val || strings.HasPrefix(v, val+"-")
+		case "^=":
+			return val != "" && strings.HasPrefix(v, val)
+		case "$=":
+			return val != "" && strings.HasSuffix(v, val)
+		case "*=":
+			return val != "" && strings.Contains(v, val)
+		default:
+			return v == val
+		}
+	}, nil
+}
+
+func (p *parser) pseudo() (func(*html.Node) bool, error) {
+	p.pos++ // :
+	name := strings.ToLower(p.ident())
+	switch name {
+	case "first-child":
+		return func(n *html.Node) bool { return previousElement(n) == nil }, nil
+	case "last-child":
+		return func(n *html.Node) bool { return nextElement(n) == nil }, nil
+	case "only-child":
+		return func(n *html.Node) bool { return previousElement(n) == nil && nextElement(n) == nil }, nil
+	case "nth-child":
+		arg, err := p.argument()
+		if err != nil {
+			return nil, err
+		}
+		a, b, err := parseNth(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *html.Node) bool {
+			i := 1
+			for prev := previousElement(n); prev != nil; prev = previousElement(prev) {
+				i++
+			}
+			if a == 0 {
+				return i == b
+			}
+			return (i-b)%a == 0 && (i-b)/a >= 0
+		}, nil
+	case "not":
+		if p.pos == len(p.s) || p.s[p.pos] != '(' {
+			return nil, fmt.Errorf("expected ( at %d", p.pos)
+		}
+		p.pos++
+		sel, err := p.group(true)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++ // )
+		return func(n *html.Node) bool { return !sel.Match(n) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported pseudo-class :%s", name)
+	}
+}
+
+// argument returns the text between the parentheses of a pseudo-class.
+func (p *parser) argument() (string, error) {
+	if p.pos == len(p.s) || p.s[p.pos] != '(' {
+		return "", fmt.Errorf("expected ( at %d", p.pos)
+	}
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return "", fmt.Errorf("expected ) after %d", p.pos)
+	}
+	arg := p.s[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+	return strings.TrimSpace(arg), nil
+}
+
+// parseNth parses the an+b argument of :nth-child, or odd or even.
+func parseNth(s string) (a, b int, err error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	before, after, ok := strings.Cut(s, "n")
+	if !ok {
+		b, err = strconv.Atoi(s)
+		return 0, b, err
+	}
+
+	switch before {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(before); err != nil {
+			return 0, 0, err
+		}
+	}
+	if after != "" {
+		if b, err = strconv.Atoi(after); err != nil {
+			return 0, 0, err
+		}
+	}
+	return a, b, nil
+}
+
+func (p *parser) value() (string, error) {
+	if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		quote := p.s[p.pos]
+		end := strings.IndexByte(p.s[p.pos+1:], quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string at %d", p.pos)
+		}
+		v := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return v, nil
+	}
+
+	v := p.ident()
+	if v == "" {
+		return "", fmt.Errorf("expected a value at %d", p.pos)
+	}
+	return v, nil
+}
+
+// ident reads an identifier, with backslash escapes, empty when there's none.
+func (p *parser) ident() string {
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		switch {
+		case r == '\\' && p.pos+size < len(p.s):
+			p.pos += size
+			r, size = utf8.DecodeRuneInString(p.s[p.pos:])
+		case r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r >= utf8.RuneSelf:
+		default:
+			return b.String()
+		}
+		b.WriteRune(r)
+		p.pos += size
+	}
+	return b.String()
+}
+
+// skipSpace skips whitespace and tells if there was some.
+func (p *parser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r\f", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func previousElement(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func nextElement(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// includes tells if the whitespace separated list v has word.
+func includes(v, word string) bool {
+	for _, w := range strings.Fields(v) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
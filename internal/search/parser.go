@@ -0,0 +1,311 @@
+package search
+
+import (
+	"fmt"
+	"llrss/internal/text"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError is returned for invalid queries, Column is where the error is, counting from 1.
+type SyntaxError struct {
+	Msg    string
+	Column int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at column %d: %s", e.Column, e.Msg)
+}
+
+// Parse parses a query, it returns a nil Expr for an empty one.
+func Parse(q string) (Expr, error) {
+	p := &parser{input: q}
+
+	for i, r := range q {
+		if r == utf8.RuneError {
+			if _, n := utf8.DecodeRuneInString(q[i:]); n == 1 {
+				return nil, p.errorf(i, "invalid UTF-8")
+			}
+		}
+	}
+
+	p.skipSpaces()
+	if p.eof() {
+		return nil, nil
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		// parseOr only stops early on an unmatched closing parenthesis
+		return nil, p.errorf(p.pos, "unexpected %q, no parenthesis to close", p.peek())
+	}
+	return e, nil
+}
+
+type parser struct {
+	input string
+	// pos is the byte offset of the next rune to read.
+	pos int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return r
+}
+
+// next reads the next rune.
+func (p *parser) next() rune {
+	r, n := utf8.DecodeRuneInString(p.input[p.pos:])
+	p.pos += n
+	return r
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+// errorf returns a SyntaxError at the byte offset pos.
+func (p *parser) errorf(pos int, format string, args ...any) *SyntaxError {
+	return &SyntaxError{
+		Msg:    fmt.Sprintf(format, args...),
+		Column: utf8.RuneCountInString(p.input[:pos]) + 1,
+	}
+}
+
+// atKeyword tells if the input continues with the keyword as a whole word.
+func (p *parser) atKeyword(kw string) bool {
+	if !strings.HasPrefix(p.input[p.pos:], kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	if end == len(p.input) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[end:])
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// parseOr parses: and ("OR" and)*.
+func (p *parser) parseOr() (Expr, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := []Expr{first}
+	for p.atKeyword("OR") {
+		orPos := p.pos
+		p.pos += len("OR")
+		p.skipSpaces()
+
+		if p.eof() || p.peek() == ')' {
+			return nil, p.errorf(orPos, "OR must be followed by a term")
+		}
+
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+
+	if len(exprs) == 1 {
+		return first, nil
+	}
+	return &Or{Exprs: exprs}, nil
+}
+
+// parseAnd parses: unary+, stopping at OR, a closing parenthesis or the end.
+func (p *parser) parseAnd() (Expr, error) {
+	var exprs []Expr
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() == ')' || p.atKeyword("OR") {
+			break
+		}
+		if p.atKeyword("AND") {
+			// AND is implicit, but accepted between terms
+			if len(exprs) == 0 {
+				return nil, p.errorf(p.pos, "AND must follow a term")
+			}
+			p.pos += len("AND")
+			continue
+		}
+
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+
+	switch len(exprs) {
+	case 0:
+		if p.atKeyword("OR") {
+			return nil, p.errorf(p.pos, "OR must follow a term")
+		}
+		return nil, p.errorf(p.pos, "expected a term")
+	case 1:
+		return exprs[0], nil
+	default:
+		return &And{Exprs: exprs}, nil
+	}
+}
+
+// parseUnary parses: "-"? primary.
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek() != '-' {
+		return p.parsePrimary()
+	}
+
+	minusPos := p.pos
+	p.pos++
+	if p.eof() || unicode.IsSpace(p.peek()) || p.peek() == ')' {
+		return nil, p.errorf(minusPos, "- must be followed by the term to exclude")
+	}
+	if p.peek() == '-' {
+		return nil, p.errorf(p.pos, "a term can only be excluded once")
+	}
+
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &Not{Expr: e}, nil
+}
+
+// parsePrimary parses: "(" expr ")" | phrase | [field ":"] (word | phrase). Words with a
+// colon which isn't after a field name, like URLs or times, are searched as they are.
+func (p *parser) parsePrimary() (Expr, error) {
+	switch p.peek() {
+	case '(':
+		openPos := p.pos
+		p.pos++
+
+		p.skipSpaces()
+		if p.eof() || p.peek() == ')' {
+			return nil, p.errorf(openPos, "empty parentheses")
+		}
+
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.eof() {
+			return nil, p.errorf(openPos, "parenthesis is never closed")
+		}
+		p.pos++ // )
+		return e, nil
+
+	case '"':
+		value, err := p.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		return &Term{Field: FieldText, Value: value, Phrase: true}, nil
+	}
+
+	start := p.pos
+	word := p.parseWord()
+
+	name, value, ok := strings.Cut(word, ":")
+	field := Field(strings.ToLower(name))
+	if !ok || !slices.Contains(fields, field) {
+		return &Term{Field: FieldText, Value: word}, nil
+	}
+
+	term := &Term{Field: field, Value: value}
+	if value == "" {
+		if p.eof() || p.peek() != '"' {
+			return nil, p.errorf(start, "%s: needs a value", name)
+		}
+
+		phrase, err := p.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		term.Value = phrase
+		term.Phrase = true
+	}
+
+	if err := p.checkTerm(term, start); err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+// parseWord reads until a space, a parenthesis or a quote.
+func (p *parser) parseWord() string {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+			break
+		}
+		p.next()
+	}
+	return p.input[start:p.pos]
+}
+
+// parsePhrase reads a quoted string, in which \" and \\ are escapes.
+func (p *parser) parsePhrase() (string, error) {
+	openPos := p.pos
+	p.pos++ // "
+
+	var b strings.Builder
+	for !p.eof() {
+		r := p.next()
+
+		switch r {
+		case '"':
+			phrase := strings.TrimSpace(b.String())
+			if phrase == "" {
+				return "", p.errorf(openPos, "empty quotes")
+			}
+			return phrase, nil
+		case '\\':
+			if !p.eof() && (p.peek() == '"' || p.peek() == '\\') {
+				r = p.peek()
+				p.pos++
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return "", p.errorf(openPos, "quote is never closed")
+}
+
+// checkTerm validates the value of a field, and parses dates.
+func (p *parser) checkTerm(t *Term, pos int) error {
+	switch t.Field {
+	case FieldIs:
+		t.Value = strings.ToLower(t.Value)
+		if !slices.Contains(isValues, t.Value) {
+			return p.errorf(pos, "unknown is:%s, expected one of %s", t.Value, strings.Join(isValues, ", "))
+		}
+
+	case FieldTag:
+		t.Value = strings.ToLower(strings.TrimSpace(t.Value))
+
+	case FieldBefore, FieldAfter:
+		d, err := text.ParseAPISearchDate(t.Value)
+		if err != nil {
+			return p.errorf(pos, "invalid date %q for %s:, expected YYYY-MM-DD", t.Value, t.Field)
+		}
+		t.Date = d
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "word", input: "kubernetes", expected: "text:kubernetes"},
+		{name: "words are all required", input: "go  generics\t", expected: "(and text:go text:generics)"},
+		{name: "phrase", input: `"exact phrase"`, expected: `text:"exact phrase"`},
+		{name: "escaped quotes in phrase", input: `"say \"hi\" \\o/"`, expected: `text:"say \"hi\" \\o/"`},
+		{name: "field", input: "author:foo", expected: "author:foo"},
+		{name: "field names are case insensitive", input: "Title:Kubernetes", expected: "title:Kubernetes"},
+		{name: "field with phrase", input: `feed:"Hacker News"`, expected: `feed:"Hacker News"`},
+		{name: "field value with colon", input: "title:c++:20", expected: "title:c++:20"},
+		{name: "unknown field is a word", input: "foo:bar", expected: "text:foo:bar"},
+		{name: "url", input: "http://example.com/a?b=c", expected: "text:http://example.com/a?b=c"},
+		{name: "time", input: "10:30", expected: "text:10:30"},
+		{name: "negation", input: "-sponsored", expected: "(not text:sponsored)"},
+		{name: "negated field", input: `-feed:"Hacker News"`, expected: `(not feed:"Hacker News")`},
+		{name: "dash inside a word", input: "e-mail", expected: "text:e-mail"},
+		{name: "is values are lowercase", input: "is:Unread is:STARRED", expected: "(and is:unread is:starred)"},
+		{name: "tags are lowercase", input: "tag:Go", expected: "tag:go"},
+		{name: "or", input: "go OR rust", expected: "(or text:go text:rust)"},
+		{name: "or binds looser than and", input: "a b OR c d", expected: "(or (and text:a text:b) (and text:c text:d))"},
+		{name: "lowercase or is a word", input: "go or rust", expected: "(and text:go text:or text:rust)"},
+		{name: "explicit and", input: "go AND rust", expected: "(and text:go text:rust)"},
+		{name: "parentheses", input: "(go OR rust) release", expected: "(and (or text:go text:rust) text:release)"},
+		{name: "negated group", input: "-(tag:ads OR sponsored)", expected: "(not (or tag:ads text:sponsored))"},
+		{name: "nested parentheses", input: "((a))", expected: "text:a"},
+		{name: "parentheses without spaces", input: "(a)(b)", expected: "(and text:a text:b)"},
+		{name: "unicode", input: `café title:"Ünïcode ☃"`, expected: `(and text:café title:"Ünïcode ☃")`},
+		{
+			name:     "everything",
+			input:    `author:foo feed:"Hacker News" tag:go is:unread is:starred before:2024-01-01 -sponsored "exact phrase" title:kubernetes`,
+			expected: `(and author:foo feed:"Hacker News" tag:go is:unread is:starred before:2024-01-01 (not text:sponsored) text:"exact phrase" title:kubernetes)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, e.String())
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, input := range []string{"", "   ", "\t\n"} {
+		e, err := Parse(input)
+		require.NoError(t, err)
+		assert.Nil(t, e)
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	e, err := Parse("after:2024-01-01 before:2024-02-01")
+	require.NoError(t, err)
+
+	terms := Required(e)
+	require.Len(t, terms, 2)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), terms[0].Date)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), terms[1].Date)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		column  int
+	}{
+		{input: `"unclosed`, message: "quote is never closed", column: 1},
+		{input: `title:"unclosed`, message: "quote is never closed", column: 7},
+		{input: `""`, message: "empty quotes", column: 1},
+		{input: "(go OR rust", message: "parenthesis is never closed", column: 1},
+		{input: "go)", message: `unexpected ')', no parenthesis to close`, column: 3},
+		{input: "()", message: "empty parentheses", column: 1},
+		{input: "go OR", message: "OR must be followed by a term", column: 4},
+		{input: "(go OR)", message: "OR must be followed by a term", column: 5},
+		{input: "OR go", message: "OR must follow a term", column: 1},
+		{input: "AND go", message: "AND must follow a term", column: 1},
+		{input: "go -", message: "- must be followed by the term to exclude", column: 4},
+		{input: "--go", message: "a term can only be excluded once", column: 2},
+		{input: "author:", message: "author: needs a value", column: 1},
+		{input: "go author: foo", message: "author: needs a value", column: 4},
+		{input: "is:new", message: "unknown is:new, expected one of unread, read, starred, unstarred", column: 1},
+		{input: "café before:yesterday", message: `invalid date "yesterday" for before:, expected YYYY-MM-DD`, column: 6},
+		{input: "after:2024-13-01", message: `invalid date "2024-13-01" for after:, expected YYYY-MM-DD`, column: 1},
+		{input: "\xff", message: "invalid UTF-8", column: 1},
+		{input: "café \xe2\x98", message: "invalid UTF-8", column: 6},
+		{input: "\"caf\xc3\"", message: "invalid UTF-8", column: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.message, syntaxErr.Msg)
+			assert.Equal(t, tt.column, syntaxErr.Column)
+		})
+	}
+}
+
+func TestRequired(t *testing.T) {
+	e, err := Parse(`go "exact phrase" -sponsored (a OR b) tag:x`)
+	require.NoError(t, err)
+
+	var required []string
+	for _, term := range Required(e) {
+		required = append(required, term.String())
+	}
+	assert.Equal(t, []string{"text:go", `text:"exact phrase"`, "tag:x"}, required)
+}
+
+func TestHasTerm(t *testing.T) {
+	e, err := Parse(`go (a OR -is:read) tag:x`)
+	require.NoError(t, err)
+
+	assert.True(t, HasTerm(e, FieldIs, IsRead, IsUnread))
+	assert.True(t, HasTerm(e, FieldTag, "x"))
+	assert.False(t, HasTerm(e, FieldIs, IsStarred))
+	assert.False(t, HasTerm(nil, FieldIs, IsRead))
+}
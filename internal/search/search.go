@@ -0,0 +1,131 @@
+// Package search parses the query language of item searches, e.g.
+//
+//	author:foo feed:"Hacker News" tag:go is:unread before:2024-01-01 -sponsored "exact phrase"
+//
+// Terms are matched all together, OR matches either side and binds looser than
+// the implicit AND, parentheses group terms and a leading - negates a term.
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Field is what a term matches, FieldText matches the title, description, content and author.
+type Field string
+
+const (
+	FieldText   Field = "text"
+	FieldTitle  Field = "title"
+	FieldAuthor Field = "author"
+	FieldFeed   Field = "feed"
+	FieldFolder Field = "folder"
+	FieldTag    Field = "tag"
+	FieldIs     Field = "is"
+	FieldBefore Field = "before"
+	FieldAfter  Field = "after"
+)
+
+// fields are the fields a term can be prefixed with.
+var fields = []Field{FieldTitle, FieldAuthor, FieldFeed, FieldFolder, FieldTag, FieldIs, FieldBefore, FieldAfter}
+
+// Values of FieldIs.
+const (
+	IsUnread    = "unread"
+	IsRead      = "read"
+	IsStarred   = "starred"
+	IsUnstarred = "unstarred"
+)
+
+var isValues = []string{IsUnread, IsRead, IsStarred, IsUnstarred}
+
+// Expr is a node of a parsed query.
+type Expr interface {
+	// String returns the expression in a canonical, fully parenthesized form.
+	String() string
+}
+
+// And matches items matching all of its expressions.
+type And struct {
+	Exprs []Expr
+}
+
+// Or matches items matching any of its expressions.
+type Or struct {
+	Exprs []Expr
+}
+
+// Not matches items not matching its expression.
+type Not struct {
+	Expr Expr
+}
+
+// Term matches a single field. Dates are parsed for FieldBefore and FieldAfter,
+// values of FieldTag and FieldIs are lowercase.
+type Term struct {
+	Date   time.Time
+	Field  Field
+	Value  string
+	Phrase bool
+}
+
+func (e *And) String() string {
+	return "(and " + joinExprs(e.Exprs) + ")"
+}
+
+func (e *Or) String() string {
+	return "(or " + joinExprs(e.Exprs) + ")"
+}
+
+func (e *Not) String() string {
+	return "(not " + e.Expr.String() + ")"
+}
+
+func (t *Term) String() string {
+	if t.Phrase || strings.ContainsAny(t.Value, " \t\"()") {
+		return fmt.Sprintf("%s:%q", t.Field, t.Value)
+	}
+	return string(t.Field) + ":" + t.Value
+}
+
+func joinExprs(exprs []Expr) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// Required returns the terms every matching item has, those not negated nor in an OR.
+func Required(e Expr) []*Term {
+	switch e := e.(type) {
+	case *Term:
+		return []*Term{e}
+	case *And:
+		var terms []*Term
+		for _, sub := range e.Exprs {
+			terms = append(terms, Required(sub)...)
+		}
+		return terms
+	default:
+		return nil
+	}
+}
+
+// HasTerm tells if any term of e, negated or not, matches field with one of the values.
+func HasTerm(e Expr, field Field, values ...string) bool {
+	switch e := e.(type) {
+	case *Term:
+		return e.Field == field && slices.Contains(values, e.Value)
+	case *Not:
+		return HasTerm(e.Expr, field, values...)
+	case *And:
+		return slices.ContainsFunc(e.Exprs, func(sub Expr) bool { return HasTerm(sub, field, values...) })
+	case *Or:
+		return slices.ContainsFunc(e.Exprs, func(sub Expr) bool { return HasTerm(sub, field, values...) })
+	default:
+		return false
+	}
+}
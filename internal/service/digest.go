@@ -0,0 +1,490 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/text"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	MaxDigestNameLength = 128
+	// DigestMaxItems is the most items sent in a digest, the others wait for the next one.
+	DigestMaxItems = 100
+	// DigestSummaryLength is how many characters of the description of items are sent.
+	DigestSummaryLength = 280
+)
+
+// digestDays are the days digests can be sent on, indexed by time.Weekday.
+var digestDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var (
+	// ErrInvalidDigestName is returned for empty or too long digest names.
+	ErrInvalidDigestName = errors.New("invalid digest name")
+	// ErrInvalidDigest is returned for digests without valid recipients, time or days, or with
+	// more than one of a folder, tag and saved search.
+	ErrInvalidDigest = errors.New("invalid digest")
+	// ErrMailDisabled is returned when sending digests without an SMTP server configured.
+	ErrMailDisabled = errors.New("no SMTP server configured")
+)
+
+//go:embed templates/digest.html templates/digest.txt
+var digestTemplates embed.FS
+
+// DigestSettings configure how digests are sent. Templates is a directory with digest.html and
+// digest.txt templates replacing the default ones.
+type DigestSettings struct {
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	Location     *time.Location
+	BaseURL      string
+	Templates    string
+}
+
+// DigestService emails the unread items of a selection on a schedule. Items are only
+// sent once by each digest.
+type DigestService interface {
+	ListDigests(ctx context.Context) ([]db.Digest, error)
+	GetDigest(ctx context.Context, id string) (*db.Digest, error)
+	CreateDigest(ctx context.Context, d *db.Digest) error
+	UpdateDigest(ctx context.Context, d *db.Digest) error
+	DeleteDigest(ctx context.Context, id string) error
+	// PreviewDigest renders the next digest without sending it.
+	PreviewDigest(ctx context.Context, id string) (*models.DigestMessage, error)
+	// SendDigest sends the next digest right away, whether it's due or not.
+	SendDigest(ctx context.Context, id string) (*models.DigestResult, error)
+	// SendDueDigests sends the digests whose time has come since they were last sent.
+	SendDueDigests(ctx context.Context) error
+}
+
+type digestService struct {
+	repo               repository.DigestRepository
+	feedService        FeedService
+	folderService      FolderService
+	savedSearchService SavedSearchService
+	settings           DigestSettings
+	htmlTemplate       *htmltemplate.Template
+	textTemplate       *texttemplate.Template
+}
+
+func NewDigestService(repo repository.DigestRepository, feedService FeedService, folderService FolderService,
+	savedSearchService SavedSearchService, settings DigestSettings) (DigestService, error) {
+	if settings.Location == nil {
+		settings.Location = time.UTC
+	}
+
+	funcs := map[string]any{"summary": digestSummary}
+	var files fs.FS = digestTemplates
+	pattern := "templates/digest.%s"
+	if settings.Templates != "" {
+		files, pattern = os.DirFS(settings.Templates), "digest.%s"
+	}
+
+	html, err := htmltemplate.New("digest.html").Funcs(funcs).ParseFS(files, fmt.Sprintf(pattern, "html"))
+	if err != nil {
+		return nil, fmt.Errorf("parse digest template: %w", err)
+	}
+	txt, err := texttemplate.New("digest.txt").Funcs(funcs).ParseFS(files, fmt.Sprintf(pattern, "txt"))
+	if err != nil {
+		return nil, fmt.Errorf("parse digest template: %w", err)
+	}
+
+	return &digestService{
+		repo:               repo,
+		feedService:        feedService,
+		folderService:      folderService,
+		savedSearchService: savedSearchService,
+		settings:           settings,
+		htmlTemplate:       html,
+		textTemplate:       txt,
+	}, nil
+}
+
+func (s *digestService) ListDigests(ctx context.Context) ([]db.Digest, error) {
+	return s.repo.ListDigests(ctx)
+}
+
+func (s *digestService) GetDigest(ctx context.Context, id string) (*db.Digest, error) {
+	return s.repo.GetDigest(ctx, id)
+}
+
+func (s *digestService) CreateDigest(ctx context.Context, d *db.Digest) error {
+	d.ID = text.RandomID()
+	if err := s.validate(ctx, d); err != nil {
+		return err
+	}
+
+	// Digests start with the items arriving from now on, see render
+	d.CreatedAt = time.Now().UTC()
+	d.LastSentAt = nil
+	if err := s.repo.SaveDigest(ctx, d); err != nil {
+		return fmt.Errorf("save digest: %w", err)
+	}
+	return nil
+}
+
+func (s *digestService) UpdateDigest(ctx context.Context, d *db.Digest) error {
+	existing, err := s.repo.GetDigest(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validate(ctx, d); err != nil {
+		return err
+	}
+
+	d.CreatedAt = existing.CreatedAt
+	d.LastSentAt = existing.LastSentAt
+	if err := s.repo.SaveDigest(ctx, d); err != nil {
+		return fmt.Errorf("save digest: %w", err)
+	}
+	return nil
+}
+
+func (s *digestService) DeleteDigest(ctx context.Context, id string) error {
+	return s.repo.DeleteDigest(ctx, id)
+}
+
+// validate checks a digest and normalizes its recipients, tag, time and days.
+func (s *digestService) validate(ctx context.Context, d *db.Digest) error {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" || len(d.Name) > MaxDigestNameLength {
+		return ErrInvalidDigestName
+	}
+
+	if len(d.Recipients) == 0 {
+		return fmt.Errorf("%w: no recipient", ErrInvalidDigest)
+	}
+	for i, r := range d.Recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("%w: recipient %q: %w", ErrInvalidDigest, r, err)
+		}
+		d.Recipients[i] = addr.Address
+	}
+
+	selections := 0
+	if d.FolderID != "" {
+		selections++
+		if _, err := s.folderService.GetFolder(ctx, d.FolderID); err != nil {
+			return err
+		}
+	}
+	if d.Tag != "" {
+		selections++
+		tag, err := NormalizeTag(d.Tag)
+		if err != nil {
+			return err
+		}
+		d.Tag = tag
+	}
+	if d.SavedSearchID != "" {
+		selections++
+		if _, err := s.savedSearchService.GetSavedSearch(ctx, d.SavedSearchID); err != nil {
+			return err
+		}
+	}
+	if selections > 1 {
+		return fmt.Errorf("%w: expected one of a folder, tag or saved search", ErrInvalidDigest)
+	}
+
+	if d.Time == "" {
+		d.Time = "08:00"
+	}
+	t, err := time.Parse("15:04", d.Time)
+	if err != nil {
+		return fmt.Errorf("%w: time %q, expected HH:MM", ErrInvalidDigest, d.Time)
+	}
+	d.Time = t.Format("15:04")
+
+	for i, day := range d.Days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		if !slices.Contains(digestDays, day) {
+			return fmt.Errorf("%w: day %q, expected one of %s", ErrInvalidDigest, d.Days[i], strings.Join(digestDays, ", "))
+		}
+		d.Days[i] = day
+	}
+	slices.SortFunc(d.Days, func(a, b string) int {
+		return slices.Index(digestDays, a) - slices.Index(digestDays, b)
+	})
+	d.Days = slices.Compact(d.Days)
+	return nil
+}
+
+func (s *digestService) PreviewDigest(ctx context.Context, id string) (*models.DigestMessage, error) {
+	d, err := s.repo.GetDigest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, _, err := s.render(ctx, d)
+	return msg, err
+}
+
+func (s *digestService) SendDigest(ctx context.Context, id string) (*models.DigestResult, error) {
+	if s.settings.SMTPAddr == "" {
+		return nil, ErrMailDisabled
+	}
+
+	d, err := s.repo.GetDigest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, d, time.Now())
+}
+
+func (s *digestService) SendDueDigests(ctx context.Context) error {
+	if s.settings.SMTPAddr == "" {
+		return nil
+	}
+
+	if _, err := s.repo.PruneDigested(ctx); err != nil {
+		return err
+	}
+
+	digests, err := s.repo.ListDigests(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	for i := range digests {
+		d := &digests[i]
+		last := d.CreatedAt
+		if d.LastSentAt != nil {
+			last = *d.LastSentAt
+		}
+		if nextDigest(d, last, s.settings.Location).After(now) {
+			continue
+		}
+
+		if _, err := s.send(ctx, d, now); err != nil {
+			errs = append(errs, fmt.Errorf("digest %s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nextDigest returns when a digest is due next after the given time.
+func nextDigest(d *db.Digest, after time.Time, loc *time.Location) time.Time {
+	at, _ := time.Parse("15:04", d.Time)
+	t := after.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	for i := range 8 {
+		next := day.AddDate(0, 0, i)
+		if next.After(after) && (len(d.Days) == 0 || slices.Contains(d.Days, digestDays[next.Weekday()])) {
+			return next
+		}
+	}
+	// Unreachable with valid days
+	return day.AddDate(0, 0, 8)
+}
+
+// send emails the items the digest hasn't sent yet and records them, along with when it was sent.
+// Nothing is emailed when there's no new item.
+func (s *digestService) send(ctx context.Context, d *db.Digest, now time.Time) (*models.DigestResult, error) {
+	msg, items, err := s.render(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > 0 {
+		if err := s.mail(d.Recipients, msg, now); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	if err := s.repo.MarkDigested(ctx, d.ID, ids, now); err != nil {
+		return nil, err
+	}
+	return &models.DigestResult{Sent: len(items)}, nil
+}
+
+// digestData is given to the digest templates.
+type digestData struct {
+	Subject string
+	Digest  *db.Digest
+	Feeds   []digestFeed
+	Count   int
+	// More is how many new items are left for the next digests.
+	More    int64
+	BaseURL string
+}
+
+type digestFeed struct {
+	Title string
+	Items []db.Item
+}
+
+// render returns the next message of a digest, and the items it has.
+func (s *digestService) render(ctx context.Context, d *db.Digest) (*models.DigestMessage, []db.Item, error) {
+	params := models.SearchParams{}
+	switch {
+	case d.FolderID != "":
+		params.FolderID = d.FolderID
+	case d.Tag != "":
+		params.Tags = []string{d.Tag}
+	case d.SavedSearchID != "":
+		saved, err := s.savedSearchService.GetSavedSearch(ctx, d.SavedSearchID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if params, err = searchParams(saved); err != nil {
+			return nil, nil, err
+		}
+	}
+	params.Unread = true
+	params.Undigested = d.ID
+	params.SavedSince = d.CreatedAt
+	params.Sort = "desc"
+	params.Limit = DigestMaxItems
+	params.Offset, params.Cursor = 0, nil
+
+	res, err := s.feedService.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	titles := make(map[string]string, len(feeds))
+	for _, f := range feeds {
+		titles[f.ID] = f.Title
+		if f.Name != "" {
+			titles[f.ID] = f.Name
+		}
+	}
+
+	byFeed := make(map[string]*digestFeed)
+	data := digestData{
+		Digest:  d,
+		Count:   len(res.Items),
+		More:    res.Total - int64(len(res.Items)),
+		BaseURL: s.settings.BaseURL,
+	}
+	for _, item := range res.Items {
+		f, ok := byFeed[item.FeedID]
+		if !ok {
+			f = &digestFeed{Title: titles[item.FeedID]}
+			byFeed[item.FeedID] = f
+		}
+		f.Items = append(f.Items, item)
+	}
+	for _, f := range byFeed {
+		data.Feeds = append(data.Feeds, *f)
+	}
+	sort.Slice(data.Feeds, func(i, j int) bool {
+		return strings.ToLower(data.Feeds[i].Title) < strings.ToLower(data.Feeds[j].Title)
+	})
+
+	plural := "s"
+	if data.Count == 1 {
+		plural = ""
+	}
+	data.Subject = fmt.Sprintf("%s: %d new item%s", d.Name, data.Count, plural)
+
+	var html, txt bytes.Buffer
+	if err := s.htmlTemplate.Execute(&html, data); err != nil {
+		return nil, nil, fmt.Errorf("render digest: %w", err)
+	}
+	if err := s.textTemplate.Execute(&txt, data); err != nil {
+		return nil, nil, fmt.Errorf("render digest: %w", err)
+	}
+
+	return &models.DigestMessage{Subject: data.Subject, HTML: html.String(), Text: txt.String()}, res.Items, nil
+}
+
+// digestSummary shortens the description of an item.
+func digestSummary(description string) string {
+	summary := strings.Join(strings.Fields(description), " ")
+	if r := []rune(summary); len(r) > DigestSummaryLength {
+		summary = strings.TrimSpace(string(r[:DigestSummaryLength])) + "…"
+	}
+	return summary
+}
+
+// mail sends a message with its text and HTML alternatives.
+func (s *digestService) mail(to []string, msg *models.DigestMessage, now time.Time) error {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.settings.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@llrss>\r\n", text.RandomID())
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qp, part.content); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+	message.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if s.settings.SMTPUsername != "" {
+		host, _, _ := net.SplitHostPort(s.settings.SMTPAddr)
+		auth = smtp.PlainAuth("", s.settings.SMTPUsername, s.settings.SMTPPassword, host)
+	}
+	from, err := mail.ParseAddress(s.settings.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", s.settings.From, err)
+	}
+	if err := smtp.SendMail(s.settings.SMTPAddr, auth, from.Address, to, message.Bytes()); err != nil {
+		return fmt.Errorf("send digest: %w", err)
+	}
+	return nil
+}
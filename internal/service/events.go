@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"llrss/internal/events"
+	"llrss/internal/repository"
+)
+
+// EventService subscribes clients to the events of the bus, restricted to some feeds or folders.
+type EventService interface {
+	// Subscribe returns a subscription to the events of the given feeds and folder, of all of them
+	// without any, and the events published after lastEventID for the client to catch up on.
+	Subscribe(ctx context.Context, feedIDs []string, folderID string, lastEventID int64) (*events.Subscription, []events.Event, error)
+	Unsubscribe(sub *events.Subscription)
+}
+
+type eventService struct {
+	bus           *events.Bus
+	folderService FolderService
+}
+
+func NewEventService(bus *events.Bus, folderService FolderService) EventService {
+	return &eventService{
+		bus:           bus,
+		folderService: folderService,
+	}
+}
+
+func (s *eventService) Subscribe(ctx context.Context, feedIDs []string, folderID string, lastEventID int64) (*events.Subscription, []events.Event, error) {
+	match, err := eventFilter(ctx, s.folderService, feedIDs, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, missed := s.bus.Subscribe(lastEventID, match)
+	return sub, missed, nil
+}
+
+func (s *eventService) Unsubscribe(sub *events.Subscription) {
+	s.bus.Unsubscribe(sub)
+}
+
+// eventFilter returns whether an event concerns the given feeds or folder, including its subfolders,
+// nil without any. Events of bulk marks concern the feeds they may have changed: all of them without
+// a feed or folder, those of the folder (or of its parent) otherwise.
+func eventFilter(ctx context.Context, folderService FolderService, feedIDs []string, folderID string) (func(events.Event) bool, error) {
+	if len(feedIDs) == 0 && folderID == "" {
+		return nil, nil
+	}
+
+	tree, err := folderService.Tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The folder of every feed, and the parent of every subfolder
+	feedFolders := make(map[string]string)
+	parents := make(map[string]string)
+	known := make(map[string]bool)
+	for _, f := range tree.Feeds {
+		known[f.ID] = true
+	}
+	for _, node := range tree.Folders {
+		for _, f := range node.Feeds {
+			feedFolders[f.ID] = node.Folder.ID
+			known[f.ID] = true
+		}
+		for _, child := range node.Children {
+			parents[child.Folder.ID] = node.Folder.ID
+			for _, f := range child.Feeds {
+				feedFolders[f.ID] = child.Folder.ID
+				known[f.ID] = true
+			}
+		}
+	}
+
+	feeds := make(map[string]bool, len(feedIDs))
+	// feedScopes are the folders bulk marks of the feeds may be restricted to
+	feedScopes := make(map[string]bool)
+	for _, id := range feedIDs {
+		if !known[id] {
+			return nil, repository.ErrFeedNotFound
+		}
+		feeds[id] = true
+		if f, ok := feedFolders[id]; ok {
+			feedScopes[f] = true
+			if parent, ok := parents[f]; ok {
+				feedScopes[parent] = true
+			}
+		}
+	}
+
+	folders := make(map[string]bool)
+	if folderID != "" {
+		if _, err := folderService.GetFolder(ctx, folderID); err != nil {
+			return nil, err
+		}
+		folders[folderID] = true
+		for child, parent := range parents {
+			if parent == folderID {
+				folders[child] = true
+			}
+		}
+	}
+
+	return func(e events.Event) bool {
+		switch {
+		case e.FeedID == "" && e.FolderID == "":
+			return true
+		case e.FeedID == "":
+			return folders[e.FolderID] || feedScopes[e.FolderID]
+		default:
+			return feeds[e.FeedID] || folders[e.FolderID] || folders[feedFolders[e.FeedID]]
+		}
+	}, nil
+}
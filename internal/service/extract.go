@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"llrss/internal/events"
+	"llrss/internal/models/db"
+	"llrss/internal/readability"
+	"llrss/internal/repository"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// MaxArticlePageSize is the size of the largest page articles are extracted from.
+const MaxArticlePageSize = 5 << 20
+
+// ErrArticleUnavailable is returned when the page of an item can't be fetched, or isn't HTML.
+var ErrArticleUnavailable = errors.New("article unavailable")
+
+// ExtractService fetches the full articles of items whose feeds only have a teaser,
+// see readability.Extract.
+type ExtractService interface {
+	// ExtractItem fetches the page of an item and stores its article on it.
+	ExtractItem(ctx context.Context, id string) (*db.Item, error)
+	// Run extracts the articles of the items added to feeds with Extract on, until ctx is done.
+	Run(ctx context.Context)
+}
+
+type extractService struct {
+	repo   repository.FeedRepository
+	bus    *events.Bus
+	client *http.Client
+}
+
+func NewExtractService(repo repository.FeedRepository, bus *events.Bus) ExtractService {
+	return &extractService{
+		repo: repo,
+		bus:  bus,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (s *extractService) ExtractItem(ctx context.Context, id string) (*db.Item, error) {
+	item, err := s.repo.GetFeedItem(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	article, err := s.fetch(ctx, item.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	// The item may have changed while its page was fetched
+	item, err = s.repo.GetFeedItem(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	item.Article = article.Content
+	item.ExtractedAt = &now
+	if err := s.repo.UpdateFeedItem(ctx, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// fetch extracts the article of the page at link.
+func (s *extractService) fetch(ctx context.Context, link string) (*readability.Article, error) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: invalid link %q", ErrArticleUnavailable, link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArticleUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code: %d", ErrArticleUnavailable, resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, fmt.Errorf("%w: unexpected content type: %s", ErrArticleUnavailable, contentType)
+	}
+
+	// Pages aren't always UTF-8, the charset is taken from the header or the document
+	body, err := charset.NewReader(io.LimitReader(resp.Body, MaxArticlePageSize), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArticleUnavailable, err)
+	}
+
+	// Redirects move relative links along
+	return readability.Extract(body, resp.Request.URL)
+}
+
+func (s *extractService) Run(ctx context.Context) {
+	added := func(e events.Event) bool { return e.Type == events.ItemsAdded }
+	sub, _ := s.bus.Subscribe(0, added)
+	defer func() { s.bus.Unsubscribe(sub) }()
+
+	var lastID int64
+	extract := func(e events.Event) {
+		lastID = max(lastID, e.ID)
+		feed, err := s.repo.GetFeed(ctx, e.FeedID)
+		if err != nil || !feed.Extract {
+			return
+		}
+
+		for _, id := range e.ItemIDs {
+			if _, err := s.ExtractItem(ctx, id); err != nil && ctx.Err() == nil {
+				log.Printf("extract item %s failed: %v", id, err)
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if ok {
+				extract(e)
+				continue
+			}
+
+			// Dropped for lagging behind, catch up from the last event
+			var missed []events.Event
+			sub, missed = s.bus.Subscribe(lastID, added)
+			for _, e := range missed {
+				extract(e)
+			}
+		}
+	}
+}
@@ -1,17 +1,25 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"llrss/internal/models"
 	"llrss/internal/models/db"
 	"llrss/internal/models/rss"
 	"llrss/internal/repository"
+	"llrss/internal/scraper"
 	"llrss/internal/text"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
+
+	"golang.org/x/net/html/charset"
 )
 
 // TODO: Implement this through a column in Feed table based on provider TTL requested.
@@ -19,16 +27,59 @@ const (
 	MinRefreshRateMinutes = 0
 )
 
+const (
+	MaxTagLength  = 64
+	MaxNoteLength = 64 * 1024
+)
+
+var (
+	// ErrInvalidTag is returned for empty or too long tags.
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrNoteTooLong is returned for notes longer than MaxNoteLength.
+	ErrNoteTooLong = errors.New("note too long")
+	// ErrNoMarkScope is returned by bulk marks that don't restrict which items they apply to.
+	ErrNoMarkScope = errors.New("mark needs a feed, folder, search or date")
+	// ErrInvalidCursor is returned for search cursors that weren't returned by a search.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrRelevanceCursor is returned for cursors on searches sorted by relevance, which only have offsets.
+	ErrRelevanceCursor = errors.New("cursors can't be used with sort=relevance, use offset")
+	// ErrInvalidFeedField is returned when updating fields of a feed which can't be updated.
+	ErrInvalidFeedField = errors.New("invalid feed field")
+)
+
+// UpdatableFeedFields are the fields of a feed set by users, the others come from its source.
+var UpdatableFeedFields = []string{"Name", "FolderID", "Retention", "Scraper", "Extract"}
+
+// feedColumns are the columns of UpdatableFeedFields.
+var feedColumns = map[string][]string{
+	"Name":      {"name"},
+	"FolderID":  {"folder_id"},
+	"Retention": {"retention_max_items", "retention_read_days"},
+	"Scraper":   {"scraper_item", "scraper_title", "scraper_link", "scraper_date", "scraper_summary", "scraper_date_format"},
+	"Extract":   {"extract"},
+}
+
 type FeedService interface {
 	FetchFeed(ctx context.Context, url string) (*db.Feed, error)
+	// ScrapeFeed fetches a web page and picks its items out with the selectors, see scraper.Scrape.
+	ScrapeFeed(ctx context.Context, pageURL string, selectors db.Scraper) (*db.Feed, error)
 	GetFeed(ctx context.Context, id string) (*db.Feed, error)
 	GetFeedByURL(ctx context.Context, url string) (*db.Feed, error)
 	ListFeeds(ctx context.Context) ([]db.Feed, error)
+	CountFeedItems(ctx context.Context, feedIDs ...string) (*models.Counts, error)
 	AddFeed(ctx context.Context, url string) (string, error)
+	AddScraperFeed(ctx context.Context, pageURL string, selectors db.Scraper) (string, error)
 	DeleteFeed(ctx context.Context, id string) error
 	UpdateFeed(ctx context.Context, feed *db.Feed) error
+	// UpdateFeedFields only updates the given fields of a feed, among UpdatableFeedFields.
+	UpdateFeedFields(ctx context.Context, feed *db.Feed, fields ...string) error
 	MarkFeedItemRead(ctx context.Context, feedItemID string, read bool) error
-	SearchFeedItems(ctx context.Context, items models.SearchParams) ([]db.Item, int64, error)
+	MarkFeedItems(ctx context.Context, params models.SearchParams, read bool) (int64, error)
+	StarFeedItem(ctx context.Context, feedItemID string, starred bool) error
+	TagFeedItem(ctx context.Context, feedItemID, tag string, tagged bool) error
+	SetFeedItemNote(ctx context.Context, feedItemID, note string) error
+	SearchFeedItems(ctx context.Context, params models.SearchParams) (*models.SearchResult, error)
+	CountFeedItemTags(ctx context.Context, params models.SearchParams) ([]models.TagCount, error)
 	RefreshFeeds(ctx context.Context) error
 	Nuke(ctx context.Context) error
 }
@@ -48,33 +99,84 @@ func NewFeedService(repo repository.FeedRepository) FeedService {
 }
 
 func (s *feedService) FetchFeed(ctx context.Context, url string) (*db.Feed, error) {
+	body, resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := parseFeed(url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// WebSub discovery: HTTP Link headers take precedence over the ones in the document.
+	hub, self := parseLinkHeader(resp.Header.Values("Link"))
+	if hub != "" {
+		feed.HubURL = hub
+	}
+	if self != "" {
+		feed.SelfURL = self
+	}
+
+	return feed, nil
+}
+
+func (s *feedService) ScrapeFeed(ctx context.Context, pageURL string, selectors db.Scraper) (*db.Feed, error) {
+	if err := scraper.Validate(selectors); err != nil {
+		return nil, err
+	}
+
+	body, resp, err := s.get(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages aren't always UTF-8, the charset is taken from the header or the document
+	r, err := charset.NewReader(bytes.NewReader(body), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("decode page: %w", err)
+	}
+
+	// Links are relative to where the page was redirected to, the feed keeps the URL it was given
+	feed, err := scraper.Scrape(r, resp.Request.URL, selectors)
+	if err != nil {
+		return nil, err
+	}
+	feed.URL = pageURL
+	return feed, nil
+}
+
+// get fetches the document at url, the body of the response returned is already read.
+func (s *feedService) get(ctx context.Context, url string) ([]byte, *http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, nil, fmt.Errorf("create request: %w", err)
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetch feed: %w", err)
+		return nil, nil, fmt.Errorf("fetch feed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, nil, fmt.Errorf("read response: %w", err)
 	}
+	return body, resp, nil
+}
 
+// parseFeed turns a raw RSS document fetched from (or pushed for) url into a feed with its items.
+func parseFeed(url string, body []byte) (*db.Feed, error) {
 	var r rss.RSS
 	if err := xml.Unmarshal(body, &r); err != nil {
 		return nil, fmt.Errorf("parse RSS: %w", err)
 	}
 
-	fmt.Println(r)
-
 	var items []db.Item
 	for _, item := range r.Channel.Items {
 		d, err := text.ParseRSSDate(item.PubDate)
@@ -83,9 +185,15 @@ func (s *feedService) FetchFeed(ctx context.Context, url string) (*db.Feed, erro
 			continue
 		}
 
+		var content string
+		if item.Content != nil {
+			content = item.Content.Content
+		}
+
 		items = append(items, db.Item{
 			Title:       item.Title,
 			Description: item.Description,
+			Content:     content,
 			Link:        item.Link,
 			Author:      item.Author,
 			Category:    item.Category,
@@ -100,13 +208,54 @@ func (s *feedService) FetchFeed(ctx context.Context, url string) (*db.Feed, erro
 		URL:         url,
 		Title:       r.Channel.Title,
 		Description: r.Channel.Description,
+		SiteURL:     strings.TrimSpace(r.Channel.Link),
 		LastFetch:   time.Now(),
 		Items:       items,
 	}
 
+	for _, l := range r.Channel.AtomLinks {
+		switch {
+		case l.Rel == "hub" && feed.HubURL == "":
+			feed.HubURL = l.Href
+		case l.Rel == "self" && feed.SelfURL == "":
+			feed.SelfURL = l.Href
+		}
+	}
+
 	return feed, nil
 }
 
+// parseLinkHeader extracts the hub and self URLs from HTTP Link header values,
+// e.g. `<https://hub.example.com/>; rel="hub", <https://example.com/feed>; rel="self"`.
+func parseLinkHeader(values []string) (hub, self string) {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = strings.Trim(target, "<>")
+
+			for _, p := range parts[1:] {
+				k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+				if !ok || !strings.EqualFold(k, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					switch {
+					case rel == "hub" && hub == "":
+						hub = target
+					case rel == "self" && self == "":
+						self = target
+					}
+				}
+			}
+		}
+	}
+	return hub, self
+}
+
 func (s *feedService) GetFeed(ctx context.Context, id string) (*db.Feed, error) {
 	return s.repo.GetFeed(ctx, id)
 }
@@ -139,14 +288,76 @@ func (s *feedService) AddFeed(ctx context.Context, url string) (string, error) {
 	return id, nil
 }
 
+// AddScraperFeed adds a new feed scraped from the web page at pageURL and returns its ID.
+func (s *feedService) AddScraperFeed(ctx context.Context, pageURL string, selectors db.Scraper) (string, error) {
+	f, _ := s.repo.GetFeedByURL(ctx, pageURL)
+	if f != nil {
+		return f.ID, nil
+	}
+
+	feed, err := s.ScrapeFeed(ctx, pageURL, selectors)
+	if err != nil {
+		return "", fmt.Errorf("scrape feed: %w", err)
+	}
+
+	id, err := s.repo.SaveFeed(ctx, feed)
+	if err != nil {
+		return "", fmt.Errorf("save feed: %w", err)
+	}
+
+	return id, nil
+}
+
 func (s *feedService) DeleteFeed(ctx context.Context, id string) error {
 	return s.repo.DeleteFeed(ctx, id)
 }
 
+// CountFeedItems returns the item counts of the given feeds, or of all of them, along with their sum.
+func (s *feedService) CountFeedItems(ctx context.Context, feedIDs ...string) (*models.Counts, error) {
+	feeds, err := s.repo.CountItems(ctx, feedIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := &models.Counts{Feeds: feeds}
+	for _, c := range feeds {
+		counts.Unread += c.Unread
+		counts.Total += c.Total
+	}
+	return counts, nil
+}
+
 func (s *feedService) UpdateFeed(ctx context.Context, feed *db.Feed) error {
+	if feed.Scraper != (db.Scraper{}) {
+		if err := scraper.Validate(feed.Scraper); err != nil {
+			return err
+		}
+	}
 	return s.repo.UpdateFeed(ctx, feed)
 }
 
+func (s *feedService) UpdateFeedFields(ctx context.Context, feed *db.Feed, fields ...string) error {
+	var columns []string
+	for _, f := range fields {
+		c, ok := feedColumns[f]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidFeedField, f)
+		}
+		columns = append(columns, c...)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	// Scraper feeds can be turned back into feeds by clearing their selectors
+	if slices.Contains(fields, "Scraper") && feed.Scraper != (db.Scraper{}) {
+		if err := scraper.Validate(feed.Scraper); err != nil {
+			return err
+		}
+	}
+	return s.repo.UpdateFeedFields(ctx, feed, columns...)
+}
+
 func (s *feedService) MarkFeedItemRead(ctx context.Context, feedItemID string, read bool) error {
 	i, err := s.repo.GetFeedItem(ctx, feedItemID)
 	if err != nil {
@@ -156,8 +367,176 @@ func (s *feedService) MarkFeedItemRead(ctx context.Context, feedItemID string, r
 	return s.repo.UpdateFeedItem(ctx, i)
 }
 
-func (s *feedService) SearchFeedItems(ctx context.Context, params models.SearchParams) ([]db.Item, int64, error) {
-	return s.repo.SearchFeedItems(ctx, params)
+// MarkFeedItems marks all the items matching the search as read or unread. To avoid
+// marking everything by mistake the search must be restricted somehow, marking all
+// the items published before now does that explicitly.
+func (s *feedService) MarkFeedItems(ctx context.Context, params models.SearchParams, read bool) (int64, error) {
+	// A blank query doesn't restrict anything
+	params.Query = strings.TrimSpace(params.Query)
+	if params.Query == "" && params.Filter == nil && params.FolderID == "" && len(params.FeedIDs) == 0 && len(params.Tags) == 0 &&
+		!params.Starred && params.FromDate.IsZero() && params.ToDate.IsZero() && params.OlderThan.IsZero() {
+		return 0, ErrNoMarkScope
+	}
+
+	for i, t := range params.Tags {
+		tag, err := NormalizeTag(t)
+		if err != nil {
+			return 0, err
+		}
+		params.Tags[i] = tag
+	}
+
+	// The repository only touches the items whose status changes
+	params.Unread = false
+	return s.repo.MarkItemsRead(ctx, params, read)
+}
+
+// StarFeedItem stars or unstars an item, starred items are kept for later and never purged.
+func (s *feedService) StarFeedItem(ctx context.Context, feedItemID string, starred bool) error {
+	i, err := s.repo.GetFeedItem(ctx, feedItemID)
+	if err != nil {
+		return err
+	}
+	if i.IsStarred == starred {
+		return nil
+	}
+
+	i.IsStarred = starred
+	i.StarredAt = nil
+	if starred {
+		now := time.Now()
+		i.StarredAt = &now
+	}
+	return s.repo.UpdateFeedItem(ctx, i)
+}
+
+// TagFeedItem adds or removes a tag on an item, tags are case insensitive.
+func (s *feedService) TagFeedItem(ctx context.Context, feedItemID, tag string, tagged bool) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	if tagged {
+		return s.repo.AddItemTag(ctx, feedItemID, tag)
+	}
+	return s.repo.RemoveItemTag(ctx, feedItemID, tag)
+}
+
+func (s *feedService) SetFeedItemNote(ctx context.Context, feedItemID, note string) error {
+	if len(note) > MaxNoteLength {
+		return ErrNoteTooLong
+	}
+
+	i, err := s.repo.GetFeedItem(ctx, feedItemID)
+	if err != nil {
+		return err
+	}
+	i.Note = strings.TrimSpace(note)
+	return s.repo.UpdateFeedItem(ctx, i)
+}
+
+// SearchFeedItems returns a page of the items matching the search, with the cursors
+// to the pages around it. The tag counts are left to CountFeedItemTags.
+func (s *feedService) SearchFeedItems(ctx context.Context, params models.SearchParams) (*models.SearchResult, error) {
+	limit := params.Limit
+	if limit > 0 {
+		// One more item tells if there's a page after this one
+		params.Limit++
+	}
+
+	items, total, err := s.repo.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	backwards := params.Cursor != nil && params.Cursor.Before
+	more := limit > 0 && len(items) > limit
+	if more {
+		if backwards {
+			items = items[1:]
+		} else {
+			items = items[:limit]
+		}
+	}
+
+	res := &models.SearchResult{
+		Items: items,
+		Len:   int64(len(items)),
+		Total: total,
+	}
+	if len(items) == 0 {
+		return res, nil
+	}
+
+	// Cursors follow the publication date, pages by relevance only have offsets
+	if params.Sort == "relevance" {
+		return res, nil
+	}
+
+	hasNext, hasPrev := more, params.Offset > 0
+	if params.Cursor != nil {
+		hasNext, hasPrev = true, true
+		if backwards {
+			hasPrev = more
+		} else {
+			hasNext = more
+		}
+	}
+
+	if hasNext {
+		last := items[len(items)-1]
+		res.NextCursor = EncodeCursor(models.Cursor{PubDate: last.PubDate, ID: last.ID})
+	}
+	if hasPrev {
+		first := items[0]
+		res.PrevCursor = EncodeCursor(models.Cursor{PubDate: first.PubDate, ID: first.ID, Before: true})
+	}
+
+	return res, nil
+}
+
+// EncodeCursor returns the opaque form of a cursor given to clients.
+func EncodeCursor(c models.Cursor) string {
+	dir := "a"
+	if c.Before {
+		dir = "b"
+	}
+	// The offset of the date is kept, as SQLite compares dates as text
+	return base64.RawURLEncoding.EncodeToString([]byte(dir + "|" + c.PubDate.Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// ParseCursor decodes a cursor returned by EncodeCursor.
+func ParseCursor(s string) (*models.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") || parts[2] == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	pubDate, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &models.Cursor{PubDate: pubDate, ID: parts[2], Before: parts[0] == "b"}, nil
+}
+
+func (s *feedService) CountFeedItemTags(ctx context.Context, params models.SearchParams) ([]models.TagCount, error) {
+	return s.repo.CountItemTags(ctx, params)
+}
+
+// NormalizeTag trims and lowercases a tag, returning ErrInvalidTag if it's empty or too long.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > MaxTagLength {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
 }
 
 // TODO: When refreshing feed I should also update the metadata of the Feed itself, in case they're changed (title, description, etc.)
@@ -168,13 +547,28 @@ func (s *feedService) RefreshFeeds(ctx context.Context) error {
 	}
 
 	for _, f := range feeds {
+		if strings.HasPrefix(f.URL, NewsletterURLPrefix) {
+			// Newsletters are received by mail, see NewsletterService
+			continue
+		}
+
+		if f.WebSubExpiresAt.After(time.Now()) {
+			fmt.Printf("feed %s is pushed by its hub, skipping refresh\n", f.URL)
+			continue
+		}
+
 		if (f.LastFetch.Add(MinRefreshRateMinutes * time.Minute)).After(time.Now()) {
 			// TODO: These must be debug logs
 			fmt.Printf("feed %s is not due for refresh\n", f.URL)
 			continue
 		}
 
-		feed, err := s.FetchFeed(ctx, f.URL)
+		var feed *db.Feed
+		if f.Scraper.Item != "" {
+			feed, err = s.ScrapeFeed(ctx, f.URL, f.Scraper)
+		} else {
+			feed, err = s.FetchFeed(ctx, f.URL)
+		}
 		if err != nil {
 			e := fmt.Errorf("error on fetching feed %s: %w", f.URL, err)
 			fmt.Printf("%v\n", e)
@@ -184,22 +578,31 @@ func (s *feedService) RefreshFeeds(ctx context.Context) error {
 		f.LastFetch = time.Now()
 		f.Title = feed.Title
 		f.Description = feed.Description
-		// Don't update items directly
-		f.Items = nil
+		f.SiteURL = feed.SiteURL
+		f.HubURL = feed.HubURL
+		f.SelfURL = feed.SelfURL
 
-		err = s.repo.UpdateFeed(ctx, &f)
+		// Only the fetched fields are written, the others may have changed during the fetch
+		err = s.repo.UpdateFeedFields(ctx, &f, "last_fetch", "title", "description", "site_url", "hub_url", "self_url")
 		if err != nil {
 			e := fmt.Errorf("error on updating last_fetch feed %s: %w", f.URL, err)
 			fmt.Printf("%v\n", e)
 			continue
 		}
 
-		err = s.repo.SaveFeedItems(ctx, f.ID, feed.Items)
+		_, err = s.repo.SaveFeedItems(ctx, f.ID, feed.Items)
 		if err != nil {
 			e := fmt.Errorf("error on saving feed items for feed %s: %w", f.URL, err)
 			fmt.Printf("%v\n", e)
 			continue
 		}
+
+		// Empty feeds may be broken for a while, the deleted items are only forgotten once gone
+		if len(feed.Items) > 0 {
+			if err := s.repo.PruneDeletedItems(ctx, f.ID, feed.Items); err != nil {
+				fmt.Printf("error on pruning deleted items for feed %s: %v\n", f.URL, err)
+			}
+		}
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // MockFeedRepository implements FeedRepository interface for testing.
@@ -22,6 +24,13 @@ type MockFeedRepository struct {
 	deleteFeedFunc   func(ctx context.Context, id string) error
 	updateFeedFunc   func(ctx context.Context, feed *db.Feed) error
 	nukeFunc         func(ctx context.Context) error
+
+	getFeedItemFunc    func(ctx context.Context, id string) (*db.Item, error)
+	updateFeedItemFunc func(ctx context.Context, s *db.Item) error
+	addItemTagFunc     func(ctx context.Context, itemID, tag string) error
+	removeItemTagFunc  func(ctx context.Context, itemID, tag string) error
+	countItemsFunc     func(ctx context.Context, feedIDs ...string) (map[string]models.ItemCount, error)
+	markItemsReadFunc  func(ctx context.Context, params models.SearchParams, read bool) (int64, error)
 }
 
 func (m *MockFeedRepository) GetFeed(ctx context.Context, id string) (*db.Feed, error) {
@@ -48,18 +57,28 @@ func (m *MockFeedRepository) UpdateFeed(ctx context.Context, feed *db.Feed) erro
 	return m.updateFeedFunc(ctx, feed)
 }
 
+func (m *MockFeedRepository) UpdateFeedFields(ctx context.Context, feed *db.Feed, columns ...string) error {
+	return m.updateFeedFunc(ctx, feed)
+}
+
 func (m *MockFeedRepository) Nuke(ctx context.Context) error {
 	return m.nukeFunc(ctx)
 }
 
 func (m *MockFeedRepository) GetFeedItem(ctx context.Context, id string) (*db.Item, error) {
-	// TODO: Implement this
-	return nil, nil
+	return m.getFeedItemFunc(ctx, id)
 }
 
 func (m *MockFeedRepository) UpdateFeedItem(ctx context.Context, s *db.Item) error {
-	// TODO: Implement this
-	return nil
+	return m.updateFeedItemFunc(ctx, s)
+}
+
+func (m *MockFeedRepository) CountItems(ctx context.Context, feedIDs ...string) (map[string]models.ItemCount, error) {
+	return m.countItemsFunc(ctx, feedIDs...)
+}
+
+func (m *MockFeedRepository) MarkItemsRead(ctx context.Context, params models.SearchParams, read bool) (int64, error) {
+	return m.markItemsReadFunc(ctx, params, read)
 }
 
 func (m *MockFeedRepository) SearchFeedItems(ctx context.Context, items models.SearchParams) ([]db.Item, int64, error) {
@@ -67,8 +86,25 @@ func (m *MockFeedRepository) SearchFeedItems(ctx context.Context, items models.S
 	return nil, 0, nil
 }
 
-func (m *MockFeedRepository) SaveFeedItems(ctx context.Context, feedID string, items []db.Item) error {
+func (m *MockFeedRepository) CountItemTags(ctx context.Context, params models.SearchParams) ([]models.TagCount, error) {
 	// TODO: Implement this
+	return nil, nil
+}
+
+func (m *MockFeedRepository) AddItemTag(ctx context.Context, itemID, tag string) error {
+	return m.addItemTagFunc(ctx, itemID, tag)
+}
+
+func (m *MockFeedRepository) RemoveItemTag(ctx context.Context, itemID, tag string) error {
+	return m.removeItemTagFunc(ctx, itemID, tag)
+}
+
+func (m *MockFeedRepository) SaveFeedItems(ctx context.Context, feedID string, items []db.Item) ([]db.Item, error) {
+	// TODO: Implement this
+	return nil, nil
+}
+
+func (m *MockFeedRepository) PruneDeletedItems(ctx context.Context, feedID string, items []db.Item) error {
 	return nil
 }
 
@@ -589,3 +625,222 @@ func TestNuke(t *testing.T) {
 	// 	t.Error("unexpected error:", err)
 	// }
 }
+
+func TestStarFeedItem(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		mockError       error
+		item            *db.Item
+		name            string
+		starred         bool
+		expectedUpdate  bool
+		expectedStarred bool
+		expectedError   bool
+	}{
+		{
+			name:            "star",
+			item:            &db.Item{ID: "1"},
+			starred:         true,
+			expectedUpdate:  true,
+			expectedStarred: true,
+		},
+		{
+			name:            "unstar",
+			item:            &db.Item{ID: "1", IsStarred: true},
+			starred:         false,
+			expectedUpdate:  true,
+			expectedStarred: false,
+		},
+		{
+			name:            "already starred",
+			item:            &db.Item{ID: "1", IsStarred: true},
+			starred:         true,
+			expectedUpdate:  false,
+			expectedStarred: true,
+		},
+		{
+			name:          "not found",
+			mockError:     errors.New("not found"),
+			starred:       true,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := false
+			mockRepo := &MockFeedRepository{
+				getFeedItemFunc: func(ctx context.Context, id string) (*db.Item, error) {
+					return tt.item, tt.mockError
+				},
+				updateFeedItemFunc: func(ctx context.Context, s *db.Item) error {
+					updated = true
+					return nil
+				},
+			}
+
+			service := NewFeedService(mockRepo)
+			err := service.StarFeedItem(ctx, "1", tt.starred)
+
+			if tt.expectedError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Error("unexpected error:", err)
+			}
+
+			if updated != tt.expectedUpdate {
+				t.Errorf("expected update %v, got %v", tt.expectedUpdate, updated)
+			}
+
+			if tt.item.IsStarred != tt.expectedStarred {
+				t.Errorf("expected starred %v, got %v", tt.expectedStarred, tt.item.IsStarred)
+			}
+
+			if tt.item.IsStarred != (tt.item.StarredAt != nil) && tt.expectedUpdate {
+				t.Errorf("expected StarredAt to follow the starred flag, got %v", tt.item.StarredAt)
+			}
+		})
+	}
+}
+
+func TestTagFeedItem(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		tag           string
+		expectedTag   string
+		tagged        bool
+		expectedError bool
+	}{
+		{name: "add", tag: "Go", expectedTag: "go", tagged: true},
+		{name: "remove", tag: "  Reading Group ", expectedTag: "reading group", tagged: false},
+		{name: "empty", tag: "   ", tagged: true, expectedError: true},
+		{name: "too long", tag: strings.Repeat("a", MaxTagLength+1), tagged: true, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added, removed string
+			mockRepo := &MockFeedRepository{
+				addItemTagFunc: func(ctx context.Context, itemID, tag string) error {
+					added = tag
+					return nil
+				},
+				removeItemTagFunc: func(ctx context.Context, itemID, tag string) error {
+					removed = tag
+					return nil
+				},
+			}
+
+			service := NewFeedService(mockRepo)
+			err := service.TagFeedItem(ctx, "1", tt.tag, tt.tagged)
+
+			if tt.expectedError {
+				if !errors.Is(err, ErrInvalidTag) {
+					t.Errorf("expected ErrInvalidTag, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Error("unexpected error:", err)
+			}
+
+			got := removed
+			if tt.tagged {
+				got = added
+			}
+			if got != tt.expectedTag {
+				t.Errorf("expected tag %q, got %q", tt.expectedTag, got)
+			}
+		})
+	}
+}
+
+func TestMarkFeedItems(t *testing.T) {
+	ctx := context.Background()
+
+	var got models.SearchParams
+	mockRepo := &MockFeedRepository{
+		markItemsReadFunc: func(ctx context.Context, params models.SearchParams, read bool) (int64, error) {
+			got = params
+			return 3, nil
+		},
+	}
+	service := NewFeedService(mockRepo)
+
+	_, err := service.MarkFeedItems(ctx, models.SearchParams{Unread: true}, true)
+	if !errors.Is(err, ErrNoMarkScope) {
+		t.Errorf("expected ErrNoMarkScope without any filter, got %v", err)
+	}
+	_, err = service.MarkFeedItems(ctx, models.SearchParams{Query: "   "}, true)
+	if !errors.Is(err, ErrNoMarkScope) {
+		t.Errorf("expected ErrNoMarkScope with a blank query, got %v", err)
+	}
+
+	n, err := service.MarkFeedItems(ctx, models.SearchParams{FeedIDs: []string{"hn"}, Tags: []string{" Go "}, Unread: true}, true)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 updated items, got %d", n)
+	}
+	if got.Unread || got.Tags[0] != "go" {
+		t.Errorf("expected normalized tags and no unread filter, got %+v", got)
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	c := models.Cursor{
+		PubDate: time.Date(2024, 11, 1, 10, 30, 0, 5, time.FixedZone("", -5*3600)),
+		ID:      "a|b",
+		Before:  true,
+	}
+
+	got, err := ParseCursor(EncodeCursor(c))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got.ID != c.ID || !got.Before || got.PubDate.Format(time.RFC3339Nano) != c.PubDate.Format(time.RFC3339Nano) {
+		t.Errorf("expected %+v, got %+v", c, got)
+	}
+
+	for _, s := range []string{"", "!!", "eHl6", base64.RawURLEncoding.EncodeToString([]byte("a|yesterday|1"))} {
+		if _, err := ParseCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor for %q, got %v", s, err)
+		}
+	}
+}
+
+func TestParseFeedContent(t *testing.T) {
+	feed, err := parseFeed("http://example.com/feed", []byte(`<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+			<channel>
+				<title>Test Feed</title>
+				<link>http://example.com/</link>
+				<item>
+					<title>Test Item</title>
+					<link>http://example.com/1</link>
+					<pubDate>Tue, 05 Nov 2024 11:00:00 GMT</pubDate>
+					<content:encoded><![CDATA[<p>Full text</p>]]></content:encoded>
+				</item>
+			</channel>
+		</rss>`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if feed.SiteURL != "http://example.com/" {
+		t.Errorf("expected the channel link as site URL, got %q", feed.SiteURL)
+	}
+	if len(feed.Items) != 1 || feed.Items[0].Content != "<p>Full text</p>" {
+		t.Errorf("expected the encoded content of the item, got %+v", feed.Items)
+	}
+}
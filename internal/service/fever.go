@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/fever"
+	"llrss/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeverItemLimit is the most items a Fever client gets at once, as the API specifies.
+const FeverItemLimit = 50
+
+// feverFavicon is a transparent pixel, the favicon of every feed since they aren't fetched.
+var feverFavicon = fever.Favicon{ID: 1, Data: "image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"}
+
+// ErrInvalidMark is returned for Fever marks of an unknown type or status, e.g. marking a feed as saved.
+var ErrInvalidMark = errors.New("invalid fever mark")
+
+// FeverService maps the Fever API onto feeds, folders (as groups) and the read and starred (saved) status of items.
+type FeverService interface {
+	LastRefreshed(ctx context.Context) (int64, error)
+	Groups(ctx context.Context) ([]fever.Group, error)
+	Feeds(ctx context.Context) ([]fever.Feed, error)
+	FeedsGroups(ctx context.Context) ([]fever.FeedsGroup, error)
+	Favicons(ctx context.Context) ([]fever.Favicon, error)
+	Items(ctx context.Context, q fever.ItemQuery) ([]fever.Item, int64, error)
+	UnreadItemIDs(ctx context.Context) (string, error)
+	SavedItemIDs(ctx context.Context) (string, error)
+	Mark(ctx context.Context, m fever.Mark) error
+}
+
+type feverService struct {
+	feedService   FeedService
+	folderService FolderService
+	repo          repository.NumberRepository
+}
+
+func NewFeverService(feedService FeedService, folderService FolderService, repo repository.NumberRepository) FeverService {
+	return &feverService{
+		feedService:   feedService,
+		folderService: folderService,
+		repo:          repo,
+	}
+}
+
+// LastRefreshed returns when a feed was last fetched, as a unix timestamp.
+func (s *feverService) LastRefreshed(ctx context.Context) (int64, error) {
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var last time.Time
+	for _, f := range feeds {
+		if f.LastFetch.After(last) {
+			last = f.LastFetch
+		}
+	}
+	if last.IsZero() {
+		return 0, nil
+	}
+	return last.Unix(), nil
+}
+
+func (s *feverService) Groups(ctx context.Context) ([]fever.Group, error) {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.repo.FolderNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]fever.Group, len(folders))
+	for i, f := range folders {
+		groups[i] = fever.Group{ID: ids[f.ID], Title: f.Name}
+	}
+	return groups, nil
+}
+
+func (s *feverService) Feeds(ctx context.Context) ([]fever.Feed, error) {
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.repo.FeedNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]fever.Feed, len(feeds))
+	for i, f := range feeds {
+		res[i] = fever.Feed{
+			ID:                ids[f.ID],
+			FaviconID:         feverFavicon.ID,
+			Title:             feedTitle(&f),
+			URL:               f.URL,
+			SiteURL:           f.SiteURL,
+			LastUpdatedOnTime: f.LastFetch.Unix(),
+		}
+	}
+	return res, nil
+}
+
+// FeedsGroups lists the feeds of every group, the feeds of a subfolder are also in the group of its parent
+// like they are when searching or marking the items of a folder.
+func (s *feverService) FeedsGroups(ctx context.Context) ([]fever.FeedsGroup, error) {
+	tree, err := s.folderService.Tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	feedIDs, err := s.repo.FeedNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folderIDs, err := s.repo.FolderNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]fever.FeedsGroup, 0, len(tree.Folders))
+	for _, node := range tree.Folders {
+		var ids []int64
+		for _, f := range node.Feeds {
+			ids = append(ids, feedIDs[f.ID])
+		}
+
+		for _, child := range node.Children {
+			var childIDs []int64
+			for _, f := range child.Feeds {
+				childIDs = append(childIDs, feedIDs[f.ID])
+			}
+			res = append(res, fever.FeedsGroup{GroupID: folderIDs[child.Folder.ID], FeedIDs: joinIDs(childIDs)})
+			ids = append(ids, childIDs...)
+		}
+
+		res = append(res, fever.FeedsGroup{GroupID: folderIDs[node.Folder.ID], FeedIDs: joinIDs(ids)})
+	}
+	return res, nil
+}
+
+func (s *feverService) Favicons(_ context.Context) ([]fever.Favicon, error) {
+	return []fever.Favicon{feverFavicon}, nil
+}
+
+// Items returns a page of items, along with how many items there are in total.
+func (s *feverService) Items(ctx context.Context, q fever.ItemQuery) ([]fever.Item, int64, error) {
+	if q.Limit <= 0 || q.Limit > FeverItemLimit {
+		q.Limit = FeverItemLimit
+	}
+	if len(q.WithIDs) > FeverItemLimit {
+		q.WithIDs = q.WithIDs[:FeverItemLimit]
+	}
+
+	// with_ids takes precedence, then paging back from max_id gets the items right before it
+	nq := models.NumberQuery{Limit: q.Limit}
+	switch {
+	case len(q.WithIDs) > 0:
+		nq.Numbers = q.WithIDs
+	case q.MaxID > 0:
+		nq.Before = q.MaxID
+		nq.Desc = true
+	default:
+		nq.After = q.SinceID
+	}
+
+	items, err := s.repo.ListNumberedItems(ctx, nq)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	feedIDs, err := s.repo.FeedNumbers(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts, err := s.feedService.CountFeedItems(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]fever.Item, len(items))
+	for i, item := range items {
+		html := item.Article
+		if html == "" {
+			html = item.Content
+		}
+		if html == "" {
+			html = item.Description
+		}
+
+		res[i] = fever.Item{
+			ID:            item.Number,
+			FeedID:        feedIDs[item.FeedID],
+			Title:         item.Title,
+			Author:        item.Author,
+			HTML:          html,
+			URL:           item.Link,
+			IsSaved:       boolInt(item.IsStarred),
+			IsRead:        boolInt(item.IsRead),
+			CreatedOnTime: item.PubDate.Unix(),
+		}
+	}
+	return res, counts.Total, nil
+}
+
+func (s *feverService) UnreadItemIDs(ctx context.Context) (string, error) {
+	ids, err := s.repo.UnreadItemNumbers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return joinIDs(ids), nil
+}
+
+func (s *feverService) SavedItemIDs(ctx context.Context) (string, error) {
+	ids, err := s.repo.StarredItemNumbers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return joinIDs(ids), nil
+}
+
+// Mark changes the status of an item, or marks the items of a feed or group published
+// up to m.Before as read. Group 0 is every item, group -1 the Fever "sparks" there are none of.
+func (s *feverService) Mark(ctx context.Context, m fever.Mark) error {
+	if m.Type == "item" {
+		id, err := s.repo.GetItemID(ctx, m.ID)
+		if err != nil {
+			return err
+		}
+
+		switch m.As {
+		case "read", "unread":
+			return s.feedService.MarkFeedItemRead(ctx, id, m.As == "read")
+		case "saved", "unsaved":
+			return s.feedService.StarFeedItem(ctx, id, m.As == "saved")
+		default:
+			return ErrInvalidMark
+		}
+	}
+
+	if m.As != "read" {
+		return ErrInvalidMark
+	}
+
+	// Item dates are stored in UTC, and compared as text
+	params := models.SearchParams{ToDate: time.Now().UTC()}
+	if m.Before > 0 {
+		params.ToDate = time.Unix(m.Before, 0).UTC()
+	}
+
+	switch {
+	case m.Type == "feed":
+		id, err := findNumber(ctx, s.repo.FeedNumbers, m.ID)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			return repository.ErrFeedNotFound
+		}
+		params.FeedIDs = []string{id}
+
+	case m.Type == "group" && m.ID == -1:
+		return nil
+
+	case m.Type == "group" && m.ID != 0:
+		id, err := findNumber(ctx, s.repo.FolderNumbers, m.ID)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			return repository.ErrFolderNotFound
+		}
+		params.FolderID = id
+
+	case m.Type != "group":
+		return ErrInvalidMark
+	}
+
+	if _, err := s.feedService.MarkFeedItems(ctx, params, true); err != nil {
+		return fmt.Errorf("mark %s %d as read: %w", m.Type, m.ID, err)
+	}
+	return nil
+}
+
+// findNumber returns the ID of the entity with the given number, or an empty one.
+func findNumber(ctx context.Context, list func(context.Context) (map[string]int64, error), number int64) (string, error) {
+	ids, err := list(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for id, n := range ids {
+		if n == number {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
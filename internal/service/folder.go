@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/text"
+	"strings"
+)
+
+const MaxFolderNameLength = 128
+
+var (
+	// ErrInvalidFolderName is returned for empty or too long folder names.
+	ErrInvalidFolderName = errors.New("invalid folder name")
+	// ErrFolderTooDeep is returned when nesting folders more than one level deep.
+	ErrFolderTooDeep = errors.New("folders can only be nested one level deep")
+)
+
+// FolderService manages the folders feeds are grouped in.
+type FolderService interface {
+	ListFolders(ctx context.Context) ([]models.FolderCount, error)
+	GetFolder(ctx context.Context, id string) (*db.Folder, error)
+	CreateFolder(ctx context.Context, name string, parentID *string) (*db.Folder, error)
+	UpdateFolder(ctx context.Context, id, name string, parentID *string) (*db.Folder, error)
+	DeleteFolder(ctx context.Context, id string) error
+	SetFeedFolder(ctx context.Context, feedID string, folderID *string) error
+	Tree(ctx context.Context) (*models.FolderTree, error)
+}
+
+type folderService struct {
+	feedRepo repository.FeedRepository
+	repo     repository.FolderRepository
+}
+
+func NewFolderService(feedRepo repository.FeedRepository, repo repository.FolderRepository) FolderService {
+	return &folderService{
+		feedRepo: feedRepo,
+		repo:     repo,
+	}
+}
+
+// ListFolders returns every folder with its unread count, which includes its subfolders.
+func (s *folderService) ListFolders(ctx context.Context) ([]models.FolderCount, error) {
+	folders, err := s.repo.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := s.unreadCounts(ctx, folders)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]models.FolderCount, len(folders))
+	for i, f := range folders {
+		res[i] = models.FolderCount{Folder: f, Unread: unread[f.ID]}
+	}
+	return res, nil
+}
+
+func (s *folderService) GetFolder(ctx context.Context, id string) (*db.Folder, error) {
+	return s.repo.GetFolder(ctx, id)
+}
+
+func (s *folderService) CreateFolder(ctx context.Context, name string, parentID *string) (*db.Folder, error) {
+	folder := &db.Folder{ID: text.RandomID()}
+	if err := s.apply(ctx, folder, name, parentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveFolder(ctx, folder); err != nil {
+		return nil, fmt.Errorf("save folder: %w", err)
+	}
+	return folder, nil
+}
+
+func (s *folderService) UpdateFolder(ctx context.Context, id, name string, parentID *string) (*db.Folder, error) {
+	folder, err := s.repo.GetFolder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(ctx, folder, name, parentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveFolder(ctx, folder); err != nil {
+		return nil, fmt.Errorf("save folder: %w", err)
+	}
+	return folder, nil
+}
+
+func (s *folderService) DeleteFolder(ctx context.Context, id string) error {
+	return s.repo.DeleteFolder(ctx, id)
+}
+
+// SetFeedFolder moves a feed into a folder, or out of any folder when folderID is nil.
+func (s *folderService) SetFeedFolder(ctx context.Context, feedID string, folderID *string) error {
+	if folderID != nil {
+		if _, err := s.repo.GetFolder(ctx, *folderID); err != nil {
+			return err
+		}
+	}
+	return s.repo.SetFeedFolder(ctx, feedID, folderID)
+}
+
+// Tree returns all the feeds grouped by folder, with the unread counts of each folder.
+func (s *folderService) Tree(ctx context.Context) (*models.FolderTree, error) {
+	folders, err := s.repo.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := s.feedRepo.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := s.unreadCounts(ctx, folders)
+	if err != nil {
+		return nil, err
+	}
+
+	feedsByFolder := make(map[string][]db.Feed)
+	tree := &models.FolderTree{}
+	for _, f := range feeds {
+		if f.FolderID == nil {
+			tree.Feeds = append(tree.Feeds, f)
+			continue
+		}
+		feedsByFolder[*f.FolderID] = append(feedsByFolder[*f.FolderID], f)
+	}
+
+	children := make(map[string][]models.FolderNode)
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], models.FolderNode{
+				Folder: f,
+				Feeds:  feedsByFolder[f.ID],
+				Unread: unread[f.ID],
+			})
+		}
+	}
+
+	for _, f := range folders {
+		if f.ParentID == nil {
+			tree.Folders = append(tree.Folders, models.FolderNode{
+				Folder:   f,
+				Feeds:    feedsByFolder[f.ID],
+				Children: children[f.ID],
+				Unread:   unread[f.ID],
+			})
+		}
+	}
+
+	return tree, nil
+}
+
+// apply validates and sets the name and parent of a folder.
+func (s *folderService) apply(ctx context.Context, folder *db.Folder, name string, parentID *string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxFolderNameLength {
+		return ErrInvalidFolderName
+	}
+
+	if parentID != nil {
+		if *parentID == folder.ID {
+			return ErrFolderTooDeep
+		}
+
+		parent, err := s.repo.GetFolder(ctx, *parentID)
+		if err != nil {
+			return err
+		}
+		if parent.ParentID != nil {
+			return ErrFolderTooDeep
+		}
+
+		// A folder with subfolders can't become a subfolder itself
+		folders, err := s.repo.ListFolders(ctx)
+		if err != nil {
+			return err
+		}
+		for _, f := range folders {
+			if f.ParentID != nil && *f.ParentID == folder.ID {
+				return ErrFolderTooDeep
+			}
+		}
+	}
+
+	folder.Name = name
+	folder.ParentID = parentID
+	return nil
+}
+
+// unreadCounts returns the unread items per folder, top level folders include their subfolders.
+func (s *folderService) unreadCounts(ctx context.Context, folders []db.Folder) (map[string]int64, error) {
+	own, err := s.repo.CountUnreadByFolder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(folders))
+	for _, f := range folders {
+		counts[f.ID] += own[f.ID]
+		if f.ParentID != nil {
+			counts[*f.ParentID] += own[f.ID]
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"testing"
+)
+
+// MockFolderRepository is an in-memory FolderRepository for testing.
+type MockFolderRepository struct {
+	folders     map[string]*db.Folder
+	feedFolders map[string]*string
+	unread      map[string]int64
+}
+
+func newMockFolderRepository(folders ...db.Folder) *MockFolderRepository {
+	m := &MockFolderRepository{
+		folders:     make(map[string]*db.Folder),
+		feedFolders: make(map[string]*string),
+		unread:      make(map[string]int64),
+	}
+	for i := range folders {
+		m.folders[folders[i].ID] = &folders[i]
+	}
+	return m
+}
+
+func (m *MockFolderRepository) GetFolder(ctx context.Context, id string) (*db.Folder, error) {
+	f, ok := m.folders[id]
+	if !ok {
+		return nil, repository.ErrFolderNotFound
+	}
+	c := *f
+	return &c, nil
+}
+
+func (m *MockFolderRepository) ListFolders(ctx context.Context) ([]db.Folder, error) {
+	folders := make([]db.Folder, 0, len(m.folders))
+	for _, f := range m.folders {
+		folders = append(folders, *f)
+	}
+	return folders, nil
+}
+
+func (m *MockFolderRepository) SaveFolder(ctx context.Context, folder *db.Folder) error {
+	c := *folder
+	m.folders[folder.ID] = &c
+	return nil
+}
+
+func (m *MockFolderRepository) DeleteFolder(ctx context.Context, id string) error {
+	delete(m.folders, id)
+	return nil
+}
+
+func (m *MockFolderRepository) SetFeedFolder(ctx context.Context, feedID string, folderID *string) error {
+	m.feedFolders[feedID] = folderID
+	return nil
+}
+
+func (m *MockFolderRepository) CountUnreadByFolder(ctx context.Context) (map[string]int64, error) {
+	return m.unread, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCreateFolder(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		expectedError error
+		parentID      *string
+		name          string
+		folderName    string
+	}{
+		{name: "top level", folderName: "News"},
+		{name: "nested", folderName: "Go", parentID: ptr("tech")},
+		{name: "empty name", folderName: "  ", expectedError: ErrInvalidFolderName},
+		{name: "unknown parent", folderName: "Go", parentID: ptr("missing"), expectedError: repository.ErrFolderNotFound},
+		{name: "too deep", folderName: "Generics", parentID: ptr("golang"), expectedError: ErrFolderTooDeep},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockFolderRepository(
+				db.Folder{ID: "tech", Name: "Tech"},
+				db.Folder{ID: "golang", Name: "Go", ParentID: ptr("tech")},
+			)
+			service := NewFolderService(&MockFeedRepository{}, repo)
+
+			folder, err := service.CreateFolder(ctx, tt.folderName, tt.parentID)
+
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Errorf("expected error %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			if folder.ID == "" || folder.Name != tt.folderName {
+				t.Errorf("unexpected folder %+v", folder)
+			}
+
+			if _, ok := repo.folders[folder.ID]; !ok {
+				t.Error("expected folder to be saved")
+			}
+		})
+	}
+}
+
+func TestUpdateFolderWithChildrenCantBeNested(t *testing.T) {
+	repo := newMockFolderRepository(
+		db.Folder{ID: "tech", Name: "Tech"},
+		db.Folder{ID: "golang", Name: "Go", ParentID: ptr("tech")},
+		db.Folder{ID: "news", Name: "News"},
+	)
+	service := NewFolderService(&MockFeedRepository{}, repo)
+
+	_, err := service.UpdateFolder(context.Background(), "tech", "Tech", ptr("news"))
+	if !errors.Is(err, ErrFolderTooDeep) {
+		t.Errorf("expected ErrFolderTooDeep, got %v", err)
+	}
+
+	_, err = service.UpdateFolder(context.Background(), "tech", "Tech", ptr("tech"))
+	if !errors.Is(err, ErrFolderTooDeep) {
+		t.Errorf("expected ErrFolderTooDeep moving a folder into itself, got %v", err)
+	}
+}
+
+func TestFolderTree(t *testing.T) {
+	repo := newMockFolderRepository(
+		db.Folder{ID: "tech", Name: "Tech"},
+		db.Folder{ID: "golang", Name: "Go", ParentID: ptr("tech")},
+	)
+	repo.unread = map[string]int64{"tech": 2, "golang": 3}
+
+	feedRepo := &MockFeedRepository{
+		listFeedsFunc: func(ctx context.Context) ([]db.Feed, error) {
+			return []db.Feed{
+				{ID: "hn", FolderID: ptr("tech")},
+				{ID: "go-blog", FolderID: ptr("golang")},
+				{ID: "unfiled"},
+			}, nil
+		},
+	}
+
+	service := NewFolderService(feedRepo, repo)
+	tree, err := service.Tree(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(tree.Feeds) != 1 || tree.Feeds[0].ID != "unfiled" {
+		t.Errorf("expected only the unfiled feed at the top level, got %+v", tree.Feeds)
+	}
+
+	if len(tree.Folders) != 1 {
+		t.Fatalf("expected 1 top level folder, got %d", len(tree.Folders))
+	}
+
+	tech := tree.Folders[0]
+	if tech.Unread != 5 {
+		t.Errorf("expected unread to include subfolders, got %d", tech.Unread)
+	}
+	if len(tech.Feeds) != 1 || tech.Feeds[0].ID != "hn" {
+		t.Errorf("unexpected feeds in Tech: %+v", tech.Feeds)
+	}
+	if len(tech.Children) != 1 || tech.Children[0].Unread != 3 || tech.Children[0].Feeds[0].ID != "go-blog" {
+		t.Errorf("unexpected subfolders of Tech: %+v", tech.Children)
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/smtpd"
+	"llrss/internal/text"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NewsletterURLPrefix starts the URL of newsletter feeds, followed by the local part of their address.
+	NewsletterURLPrefix = "newsletter:"
+	// MaxNewsletterTitleLength is the length of the longest newsletter title.
+	MaxNewsletterTitleLength = 256
+)
+
+var (
+	// ErrInvalidNewsletterTitle is returned for empty or too long newsletter titles.
+	ErrInvalidNewsletterTitle = errors.New("invalid newsletter title")
+	// ErrUnknownRecipient is returned for mail to addresses which aren't those of a newsletter,
+	// the SMTP server rejects it for good.
+	ErrUnknownRecipient = smtpd.ErrUnknownRecipient
+)
+
+// NewsletterService turns the newsletters mailed to feeds into their items. Each newsletter
+// feed has an address of its own to subscribe with, at the domain mail is received for.
+type NewsletterService interface {
+	ListNewsletters(ctx context.Context) ([]models.Newsletter, error)
+	// CreateNewsletter creates a newsletter feed with a new address.
+	CreateNewsletter(ctx context.Context, title string) (*models.Newsletter, error)
+
+	// Accept and Deliver receive the mail of newsletters, see smtpd.Handler.
+	Accept(ctx context.Context, rcpt string) error
+	Deliver(ctx context.Context, rcpt string, msg []byte) error
+}
+
+type newsletterService struct {
+	repo   repository.FeedRepository
+	domain string
+}
+
+func NewNewsletterService(repo repository.FeedRepository, domain string) NewsletterService {
+	return &newsletterService{
+		repo:   repo,
+		domain: strings.ToLower(domain),
+	}
+}
+
+func (s *newsletterService) ListNewsletters(ctx context.Context) ([]models.Newsletter, error) {
+	feeds, err := s.repo.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []models.Newsletter{}
+	for _, f := range feeds {
+		if strings.HasPrefix(f.URL, NewsletterURLPrefix) {
+			res = append(res, s.newsletter(&f))
+		}
+	}
+	return res, nil
+}
+
+func (s *newsletterService) CreateNewsletter(ctx context.Context, title string) (*models.Newsletter, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || len(title) > MaxNewsletterTitleLength {
+		return nil, ErrInvalidNewsletterTitle
+	}
+
+	// The address is readable but can't be guessed, e.g. go-weekly.3f9a2c1b@
+	local := text.RandomID()[:8]
+	if slug := slugify(title); slug != "" {
+		local = slug + "." + local
+	}
+
+	feed := &db.Feed{
+		URL:       NewsletterURLPrefix + local,
+		Title:     title,
+		LastFetch: time.Now(),
+	}
+	if _, err := s.repo.SaveFeed(ctx, feed); err != nil {
+		return nil, err
+	}
+
+	n := s.newsletter(feed)
+	return &n, nil
+}
+
+func (s *newsletterService) newsletter(f *db.Feed) models.Newsletter {
+	return models.Newsletter{
+		FeedID:  f.ID,
+		Title:   f.Title,
+		Address: strings.TrimPrefix(f.URL, NewsletterURLPrefix) + "@" + s.domain,
+	}
+}
+
+// slugify lowercases the letters and digits of a title, without their accents, and replaces
+// what's between them by dashes.
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 32 {
+			break
+		}
+	}
+	return b.String()
+}
+
+func (s *newsletterService) Accept(ctx context.Context, rcpt string) error {
+	_, err := s.feed(ctx, rcpt)
+	return err
+}
+
+// feed returns the newsletter feed mail to rcpt goes to.
+func (s *newsletterService) feed(ctx context.Context, rcpt string) (*db.Feed, error) {
+	i := strings.LastIndexByte(rcpt, '@')
+	if i < 0 || !strings.EqualFold(rcpt[i+1:], s.domain) {
+		return nil, ErrUnknownRecipient
+	}
+
+	f, err := s.repo.GetFeedByURL(ctx, NewsletterURLPrefix+strings.ToLower(rcpt[:i]))
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, ErrUnknownRecipient
+	}
+	return f, nil
+}
+
+func (s *newsletterService) Deliver(ctx context.Context, rcpt string, msg []byte) error {
+	feed, err := s.feed(ctx, rcpt)
+	if err != nil {
+		return err
+	}
+
+	item, err := parseMessage(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", smtpd.ErrRejected, err)
+	}
+	if _, err := s.repo.SaveFeedItems(ctx, feed.ID, []db.Item{*item}); err != nil {
+		return err
+	}
+
+	// Only the fetch time is written, the feed may have been edited meanwhile
+	feed.LastFetch = time.Now()
+	return s.repo.UpdateFeedFields(ctx, feed, "last_fetch")
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// parseMessage turns an email into an item, its content is the HTML part, or the text one.
+// The link of the item is the message ID as a mid: URL, which tells resent messages apart.
+func parseMessage(msg []byte) (*db.Item, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("parse message: %w", err)
+	}
+
+	title, err := wordDecoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		title = m.Header.Get("Subject")
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "(no subject)"
+	}
+
+	item := &db.Item{Title: title, PubDate: time.Now().UTC()}
+	if d, err := m.Header.Date(); err == nil {
+		item.PubDate = d.UTC()
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(m.Header.Get("From")); err == nil {
+		item.Author = from.Name
+		if item.Author == "" {
+			item.Author = from.Address
+		}
+	}
+
+	id := strings.Trim(strings.TrimSpace(m.Header.Get("Message-ID")), "<>")
+	if id == "" {
+		id = text.RandomID() + "@llrss"
+	}
+	item.Link = "mid:" + url.PathEscape(id)
+
+	var htmlPart, textPart string
+	err = readParts(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body, &htmlPart, &textPart)
+	if err != nil {
+		return nil, fmt.Errorf("parse body: %w", err)
+	}
+
+	item.Content = htmlPart
+	if item.Content == "" {
+		item.Content = textToHTML(textPart)
+	}
+	item.Description = textPart
+	if item.Description == "" {
+		item.Description = htmlPart
+	}
+	return item, nil
+}
+
+// readParts reads the first HTML and text parts of a body, which may be multipart.
+// Attachments are left out.
+func readParts(contentType, encoding string, body io.Reader, htmlPart, textPart *string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Bodies without a content type are text
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d, _, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition")); d == "attachment" {
+				continue
+			}
+
+			err = readParts(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p, htmlPart, textPart)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var part *string
+	switch {
+	case mediaType == "text/html" && *htmlPart == "":
+		part = htmlPart
+	case mediaType == "text/plain" && *textPart == "":
+		part = textPart
+	default:
+		return nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if cs := params["charset"]; cs != "" {
+		if body, err = charset.NewReaderLabel(cs, body); err != nil {
+			return err
+		}
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	*part = strings.TrimSpace(string(b))
+	return nil
+}
+
+// textToHTML makes paragraphs of the blank line separated blocks of a text.
+func textToHTML(s string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(p), "\n", "<br>"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
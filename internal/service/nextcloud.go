@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/models/nextcloud"
+	"llrss/internal/repository"
+	"strings"
+)
+
+// NextcloudVersion is the version of Nextcloud News the API presents itself as.
+const NextcloudVersion = "25.0.0"
+
+var (
+	// ErrFolderExists is returned when creating or renaming a folder to the name of another one.
+	ErrFolderExists = errors.New("folder already exists")
+	// ErrFeedExists is returned when subscribing to a feed twice.
+	ErrFeedExists = errors.New("feed already exists")
+	// ErrUnreadableFeed is returned when subscribing to a feed which can't be fetched or parsed.
+	ErrUnreadableFeed = errors.New("feed can't be read")
+	// ErrInvalidItemType is returned for item queries of an unknown type.
+	ErrInvalidItemType = errors.New("invalid item type")
+)
+
+// NextcloudService maps the Nextcloud News API onto feeds, folders and the read and starred status of items.
+type NextcloudService interface {
+	Folders(ctx context.Context) (*nextcloud.Folders, error)
+	CreateFolder(ctx context.Context, name string) (*nextcloud.Folders, error)
+	RenameFolder(ctx context.Context, id int64, name string) error
+	DeleteFolder(ctx context.Context, id int64) error
+	MarkFolderRead(ctx context.Context, id, newestItemID int64) error
+	Feeds(ctx context.Context) (*nextcloud.Feeds, error)
+	CreateFeed(ctx context.Context, url string, folderID int64) (*nextcloud.Feeds, error)
+	DeleteFeed(ctx context.Context, id int64) error
+	MoveFeed(ctx context.Context, id, folderID int64) error
+	RenameFeed(ctx context.Context, id int64, title string) error
+	MarkFeedRead(ctx context.Context, id, newestItemID int64) error
+	Items(ctx context.Context, q nextcloud.ItemQuery) (*nextcloud.Items, error)
+	MarkItems(ctx context.Context, itemIDs []int64, read bool) error
+	StarItems(ctx context.Context, itemIDs []int64, starred bool) error
+	MarkAllRead(ctx context.Context, newestItemID int64) error
+}
+
+type nextcloudService struct {
+	feedService   FeedService
+	folderService FolderService
+	numbers       repository.NumberRepository
+}
+
+func NewNextcloudService(feedService FeedService, folderService FolderService, numbers repository.NumberRepository) NextcloudService {
+	return &nextcloudService{
+		feedService:   feedService,
+		folderService: folderService,
+		numbers:       numbers,
+	}
+}
+
+func (s *nextcloudService) Folders(ctx context.Context) (*nextcloud.Folders, error) {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.numbers.FolderNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &nextcloud.Folders{Folders: make([]nextcloud.Folder, len(folders))}
+	for i, f := range folders {
+		res.Folders[i] = nextcloud.Folder{ID: ids[f.ID], Name: f.Name}
+	}
+	return res, nil
+}
+
+func (s *nextcloudService) CreateFolder(ctx context.Context, name string) (*nextcloud.Folders, error) {
+	if err := s.checkFolderName(ctx, "", name); err != nil {
+		return nil, err
+	}
+
+	folder, err := s.folderService.CreateFolder(ctx, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.numbers.FolderNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &nextcloud.Folders{Folders: []nextcloud.Folder{{ID: ids[folder.ID], Name: folder.Name}}}, nil
+}
+
+func (s *nextcloudService) RenameFolder(ctx context.Context, id int64, name string) error {
+	folder, err := s.folder(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkFolderName(ctx, folder.ID, name); err != nil {
+		return err
+	}
+
+	_, err = s.folderService.UpdateFolder(ctx, folder.ID, name, folder.ParentID)
+	return err
+}
+
+func (s *nextcloudService) DeleteFolder(ctx context.Context, id int64) error {
+	folder, err := s.folder(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.folderService.DeleteFolder(ctx, folder.ID)
+}
+
+func (s *nextcloudService) MarkFolderRead(ctx context.Context, id, newestItemID int64) error {
+	folder, err := s.folder(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.markRead(ctx, models.SearchParams{FolderID: folder.ID}, newestItemID)
+}
+
+// Feeds lists the feeds with their unread items, along with how many items are starred and the newest item.
+func (s *nextcloudService) Feeds(ctx context.Context) (*nextcloud.Feeds, error) {
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &nextcloud.Feeds{Feeds: make([]nextcloud.Feed, 0, len(feeds))}
+	if err := s.feeds(ctx, res, feeds); err != nil {
+		return nil, err
+	}
+
+	starred, err := s.numbers.StarredItemNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.StarredCount = int64(len(starred))
+	return res, nil
+}
+
+// CreateFeed subscribes to a feed, in the given folder or at the root with 0.
+func (s *nextcloudService) CreateFeed(ctx context.Context, url string, folderID int64) (*nextcloud.Feeds, error) {
+	if f, _ := s.feedService.GetFeedByURL(ctx, url); f != nil {
+		return nil, ErrFeedExists
+	}
+
+	var folder *db.Folder
+	if folderID != 0 {
+		var err error
+		if folder, err = s.folder(ctx, folderID); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := s.feedService.AddFeed(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnreadableFeed, err)
+	}
+	if folder != nil {
+		if err := s.folderService.SetFeedFolder(ctx, id, &folder.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	feed, err := s.feedService.GetFeed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &nextcloud.Feeds{}
+	if err := s.feeds(ctx, res, []db.Feed{*feed}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *nextcloudService) DeleteFeed(ctx context.Context, id int64) error {
+	feedID, err := s.feedID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.feedService.DeleteFeed(ctx, feedID)
+}
+
+// MoveFeed moves a feed to the given folder, or to the root with 0.
+func (s *nextcloudService) MoveFeed(ctx context.Context, id, folderID int64) error {
+	feedID, err := s.feedID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if folderID == 0 {
+		return s.folderService.SetFeedFolder(ctx, feedID, nil)
+	}
+
+	folder, err := s.folder(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	return s.folderService.SetFeedFolder(ctx, feedID, &folder.ID)
+}
+
+func (s *nextcloudService) RenameFeed(ctx context.Context, id int64, title string) error {
+	feedID, err := s.feedID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	feed, err := s.feedService.GetFeed(ctx, feedID)
+	if err != nil {
+		return err
+	}
+	feed.Name = strings.TrimSpace(title)
+	feed.Items = nil
+	return s.feedService.UpdateFeed(ctx, feed)
+}
+
+func (s *nextcloudService) MarkFeedRead(ctx context.Context, id, newestItemID int64) error {
+	feedID, err := s.feedID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.markRead(ctx, models.SearchParams{FeedIDs: []string{feedID}}, newestItemID)
+}
+
+// Items returns the items of a feed, a folder, the starred ones or all of them, newest first unless
+// q.OldestFirst. Pages start after q.Offset, the number of the last item of the previous one.
+func (s *nextcloudService) Items(ctx context.Context, q nextcloud.ItemQuery) (*nextcloud.Items, error) {
+	nq := models.NumberQuery{Limit: q.BatchSize, ModifiedSince: q.LastModified, Desc: !q.OldestFirst}
+	if q.OldestFirst {
+		nq.After = q.Offset
+	} else {
+		nq.Before = q.Offset
+	}
+
+	// Updated items include the read ones, for clients to sync their status
+	nq.Params.Unread = !q.GetRead && q.LastModified == 0
+
+	switch q.Type {
+	case nextcloud.TypeFeed:
+		feedID, err := s.feedID(ctx, q.ID)
+		if err != nil {
+			return nil, err
+		}
+		nq.Params.FeedIDs = []string{feedID}
+	case nextcloud.TypeFolder:
+		folder, err := s.folder(ctx, q.ID)
+		if err != nil {
+			return nil, err
+		}
+		nq.Params.FolderID = folder.ID
+	case nextcloud.TypeStarred:
+		nq.Params.Starred = true
+	case nextcloud.TypeAll:
+	default:
+		return nil, ErrInvalidItemType
+	}
+
+	items, err := s.numbers.ListNumberedItems(ctx, nq)
+	if err != nil {
+		return nil, err
+	}
+
+	feedIDs, err := s.numbers.FeedNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &nextcloud.Items{Items: make([]nextcloud.Item, len(items))}
+	for i, item := range items {
+		body := item.Article
+		if body == "" {
+			body = item.Content
+		}
+		if body == "" {
+			body = item.Description
+		}
+
+		res.Items[i] = nextcloud.Item{
+			ID:   item.Number,
+			GUID: item.Link,
+			// Item IDs are hashes of their link already
+			GUIDHash:     item.ID,
+			URL:          item.Link,
+			Title:        item.Title,
+			Author:       item.Author,
+			PubDate:      item.PubDate.Unix(),
+			Body:         body,
+			FeedID:       feedIDs[item.FeedID],
+			Unread:       !item.IsRead,
+			Starred:      item.IsStarred,
+			LastModified: item.UpdatedAt,
+			Fingerprint:  item.ID,
+		}
+	}
+	return res, nil
+}
+
+func (s *nextcloudService) MarkItems(ctx context.Context, itemIDs []int64, read bool) error {
+	return s.eachItem(ctx, itemIDs, func(id string) error {
+		return s.feedService.MarkFeedItemRead(ctx, id, read)
+	})
+}
+
+func (s *nextcloudService) StarItems(ctx context.Context, itemIDs []int64, starred bool) error {
+	return s.eachItem(ctx, itemIDs, func(id string) error {
+		return s.feedService.StarFeedItem(ctx, id, starred)
+	})
+}
+
+func (s *nextcloudService) MarkAllRead(ctx context.Context, newestItemID int64) error {
+	return s.markRead(ctx, models.SearchParams{}, newestItemID)
+}
+
+// eachItem applies fn to the items with the given numbers, unknown ones are skipped
+// like Nextcloud does, as they may have been removed since the client synced.
+func (s *nextcloudService) eachItem(ctx context.Context, itemIDs []int64, fn func(id string) error) error {
+	for _, n := range itemIDs {
+		id, err := s.numbers.GetItemID(ctx, n)
+		if repository.IsItemNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markRead marks the items matching params up to the newest item the client knows of as read,
+// so that items fetched since stay unread.
+func (s *nextcloudService) markRead(ctx context.Context, params models.SearchParams, newestItemID int64) error {
+	if _, err := s.numbers.MarkItemsRead(ctx, params, newestItemID); err != nil {
+		return fmt.Errorf("mark items up to %d as read: %w", newestItemID, err)
+	}
+	return nil
+}
+
+// feeds appends feeds in their Nextcloud form to res, and sets its newest item.
+func (s *nextcloudService) feeds(ctx context.Context, res *nextcloud.Feeds, feeds []db.Feed) error {
+	feedIDs, err := s.numbers.FeedNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	folderIDs, err := s.numbers.FolderNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts, err := s.feedService.CountFeedItems(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range feeds {
+		feed := nextcloud.Feed{
+			ID:    feedIDs[f.ID],
+			URL:   f.URL,
+			Title: feedTitle(&f),
+			// Feeds don't record when they were added, their first fetch is close
+			Added:       f.LastFetch.Unix(),
+			UnreadCount: counts.Feeds[f.ID].Unread,
+			Link:        f.SiteURL,
+		}
+		if f.FolderID != nil {
+			feed.FolderID = folderIDs[*f.FolderID]
+		}
+		res.Feeds = append(res.Feeds, feed)
+	}
+
+	newest, err := s.numbers.ListNumberedItems(ctx, models.NumberQuery{Desc: true, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(newest) > 0 {
+		res.NewestItemID = newest[0].Number
+	}
+	return nil
+}
+
+// folder returns the folder with the given number.
+func (s *nextcloudService) folder(ctx context.Context, number int64) (*db.Folder, error) {
+	id, err := findNumber(ctx, s.numbers.FolderNumbers, number)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, repository.ErrFolderNotFound
+	}
+	return s.folderService.GetFolder(ctx, id)
+}
+
+// feedID returns the ID of the feed with the given number.
+func (s *nextcloudService) feedID(ctx context.Context, number int64) (string, error) {
+	id, err := findNumber(ctx, s.numbers.FeedNumbers, number)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", repository.ErrFeedNotFound
+	}
+	return id, nil
+}
+
+// checkFolderName fails when another folder than the given one has this name, ignoring case.
+func (s *nextcloudService) checkFolderName(ctx context.Context, folderID, name string) error {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range folders {
+		if f.ID != folderID && strings.EqualFold(f.Name, strings.TrimSpace(name)) {
+			return ErrFolderExists
+		}
+	}
+	return nil
+}
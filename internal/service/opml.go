@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/opml"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// OPMLImportConcurrency is how many feeds are fetched at the same time during an import.
+const OPMLImportConcurrency = 8
+
+// OPMLImportTimeout is how long an import waits for its feeds to be fetched, within the
+// server's write timeout. The feeds left are still added afterwards, in the background.
+var OPMLImportTimeout = 10 * time.Second
+
+// OPMLService imports and exports subscription lists to move between readers.
+type OPMLService interface {
+	Import(ctx context.Context, r io.Reader) (*models.ImportReport, error)
+	Export(ctx context.Context, filter models.ExportFilter) (*opml.OPML, error)
+}
+
+type opmlService struct {
+	feedService   FeedService
+	folderService FolderService
+}
+
+func NewOPMLService(feedService FeedService, folderService FolderService) OPMLService {
+	return &opmlService{
+		feedService:   feedService,
+		folderService: folderService,
+	}
+}
+
+// importEntry is a feed outline, with the folder path it's nested in.
+type importEntry struct {
+	outline opml.Outline
+	path    []string
+}
+
+// Import adds every feed of an OPML document, nested outlines become folders
+// and outline titles custom feed names. Feeds already subscribed to are left untouched.
+// The outlines not done after OPMLImportTimeout are reported as pending.
+func (s *opmlService) Import(ctx context.Context, r io.Reader) (*models.ImportReport, error) {
+	doc, err := opml.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []importEntry
+	collectOutlines(doc.Body.Outlines, nil, &entries)
+
+	folders, err := s.ensureFolders(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.OutlineResult, len(entries))
+	seen := make(map[string]bool)
+	var queued []int
+
+	for i, e := range entries {
+		url := e.outline.FeedURL()
+		results[i] = models.OutlineResult{
+			Name:   e.outline.Name(),
+			URL:    url,
+			Folder: strings.Join(e.path, "/"),
+			Status: models.OutlinePending,
+		}
+
+		// The same feed in several folders is only added once, in the first one
+		if seen[url] {
+			results[i].Status = models.OutlineExists
+			results[i].Error = "duplicate outline"
+			continue
+		}
+		seen[url] = true
+		queued = append(queued, i)
+	}
+
+	// The fetches outlive the request when they take too long
+	ctx = context.WithoutCancel(ctx)
+	var mu sync.Mutex
+	jobs := make(chan int)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for w := 0; w < OPMLImportConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := s.importOutline(ctx, entries[i], folders[strings.Join(entries[i].path, "/")])
+				mu.Lock()
+				results[i] = res
+				mu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		for _, i := range queued {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(OPMLImportTimeout):
+	}
+
+	mu.Lock()
+	report := &models.ImportReport{Outlines: slices.Clone(results)}
+	mu.Unlock()
+	for _, res := range report.Outlines {
+		switch res.Status {
+		case models.OutlineAdded:
+			report.Added++
+		case models.OutlineExists:
+			report.Existing++
+		case models.OutlineFailed:
+			report.Failed++
+		case models.OutlinePending:
+			report.Pending++
+		}
+	}
+
+	return report, nil
+}
+
+func (s *opmlService) importOutline(ctx context.Context, e importEntry, folderID *string) models.OutlineResult {
+	res := models.OutlineResult{
+		Name:   e.outline.Name(),
+		URL:    e.outline.FeedURL(),
+		Folder: strings.Join(e.path, "/"),
+	}
+
+	fail := func(err error) models.OutlineResult {
+		res.Status = models.OutlineFailed
+		res.Error = err.Error()
+		return res
+	}
+
+	u, err := neturl.Parse(res.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fail(fmt.Errorf("invalid feed URL %q", res.URL))
+	}
+
+	existing, _ := s.feedService.GetFeedByURL(ctx, res.URL)
+	if existing != nil {
+		res.Status = models.OutlineExists
+		res.FeedID = existing.ID
+		return res
+	}
+
+	id, err := s.feedService.AddFeed(ctx, res.URL)
+	if err != nil {
+		return fail(err)
+	}
+	res.FeedID = id
+
+	feed, err := s.feedService.GetFeed(ctx, id)
+	if err != nil {
+		return fail(err)
+	}
+
+	if res.Name != feed.Title {
+		feed.Name = res.Name
+	}
+	feed.FolderID = folderID
+	// Items are already saved by AddFeed
+	feed.Items = nil
+
+	if err := s.feedService.UpdateFeed(ctx, feed); err != nil {
+		return fail(err)
+	}
+
+	res.Status = models.OutlineAdded
+	return res
+}
+
+// collectOutlines flattens the outlines into feed entries. Folders can only be
+// nested one level deep, so deeper outlines end up in their second level ancestor.
+func collectOutlines(outlines []opml.Outline, path []string, entries *[]importEntry) {
+	for _, o := range outlines {
+		if o.FeedURL() != "" {
+			*entries = append(*entries, importEntry{outline: o, path: path})
+			continue
+		}
+
+		sub := path
+		if name := o.Name(); name != "" && len(path) < 2 {
+			// Long names are cut to MaxFolderNameLength bytes, without splitting a rune
+			if len(name) > MaxFolderNameLength {
+				end := MaxFolderNameLength
+				for end > 0 && !utf8.RuneStart(name[end]) {
+					end--
+				}
+				name = name[:end]
+			}
+			sub = append(append([]string{}, path...), name)
+		}
+		collectOutlines(o.Outlines, sub, entries)
+	}
+}
+
+// ensureFolders creates the folders the entries are nested in, reusing the
+// existing ones with the same name, and returns their IDs by path.
+func (s *opmlService) ensureFolders(ctx context.Context, entries []importEntry) (map[string]*string, error) {
+	existing, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ parent, name string }
+	byName := make(map[key]string, len(existing))
+	for _, f := range existing {
+		parent := ""
+		if f.ParentID != nil {
+			parent = *f.ParentID
+		}
+		byName[key{parent, strings.ToLower(f.Name)}] = f.ID
+	}
+
+	ids := map[string]*string{"": nil}
+	for _, e := range entries {
+		parent := ""
+		for i, name := range e.path {
+			path := strings.Join(e.path[:i+1], "/")
+			if id, ok := ids[path]; ok {
+				parent = *id
+				continue
+			}
+
+			k := key{parent, strings.ToLower(name)}
+			id, ok := byName[k]
+			if !ok {
+				var parentID *string
+				if parent != "" {
+					parentID = &parent
+				}
+
+				folder, err := s.folderService.CreateFolder(ctx, name, parentID)
+				if err != nil {
+					return nil, fmt.Errorf("create folder %s: %w", path, err)
+				}
+				id = folder.ID
+				byName[k] = id
+			}
+
+			ids[path] = &id
+			parent = id
+		}
+	}
+
+	return ids, nil
+}
+
+// Export returns the feeds as an OPML 2.0 document, nested in outlines for their folders.
+// Folders without any exported feed are left out.
+func (s *opmlService) Export(ctx context.Context, filter models.ExportFilter) (*opml.OPML, error) {
+	tree, err := s.folderService.Tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	include := func(f db.Feed) bool {
+		return len(filter.FeedIDs) == 0 || slices.Contains(filter.FeedIDs, f.ID)
+	}
+
+	var outlines []opml.Outline
+	if filter.FolderID != "" {
+		node := findFolder(tree.Folders, filter.FolderID)
+		if node == nil {
+			// Let the folder service report the folder as missing
+			if _, err := s.folderService.GetFolder(ctx, filter.FolderID); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("folder %s not in tree", filter.FolderID)
+		}
+		if o, ok := folderOutline(*node, include); ok {
+			outlines = append(outlines, o)
+		}
+	} else {
+		for _, node := range tree.Folders {
+			if o, ok := folderOutline(node, include); ok {
+				outlines = append(outlines, o)
+			}
+		}
+		for _, f := range tree.Feeds {
+			if include(f) {
+				outlines = append(outlines, feedOutline(f))
+			}
+		}
+	}
+
+	return &opml.OPML{
+		Version: "2.0",
+		Head: opml.Head{
+			Title:       "llrss subscriptions",
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+		Body: opml.Body{Outlines: outlines},
+	}, nil
+}
+
+func findFolder(nodes []models.FolderNode, id string) *models.FolderNode {
+	for i := range nodes {
+		if nodes[i].Folder.ID == id {
+			return &nodes[i]
+		}
+		if node := findFolder(nodes[i].Children, id); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// folderOutline returns the outline of a folder, or false when none of its feeds are included.
+func folderOutline(node models.FolderNode, include func(db.Feed) bool) (opml.Outline, bool) {
+	o := opml.Outline{Text: node.Folder.Name, Title: node.Folder.Name}
+	for _, child := range node.Children {
+		if c, ok := folderOutline(child, include); ok {
+			o.Outlines = append(o.Outlines, c)
+		}
+	}
+	for _, f := range node.Feeds {
+		if include(f) {
+			o.Outlines = append(o.Outlines, feedOutline(f))
+		}
+	}
+	return o, len(o.Outlines) > 0
+}
+
+func feedOutline(f db.Feed) opml.Outline {
+	name := feedTitle(&f)
+	return opml.Outline{
+		Text:    name,
+		Title:   name,
+		Type:    "rss",
+		XMLURL:  f.URL,
+		HTMLURL: f.SiteURL,
+	}
+}
+
+// feedTitle is the name shown for a feed, its custom name, title or URL.
+func feedTitle(f *db.Feed) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.URL
+}
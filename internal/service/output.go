@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/models/rss"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// OutputItemLimit is how many of the newest items an output feed has.
+const OutputItemLimit = 50
+
+// Kinds of output feeds, the ID of an output feed is the ID of what it's made of,
+// a tag name, or "all" for starred items.
+const (
+	OutputFeed    = "feed"
+	OutputFolder  = "folder"
+	OutputTag     = "tag"
+	OutputSearch  = "search"
+	OutputStarred = "starred"
+)
+
+// ErrUnknownOutput is returned for output feeds of an unknown kind, or starred ones not named "all".
+var ErrUnknownOutput = errors.New("unknown output feed")
+
+// OutputService republishes streams of items as RSS and Atom feeds, for other tools to consume.
+type OutputService interface {
+	RSS(ctx context.Context, kind, id string) (*rss.RSS, error)
+	Atom(ctx context.Context, kind, id string) (*rss.AtomFeed, error)
+}
+
+type outputService struct {
+	feedService        FeedService
+	folderService      FolderService
+	savedSearchService SavedSearchService
+	baseURL            string
+}
+
+// NewOutputService creates the service of the output feeds served under baseURL + "/out/".
+func NewOutputService(feedService FeedService, folderService FolderService, savedSearchService SavedSearchService, baseURL string) OutputService {
+	return &outputService{
+		feedService:        feedService,
+		folderService:      folderService,
+		savedSearchService: savedSearchService,
+		baseURL:            strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// stream is what an output feed is made of, regardless of its format.
+type stream struct {
+	title       string
+	description string
+	items       []db.Item
+	// updated is the date of the newest item, or now without items.
+	updated time.Time
+}
+
+func (s *outputService) RSS(ctx context.Context, kind, id string) (*rss.RSS, error) {
+	st, err := s.stream(ctx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]rss.Item, len(st.items))
+	for i, item := range st.items {
+		items[i] = rss.Item{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Author:      item.Author,
+			Category:    item.Category,
+			Comments:    item.Comments,
+			// Item IDs are derived from their link, which makes it a stable GUID
+			GUID:    &rss.GUID{ID: item.Link, IsPermaLink: "true"},
+			PubDate: item.PubDate.UTC().Format(time.RFC1123Z),
+		}
+		if item.Content != "" {
+			items[i].Content = &rss.Content{Content: item.Content}
+		}
+	}
+
+	return &rss.RSS{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		Channel: rss.Channel{
+			Title:         st.title,
+			Link:          s.baseURL + "/",
+			Description:   st.description,
+			Generator:     "llrss",
+			LastBuildDate: st.updated.UTC().Format(time.RFC1123Z),
+			AtomLinks:     []rss.AtomLink{{Href: s.outputURL(kind, id, "xml"), Rel: "self", Type: "application/rss+xml"}},
+			Items:         items,
+		},
+	}, nil
+}
+
+func (s *outputService) Atom(ctx context.Context, kind, id string) (*rss.AtomFeed, error) {
+	st, err := s.stream(ctx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	self := s.outputURL(kind, id, "atom")
+	entries := make([]rss.AtomEntry, len(st.items))
+	for i, item := range st.items {
+		date := item.PubDate.UTC().Format(time.RFC3339)
+		entries[i] = rss.AtomEntry{
+			ID:        item.Link,
+			Title:     item.Title,
+			Links:     []rss.AtomLink{{Href: item.Link, Rel: "alternate"}},
+			Published: date,
+			Updated:   date,
+		}
+		if item.Author != "" {
+			entries[i].Author = &rss.AtomPerson{Name: item.Author}
+		}
+		if item.Category != "" {
+			entries[i].Categories = []rss.AtomCategory{{Term: item.Category}}
+		}
+		if item.Description != "" {
+			entries[i].Summary = &rss.AtomText{Type: "html", Body: item.Description}
+		}
+		if item.Content != "" {
+			entries[i].Content = &rss.AtomText{Type: "html", Body: item.Content}
+		}
+	}
+
+	return &rss.AtomFeed{
+		ID:        self,
+		Title:     st.title,
+		Subtitle:  st.description,
+		Updated:   st.updated.UTC().Format(time.RFC3339),
+		Generator: "llrss",
+		Links: []rss.AtomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: s.baseURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Entries: entries,
+	}, nil
+}
+
+// outputURL is the public URL of an output feed, without its token.
+func (s *outputService) outputURL(kind, id, ext string) string {
+	return fmt.Sprintf("%s/out/%s/%s.%s", s.baseURL, kind, neturl.PathEscape(id), ext)
+}
+
+// stream returns the newest items of an output feed, with its title.
+func (s *outputService) stream(ctx context.Context, kind, id string) (*stream, error) {
+	st := &stream{}
+	params := models.SearchParams{}
+
+	switch kind {
+	case OutputFeed:
+		feed, err := s.feedService.GetFeed(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		st.title = feedTitle(feed)
+		st.description = feed.Description
+		params.FeedIDs = []string{feed.ID}
+
+	case OutputFolder:
+		folder, err := s.folderService.GetFolder(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		st.title = folder.Name
+		st.description = "Items of the " + folder.Name + " folder"
+		params.FolderID = folder.ID
+
+	case OutputTag:
+		tag, err := NormalizeTag(id)
+		if err != nil {
+			return nil, err
+		}
+		st.title = "Tagged " + tag
+		st.description = "Items tagged " + tag
+		params.Tags = []string{tag}
+
+	case OutputSearch:
+		saved, err := s.savedSearchService.GetSavedSearch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if params, err = searchParams(saved); err != nil {
+			return nil, err
+		}
+		st.title = saved.Name
+		st.description = "Results of the " + saved.Name + " search"
+
+	case OutputStarred:
+		if id != "all" {
+			return nil, ErrUnknownOutput
+		}
+		st.title = "Starred items"
+		st.description = "Starred items"
+		params.Starred = true
+
+	default:
+		return nil, ErrUnknownOutput
+	}
+
+	// Whatever the order of a saved search, feeds are made of the newest items
+	params.Sort = "desc"
+	params.Limit = OutputItemLimit
+
+	res, err := s.feedService.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	st.items = res.Items
+
+	st.updated = time.Now()
+	if len(st.items) > 0 {
+		st.updated = st.items[0].PubDate
+	}
+	return st, nil
+}
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/models/greader"
+	"llrss/internal/repository"
+	"llrss/internal/search"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ReaderDefaultCount is how many items a stream page has when the client doesn't say.
+	ReaderDefaultCount = 20
+	// ReaderMaxCount is the most items of a stream page, clients ask for up to 10000 item IDs at once.
+	ReaderMaxCount = 10000
+)
+
+var (
+	// ErrUnknownStream is returned for stream IDs which aren't a feed, a label or a known state.
+	ErrUnknownStream = errors.New("unknown stream")
+	// ErrInvalidSubscriptionEdit is returned for subscription edits of an unknown action.
+	ErrInvalidSubscriptionEdit = errors.New("invalid subscription edit")
+)
+
+// ReaderService maps the Google Reader API onto feeds, folders and tags (both as labels),
+// and the read and starred status of items.
+type ReaderService interface {
+	Subscriptions(ctx context.Context) (*greader.SubscriptionList, error)
+	EditSubscription(ctx context.Context, edit greader.SubscriptionEdit) error
+	QuickAdd(ctx context.Context, url string) (*greader.QuickAddResult, error)
+	Tags(ctx context.Context) (*greader.TagList, error)
+	UnreadCounts(ctx context.Context) (*greader.UnreadCounts, error)
+	StreamItemIDs(ctx context.Context, q greader.StreamQuery) (*greader.ItemRefs, error)
+	StreamContents(ctx context.Context, q greader.StreamQuery) (*greader.Stream, error)
+	ItemContents(ctx context.Context, itemIDs []string) (*greader.Stream, error)
+	EditTag(ctx context.Context, itemIDs []string, add, remove []string) error
+	MarkAllAsRead(ctx context.Context, streamID string, before time.Time) error
+}
+
+type readerService struct {
+	feedService   FeedService
+	folderService FolderService
+	numbers       repository.NumberRepository
+}
+
+func NewReaderService(feedService FeedService, folderService FolderService, numbers repository.NumberRepository) ReaderService {
+	return &readerService{
+		feedService:   feedService,
+		folderService: folderService,
+		numbers:       numbers,
+	}
+}
+
+func (s *readerService) Subscriptions(ctx context.Context) (*greader.SubscriptionList, error) {
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := s.folderNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &greader.SubscriptionList{Subscriptions: make([]greader.Subscription, len(feeds))}
+	for i, f := range feeds {
+		sub := greader.Subscription{
+			ID:         greader.FeedPrefix + f.ID,
+			Title:      feedTitle(&f),
+			Categories: []greader.Category{},
+			URL:        f.URL,
+			HTMLURL:    f.SiteURL,
+		}
+		if f.FolderID != nil {
+			name := folders[*f.FolderID]
+			sub.Categories = append(sub.Categories, greader.Category{ID: greader.LabelPrefix + name, Label: name})
+		}
+		list.Subscriptions[i] = sub
+	}
+	return list, nil
+}
+
+// EditSubscription subscribes to ("feed/{url}"), unsubscribes from or edits a feed, then renames
+// it and moves it in or out of the folder named by its labels. Folders are created as needed.
+func (s *readerService) EditSubscription(ctx context.Context, edit greader.SubscriptionEdit) error {
+	id, ok := strings.CutPrefix(edit.StreamID, greader.FeedPrefix)
+	if !ok || id == "" {
+		return ErrUnknownStream
+	}
+
+	switch edit.Action {
+	case "subscribe":
+		var err error
+		if id, err = s.feedService.AddFeed(ctx, id); err != nil {
+			return err
+		}
+	case "unsubscribe":
+		return s.feedService.DeleteFeed(ctx, id)
+	case "edit":
+	default:
+		return ErrInvalidSubscriptionEdit
+	}
+
+	feed, err := s.feedService.GetFeed(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if edit.Title != "" && edit.Title != feed.Title {
+		feed.Name = edit.Title
+		feed.Items = nil
+		if err := s.feedService.UpdateFeed(ctx, feed); err != nil {
+			return err
+		}
+	}
+
+	if name, ok := strings.CutPrefix(greader.NormalizeStreamID(edit.AddLabel), greader.LabelPrefix); ok {
+		folder, err := s.ensureFolder(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.folderService.SetFeedFolder(ctx, feed.ID, &folder.ID)
+	}
+
+	if name, ok := strings.CutPrefix(greader.NormalizeStreamID(edit.RemoveLabel), greader.LabelPrefix); ok && feed.FolderID != nil {
+		folder, err := s.findFolder(ctx, name)
+		if err != nil {
+			return err
+		}
+		if folder != nil && folder.ID == *feed.FolderID {
+			return s.folderService.SetFeedFolder(ctx, feed.ID, nil)
+		}
+	}
+	return nil
+}
+
+func (s *readerService) QuickAdd(ctx context.Context, url string) (*greader.QuickAddResult, error) {
+	id, err := s.feedService.AddFeed(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := s.feedService.GetFeed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &greader.QuickAddResult{
+		NumResults: 1,
+		Query:      url,
+		StreamID:   greader.FeedPrefix + feed.ID,
+		StreamName: feedTitle(feed),
+	}, nil
+}
+
+// Tags lists the starred state, the folders and the item tags.
+func (s *readerService) Tags(ctx context.Context) (*greader.TagList, error) {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.feedService.CountFeedItemTags(ctx, models.SearchParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	list := &greader.TagList{Tags: []greader.Tag{{ID: greader.StateStarred}}}
+	for _, f := range folders {
+		list.Tags = append(list.Tags, greader.Tag{ID: greader.LabelPrefix + f.Name, Type: "folder"})
+	}
+	for _, t := range tags {
+		list.Tags = append(list.Tags, greader.Tag{ID: greader.LabelPrefix + t.Tag, Type: "tag"})
+	}
+	return list, nil
+}
+
+// UnreadCounts returns the unread items of every feed and folder, and of the reading list.
+func (s *readerService) UnreadCounts(ctx context.Context) (*greader.UnreadCounts, error) {
+	counts, err := s.feedService.CountFeedItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &greader.UnreadCounts{
+		Max:          counts.Unread,
+		UnreadCounts: []greader.UnreadCount{{ID: greader.StateReadingList, Count: counts.Unread}},
+	}
+	for id, c := range counts.Feeds {
+		res.UnreadCounts = append(res.UnreadCounts, greader.UnreadCount{ID: greader.FeedPrefix + id, Count: c.Unread})
+	}
+	for _, f := range folders {
+		res.UnreadCounts = append(res.UnreadCounts, greader.UnreadCount{ID: greader.LabelPrefix + f.Name, Count: f.Unread})
+	}
+	return res, nil
+}
+
+func (s *readerService) StreamItemIDs(ctx context.Context, q greader.StreamQuery) (*greader.ItemRefs, error) {
+	res, numbers, err := s.searchStream(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := &greader.ItemRefs{ItemRefs: make([]greader.ItemRef, 0, len(res.Items)), Continuation: res.NextCursor}
+	for _, item := range res.Items {
+		refs.ItemRefs = append(refs.ItemRefs, greader.ItemRef{ID: strconv.FormatInt(numbers[item.ID], 10)})
+	}
+	return refs, nil
+}
+
+func (s *readerService) StreamContents(ctx context.Context, q greader.StreamQuery) (*greader.Stream, error) {
+	res, numbers, err := s.searchStream(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.NumberedItem, len(res.Items))
+	for i, item := range res.Items {
+		items[i] = models.NumberedItem{Item: item, Number: numbers[item.ID]}
+	}
+
+	stream, err := s.stream(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	stream.ID = q.StreamID
+	stream.Continuation = res.NextCursor
+	return stream, nil
+}
+
+// ItemContents returns the items with the given IDs, in the long or short form.
+func (s *readerService) ItemContents(ctx context.Context, itemIDs []string) (*greader.Stream, error) {
+	numbers := make([]int64, len(itemIDs))
+	for i, id := range itemIDs {
+		n, err := greader.ParseItemID(id)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = n
+	}
+
+	var items []models.NumberedItem
+	if len(numbers) > 0 {
+		var err error
+		items, err = s.numbers.ListNumberedItems(ctx, models.NumberQuery{Numbers: numbers, Limit: len(numbers)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stream, err := s.stream(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	stream.ID = greader.StateReadingList
+	return stream, nil
+}
+
+// EditTag adds and removes the read, kept-unread and starred states, and labels as tags, to items.
+// Other states, like the tracking ones, are ignored.
+func (s *readerService) EditTag(ctx context.Context, itemIDs []string, add, remove []string) error {
+	for _, itemID := range itemIDs {
+		n, err := greader.ParseItemID(itemID)
+		if err != nil {
+			return err
+		}
+
+		id, err := s.numbers.GetItemID(ctx, n)
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range add {
+			if err := s.editTag(ctx, id, greader.NormalizeStreamID(tag), true); err != nil {
+				return err
+			}
+		}
+		for _, tag := range remove {
+			if err := s.editTag(ctx, id, greader.NormalizeStreamID(tag), false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *readerService) editTag(ctx context.Context, itemID, tag string, added bool) error {
+	switch tag {
+	case greader.StateRead:
+		return s.feedService.MarkFeedItemRead(ctx, itemID, added)
+	case greader.StateKeptUnread:
+		return s.feedService.MarkFeedItemRead(ctx, itemID, !added)
+	case greader.StateStarred:
+		return s.feedService.StarFeedItem(ctx, itemID, added)
+	}
+
+	if label, ok := strings.CutPrefix(tag, greader.LabelPrefix); ok {
+		err := s.feedService.TagFeedItem(ctx, itemID, label, added)
+		if !added && errors.Is(err, repository.ErrTagNotFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// MarkAllAsRead marks the items of a stream published before the given time as read, all of them with a zero time.
+func (s *readerService) MarkAllAsRead(ctx context.Context, streamID string, before time.Time) error {
+	params, err := s.streamParams(ctx, greader.StreamQuery{StreamID: streamID})
+	if err != nil {
+		return err
+	}
+
+	// Item dates are stored in UTC, and compared as text
+	params.ToDate = time.Now().UTC()
+	if !before.IsZero() {
+		params.ToDate = before.UTC()
+	}
+
+	if _, err := s.feedService.MarkFeedItems(ctx, params, true); err != nil {
+		return fmt.Errorf("mark %s as read: %w", streamID, err)
+	}
+	return nil
+}
+
+// searchStream returns a page of the items of a stream, with their numbers.
+func (s *readerService) searchStream(ctx context.Context, q greader.StreamQuery) (*models.SearchResult, map[string]int64, error) {
+	params, err := s.streamParams(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params.Limit = ReaderDefaultCount
+	if q.Count > 0 {
+		params.Limit = min(q.Count, ReaderMaxCount)
+	}
+
+	params.Sort = "desc"
+	if q.OldestFirst {
+		params.Sort = "asc"
+	}
+
+	if q.NewerThan > 0 {
+		params.FromDate = time.Unix(q.NewerThan, 0).UTC()
+	}
+	if q.OlderThan > 0 {
+		params.ToDate = time.Unix(q.OlderThan, 0).UTC()
+	}
+
+	if q.Continuation != "" {
+		if params.Cursor, err = ParseCursor(q.Continuation); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	res, err := s.feedService.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, len(res.Items))
+	for i, item := range res.Items {
+		ids[i] = item.ID
+	}
+
+	numbers, err := s.numbers.ItemNumbers(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, numbers, nil
+}
+
+// streamParams returns the search of the items of a stream, a label is a folder
+// when there's one with this name, a tag otherwise.
+func (s *readerService) streamParams(ctx context.Context, q greader.StreamQuery) (models.SearchParams, error) {
+	var params models.SearchParams
+
+	id := greader.NormalizeStreamID(q.StreamID)
+	switch {
+	case id == "" || id == greader.StateReadingList:
+	case id == greader.StateStarred:
+		params.Starred = true
+	case id == greader.StateRead:
+		params.Filter = &search.Term{Field: search.FieldIs, Value: search.IsRead}
+	case strings.HasPrefix(id, greader.FeedPrefix):
+		params.FeedIDs = []string{strings.TrimPrefix(id, greader.FeedPrefix)}
+	case strings.HasPrefix(id, greader.LabelPrefix):
+		name := strings.TrimPrefix(id, greader.LabelPrefix)
+		folder, err := s.findFolder(ctx, name)
+		if err != nil {
+			return params, err
+		}
+		if folder != nil {
+			params.FolderID = folder.ID
+			break
+		}
+
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return params, err
+		}
+		params.Tags = []string{tag}
+	default:
+		return params, ErrUnknownStream
+	}
+
+	if greader.NormalizeStreamID(q.Exclude) == greader.StateRead {
+		params.Unread = true
+	}
+
+	switch greader.NormalizeStreamID(q.Include) {
+	case greader.StateStarred:
+		params.Starred = true
+	case greader.StateRead:
+		params.Filter = &search.Term{Field: search.FieldIs, Value: search.IsRead}
+	}
+	return params, nil
+}
+
+// stream turns items into their Google Reader form, with the feed they're from.
+func (s *readerService) stream(ctx context.Context, items []models.NumberedItem) (*greader.Stream, error) {
+	feeds, err := s.feedService.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := s.folderNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*db.Feed, len(feeds))
+	for i := range feeds {
+		byID[feeds[i].ID] = &feeds[i]
+	}
+
+	stream := &greader.Stream{Direction: "ltr", Updated: time.Now().Unix(), Items: make([]greader.Item, len(items))}
+	for i, item := range items {
+		html := item.Article
+		if html == "" {
+			html = item.Content
+		}
+		if html == "" {
+			html = item.Description
+		}
+
+		categories := []string{greader.StateReadingList}
+		if item.IsRead {
+			categories = append(categories, greader.StateRead)
+		}
+		if item.IsStarred {
+			categories = append(categories, greader.StateStarred)
+		}
+		for _, t := range item.Tags {
+			categories = append(categories, greader.LabelPrefix+t.Name)
+		}
+
+		origin := greader.Origin{StreamID: greader.FeedPrefix + item.FeedID}
+		if f, ok := byID[item.FeedID]; ok {
+			origin.Title = feedTitle(f)
+			origin.HTMLURL = f.SiteURL
+			if f.FolderID != nil {
+				categories = append(categories, greader.LabelPrefix+folders[*f.FolderID])
+			}
+		}
+
+		stream.Items[i] = greader.Item{
+			ID:            greader.LongItemID(item.Number),
+			CrawlTimeMsec: strconv.FormatInt(item.PubDate.UnixMilli(), 10),
+			TimestampUsec: strconv.FormatInt(item.PubDate.UnixMicro(), 10),
+			Published:     item.PubDate.Unix(),
+			Updated:       item.PubDate.Unix(),
+			Title:         item.Title,
+			Author:        item.Author,
+			Canonical:     []greader.Link{{Href: item.Link}},
+			Alternate:     []greader.Link{{Href: item.Link, Type: "text/html"}},
+			Summary:       greader.Content{Direction: "ltr", Content: html},
+			Categories:    categories,
+			Origin:        origin,
+		}
+	}
+	return stream, nil
+}
+
+// folderNames returns the name of every folder by ID.
+func (s *readerService) folderNames(ctx context.Context) (map[string]string, error) {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(folders))
+	for _, f := range folders {
+		names[f.ID] = f.Name
+	}
+	return names, nil
+}
+
+// findFolder returns the folder with the given name, ignoring case, or nil.
+func (s *readerService) findFolder(ctx context.Context, name string) (*db.Folder, error) {
+	folders, err := s.folderService.ListFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range folders {
+		if strings.EqualFold(f.Name, name) {
+			return &f.Folder, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *readerService) ensureFolder(ctx context.Context, name string) (*db.Folder, error) {
+	folder, err := s.findFolder(ctx, name)
+	if err != nil || folder != nil {
+		return folder, err
+	}
+	return s.folderService.CreateFolder(ctx, name, nil)
+}
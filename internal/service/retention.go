@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"time"
+)
+
+// RetentionService purges items according to the global retention policy and the per-feed overrides.
+type RetentionService interface {
+	Purge(ctx context.Context, dryRun bool) (*models.PurgeReport, error)
+}
+
+type retentionService struct {
+	feedRepo repository.FeedRepository
+	repo     repository.RetentionRepository
+	defaults db.RetentionPolicy
+}
+
+func NewRetentionService(feedRepo repository.FeedRepository, repo repository.RetentionRepository, defaults db.RetentionPolicy) RetentionService {
+	return &retentionService{
+		feedRepo: feedRepo,
+		repo:     repo,
+		defaults: defaults,
+	}
+}
+
+// Purge deletes the items not satisfying their feed's policy. On a dry run
+// nothing is deleted and the report tells what would be.
+func (s *retentionService) Purge(ctx context.Context, dryRun bool) (*models.PurgeReport, error) {
+	feeds, err := s.feedRepo.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &models.PurgeReport{
+		DryRun: dryRun,
+		Feeds:  []models.FeedPurge{},
+	}
+
+	for _, f := range feeds {
+		policy := f.Retention.Or(s.defaults)
+
+		items, err := s.repo.ListPurgeCandidates(ctx, f.ID, policy, now)
+		if err != nil {
+			return nil, fmt.Errorf("list purge candidates for feed %s: %w", f.URL, err)
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		count := int64(len(items))
+		if !dryRun {
+			ids := make([]string, len(items))
+			for i, item := range items {
+				ids[i] = item.ID
+			}
+
+			count, err = s.repo.DeleteItems(ctx, ids)
+			if err != nil {
+				return nil, fmt.Errorf("delete items for feed %s: %w", f.URL, err)
+			}
+		}
+
+		report.Feeds = append(report.Feeds, models.FeedPurge{
+			FeedID: f.ID,
+			Title:  f.Title,
+			Policy: policy,
+			Items:  items,
+			Count:  count,
+		})
+		report.Total += count
+	}
+
+	return report, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/rules"
+	"llrss/internal/text"
+	"strings"
+)
+
+const MaxRuleNameLength = 128
+
+// ruleBatchSize is how many items are matched at once when applying a rule to the saved items,
+// and the most items posted in one webhook delivery.
+const ruleBatchSize = 200
+
+// ErrInvalidRuleName is returned for empty or too long rule names.
+var ErrInvalidRuleName = errors.New("invalid rule name")
+
+// RuleService manages the rules run on the new items of feeds, see rules.NewFeedRepository.
+type RuleService interface {
+	ListRules(ctx context.Context) ([]db.Rule, error)
+	GetRule(ctx context.Context, id string) (*db.Rule, error)
+	CreateRule(ctx context.Context, rule *db.Rule) error
+	UpdateRule(ctx context.Context, rule *db.Rule) error
+	DeleteRule(ctx context.Context, id string) error
+	// ApplyRule runs a rule on the items already saved, even when it's disabled.
+	ApplyRule(ctx context.Context, id string) (*models.RuleResult, error)
+}
+
+type ruleService struct {
+	repo          repository.RuleRepository
+	feedService   FeedService
+	retentionRepo repository.RetentionRepository
+	webhookRepo   repository.WebhookRepository
+}
+
+func NewRuleService(repo repository.RuleRepository, feedService FeedService, retentionRepo repository.RetentionRepository,
+	webhookRepo repository.WebhookRepository) RuleService {
+	return &ruleService{
+		repo:          repo,
+		feedService:   feedService,
+		retentionRepo: retentionRepo,
+		webhookRepo:   webhookRepo,
+	}
+}
+
+func (s *ruleService) ListRules(ctx context.Context) ([]db.Rule, error) {
+	return s.repo.ListRules(ctx)
+}
+
+func (s *ruleService) GetRule(ctx context.Context, id string) (*db.Rule, error) {
+	return s.repo.GetRule(ctx, id)
+}
+
+func (s *ruleService) CreateRule(ctx context.Context, rule *db.Rule) error {
+	rule.ID = text.RandomID()
+	if err := s.validate(ctx, rule); err != nil {
+		return err
+	}
+
+	if err := s.repo.SaveRule(ctx, rule); err != nil {
+		return fmt.Errorf("save rule: %w", err)
+	}
+	return nil
+}
+
+func (s *ruleService) UpdateRule(ctx context.Context, rule *db.Rule) error {
+	existing, err := s.repo.GetRule(ctx, rule.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validate(ctx, rule); err != nil {
+		return err
+	}
+
+	rule.CreatedAt = existing.CreatedAt
+	if err := s.repo.SaveRule(ctx, rule); err != nil {
+		return fmt.Errorf("save rule: %w", err)
+	}
+	return nil
+}
+
+func (s *ruleService) DeleteRule(ctx context.Context, id string) error {
+	return s.repo.DeleteRule(ctx, id)
+}
+
+// validate checks the name, conditions and actions of a rule, normalizes its tags and
+// checks that its webhooks exist.
+func (s *ruleService) validate(ctx context.Context, rule *db.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" || len(rule.Name) > MaxRuleNameLength {
+		return ErrInvalidRuleName
+	}
+
+	for i, c := range rule.Conditions {
+		rule.Conditions[i].Field = strings.ToLower(strings.TrimSpace(c.Field))
+		rule.Conditions[i].Op = strings.ToLower(strings.TrimSpace(c.Op))
+		rule.Conditions[i].Value = strings.TrimSpace(c.Value)
+	}
+	if _, err := rules.Compile(rule); err != nil {
+		return err
+	}
+
+	for i, a := range rule.Actions {
+		switch a.Type {
+		case rules.ActionTag:
+			tag, err := NormalizeTag(a.Value)
+			if err != nil {
+				return err
+			}
+			rule.Actions[i].Value = tag
+		case rules.ActionWebhook:
+			if _, err := s.webhookRepo.GetWebhook(ctx, a.Value); err != nil {
+				return err
+			}
+		default:
+			rule.Actions[i].Value = ""
+		}
+	}
+	return nil
+}
+
+func (s *ruleService) ApplyRule(ctx context.Context, id string) (*models.RuleResult, error) {
+	rule, err := s.repo.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m, err := rules.Compile(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only read the feed the rule is restricted to, when it is
+	params := models.SearchParams{Sort: "asc", Limit: ruleBatchSize}
+	for _, c := range rule.Conditions {
+		if c.Field == rules.FieldFeed && c.Op == rules.OpEquals {
+			params.FeedIDs = []string{c.Value}
+		}
+	}
+
+	res := &models.RuleResult{}
+	var matched []db.Item
+	for {
+		page, err := s.feedService.SearchFeedItems(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Items {
+			if m.Match(&item) {
+				matched = append(matched, item)
+			}
+		}
+
+		if len(page.Items) < ruleBatchSize {
+			break
+		}
+		last := page.Items[len(page.Items)-1]
+		params.Cursor = &models.Cursor{PubDate: last.PubDate, ID: last.ID}
+	}
+
+	res.Matched = int64(len(matched))
+	if len(matched) == 0 {
+		return res, nil
+	}
+	if err := s.run(ctx, m, matched); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// run does the actions of a rule to the items, through the feed service for their changes to be published.
+func (s *ruleService) run(ctx context.Context, m *rules.Matcher, items []db.Item) error {
+	for _, a := range m.Rule.Actions {
+		switch a.Type {
+		case rules.ActionMarkRead:
+			for _, item := range items {
+				if !item.IsRead {
+					if err := s.feedService.MarkFeedItemRead(ctx, item.ID, true); err != nil {
+						return err
+					}
+				}
+			}
+		case rules.ActionStar:
+			for _, item := range items {
+				if !item.IsStarred {
+					if err := s.feedService.StarFeedItem(ctx, item.ID, true); err != nil {
+						return err
+					}
+				}
+			}
+		case rules.ActionTag:
+			for _, item := range items {
+				if err := s.feedService.TagFeedItem(ctx, item.ID, a.Value, true); err != nil {
+					return err
+				}
+			}
+		case rules.ActionWebhook:
+			for start := 0; start < len(items); start += ruleBatchSize {
+				if err := rules.Notify(ctx, s.webhookRepo, a.Value, m.Rule, "", items[start:min(start+ruleBatchSize, len(items))]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Deleting last, the other actions may notify the items. The deleted items are remembered
+	// for refreshes not to save them again, whether the rule is enabled or not.
+	if m.Has(rules.ActionDelete) {
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		if _, err := s.retentionRepo.DeleteItems(ctx, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/search"
+	"llrss/internal/text"
+	"slices"
+	"strings"
+)
+
+const MaxSavedSearchNameLength = 128
+
+var (
+	// ErrInvalidSavedSearchName is returned for empty or too long saved search names.
+	ErrInvalidSavedSearchName = errors.New("invalid saved search name")
+	// ErrInvalidSort is returned for sort orders other than asc, desc and relevance.
+	ErrInvalidSort = errors.New("invalid sort, expected asc, desc or relevance")
+	// ErrInvalidDateRange is returned for saved searches ending before they start.
+	ErrInvalidDateRange = errors.New("invalid date range, to_date is before from_date")
+)
+
+// SavedSearchService manages searches saved to be run again, like smart folders.
+type SavedSearchService interface {
+	ListSavedSearches(ctx context.Context) ([]models.SavedSearchCount, error)
+	GetSavedSearch(ctx context.Context, id string) (*db.SavedSearch, error)
+	CreateSavedSearch(ctx context.Context, s *db.SavedSearch) error
+	UpdateSavedSearch(ctx context.Context, s *db.SavedSearch) error
+	DeleteSavedSearch(ctx context.Context, id string) error
+	SearchSavedSearch(ctx context.Context, id string, page models.SearchParams) (*models.SearchResult, error)
+}
+
+type savedSearchService struct {
+	feedService FeedService
+	repo        repository.SavedSearchRepository
+}
+
+func NewSavedSearchService(feedService FeedService, repo repository.SavedSearchRepository) SavedSearchService {
+	return &savedSearchService{
+		feedService: feedService,
+		repo:        repo,
+	}
+}
+
+// ListSavedSearches returns every saved search with how many unread items match it.
+func (s *savedSearchService) ListSavedSearches(ctx context.Context) ([]models.SavedSearchCount, error) {
+	searches, err := s.repo.ListSavedSearches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]models.SavedSearchCount, len(searches))
+	for i, saved := range searches {
+		params, err := searchParams(&saved)
+		if err != nil {
+			return nil, fmt.Errorf("saved search %s: %w", saved.ID, err)
+		}
+		params.Unread = true
+		params.Limit = 1
+
+		page, err := s.feedService.SearchFeedItems(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = models.SavedSearchCount{SavedSearch: saved, Unread: page.Total}
+	}
+	return res, nil
+}
+
+func (s *savedSearchService) GetSavedSearch(ctx context.Context, id string) (*db.SavedSearch, error) {
+	return s.repo.GetSavedSearch(ctx, id)
+}
+
+func (s *savedSearchService) CreateSavedSearch(ctx context.Context, saved *db.SavedSearch) error {
+	saved.ID = text.RandomID()
+	if err := validateSavedSearch(saved); err != nil {
+		return err
+	}
+
+	if err := s.repo.SaveSavedSearch(ctx, saved); err != nil {
+		return fmt.Errorf("save saved search: %w", err)
+	}
+	return nil
+}
+
+func (s *savedSearchService) UpdateSavedSearch(ctx context.Context, saved *db.SavedSearch) error {
+	existing, err := s.repo.GetSavedSearch(ctx, saved.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateSavedSearch(saved); err != nil {
+		return err
+	}
+
+	saved.CreatedAt = existing.CreatedAt
+	if err := s.repo.SaveSavedSearch(ctx, saved); err != nil {
+		return fmt.Errorf("save saved search: %w", err)
+	}
+	return nil
+}
+
+func (s *savedSearchService) DeleteSavedSearch(ctx context.Context, id string) error {
+	return s.repo.DeleteSavedSearch(ctx, id)
+}
+
+// SearchSavedSearch returns a page of the results of a saved search, page only sets the
+// Limit, Offset and Cursor of the search. Searches sorted by relevance are only paged by offset.
+func (s *savedSearchService) SearchSavedSearch(ctx context.Context, id string, page models.SearchParams) (*models.SearchResult, error) {
+	saved, err := s.repo.GetSavedSearch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := searchParams(saved)
+	if err != nil {
+		return nil, err
+	}
+	if page.Cursor != nil && params.Sort == "relevance" {
+		return nil, ErrRelevanceCursor
+	}
+	params.Limit = page.Limit
+	params.Offset = page.Offset
+	params.Cursor = page.Cursor
+
+	res, err := s.feedService.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Tags, err = s.feedService.CountFeedItemTags(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// validateSavedSearch checks the name, query, sort and dates of a saved search, and normalizes its tags.
+func validateSavedSearch(saved *db.SavedSearch) error {
+	saved.Name = strings.TrimSpace(saved.Name)
+	if saved.Name == "" || len(saved.Name) > MaxSavedSearchNameLength {
+		return ErrInvalidSavedSearchName
+	}
+
+	saved.Query = strings.TrimSpace(saved.Query)
+	if _, err := search.Parse(saved.Query); err != nil {
+		return err
+	}
+
+	if saved.Sort != "" && !slices.Contains([]string{"asc", "desc", "relevance"}, saved.Sort) {
+		return ErrInvalidSort
+	}
+
+	if saved.FromDate != nil && saved.ToDate != nil && saved.ToDate.Before(*saved.FromDate) {
+		return ErrInvalidDateRange
+	}
+
+	for i, t := range saved.Tags {
+		tag, err := NormalizeTag(t)
+		if err != nil {
+			return err
+		}
+		saved.Tags[i] = tag
+	}
+	return nil
+}
+
+// searchParams returns the search a saved search runs, without pagination.
+func searchParams(saved *db.SavedSearch) (models.SearchParams, error) {
+	filter, err := search.Parse(saved.Query)
+	if err != nil {
+		return models.SearchParams{}, err
+	}
+
+	sort := saved.Sort
+	if sort == "" {
+		sort = "desc"
+	}
+
+	params := models.SearchParams{
+		Query:          saved.Query,
+		Filter:         filter,
+		FolderID:       saved.FolderID,
+		FeedIDs:        saved.FeedIDs,
+		ExcludeFeedIDs: saved.ExcludeFeedIDs,
+		Tags:           saved.Tags,
+		Unread:         saved.Unread,
+		Starred:        saved.Starred,
+		Sort:           sort,
+	}
+	if saved.FromDate != nil {
+		params.FromDate = *saved.FromDate
+	}
+	if saved.ToDate != nil {
+		params.ToDate = *saved.ToDate
+	}
+	return params, nil
+}
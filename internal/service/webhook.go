@@ -0,0 +1,505 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"llrss/internal/events"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"llrss/internal/text"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookPollInterval is how often deliveries due for a retry are looked for.
+	WebhookPollInterval = time.Minute
+	// WebhookDeliveryRetention is how long delivered and failed deliveries are kept.
+	WebhookDeliveryRetention = 30 * 24 * time.Hour
+	// WebhookDeliveriesShown is how many of the latest deliveries of a webhook are listed.
+	WebhookDeliveriesShown = 100
+
+	webhookBatchSize = 100
+)
+
+// webhookBackoff is how long to wait before retrying after each failed attempt,
+// a delivery failing once more than that is given up.
+var webhookBackoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+// WebhookMaxAttempts is how many times a delivery is attempted before it's failed for good.
+var WebhookMaxAttempts = len(webhookBackoff) + 1
+
+var (
+	ErrInvalidWebhookURL = errors.New("invalid webhook URL, expected an http or https one")
+	ErrInvalidEventType  = errors.New("invalid event type")
+)
+
+// WebhookService posts the events of the bus to the webhooks subscribed to them. Deliveries
+// are queued in the database and retried with backoff until the receiver accepts them.
+type WebhookService interface {
+	ListWebhooks(ctx context.Context) ([]db.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*db.Webhook, error)
+	// CreateWebhook saves a new webhook, with a random secret when it has none.
+	CreateWebhook(ctx context.Context, w *db.Webhook) error
+	UpdateWebhook(ctx context.Context, w *db.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	// ListDeliveries returns the latest deliveries of a webhook with their attempts.
+	ListDeliveries(ctx context.Context, id string) ([]db.WebhookDelivery, error)
+
+	// Enqueue queues a delivery of the event for every webhook it concerns.
+	Enqueue(ctx context.Context, e events.Event) error
+	// DeliverPending attempts the deliveries which are due, and prunes old ones.
+	DeliverPending(ctx context.Context) error
+	// Run enqueues the events of the bus and delivers them, until ctx is done.
+	Run(ctx context.Context)
+}
+
+type webhookService struct {
+	repo               repository.WebhookRepository
+	feedService        FeedService
+	folderService      FolderService
+	savedSearchService SavedSearchService
+	bus                *events.Bus
+	client             *http.Client
+
+	// mu keeps deliveries from being attempted twice at once
+	mu sync.Mutex
+}
+
+func NewWebhookService(repo repository.WebhookRepository, feedService FeedService, folderService FolderService,
+	savedSearchService SavedSearchService, bus *events.Bus) WebhookService {
+	return &webhookService{
+		repo:               repo,
+		feedService:        feedService,
+		folderService:      folderService,
+		savedSearchService: savedSearchService,
+		bus:                bus,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *webhookService) ListWebhooks(ctx context.Context) ([]db.Webhook, error) {
+	return s.repo.ListWebhooks(ctx)
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, id string) (*db.Webhook, error) {
+	return s.repo.GetWebhook(ctx, id)
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, w *db.Webhook) error {
+	if err := s.validate(ctx, w); err != nil {
+		return err
+	}
+
+	if w.Secret == "" {
+		secret, err := newWebSubSecret()
+		if err != nil {
+			return err
+		}
+		w.Secret = secret
+	}
+	w.ID = text.RandomID()
+	w.CreatedAt = time.Now().UTC()
+	return s.repo.SaveWebhook(ctx, w)
+}
+
+// UpdateWebhook replaces a webhook, keeping its secret when none is given.
+func (s *webhookService) UpdateWebhook(ctx context.Context, w *db.Webhook) error {
+	existing, err := s.repo.GetWebhook(ctx, w.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.validate(ctx, w); err != nil {
+		return err
+	}
+
+	if w.Secret == "" {
+		w.Secret = existing.Secret
+	}
+	w.CreatedAt = existing.CreatedAt
+	return s.repo.SaveWebhook(ctx, w)
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, id string) error {
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, id string) ([]db.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, id, WebhookDeliveriesShown)
+}
+
+func (s *webhookService) validate(ctx context.Context, w *db.Webhook) error {
+	w.URL = strings.TrimSpace(w.URL)
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	if len(w.EventTypes) == 0 {
+		return fmt.Errorf("%w, expected at least one of %s", ErrInvalidEventType, strings.Join(events.Types, ", "))
+	}
+	for _, t := range w.EventTypes {
+		if !slices.Contains(events.Types, t) {
+			return fmt.Errorf("%w %q, expected one of %s", ErrInvalidEventType, t, strings.Join(events.Types, ", "))
+		}
+	}
+	slices.Sort(w.EventTypes)
+	w.EventTypes = slices.Compact(w.EventTypes)
+
+	if w.FeedID != "" {
+		if _, err := s.feedService.GetFeed(ctx, w.FeedID); err != nil {
+			return err
+		}
+	}
+	if w.FolderID != "" {
+		if _, err := s.folderService.GetFolder(ctx, w.FolderID); err != nil {
+			return err
+		}
+	}
+	if w.SavedSearchID != "" {
+		if _, err := s.savedSearchService.GetSavedSearch(ctx, w.SavedSearchID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *webhookService) Enqueue(ctx context.Context, e events.Event) error {
+	if e.Type == events.Resync {
+		return nil
+	}
+
+	hooks, err := s.repo.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	base := models.WebhookPayload{
+		ID:       e.ID,
+		Type:     e.Type,
+		Time:     e.Time,
+		FeedID:   e.FeedID,
+		FolderID: e.FolderID,
+		ItemIDs:  e.ItemIDs,
+		Count:    e.Count,
+	}
+	if e.FeedID != "" && e.Type != events.FeedRemoved {
+		if f, err := s.feedService.GetFeed(ctx, e.FeedID); err == nil {
+			base.Feed = webhookFeed(f)
+		}
+	}
+	// The new items, loaded once for all the webhooks without a saved search
+	var added []db.Item
+	loaded := false
+
+	now := time.Now().UTC()
+	var deliveries []db.WebhookDelivery
+	for _, hook := range hooks {
+		if !slices.Contains(hook.EventTypes, e.Type) {
+			continue
+		}
+
+		ok, err := s.concerns(ctx, &hook, e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		payload := base
+		switch {
+		case hook.SavedSearchID != "":
+			// Only events saying which items changed can be matched against a search
+			if len(e.ItemIDs) == 0 {
+				continue
+			}
+			items, err := s.searchItems(ctx, hook.SavedSearchID, e.ItemIDs)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				continue
+			}
+			payload.ItemIDs = make([]string, len(items))
+			for i, item := range items {
+				payload.ItemIDs[i] = item.ID
+			}
+			if e.Type == events.ItemsAdded {
+				payload.Items = models.NewWebhookItems(items)
+			}
+		case e.Type == events.ItemsAdded:
+			if !loaded {
+				res, err := s.feedService.SearchFeedItems(ctx, models.SearchParams{ItemIDs: e.ItemIDs, Sort: "desc", Limit: len(e.ItemIDs)})
+				if err != nil {
+					return err
+				}
+				added, loaded = res.Items, true
+			}
+			payload.Items = models.NewWebhookItems(added)
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, db.WebhookDelivery{
+			ID:            text.RandomID(),
+			WebhookID:     hook.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       string(body),
+			Status:        db.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	return s.repo.SaveDeliveries(ctx, deliveries)
+}
+
+// concerns returns whether the event is about the feed or folder a webhook is restricted to.
+// Webhooks whose feed or folder is gone only get the removal of the feed.
+func (s *webhookService) concerns(ctx context.Context, hook *db.Webhook, e events.Event) (bool, error) {
+	if hook.FeedID == "" && hook.FolderID == "" {
+		return true, nil
+	}
+	if e.Type == events.FeedRemoved && e.FeedID == hook.FeedID {
+		return true, nil
+	}
+
+	var feedIDs []string
+	if hook.FeedID != "" {
+		feedIDs = []string{hook.FeedID}
+	}
+	match, err := eventFilter(ctx, s.folderService, feedIDs, hook.FolderID)
+	if errors.Is(err, repository.ErrFeedNotFound) || errors.Is(err, repository.ErrFolderNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return match(e), nil
+}
+
+// searchItems returns which of the given items match a saved search.
+func (s *webhookService) searchItems(ctx context.Context, savedSearchID string, itemIDs []string) ([]db.Item, error) {
+	saved, err := s.savedSearchService.GetSavedSearch(ctx, savedSearchID)
+	if errors.Is(err, repository.ErrSavedSearchNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := searchParams(saved)
+	if err != nil {
+		return nil, err
+	}
+	params.ItemIDs = itemIDs
+	params.Limit = len(itemIDs)
+
+	res, err := s.feedService.SearchFeedItems(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return res.Items, nil
+}
+
+func webhookFeed(f *db.Feed) *models.WebhookFeed {
+	title := f.Title
+	if f.Name != "" {
+		title = f.Name
+	}
+	return &models.WebhookFeed{
+		ID:      f.ID,
+		Title:   title,
+		URL:     f.URL,
+		SiteURL: f.SiteURL,
+	}
+}
+
+func (s *webhookService) DeliverPending(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := make(map[string]*db.Webhook)
+	for {
+		due, err := s.repo.ListDueDeliveries(ctx, time.Now().UTC(), webhookBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range due {
+			hook, ok := hooks[due[i].WebhookID]
+			if !ok {
+				hook, err = s.repo.GetWebhook(ctx, due[i].WebhookID)
+				// Rule actions may have queued deliveries for a webhook deleted since
+				if errors.Is(err, repository.ErrWebhookNotFound) {
+					due[i].Status = db.WebhookDeliveryFailed
+					if err := s.repo.RecordAttempt(ctx, &due[i], &db.WebhookAttempt{Error: err.Error(), CreatedAt: time.Now().UTC()}); err != nil {
+						return err
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				hooks[hook.ID] = hook
+			}
+			if err := s.deliver(ctx, hook, &due[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(due) < webhookBatchSize {
+			break
+		}
+	}
+
+	_, err := s.repo.PruneDeliveries(ctx, time.Now().UTC().Add(-WebhookDeliveryRetention))
+	return err
+}
+
+// deliver attempts a delivery, and schedules the next attempt when it fails.
+func (s *webhookService) deliver(ctx context.Context, hook *db.Webhook, delivery *db.WebhookDelivery) error {
+	start := time.Now()
+	status, err := s.post(ctx, hook, delivery)
+	// Shutting down isn't the receiver's failure
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	attempt := &db.WebhookAttempt{
+		StatusCode: status,
+		Duration:   time.Since(start),
+		CreatedAt:  time.Now().UTC(),
+	}
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		delivery.Status = db.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &attempt.CreatedAt
+	case delivery.Attempts >= WebhookMaxAttempts:
+		attempt.Error = err.Error()
+		delivery.Status = db.WebhookDeliveryFailed
+	default:
+		attempt.Error = err.Error()
+		delivery.NextAttemptAt = attempt.CreatedAt.Add(webhookBackoff[delivery.Attempts-1])
+	}
+
+	return s.repo.RecordAttempt(ctx, delivery, attempt)
+}
+
+// post sends a delivery signed with the secret of its webhook, it's delivered when the receiver
+// answers with a 2xx status code.
+func (s *webhookService) post(ctx context.Context, hook *db.Webhook, delivery *db.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-LLRSS-Event", delivery.EventType)
+	req.Header.Set("X-LLRSS-Delivery", delivery.ID)
+	req.Header.Set("X-LLRSS-Signature", WebhookSignature(hook.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// WebhookSignature returns the X-LLRSS-Signature of a payload, "sha256=<hex hmac of body>".
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookService) Run(ctx context.Context) {
+	sub, _ := s.bus.Subscribe(0, nil)
+	defer func() { s.bus.Unsubscribe(sub) }()
+
+	wake := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(WebhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("webhook deliveries failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+
+	var lastID int64
+	enqueue := func(e events.Event) {
+		lastID = max(lastID, e.ID)
+		if err := s.Enqueue(ctx, e); err != nil {
+			log.Printf("webhook enqueue of event %d failed: %v", e.ID, err)
+			return
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if ok {
+				enqueue(e)
+				continue
+			}
+
+			// Dropped for lagging behind, catch up from the last event
+			var missed []events.Event
+			sub, missed = s.bus.Subscribe(lastID, nil)
+			for _, e := range missed {
+				enqueue(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"llrss/internal/models"
+	"llrss/internal/models/db"
+	"llrss/internal/repository"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// WebSubLeaseSeconds is the lease we ask hubs for, they are free to grant a different one.
+	WebSubLeaseSeconds = 10 * 24 * 60 * 60
+	// WebSubRenewBefore is how long before the lease expiry a subscription gets renewed at most.
+	WebSubRenewBefore = 24 * time.Hour
+	// WebSubRetryAfter is how long to wait before retrying a pending or denied subscription.
+	WebSubRetryAfter = time.Hour
+)
+
+var (
+	// ErrInvalidSignature is returned when pushed content doesn't match its X-Hub-Signature.
+	ErrInvalidSignature = errors.New("invalid websub signature")
+	// ErrInvalidIntent is returned when a hub verifies an intent we don't have.
+	ErrInvalidIntent = errors.New("invalid websub intent")
+)
+
+// WebSubService implements a WebSub (PubSubHubbub) subscriber for feeds advertising a hub.
+type WebSubService interface {
+	Subscribe(ctx context.Context, feed *db.Feed) error
+	VerifyIntent(ctx context.Context, feedID string, v models.WebSubVerification) (string, error)
+	Distribute(ctx context.Context, feedID string, body []byte, signature string) error
+	SyncSubscriptions(ctx context.Context) error
+}
+
+type webSubService struct {
+	feedRepo    repository.FeedRepository
+	repo        repository.WebSubRepository
+	client      *http.Client
+	callbackURL string
+}
+
+// NewWebSubService creates a subscriber whose callbacks are served under baseURL + "/websub/{feedID}".
+func NewWebSubService(feedRepo repository.FeedRepository, repo repository.WebSubRepository, baseURL string) WebSubService {
+	return &webSubService{
+		feedRepo:    feedRepo,
+		repo:        repo,
+		callbackURL: strings.TrimRight(baseURL, "/") + "/websub/",
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Subscribe sends a subscription request for the feed to its hub.
+// The subscription stays pending until the hub verifies the intent.
+func (s *webSubService) Subscribe(ctx context.Context, feed *db.Feed) error {
+	if feed.HubURL == "" {
+		return fmt.Errorf("feed %s doesn't advertise a hub", feed.ID)
+	}
+
+	sub, err := s.repo.GetSubscription(ctx, feed.ID)
+	if err != nil && !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		return err
+	}
+	if sub == nil {
+		sub = &db.WebSubSubscription{FeedID: feed.ID}
+	}
+
+	// Keep the secret on renewals, content signed with it may still be in flight.
+	if sub.Secret == "" {
+		sub.Secret, err = newWebSubSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	sub.HubURL = feed.HubURL
+	sub.TopicURL = topicURL(feed)
+	if sub.State != db.WebSubStateActive {
+		sub.State = db.WebSubStatePending
+	}
+
+	// Save before asking, some hubs verify the intent before answering the request.
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return fmt.Errorf("save subscription: %w", err)
+	}
+
+	form := url.Values{
+		"hub.callback":      {s.callbackURL + feed.ID},
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicURL},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(WebSubLeaseSeconds)},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.HubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code from hub: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// VerifyIntent handles the hub's verification request and returns the challenge to echo back.
+func (s *webSubService) VerifyIntent(ctx context.Context, feedID string, v models.WebSubVerification) (string, error) {
+	sub, err := s.repo.GetSubscription(ctx, feedID)
+	if err != nil {
+		return "", err
+	}
+
+	if v.Topic != sub.TopicURL {
+		return "", ErrInvalidIntent
+	}
+
+	switch v.Mode {
+	case "subscribe":
+		if v.Challenge == "" {
+			return "", ErrInvalidIntent
+		}
+		lease := v.LeaseSeconds
+		if lease <= 0 {
+			lease = WebSubLeaseSeconds
+		}
+		sub.State = db.WebSubStateActive
+		sub.LeaseSeconds = lease
+		sub.ExpiresAt = time.Now().Add(time.Duration(lease) * time.Second)
+	case "denied":
+		fmt.Printf("websub subscription for feed %s denied: %s\n", feedID, v.Reason)
+		sub.State = db.WebSubStateDenied
+		sub.ExpiresAt = time.Time{}
+	default:
+		// We never unsubscribe, leases are left to expire.
+		return "", ErrInvalidIntent
+	}
+
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return "", fmt.Errorf("save subscription: %w", err)
+	}
+
+	return v.Challenge, nil
+}
+
+// Distribute ingests content pushed by the hub, going through the same path as a refresh.
+func (s *webSubService) Distribute(ctx context.Context, feedID string, body []byte, signature string) error {
+	sub, err := s.repo.GetSubscription(ctx, feedID)
+	if err != nil {
+		return err
+	}
+
+	if !validSignature(sub.Secret, body, signature) {
+		return ErrInvalidSignature
+	}
+
+	f, err := s.feedRepo.GetFeed(ctx, feedID)
+	if err != nil {
+		return err
+	}
+
+	feed, err := parseFeed(f.URL, body)
+	if err != nil {
+		return err
+	}
+
+	f.LastFetch = time.Now()
+	f.Title = feed.Title
+	f.Description = feed.Description
+	f.SiteURL = feed.SiteURL
+	f.Items = nil
+
+	if err := s.feedRepo.UpdateFeed(ctx, f); err != nil {
+		return fmt.Errorf("update feed: %w", err)
+	}
+
+	_, err = s.feedRepo.SaveFeedItems(ctx, f.ID, feed.Items)
+	return err
+}
+
+// SyncSubscriptions subscribes feeds advertising a hub and renews leases about to expire.
+func (s *webSubService) SyncSubscriptions(ctx context.Context) error {
+	feeds, err := s.feedRepo.ListFeeds(ctx)
+	if err != nil {
+		return err
+	}
+
+	subs, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	byFeed := make(map[string]db.WebSubSubscription, len(subs))
+	for _, sub := range subs {
+		byFeed[sub.FeedID] = sub
+	}
+
+	now := time.Now()
+	for _, f := range feeds {
+		if f.HubURL == "" {
+			continue
+		}
+
+		sub, ok := byFeed[f.ID]
+		if ok && !needsSubscribe(&sub, &f, now) {
+			continue
+		}
+
+		if err := s.Subscribe(ctx, &f); err != nil {
+			fmt.Printf("websub subscribe for feed %s: %v\n", f.URL, err)
+		}
+	}
+
+	return nil
+}
+
+func needsSubscribe(sub *db.WebSubSubscription, f *db.Feed, now time.Time) bool {
+	if sub.HubURL != f.HubURL || sub.TopicURL != topicURL(f) {
+		return true
+	}
+
+	switch sub.State {
+	case db.WebSubStateActive:
+		// Short leases are renewed halfway through
+		renewBefore := WebSubRenewBefore
+		if lease := time.Duration(sub.LeaseSeconds) * time.Second; lease/2 < renewBefore {
+			renewBefore = lease / 2
+		}
+		return sub.ExpiresAt.Add(-renewBefore).Before(now)
+	default:
+		return sub.UpdatedAt.Add(WebSubRetryAfter).Before(now)
+	}
+}
+
+func topicURL(f *db.Feed) string {
+	if f.SelfURL != "" {
+		return f.SelfURL
+	}
+	return f.URL
+}
+
+func newWebSubSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validSignature checks an X-Hub-Signature header value, e.g. "sha256=<hex hmac of body>".
+func validSignature(secret string, body []byte, signature string) bool {
+	method, sig, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+
+	var h func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,323 @@
+// Package smtpd receives mail over SMTP, or LMTP for sessions started with LHLO. It only
+// accepts mail for the recipients its handler knows of, and doesn't relay nor authenticate:
+// it's meant to listen locally or behind a mail server.
+package smtpd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the size of the largest message accepted by default.
+	DefaultMaxSize = 10 << 20
+	// MaxRecipients is how many recipients a message can have.
+	MaxRecipients = 100
+
+	// timeout is how long a client can stay silent before being disconnected.
+	timeout = 5 * time.Minute
+)
+
+var (
+	// ErrRejected is wrapped by the delivery errors which won't go away when retrying, like
+	// malformed messages, they're reported as permanent failures to the sender.
+	ErrRejected = errors.New("message rejected")
+	// ErrUnknownRecipient is wrapped by the errors of Accept for recipients mail is never
+	// accepted for, the other errors are reported as temporary failures.
+	ErrUnknownRecipient = errors.New("unknown recipient")
+)
+
+// Handler decides which recipients mail is accepted for, and receives the messages.
+type Handler interface {
+	// Accept returns an error for the recipients mail isn't accepted for, wrapping
+	// ErrUnknownRecipient unless it may be accepted later.
+	Accept(ctx context.Context, rcpt string) error
+	// Deliver receives a message sent to an accepted recipient.
+	Deliver(ctx context.Context, rcpt string, msg []byte) error
+}
+
+type Server struct {
+	// Hostname is the name the server greets clients with.
+	Hostname string
+	Handler  Handler
+	// MaxSize is the size of the largest message accepted, DefaultMaxSize when 0.
+	MaxSize int64
+}
+
+// ListenAndServe listens on addr, a TCP address or a unix socket as unix:/path, and serves
+// the clients until ctx is done.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+		// The socket of a previous run is left behind
+		_ = os.Remove(path)
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves the clients of ln until ctx is done, ln is then closed.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+// session is the state of a client connection.
+type session struct {
+	s    *Server
+	text *textproto.Conn
+	// lmtp is set by LHLO, messages then get a reply per recipient.
+	lmtp    bool
+	greeted bool
+	// from is set by MAIL, which starts a transaction.
+	from  *string
+	rcpts []string
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sess := &session{s: s, text: textproto.NewConn(conn)}
+	sess.reply(220, s.Hostname+" llrss ready")
+
+	for {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess.greeted, sess.lmtp = true, false
+			sess.reset()
+			sess.reply(250, s.Hostname)
+		case "EHLO", "LHLO":
+			sess.greeted, sess.lmtp = true, strings.EqualFold(verb, "LHLO")
+			sess.reset()
+			sess.reply(250, s.Hostname, "PIPELINING", "8BITMIME", "SIZE "+strconv.FormatInt(s.maxSize(), 10))
+		case "MAIL":
+			sess.mail(arg)
+		case "RCPT":
+			sess.rcpt(ctx, arg)
+		case "DATA":
+			if err := sess.data(ctx); err != nil {
+				return
+			}
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "VRFY":
+			sess.reply(252, "Cannot verify users")
+		case "QUIT":
+			sess.reply(221, "Bye")
+			return
+		default:
+			sess.reply(500, "Unknown command")
+		}
+	}
+}
+
+func (s *Server) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+func (sess *session) mail(arg string) {
+	if !sess.greeted {
+		sess.reply(503, "Say hello first")
+		return
+	}
+	if sess.from != nil {
+		sess.reply(503, "Nested MAIL command")
+		return
+	}
+
+	from, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		sess.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, "=")
+		if strings.EqualFold(k, "SIZE") {
+			if size, err := strconv.ParseInt(v, 10, 64); err == nil && size > sess.s.maxSize() {
+				sess.reply(552, "Message too big")
+				return
+			}
+		}
+	}
+
+	sess.from = &from
+	sess.reply(250, "OK")
+}
+
+func (sess *session) rcpt(ctx context.Context, arg string) {
+	if sess.from == nil {
+		sess.reply(503, "Need MAIL before RCPT")
+		return
+	}
+
+	rcpt, _, ok := parsePath(arg, "TO:")
+	if !ok || rcpt == "" {
+		sess.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(sess.rcpts) >= MaxRecipients {
+		sess.reply(452, "Too many recipients")
+		return
+	}
+	err := sess.s.Handler.Accept(ctx, rcpt)
+	switch {
+	case errors.Is(err, ErrUnknownRecipient):
+		sess.reply(550, "No such recipient: "+err.Error())
+		return
+	case err != nil:
+		log.Printf("accepting %s failed: %v", rcpt, err)
+		sess.reply(451, "Recipient can't be checked, try again later")
+		return
+	}
+
+	sess.rcpts = append(sess.rcpts, rcpt)
+	sess.reply(250, "OK")
+}
+
+// data receives a message and delivers it, the error is only for the connection failing.
+func (sess *session) data(ctx context.Context) error {
+	if len(sess.rcpts) == 0 {
+		sess.reply(503, "Need RCPT before DATA")
+		return nil
+	}
+	defer sess.reset()
+
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+	r := sess.text.DotReader()
+	msg, err := io.ReadAll(io.LimitReader(r, sess.s.maxSize()+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(msg)) > sess.s.maxSize() {
+		// Read the rest to answer after it
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		sess.replyAll(552, "Message too big")
+		return nil
+	}
+
+	var delivered int
+	var last error
+	for _, rcpt := range sess.rcpts {
+		err := sess.s.Handler.Deliver(ctx, rcpt, msg)
+		if err != nil {
+			log.Printf("delivery to %s failed: %v", rcpt, err)
+			last = err
+		} else {
+			delivered++
+		}
+		if sess.lmtp {
+			sess.replyDelivery(rcpt, err)
+		}
+	}
+
+	// SMTP has one reply for every recipient, which only fails when they all do
+	if !sess.lmtp {
+		if delivered > 0 {
+			last = nil
+		}
+		sess.replyDelivery("", last)
+	}
+	return nil
+}
+
+func (sess *session) replyDelivery(rcpt string, err error) {
+	switch {
+	case err == nil:
+		sess.reply(250, strings.TrimSpace("OK "+rcpt))
+	case errors.Is(err, ErrRejected):
+		sess.reply(554, err.Error())
+	default:
+		sess.reply(451, "Delivery failed, try again later")
+	}
+}
+
+// replyAll replies once, or once per recipient in LMTP sessions.
+func (sess *session) replyAll(code int, msg string) {
+	n := 1
+	if sess.lmtp {
+		n = len(sess.rcpts)
+	}
+	for i := 0; i < n; i++ {
+		sess.reply(code, msg)
+	}
+}
+
+func (sess *session) reset() {
+	sess.from = nil
+	sess.rcpts = nil
+}
+
+// reply writes a reply, with a line per message.
+func (sess *session) reply(code int, msgs ...string) {
+	for i, msg := range msgs {
+		sep := " "
+		if i < len(msgs)-1 {
+			sep = "-"
+		}
+		if err := sess.text.PrintfLine("%d%s%s", code, sep, msg); err != nil {
+			return
+		}
+	}
+}
+
+// parsePath parses the argument of MAIL and RCPT, like "FROM:<a@example.com> SIZE=1024",
+// into the address and its parameters.
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	return arg[1:end], strings.Fields(arg[end+1:]), true
+}
@@ -0,0 +1,121 @@
+package smtpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type handler struct {
+	mu        sync.Mutex
+	delivered map[string][]string
+}
+
+func (h *handler) Accept(_ context.Context, rcpt string) error {
+	switch {
+	case rcpt == "unavailable@example.com":
+		return errors.New("database is down")
+	case !strings.HasSuffix(rcpt, "@example.com"):
+		return fmt.Errorf("%w: unknown domain", ErrUnknownRecipient)
+	}
+	return nil
+}
+
+func (h *handler) Deliver(_ context.Context, rcpt string, msg []byte) error {
+	switch rcpt {
+	case "broken@example.com":
+		return fmt.Errorf("%w: malformed", ErrRejected)
+	case "down@example.com":
+		return errors.New("database is down")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delivered[rcpt] = append(h.delivered[rcpt], string(msg))
+	return nil
+}
+
+func serve(t *testing.T, maxSize int64) (string, *handler) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h := &handler{delivered: make(map[string][]string)}
+	s := &Server{Hostname: "mx.example.com", Handler: h, MaxSize: maxSize}
+	go s.Serve(ctx, ln)
+	return ln.Addr().String(), h
+}
+
+const message = "From: Go Weekly <news@golangweekly.com>\r\nSubject: Issue 500\r\n\r\nHello,\r\n.. a line starting with a dot\r\n"
+
+func TestSMTP(t *testing.T) {
+	addr, h := serve(t, 0)
+
+	err := smtp.SendMail(addr, nil, "news@golangweekly.com", []string{"go@example.com", "down@example.com"}, []byte(message))
+	require.NoError(t, err, "the message is accepted when one recipient gets it")
+	assert.Equal(t, []string{strings.ReplaceAll(message, "\r\n", "\n")}, h.delivered["go@example.com"], "the message is received as sent")
+
+	err = smtp.SendMail(addr, nil, "news@golangweekly.com", []string{"go@elsewhere.com"}, []byte(message))
+	assert.ErrorContains(t, err, "550")
+
+	err = smtp.SendMail(addr, nil, "news@golangweekly.com", []string{"broken@example.com"}, []byte(message))
+	assert.ErrorContains(t, err, "554")
+}
+
+func TestLMTP(t *testing.T) {
+	addr, h := serve(t, 64)
+
+	conn, err := textproto.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	expect := func(code int) string {
+		t.Helper()
+		_, msg, err := conn.ReadResponse(code)
+		require.NoError(t, err)
+		return msg
+	}
+	cmd := func(code int, format string, args ...any) string {
+		t.Helper()
+		require.NoError(t, conn.PrintfLine(format, args...))
+		return expect(code)
+	}
+
+	expect(220)
+	assert.Contains(t, cmd(250, "LHLO client"), "SIZE 64")
+	cmd(250, "MAIL FROM:<news@golangweekly.com>")
+	cmd(250, "RCPT TO:<go@example.com>")
+	cmd(550, "RCPT TO:<go@elsewhere.com>")
+	cmd(451, "RCPT TO:<unavailable@example.com>")
+	cmd(250, "RCPT TO:<down@example.com>")
+	cmd(250, "RCPT TO:<broken@example.com>")
+	cmd(354, "DATA")
+
+	// A reply per accepted recipient
+	cmd(250, "Subject: Hi\r\n\r\nHello\r\n.")
+	expect(451)
+	expect(554)
+	assert.Len(t, h.delivered["go@example.com"], 1)
+
+	cmd(503, "DATA")
+	cmd(552, "MAIL FROM:<news@golangweekly.com> SIZE=1000")
+	cmd(250, "MAIL FROM:<news@golangweekly.com>")
+	cmd(250, "RCPT TO:<go@example.com>")
+	cmd(354, "DATA")
+	cmd(552, "%s\r\n.", strings.Repeat("too big ", 10))
+	assert.Len(t, h.delivered["go@example.com"], 1)
+
+	cmd(221, "QUIT")
+}
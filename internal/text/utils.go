@@ -2,6 +2,7 @@ package text
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -137,3 +138,12 @@ func stripHTML(input string) string {
 
 	return buffer.String()
 }
+
+// RandomID returns a random hex ID, for entities which can't be identified by URL.
+func RandomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}